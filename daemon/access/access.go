@@ -0,0 +1,227 @@
+package access
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/eduardo-escoto/gpu_request/daemon/monitor"
+	_ "github.com/go-sql-driver/mysql"
+)
+
+// restrictedMode leaves device access to root, the owning group and ACL entries.
+// The group bits double as the ACL mask, so they must stay read/write.
+const restrictedMode os.FileMode = 0660
+
+var deviceNamePattern = regexp.MustCompile(`^nvidia([0-9]+)$`)
+
+// Enforcer limits each /dev/nvidiaN to the users holding an active reservation on that GPU
+type Enforcer struct {
+	DevDir        string    // Directory holding the device nodes, normally /dev
+	ACL           DeviceACL // ACL backend used to grant and revoke access
+	AlwaysAllowed []string  // Users that keep access to every GPU (e.g., admins)
+	Verbose       bool
+
+	// MinorNumbers maps each GPU UUID to the N of its /dev/nvidiaN, which need not match
+	// the nvidia-smi index; nil uses NvidiaMinorNumbers
+	MinorNumbers func() (map[string]int, error)
+}
+
+// NvidiaMinorNumbers asks nvidia-smi for the device minor number of every GPU by UUID
+func NvidiaMinorNumbers() (map[string]int, error) {
+	out, err := exec.Command("nvidia-smi", "--query-gpu=uuid,minor_number", "--format=csv,noheader,nounits").Output()
+	if err != nil {
+		return nil, fmt.Errorf("failed to execute nvidia-smi: %v", err)
+	}
+	return parseMinorNumbers(string(out))
+}
+
+// parseMinorNumbers reads "<uuid>, <minor>" lines
+func parseMinorNumbers(output string) (map[string]int, error) {
+	minors := make(map[string]int)
+	for _, line := range strings.Split(output, "\n") {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		uuid, minor, ok := strings.Cut(line, ",")
+		number, err := strconv.Atoi(strings.TrimSpace(minor))
+		if !ok || err != nil {
+			return nil, fmt.Errorf("unexpected nvidia-smi output %q", line)
+		}
+		minors[strings.TrimSpace(uuid)] = number
+	}
+	return minors, nil
+}
+
+// Reconcile brings the device ACLs in line with the desired users per GPU UUID. Device
+// nodes of GPUs missing from desired, or whose UUID is unknown, end up with no reserved
+// users at all.
+func (e *Enforcer) Reconcile(desired map[string][]string) error {
+	minorNumbers := e.MinorNumbers
+	if minorNumbers == nil {
+		minorNumbers = NvidiaMinorNumbers
+	}
+	minors, err := minorNumbers()
+	if err != nil {
+		return err
+	}
+	uuids := make(map[int]string)
+	for uuid, minor := range minors {
+		uuids[minor] = uuid
+	}
+
+	entries, err := os.ReadDir(e.DevDir)
+	if err != nil {
+		return fmt.Errorf("failed to read device directory %s: %v", e.DevDir, err)
+	}
+
+	for _, entry := range entries {
+		match := deviceNamePattern.FindStringSubmatch(entry.Name())
+		if match == nil {
+			continue
+		}
+		minor, _ := strconv.Atoi(match[1])
+		path := filepath.Join(e.DevDir, entry.Name())
+
+		var allowed []string
+		if uuid, ok := uuids[minor]; ok {
+			allowed = slices.Clone(desired[uuid])
+		}
+		if err := e.reconcileDevice(path, append(allowed, e.AlwaysAllowed...)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// reconcileDevice restricts a single device node and syncs its named-user ACL entries
+func (e *Enforcer) reconcileDevice(path string, allowed []string) error {
+	info, err := os.Stat(path)
+	if err != nil {
+		return fmt.Errorf("failed to stat %s: %v", path, err)
+	}
+	if info.Mode().Perm() != restrictedMode {
+		if err := os.Chmod(path, restrictedMode); err != nil {
+			return fmt.Errorf("failed to restrict %s: %v", path, err)
+		}
+		if e.Verbose {
+			log.Printf("Restricted %s to mode %o", path, restrictedMode)
+		}
+	}
+
+	current, err := e.ACL.Users(path)
+	if err != nil {
+		return err
+	}
+
+	for _, user := range allowed {
+		if slices.Contains(current, user) {
+			continue
+		}
+		if err := e.ACL.Grant(path, user); err != nil {
+			return err
+		}
+		log.Printf("Granted %s access to %s", user, path)
+		current = append(current, user)
+	}
+
+	for _, user := range current {
+		if slices.Contains(allowed, user) {
+			continue
+		}
+		if err := e.ACL.Revoke(path, user); err != nil {
+			return err
+		}
+		log.Printf("Revoked %s access to %s", user, path)
+	}
+
+	return nil
+}
+
+// StartAccessEnforcer periodically applies the active GPU assignments of this node to its device nodes
+func StartAccessEnforcer(dsn string, enforcer *Enforcer, interval time.Duration) error {
+	// Connect to the database
+	db, err := sql.Open("mysql", dsn)
+	if err != nil {
+		log.Printf("Error connecting to database: %v", err)
+		return err
+	}
+	defer db.Close()
+
+	// Test the connection
+	err = db.Ping()
+	if err != nil {
+		log.Printf("Error pinging database: %v", err)
+		return err
+	}
+
+	// Get the server name
+	serverName, err := monitor.GetServerName()
+	if err != nil {
+		log.Printf("Error getting server name: %v", err)
+		return err
+	}
+
+	// Daemon loop
+	for {
+		desired, err := fetchActiveAssignments(db, serverName)
+		if err != nil {
+			// Keep the current ACLs rather than locking everyone out on a database hiccup
+			log.Printf("Error fetching active assignments: %v", err)
+			time.Sleep(interval)
+			continue
+		}
+
+		if enforcer.Verbose {
+			log.Printf("Active GPU assignments on %s: %v", serverName, desired)
+		}
+
+		if err := enforcer.Reconcile(desired); err != nil {
+			log.Printf("Error enforcing GPU access: %v", err)
+		}
+
+		time.Sleep(interval)
+	}
+}
+
+// fetchActiveAssignments maps each GPU UUID on the node to the users of the in-progress requests assigned to it
+func fetchActiveAssignments(db *sql.DB, serverName string) (map[string][]string, error) {
+	rows, err := db.Query(`
+		SELECT g.gpu_uuid, u.user_name
+		FROM gpu_scheduler.request_gpu_assignments a
+		JOIN gpu_scheduler.requests r ON r.id = a.request_id
+		JOIN gpu_scheduler.gpus g ON g.gpu_uuid = a.gpu_uuid
+		JOIN gpu_scheduler.users u ON u.id = r.user_id
+		WHERE g.server_name = ?
+			AND r.status = 'in_progress'
+			AND (r.start_time IS NULL OR r.start_time <= NOW())
+			AND (r.end_time IS NULL OR r.end_time > NOW())`,
+		serverName,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	desired := make(map[string][]string)
+	for rows.Next() {
+		var gpuUUID string
+		var userName string
+		if err := rows.Scan(&gpuUUID, &userName); err != nil {
+			return nil, err
+		}
+		if !slices.Contains(desired[gpuUUID], userName) {
+			desired[gpuUUID] = append(desired[gpuUUID], userName)
+		}
+	}
+	return desired, rows.Err()
+}
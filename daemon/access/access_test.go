@@ -0,0 +1,134 @@
+package access
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+// fakeACL records named-user entries per path instead of running setfacl
+type fakeACL struct {
+	entries map[string][]string
+}
+
+func (f *fakeACL) Users(path string) ([]string, error) {
+	return slices.Clone(f.entries[filepath.Base(path)]), nil
+}
+
+func (f *fakeACL) Grant(path, user string) error {
+	f.entries[filepath.Base(path)] = append(f.entries[filepath.Base(path)], user)
+	return nil
+}
+
+func (f *fakeACL) Revoke(path, user string) error {
+	name := filepath.Base(path)
+	f.entries[name] = slices.DeleteFunc(f.entries[name], func(u string) bool { return u == user })
+	return nil
+}
+
+func TestReconcile(t *testing.T) {
+	// GPU-B is enumerated first by nvidia-smi but sits on /dev/nvidia1
+	minors := map[string]int{"GPU-A": 0, "GPU-B": 1, "GPU-C": 2}
+
+	tests := []struct {
+		name    string
+		initial map[string][]string // ACL entries before reconciling, by device name
+		desired map[string][]string // Reserved users by GPU UUID
+		always  []string
+		want    map[string][]string
+	}{
+		{
+			name:    "grants reserved users",
+			desired: map[string][]string{"GPU-A": {"alice"}, "GPU-B": {"bob", "carol"}},
+			want:    map[string][]string{"nvidia0": {"alice"}, "nvidia1": {"bob", "carol"}, "nvidia2": nil},
+		},
+		{
+			name:    "revokes users without a reservation",
+			initial: map[string][]string{"nvidia0": {"alice", "mallory"}, "nvidia2": {"mallory"}},
+			desired: map[string][]string{"GPU-A": {"alice"}},
+			want:    map[string][]string{"nvidia0": {"alice"}, "nvidia1": nil, "nvidia2": nil},
+		},
+		{
+			name:    "keeps always-allowed users everywhere",
+			initial: map[string][]string{"nvidia1": {"admin"}},
+			desired: map[string][]string{"GPU-C": {"dave"}},
+			always:  []string{"admin"},
+			want:    map[string][]string{"nvidia0": {"admin"}, "nvidia1": {"admin"}, "nvidia2": {"dave", "admin"}},
+		},
+		{
+			name:    "unknown UUIDs grant nothing",
+			desired: map[string][]string{"GPU-X": {"erin"}},
+			want:    map[string][]string{"nvidia0": nil, "nvidia1": nil, "nvidia2": nil},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			devDir := t.TempDir()
+			for _, name := range []string{"nvidia0", "nvidia1", "nvidia2", "nvidiactl", "nvidia-uvm"} {
+				if err := os.WriteFile(filepath.Join(devDir, name), nil, 0666); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			acl := &fakeACL{entries: make(map[string][]string)}
+			for name, users := range tt.initial {
+				acl.entries[name] = slices.Clone(users)
+			}
+			enforcer := &Enforcer{
+				DevDir:        devDir,
+				ACL:           acl,
+				AlwaysAllowed: tt.always,
+				MinorNumbers:  func() (map[string]int, error) { return minors, nil },
+			}
+
+			if err := enforcer.Reconcile(tt.desired); err != nil {
+				t.Fatalf("Reconcile: %v", err)
+			}
+
+			for name, want := range tt.want {
+				got := acl.entries[name]
+				slices.Sort(got)
+				want = slices.Sorted(slices.Values(want))
+				if !slices.Equal(got, want) {
+					t.Errorf("%s: users %v, want %v", name, got, want)
+				}
+
+				info, err := os.Stat(filepath.Join(devDir, name))
+				if err != nil {
+					t.Fatal(err)
+				}
+				if info.Mode().Perm() != restrictedMode {
+					t.Errorf("%s: mode %o, want %o", name, info.Mode().Perm(), restrictedMode)
+				}
+			}
+			for _, name := range []string{"nvidiactl", "nvidia-uvm"} {
+				if len(acl.entries[name]) > 0 {
+					t.Errorf("%s is not a GPU device node but got users %v", name, acl.entries[name])
+				}
+			}
+		})
+	}
+}
+
+func TestParseMinorNumbers(t *testing.T) {
+	got, err := parseMinorNumbers("GPU-aaaa, 1\nGPU-bbbb, 0\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 2 || got["GPU-aaaa"] != 1 || got["GPU-bbbb"] != 0 {
+		t.Errorf("got %v", got)
+	}
+
+	if _, err := parseMinorNumbers("GPU-aaaa, [N/A]\n"); err == nil {
+		t.Error("expected an error for a missing minor number")
+	}
+}
+
+func TestParseACLUsers(t *testing.T) {
+	output := "user::rw-\nuser:alice:rw-\nuser:bob:rw-\t#effective:rw-\ngroup::rw-\nmask::rw-\nother::---\n"
+	if got := parseACLUsers(output); !slices.Equal(got, []string{"alice", "bob"}) {
+		t.Errorf("got %v", got)
+	}
+}
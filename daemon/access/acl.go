@@ -0,0 +1,65 @@
+package access
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+// DeviceACL reads and edits the named-user entries of a device node's access control list
+type DeviceACL interface {
+	Users(path string) ([]string, error) // Users with a named ACL entry on the path
+	Grant(path, user string) error       // Give the user read/write access
+	Revoke(path, user string) error      // Remove the user's entry
+}
+
+// SetfaclACL manages POSIX ACLs with the getfacl/setfacl tools. It works on any
+// filesystem with ACL support, so a plain temporary directory can stand in for /dev.
+type SetfaclACL struct{}
+
+// Users lists the users with a named entry in the ACL of path
+func (SetfaclACL) Users(path string) ([]string, error) {
+	cmd := exec.Command("getfacl", "--omit-header", "--absolute-names", path)
+
+	var out bytes.Buffer
+	cmd.Stdout = &out
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("failed to execute getfacl for %s: %v", path, err)
+	}
+
+	return parseACLUsers(out.String()), nil
+}
+
+// Grant gives user read/write access to path
+func (SetfaclACL) Grant(path, user string) error {
+	output, err := exec.Command("setfacl", "-m", "u:"+user+":rw", path).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("failed to grant %s access to %s: %v (%s)", user, path, err, strings.TrimSpace(string(output)))
+	}
+	return nil
+}
+
+// Revoke removes the ACL entry of user from path
+func (SetfaclACL) Revoke(path, user string) error {
+	output, err := exec.Command("setfacl", "-x", "u:"+user, path).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("failed to revoke %s access to %s: %v (%s)", user, path, err, strings.TrimSpace(string(output)))
+	}
+	return nil
+}
+
+// parseACLUsers extracts named users from getfacl output, e.g. "user:alice:rw-  #effective:rw-"
+func parseACLUsers(output string) []string {
+	var users []string
+	scanner := bufio.NewScanner(strings.NewReader(output))
+	for scanner.Scan() {
+		fields := strings.Split(strings.TrimSpace(scanner.Text()), ":")
+		if len(fields) < 3 || fields[0] != "user" || fields[1] == "" {
+			continue
+		}
+		users = append(users, fields[1])
+	}
+	return users
+}
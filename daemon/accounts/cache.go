@@ -0,0 +1,89 @@
+package accounts
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// validUserName guards cache paths against names sshd should never pass anyway
+var validUserName = regexp.MustCompile(`^[a-z_][a-z0-9_.-]*\$?$`)
+
+// KeyCache keeps the last known authorized keys of each user on local disk, so logins
+// keep working while the database is unreachable
+type KeyCache struct {
+	Dir    string        // One file per user
+	MaxAge time.Duration // Entries older than this are ignored; zero means no limit
+}
+
+func (c *KeyCache) path(userName string) (string, error) {
+	if !validUserName.MatchString(userName) {
+		return "", fmt.Errorf("invalid user name %q", userName)
+	}
+	return filepath.Join(c.Dir, userName), nil
+}
+
+// Store records the keys of an authorized user
+func (c *KeyCache) Store(userName string, keys []string) error {
+	path, err := c.path(userName)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(c.Dir, 0700); err != nil {
+		return fmt.Errorf("failed to create cache directory %s: %v", c.Dir, err)
+	}
+
+	tmpPath := path + ".tmp"
+	if err := os.WriteFile(tmpPath, []byte(strings.Join(keys, "\n")+"\n"), 0600); err != nil {
+		return fmt.Errorf("failed to write key cache for %s: %v", userName, err)
+	}
+	return os.Rename(tmpPath, path)
+}
+
+// Forget drops a user from the cache, e.g. once their access was revoked
+func (c *KeyCache) Forget(userName string) error {
+	path, err := c.path(userName)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("failed to remove key cache for %s: %v", userName, err)
+	}
+	return nil
+}
+
+// Load returns the cached keys of a user, or nil if there is no fresh entry
+func (c *KeyCache) Load(userName string) ([]string, error) {
+	path, err := c.path(userName)
+	if err != nil {
+		return nil, err
+	}
+
+	info, err := os.Stat(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to stat key cache for %s: %v", userName, err)
+	}
+	if c.MaxAge > 0 && time.Since(info.ModTime()) > c.MaxAge {
+		return nil, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read key cache for %s: %v", userName, err)
+	}
+
+	var keys []string
+	for _, line := range strings.Split(string(data), "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			keys = append(keys, line)
+		}
+	}
+	return keys, nil
+}
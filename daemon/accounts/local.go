@@ -0,0 +1,232 @@
+package accounts
+
+import (
+	"bufio"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// LocalAccount is an account as found in the node's /etc/passwd and /etc/shadow
+type LocalAccount struct {
+	UserName string
+	UID      int
+	GID      int
+	Home     string // Home directory, relative to the provisioning root
+	Locked   bool   // Account expiration date in /etc/shadow has passed
+}
+
+// readLocalAccounts parses the passwd and shadow files under root
+func readLocalAccounts(root string) (map[string]LocalAccount, error) {
+	passwd, err := readColonFile(filepath.Join(root, "etc", "passwd"))
+	if err != nil {
+		return nil, err
+	}
+
+	accounts := make(map[string]LocalAccount)
+	for _, fields := range passwd {
+		if len(fields) < 7 {
+			continue
+		}
+		uid, _ := strconv.Atoi(fields[2])
+		gid, _ := strconv.Atoi(fields[3])
+		accounts[fields[0]] = LocalAccount{
+			UserName: fields[0],
+			UID:      uid,
+			GID:      gid,
+			Home:     fields[5],
+		}
+	}
+
+	// A missing shadow file just means no account is known to be locked
+	shadow, err := readColonFile(filepath.Join(root, "etc", "shadow"))
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+	// Locking expires the account (usermod --expiredate 1); a "!" password alone is not a lock,
+	// as useradd leaves new accounts without a password that way
+	today := time.Now().Unix() / (24 * 60 * 60)
+	for _, fields := range shadow {
+		account, ok := accounts[fields[0]]
+		if !ok || len(fields) < 8 {
+			continue
+		}
+		expire, err := strconv.ParseInt(fields[7], 10, 64)
+		account.Locked = err == nil && expire <= today
+		accounts[fields[0]] = account
+	}
+
+	return accounts, nil
+}
+
+// readColonFile splits every non-empty, non-comment line of a colon-separated file
+func readColonFile(path string) ([][]string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open %s: %w", path, err)
+	}
+	defer file.Close()
+
+	var lines [][]string
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		lines = append(lines, strings.Split(line, ":"))
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", path, err)
+	}
+	return lines, nil
+}
+
+// authorizedKeysPath returns where an account's authorized_keys lives under root
+func authorizedKeysPath(root string, account LocalAccount) string {
+	return filepath.Join(root, account.Home, ".ssh", "authorized_keys")
+}
+
+// openSSHDir opens an account's ~/.ssh, creating it if needed, as a root that confines
+// every later read and write beneath it, and refuses it unless it is a directory owned by
+// the account. The provisioner runs as root inside a home directory the user controls, so
+// a planted symlink (e.g., ~/.ssh pointing at /root/.ssh) must never redirect its writes.
+// Returns nil if ~/.ssh does not exist and create is false.
+func openSSHDir(root string, account LocalAccount, create bool) (*os.Root, error) {
+	sshDir := filepath.Dir(authorizedKeysPath(root, account))
+
+	created := false
+	if _, err := os.Lstat(sshDir); errors.Is(err, os.ErrNotExist) {
+		if !create {
+			return nil, nil
+		}
+		// Mkdir fails rather than follow a symlink planted in the meantime
+		if err := os.Mkdir(sshDir, 0700); err != nil {
+			return nil, fmt.Errorf("failed to create %s: %v", sshDir, err)
+		}
+		created = true
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to stat %s: %v", sshDir, err)
+	}
+
+	dir, err := os.OpenRoot(sshDir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open %s: %v", sshDir, err)
+	}
+	self, err := dir.Open(".")
+	if err != nil {
+		dir.Close()
+		return nil, fmt.Errorf("failed to open %s: %v", sshDir, err)
+	}
+	defer self.Close()
+
+	// Only root can hand the directory over; unprivileged runs (e.g., against a temp root) keep ownership
+	if created && os.Geteuid() == 0 {
+		if err := self.Chown(account.UID, account.GID); err != nil {
+			dir.Close()
+			return nil, fmt.Errorf("failed to chown %s: %v", sshDir, err)
+		}
+	}
+
+	// Checked on the opened directory, so a symlink swapped in at any point is caught
+	info, err := self.Stat()
+	if err != nil {
+		dir.Close()
+		return nil, fmt.Errorf("failed to stat %s: %v", sshDir, err)
+	}
+	if stat, ok := info.Sys().(*syscall.Stat_t); !ok || !info.IsDir() || int(stat.Uid) != account.UID {
+		dir.Close()
+		return nil, fmt.Errorf("refusing %s, it is not a directory owned by %s", sshDir, account.UserName)
+	}
+	return dir, nil
+}
+
+// readAuthorizedKeys returns the keys currently installed for an account
+func readAuthorizedKeys(root string, account LocalAccount) ([]string, error) {
+	dir, err := openSSHDir(root, account, false)
+	if err != nil || dir == nil {
+		return nil, err
+	}
+	defer dir.Close()
+
+	file, err := dir.Open("authorized_keys")
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to open authorized_keys for %s: %v", account.UserName, err)
+	}
+	defer file.Close()
+
+	data, err := io.ReadAll(file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read authorized_keys for %s: %v", account.UserName, err)
+	}
+
+	var keys []string
+	for _, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line != "" && !strings.HasPrefix(line, "#") {
+			keys = append(keys, line)
+		}
+	}
+	return keys, nil
+}
+
+// writeAuthorizedKeys replaces an account's authorized_keys with the given keys, writing
+// only beneath the verified ~/.ssh (see openSSHDir)
+func writeAuthorizedKeys(root string, account LocalAccount, keys []string) error {
+	dir, err := openSSHDir(root, account, true)
+	if err != nil {
+		return err
+	}
+	defer dir.Close()
+
+	content := "# Managed by the GPU scheduler daemon; local edits are overwritten\n"
+	for _, key := range keys {
+		content += key + "\n"
+	}
+
+	// Write to a fresh temporary file first so sshd never sees a half-written file. The
+	// random name and O_EXCL make sure it is a new file, not one planted by the user.
+	tmpName := "authorized_keys." + rand.Text()
+	tmp, err := dir.OpenFile(tmpName, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return fmt.Errorf("failed to create authorized_keys for %s: %v", account.UserName, err)
+	}
+	err = writeKeysFile(tmp, content, account)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	// Renaming replaces authorized_keys itself, even if it is a symlink
+	sshDir := dir.Name()
+	if err == nil {
+		err = os.Rename(filepath.Join(sshDir, tmpName), filepath.Join(sshDir, "authorized_keys"))
+	}
+	if err != nil {
+		dir.Remove(tmpName)
+		return fmt.Errorf("failed to install authorized_keys for %s: %v", account.UserName, err)
+	}
+	return nil
+}
+
+// writeKeysFile fills the open temporary file and hands it to the account
+func writeKeysFile(file *os.File, content string, account LocalAccount) error {
+	if _, err := file.WriteString(content); err != nil {
+		return err
+	}
+	// Only root can hand the file over; unprivileged runs keep ownership
+	if os.Geteuid() == 0 {
+		if err := file.Chown(account.UID, account.GID); err != nil {
+			return err
+		}
+	}
+	return file.Sync()
+}
@@ -0,0 +1,59 @@
+package accounts
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// DefaultMinUID is the first UID of regular login accounts on most distributions (UID_MIN in /etc/login.defs)
+const DefaultMinUID = 1000
+
+// DefaultDeniedUsers are never managed, whatever their UID
+var DefaultDeniedUsers = []string{"root", "nobody"}
+
+// AccountPolicy keeps the scheduler away from system accounts: a database user named
+// after one (e.g., "root" or "daemon") must never get keys installed, be accepted by
+// sshd or be locked
+type AccountPolicy struct {
+	MinUID int      // Existing accounts below this UID are system accounts
+	Denied []string // Names that are never managed
+}
+
+// DefaultAccountPolicy returns the policy used when none is configured
+func DefaultAccountPolicy() AccountPolicy {
+	return AccountPolicy{MinUID: DefaultMinUID, Denied: DefaultDeniedUsers}
+}
+
+// ParseDeniedUsers splits a comma-separated list of user names, ignoring blanks
+func ParseDeniedUsers(list string) []string {
+	var names []string
+	for _, name := range strings.Split(list, ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// Check returns why an account may not be managed, or nil if it may. Accounts that do
+// not exist yet are only checked against the deny-list; useradd gives them a login UID.
+func (p AccountPolicy) Check(userName string, account LocalAccount, exists bool) error {
+	if slices.Contains(p.Denied, userName) {
+		return fmt.Errorf("%s is on the deny-list of unmanaged accounts", userName)
+	}
+	if exists && (account.UID < p.MinUID || account.UID == 0) {
+		return fmt.Errorf("%s is a system account (UID %d, below %d)", userName, account.UID, p.MinUID)
+	}
+	return nil
+}
+
+// CheckLocal is Check against the accounts in the passwd file under root
+func (p AccountPolicy) CheckLocal(root, userName string) error {
+	local, err := readLocalAccounts(root)
+	if err != nil {
+		return err
+	}
+	account, exists := local[userName]
+	return p.Check(userName, account, exists)
+}
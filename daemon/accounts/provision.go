@@ -0,0 +1,252 @@
+package accounts
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"os/exec"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+// ChangeKind is the kind of change the provisioner makes to a local account
+type ChangeKind string
+
+const (
+	ChangeCreate ChangeKind = "create"
+	ChangeLock   ChangeKind = "lock"
+	ChangeUnlock ChangeKind = "unlock"
+	ChangeKeys   ChangeKind = "keys"
+)
+
+// Change is a single step needed to bring a local account in line with the database
+type Change struct {
+	Kind     ChangeKind
+	UserName string
+	Name     string   // Full name, used as the GECOS field on creation
+	Keys     []string // Desired authorized keys (ChangeKeys only)
+	OldKeys  []string // Currently installed keys (ChangeKeys only)
+}
+
+// String renders the change as a line of a dry-run diff
+func (c Change) String() string {
+	switch c.Kind {
+	case ChangeCreate:
+		return fmt.Sprintf("+ create account %s (%s)", c.UserName, c.Name)
+	case ChangeLock:
+		return fmt.Sprintf("- lock account %s", c.UserName)
+	case ChangeUnlock:
+		return fmt.Sprintf("~ unlock account %s", c.UserName)
+	case ChangeKeys:
+		lines := []string{fmt.Sprintf("~ authorized_keys for %s", c.UserName)}
+		for _, key := range c.Keys {
+			if !slices.Contains(c.OldKeys, key) {
+				lines = append(lines, "    + "+key)
+			}
+		}
+		for _, key := range c.OldKeys {
+			if !slices.Contains(c.Keys, key) {
+				lines = append(lines, "    - "+key)
+			}
+		}
+		return strings.Join(lines, "\n")
+	}
+	return fmt.Sprintf("? %s %s", c.Kind, c.UserName)
+}
+
+// Provisioner creates, locks and unlocks local accounts and installs their SSH keys.
+// Only accounts named after scheduler users are ever touched, and never those the
+// policy rules out as system accounts.
+type Provisioner struct {
+	Root    string        // Filesystem root to provision, "/" on a real node
+	Shell   string        // Login shell for new accounts
+	Policy  AccountPolicy // Accounts that are never created, modified or locked
+	DryRun  bool          // Print the diff instead of applying it
+	Verbose bool
+}
+
+// Plan compares the database users with the local accounts and returns the changes to make
+func (p *Provisioner) Plan(users []User, now time.Time) ([]Change, error) {
+	local, err := readLocalAccounts(p.Root)
+	if err != nil {
+		return nil, err
+	}
+
+	var changes []Change
+	for _, user := range users {
+		account, exists := local[user.UserName]
+		if err := p.Policy.Check(user.UserName, account, exists); err != nil {
+			log.Printf("Skipping account %s: %v", user.UserName, err)
+			continue
+		}
+
+		var oldKeys []string
+		if exists {
+			oldKeys, err = readAuthorizedKeys(p.Root, account)
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		var wantKeys []string
+		switch {
+		case user.Active(now):
+			wantKeys = user.SSHKeys
+			if !exists {
+				changes = append(changes, Change{Kind: ChangeCreate, UserName: user.UserName, Name: user.Name})
+			} else if account.Locked {
+				changes = append(changes, Change{Kind: ChangeUnlock, UserName: user.UserName})
+			}
+		case user.Revoked(now):
+			if !exists {
+				continue
+			}
+			if !account.Locked {
+				changes = append(changes, Change{Kind: ChangeLock, UserName: user.UserName})
+			}
+		default:
+			// Access not granted yet; leave any manually created account alone
+			continue
+		}
+
+		if !keysEqual(oldKeys, wantKeys) {
+			changes = append(changes, Change{Kind: ChangeKeys, UserName: user.UserName, Keys: wantKeys, OldKeys: oldKeys})
+		}
+	}
+
+	return changes, nil
+}
+
+// Apply performs the planned changes in order, or only logs them in dry-run mode
+func (p *Provisioner) Apply(changes []Change) error {
+	for _, change := range changes {
+		if p.DryRun {
+			fmt.Println(change)
+			continue
+		}
+
+		var err error
+		switch change.Kind {
+		case ChangeCreate:
+			err = p.run("useradd", "--create-home", "--shell", p.Shell, "--comment", change.Name, change.UserName)
+		case ChangeLock:
+			// Expiring the account also stops key-based logins, which a password lock alone does not
+			err = p.run("usermod", "--lock", "--expiredate", "1", change.UserName)
+		case ChangeUnlock:
+			err = p.run("usermod", "--unlock", "--expiredate", "", change.UserName)
+		case ChangeKeys:
+			err = p.installKeys(change)
+		}
+		if err != nil {
+			return err
+		}
+
+		log.Println(change)
+	}
+	return nil
+}
+
+// installKeys writes the desired keys, re-reading passwd so freshly created accounts are found
+func (p *Provisioner) installKeys(change Change) error {
+	local, err := readLocalAccounts(p.Root)
+	if err != nil {
+		return err
+	}
+	account, ok := local[change.UserName]
+	if !ok {
+		return fmt.Errorf("account %s does not exist", change.UserName)
+	}
+	if err := p.Policy.Check(change.UserName, account, true); err != nil {
+		return err
+	}
+	return writeAuthorizedKeys(p.Root, account, change.Keys)
+}
+
+// run executes a shadow-utils command against the provisioning root
+func (p *Provisioner) run(name string, args ...string) error {
+	if p.Root != "" && p.Root != "/" {
+		args = append([]string{"--prefix", p.Root}, args...)
+	}
+	if p.Verbose {
+		log.Printf("Running %s %s", name, strings.Join(args, " "))
+	}
+
+	output, err := exec.Command(name, args...).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("failed to run %s: %v (%s)", name, err, strings.TrimSpace(string(output)))
+	}
+	return nil
+}
+
+// Reconcile runs one provisioning pass against the database
+func (p *Provisioner) Reconcile(db *sql.DB) error {
+	users, err := FetchUsers(db)
+	if err != nil {
+		return fmt.Errorf("failed to fetch users: %v", err)
+	}
+
+	changes, err := p.Plan(users, time.Now())
+	if err != nil {
+		return err
+	}
+	if p.Verbose || p.DryRun {
+		log.Printf("%d account change(s) needed under %s", len(changes), p.Root)
+	}
+
+	return p.Apply(changes)
+}
+
+// StartAccountProvisioner reconciles local accounts with the database every interval
+func StartAccountProvisioner(dsn string, provisioner *Provisioner, interval time.Duration) error {
+	// Access grants and revocations are DATETIME columns scanned into sql.NullTime
+	cfg, err := mysql.ParseDSN(dsn)
+	if err != nil {
+		log.Printf("Error parsing DSN: %v", err)
+		return err
+	}
+	cfg.ParseTime = true
+
+	// Connect to the database
+	db, err := sql.Open("mysql", cfg.FormatDSN())
+	if err != nil {
+		log.Printf("Error connecting to database: %v", err)
+		return err
+	}
+	defer db.Close()
+
+	// Test the connection
+	err = db.Ping()
+	if err != nil {
+		log.Printf("Error pinging database: %v", err)
+		return err
+	}
+
+	// A dry run is a one-off diff rather than a loop
+	if provisioner.DryRun {
+		return provisioner.Reconcile(db)
+	}
+
+	// Daemon loop
+	for {
+		if err := provisioner.Reconcile(db); err != nil {
+			log.Printf("Error provisioning accounts: %v", err)
+		}
+		time.Sleep(interval)
+	}
+}
+
+// keysEqual compares two key lists ignoring order
+func keysEqual(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for _, key := range a {
+		if !slices.Contains(b, key) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,302 @@
+package accounts
+
+import (
+	"database/sql"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// ownerUID is the UID test accounts get: one the test can own files as
+func ownerUID() int {
+	if os.Geteuid() == 0 {
+		return 1001
+	}
+	return os.Getuid()
+}
+
+// testPolicy allows the owner UID while still ruling out the system accounts of testRoot
+var testPolicy = AccountPolicy{MinUID: 100, Denied: []string{"nobody"}}
+
+// testRoot builds a provisioning root with root, daemon, nobody and the given login accounts
+func testRoot(t *testing.T, users map[string]bool) string {
+	t.Helper()
+	root := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(root, "etc"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	uid := ownerUID()
+	passwd := []string{
+		"root:x:0:0:root:/root:/bin/bash",
+		"daemon:x:1:1:daemon:/usr/sbin:/usr/sbin/nologin",
+		"nobody:x:65534:65534:nobody:/nonexistent:/usr/sbin/nologin",
+	}
+	shadow := []string{"root:*:19000::::::", "daemon:*:19000::::::", "nobody:*:19000::::::"}
+	for name, locked := range users {
+		passwd = append(passwd, strings.Join([]string{name, "x", strconv.Itoa(uid), strconv.Itoa(uid), name, "/home/" + name, "/bin/bash"}, ":"))
+		// As useradd leaves them, accounts have no password; locked ones are expired
+		expire := ""
+		if locked {
+			expire = "1"
+		}
+		shadow = append(shadow, name+":!:19000:::::"+expire+":")
+		mkdirOwned(t, filepath.Join(root, "home", name), uid)
+	}
+	mkdirOwned(t, filepath.Join(root, "root"), 0)
+	writeFile(t, filepath.Join(root, "etc", "passwd"), strings.Join(passwd, "\n")+"\n")
+	writeFile(t, filepath.Join(root, "etc", "shadow"), strings.Join(shadow, "\n")+"\n")
+	return root
+}
+
+func mkdirOwned(t *testing.T, path string, uid int) {
+	t.Helper()
+	if err := os.MkdirAll(path, 0700); err != nil {
+		t.Fatal(err)
+	}
+	if os.Geteuid() == 0 {
+		if err := os.Chown(path, uid, uid); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func writeFile(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func readFile(t *testing.T, path string) string {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+func granted(at time.Time) sql.NullTime {
+	return sql.NullTime{Time: at, Valid: true}
+}
+
+func TestPlan(t *testing.T) {
+	now := time.Date(2026, 10, 19, 12, 0, 0, 0, time.UTC)
+	root := testRoot(t, map[string]bool{"alice": false, "bob": true, "carol": false, "dave": false})
+	uid := ownerUID()
+	mkdirOwned(t, filepath.Join(root, "home", "alice", ".ssh"), uid)
+	writeFile(t, filepath.Join(root, "home", "alice", ".ssh", "authorized_keys"), "# managed\nssh-ed25519 OLD alice\n")
+
+	users := []User{
+		{UserName: "alice", IsWhitelisted: true, GrantedAccessAt: granted(now.Add(-time.Hour)), SSHKeys: []string{"ssh-ed25519 NEW alice"}},
+		{UserName: "bob", IsWhitelisted: true, GrantedAccessAt: granted(now.Add(-time.Hour))},
+		{UserName: "carol", IsWhitelisted: true, GrantedAccessAt: granted(now.Add(-48 * time.Hour)), RevokedAccessAt: granted(now.Add(-time.Hour))},
+		{UserName: "dave", IsWhitelisted: true, GrantedAccessAt: granted(now.Add(time.Hour))},
+		{UserName: "erin", Name: "Erin E", IsWhitelisted: true, GrantedAccessAt: granted(now.Add(-time.Hour)), SSHKeys: []string{"ssh-ed25519 KEY erin"}},
+		// Rows named after system accounts must never be acted on
+		{UserName: "root", IsWhitelisted: true, GrantedAccessAt: granted(now.Add(-time.Hour)), SSHKeys: []string{"ssh-ed25519 EVIL root"}},
+		{UserName: "daemon", IsWhitelisted: false, GrantedAccessAt: granted(now.Add(-time.Hour))},
+		{UserName: "nobody", IsWhitelisted: true, GrantedAccessAt: granted(now.Add(-time.Hour)), SSHKeys: []string{"ssh-ed25519 EVIL nobody"}},
+	}
+
+	p := &Provisioner{Root: root, Policy: testPolicy}
+	changes, err := p.Plan(users, now)
+	if err != nil {
+		t.Fatalf("Plan: %v", err)
+	}
+
+	var got []string
+	for _, change := range changes {
+		got = append(got, string(change.Kind)+" "+change.UserName)
+	}
+	want := []string{"keys alice", "unlock bob", "lock carol", "create erin", "keys erin"}
+	if !slices.Equal(got, want) {
+		t.Errorf("changes %v, want %v", got, want)
+	}
+	if !slices.Equal(changes[0].OldKeys, []string{"ssh-ed25519 OLD alice"}) {
+		t.Errorf("alice's old keys %v", changes[0].OldKeys)
+	}
+}
+
+func TestApplyInstallsKeys(t *testing.T) {
+	root := testRoot(t, map[string]bool{"alice": false})
+	p := &Provisioner{Root: root, Policy: testPolicy}
+
+	keys := []string{"ssh-ed25519 AAA alice@laptop", "ssh-rsa BBB alice@desktop"}
+	if err := p.Apply([]Change{{Kind: ChangeKeys, UserName: "alice", Keys: keys}}); err != nil {
+		t.Fatalf("Apply: %v", err)
+	}
+
+	path := filepath.Join(root, "home", "alice", ".ssh", "authorized_keys")
+	content := readFile(t, path)
+	for _, key := range keys {
+		if !strings.Contains(content, key+"\n") {
+			t.Errorf("authorized_keys is missing %q:\n%s", key, content)
+		}
+	}
+	entries, err := os.ReadDir(filepath.Dir(path))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 {
+		t.Errorf("temporary files left behind: %v", entries)
+	}
+
+	local, err := readLocalAccounts(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	installed, err := readAuthorizedKeys(root, local["alice"])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(installed, keys) {
+		t.Errorf("read back %v, want %v", installed, keys)
+	}
+
+	// A second pass has nothing left to do
+	now := time.Now()
+	changes, err := p.Plan([]User{{UserName: "alice", IsWhitelisted: true, GrantedAccessAt: granted(now.Add(-time.Hour)), SSHKeys: keys}}, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(changes) != 0 {
+		t.Errorf("unexpected changes %v", changes)
+	}
+}
+
+func TestApplyRefusesSystemAccounts(t *testing.T) {
+	root := testRoot(t, nil)
+	p := &Provisioner{Root: root, Policy: testPolicy}
+
+	err := p.Apply([]Change{{Kind: ChangeKeys, UserName: "root", Keys: []string{"ssh-ed25519 EVIL root"}}})
+	if err == nil {
+		t.Fatal("expected keys for root to be refused")
+	}
+	if _, err := os.Stat(filepath.Join(root, "root", ".ssh")); !os.IsNotExist(err) {
+		t.Errorf("root's ~/.ssh was touched: %v", err)
+	}
+}
+
+func TestWriteAuthorizedKeysSymlinks(t *testing.T) {
+	keys := []string{"ssh-ed25519 AAA alice"}
+
+	tests := []struct {
+		name    string
+		plant   func(t *testing.T, home, outside string) // Plants links in the user's home pointing outside
+		wantErr bool
+	}{
+		{
+			name: "symlinked ~/.ssh is refused",
+			plant: func(t *testing.T, home, outside string) {
+				if err := os.Symlink(outside, filepath.Join(home, ".ssh")); err != nil {
+					t.Fatal(err)
+				}
+			},
+			wantErr: true,
+		},
+		{
+			name: "symlinked authorized_keys is replaced, not followed",
+			plant: func(t *testing.T, home, outside string) {
+				mkdirOwned(t, filepath.Join(home, ".ssh"), ownerUID())
+				if err := os.Symlink(filepath.Join(outside, "authorized_keys"), filepath.Join(home, ".ssh", "authorized_keys")); err != nil {
+					t.Fatal(err)
+				}
+			},
+		},
+		{
+			name: "planted temporary file is not followed",
+			plant: func(t *testing.T, home, outside string) {
+				mkdirOwned(t, filepath.Join(home, ".ssh"), ownerUID())
+				if err := os.Symlink(filepath.Join(outside, "authorized_keys"), filepath.Join(home, ".ssh", "authorized_keys.tmp")); err != nil {
+					t.Fatal(err)
+				}
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			root := testRoot(t, map[string]bool{"alice": false})
+			home := filepath.Join(root, "home", "alice")
+			// Stands in for /root/.ssh, which must survive whatever alice plants
+			outside := filepath.Join(root, "root", ".ssh")
+			mkdirOwned(t, outside, 0)
+			writeFile(t, filepath.Join(outside, "authorized_keys"), "ssh-ed25519 ADMIN root\n")
+			tt.plant(t, home, outside)
+
+			local, err := readLocalAccounts(root)
+			if err != nil {
+				t.Fatal(err)
+			}
+			err = writeAuthorizedKeys(root, local["alice"], keys)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("writeAuthorizedKeys error %v, want error %v", err, tt.wantErr)
+			}
+
+			if content := readFile(t, filepath.Join(outside, "authorized_keys")); content != "ssh-ed25519 ADMIN root\n" {
+				t.Errorf("file outside the home directory was changed:\n%s", content)
+			}
+			if !tt.wantErr {
+				path := filepath.Join(home, ".ssh", "authorized_keys")
+				info, err := os.Lstat(path)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if !info.Mode().IsRegular() {
+					t.Errorf("authorized_keys is %v, want a regular file", info.Mode())
+				}
+				if content := readFile(t, path); !strings.Contains(content, keys[0]) {
+					t.Errorf("authorized_keys:\n%s", content)
+				}
+			}
+		})
+	}
+}
+
+func TestWriteAuthorizedKeysRefusesForeignSSHDir(t *testing.T) {
+	root := testRoot(t, map[string]bool{"alice": false})
+	local, err := readLocalAccounts(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mkdirOwned(t, filepath.Join(root, "home", "alice", ".ssh"), ownerUID())
+
+	// The directory belongs to someone other than the account
+	account := local["alice"]
+	account.UID++
+	if err := writeAuthorizedKeys(root, account, []string{"ssh-ed25519 AAA alice"}); err == nil {
+		t.Fatal("expected a ~/.ssh owned by another user to be refused")
+	}
+}
+
+func TestAccountPolicy(t *testing.T) {
+	policy := AccountPolicy{MinUID: 1000, Denied: []string{"root", "nobody"}}
+	tests := []struct {
+		name    string
+		account LocalAccount
+		exists  bool
+		allowed bool
+	}{
+		{"alice", LocalAccount{UID: 1001}, true, true},
+		{"newuser", LocalAccount{}, false, true},
+		{"root", LocalAccount{}, false, false},
+		{"daemon", LocalAccount{UID: 1}, true, false},
+		{"nobody", LocalAccount{UID: 65534}, true, false},
+		{"svc", LocalAccount{UID: 999}, true, false},
+	}
+	for _, tt := range tests {
+		if err := policy.Check(tt.name, tt.account, tt.exists); (err == nil) != tt.allowed {
+			t.Errorf("Check(%s): %v, want allowed %v", tt.name, err, tt.allowed)
+		}
+	}
+
+	if got := ParseDeniedUsers(" root, ,nobody ,"); !slices.Equal(got, []string{"root", "nobody"}) {
+		t.Errorf("ParseDeniedUsers: %v", got)
+	}
+}
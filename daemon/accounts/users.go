@@ -0,0 +1,83 @@
+package accounts
+
+import (
+	"database/sql"
+	"strings"
+	"time"
+)
+
+// User is a scheduler user together with the SSH keys registered for them
+type User struct {
+	UserName        string
+	Name            string
+	IsWhitelisted   bool
+	GrantedAccessAt sql.NullTime
+	RevokedAccessAt sql.NullTime
+	SSHKeys         []string
+}
+
+// Active reports whether the user should currently be able to log in
+func (u User) Active(now time.Time) bool {
+	if !u.IsWhitelisted || !u.GrantedAccessAt.Valid || u.GrantedAccessAt.Time.After(now) {
+		return false
+	}
+	return !u.Revoked(now)
+}
+
+// Revoked reports whether the user's access was taken away. Users that were never
+// granted access are neither active nor revoked and are left alone.
+func (u User) Revoked(now time.Time) bool {
+	if u.RevokedAccessAt.Valid && !u.RevokedAccessAt.Time.After(now) {
+		return true
+	}
+	return !u.IsWhitelisted && u.GrantedAccessAt.Valid
+}
+
+// FetchUsers loads every user and their SSH keys from the database
+func FetchUsers(db *sql.DB) ([]User, error) {
+	return queryUsers(db, "")
+}
+
+// FetchUser loads a single user and their SSH keys, returning nil if there is no such user
+func FetchUser(db *sql.DB, userName string) (*User, error) {
+	users, err := queryUsers(db, "WHERE u.user_name = ?", userName)
+	if err != nil || len(users) == 0 {
+		return nil, err
+	}
+	return &users[0], nil
+}
+
+func queryUsers(db *sql.DB, whereClause string, args ...interface{}) ([]User, error) {
+	rows, err := db.Query(`
+		SELECT u.user_name, u.name, u.is_whitelisted, u.granted_access_at, u.revoked_access_at, k.ssh_key
+		FROM gpu_scheduler.users u
+		LEFT JOIN gpu_scheduler.user_ssh_keys k ON k.user_id = u.id
+		`+whereClause+`
+		ORDER BY u.user_name, k.id`,
+		args...,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var users []User
+	for rows.Next() {
+		var user User
+		var sshKey sql.NullString
+		err := rows.Scan(&user.UserName, &user.Name, &user.IsWhitelisted, &user.GrantedAccessAt, &user.RevokedAccessAt, &sshKey)
+		if err != nil {
+			return nil, err
+		}
+
+		// One row per key, so fold consecutive rows of the same user together
+		if len(users) == 0 || users[len(users)-1].UserName != user.UserName {
+			users = append(users, user)
+		}
+		if key := strings.TrimSpace(sshKey.String); key != "" {
+			last := &users[len(users)-1]
+			last.SSHKeys = append(last.SSHKeys, key)
+		}
+	}
+	return users, rows.Err()
+}
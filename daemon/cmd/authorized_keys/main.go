@@ -0,0 +1,133 @@
+// Command authorized_keys prints the SSH keys of a scheduler user for sshd's AuthorizedKeysCommand.
+//
+// Keys are only returned while the user is whitelisted, granted and not revoked in the database,
+// so revoking someone takes effect on every node at their next login. System accounts (below
+// -min-uid or listed in -deny-users) never get keys, whatever the database says. The last good answer is
+// cached locally and used while the database cannot be reached. Example sshd_config:
+//
+//	AuthorizedKeysCommand /usr/local/bin/gpu_authorized_keys -dsn-file /etc/gpu_scheduler/dsn %u
+//	AuthorizedKeysCommandUser gpu_scheduler
+package main
+
+import (
+	"context"
+	"database/sql"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/eduardo-escoto/gpu_request/daemon/accounts"
+	"github.com/go-sql-driver/mysql"
+)
+
+func main() {
+	// Define command-line flags
+	dsnFlag := flag.String("dsn", "", "Database DSN (can also be set via the DATABASE_DSN environment variable)")
+	dsnFileFlag := flag.String("dsn-file", "", "File containing the database DSN, to keep credentials off the command line")
+	cacheDirFlag := flag.String("cache-dir", "/var/cache/gpu_scheduler/authorized_keys", "Directory for the local key cache")
+	cacheMaxAgeFlag := flag.Duration("cache-max-age", 7*24*time.Hour, "Ignore cached keys older than this (0 keeps them forever)")
+	timeoutFlag := flag.Duration("timeout", 3*time.Second, "Database timeout before falling back to the cache")
+	minUIDFlag := flag.Int("min-uid", accounts.DefaultMinUID, "Never return keys for existing accounts below this UID")
+	denyFlag := flag.String("deny-users", strings.Join(accounts.DefaultDeniedUsers, ","), "Comma-separated accounts that never get keys")
+
+	// Parse command-line flags
+	flag.Parse()
+
+	// sshd reports anything on stderr in its log; stdout must only contain keys
+	log.SetFlags(0)
+	log.SetPrefix("gpu_authorized_keys: ")
+
+	if flag.NArg() != 1 {
+		log.Fatalf("Usage: %s [-dsn=<dsn> | -dsn-file=<path>] [-cache-dir=<dir>] <user_name>", os.Args[0])
+	}
+	userName := flag.Arg(0)
+
+	policy := accounts.AccountPolicy{MinUID: *minUIDFlag, Denied: accounts.ParseDeniedUsers(*denyFlag)}
+	if err := policy.CheckLocal("/", userName); err != nil {
+		log.Printf("No keys for %s: %v", userName, err)
+		return
+	}
+
+	cache := &accounts.KeyCache{Dir: *cacheDirFlag, MaxAge: *cacheMaxAgeFlag}
+
+	keys, err := lookupKeys(*dsnFlag, *dsnFileFlag, *timeoutFlag, userName, cache)
+	if err != nil {
+		log.Printf("Database lookup for %s failed, using cached keys: %v", userName, err)
+		keys, err = cache.Load(userName)
+		if err != nil {
+			log.Fatalf("Error reading key cache: %v", err)
+		}
+	}
+
+	for _, key := range keys {
+		fmt.Println(key)
+	}
+}
+
+// lookupKeys asks the database for the user's keys and refreshes the cache with the answer
+func lookupKeys(dsn, dsnFile string, timeout time.Duration, userName string, cache *accounts.KeyCache) ([]string, error) {
+	dsn, err := loadDSN(dsn, dsnFile)
+	if err != nil {
+		return nil, err
+	}
+
+	// Fail fast: sshd is waiting on us while the user sits at the login prompt
+	cfg, err := mysql.ParseDSN(dsn)
+	if err != nil {
+		return nil, fmt.Errorf("invalid DSN: %v", err)
+	}
+	cfg.Timeout = timeout
+	cfg.ReadTimeout = timeout
+	cfg.ParseTime = true
+
+	db, err := sql.Open("mysql", cfg.FormatDSN())
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	if err := db.PingContext(ctx); err != nil {
+		return nil, err
+	}
+
+	user, err := accounts.FetchUser(db, userName)
+	if err != nil {
+		return nil, err
+	}
+
+	// The database answered, so it is authoritative: unknown or inactive users get nothing
+	if user == nil || !user.Active(time.Now()) {
+		if err := cache.Forget(userName); err != nil {
+			log.Printf("Error clearing key cache: %v", err)
+		}
+		return nil, nil
+	}
+
+	if err := cache.Store(userName, user.SSHKeys); err != nil {
+		log.Printf("Error updating key cache: %v", err)
+	}
+	return user.SSHKeys, nil
+}
+
+// loadDSN resolves the DSN from the flag, the DSN file or the environment, in that order
+func loadDSN(dsn, dsnFile string) (string, error) {
+	if dsn != "" {
+		return dsn, nil
+	}
+	if dsnFile != "" {
+		data, err := os.ReadFile(dsnFile)
+		if err != nil {
+			return "", fmt.Errorf("failed to read DSN file: %v", err)
+		}
+		return strings.TrimSpace(string(data)), nil
+	}
+	if dsn = os.Getenv("DATABASE_DSN"); dsn != "" {
+		return dsn, nil
+	}
+	return "", fmt.Errorf("no DSN provided")
+}
@@ -11,14 +11,17 @@ import (
 )
 
 type Command struct {
-	ID          int
-	TargetNode  string
-	CommandType string
-	Parameters  string
-	Status      string
+	ID          int    `json:"id"`
+	TargetNode  string `json:"target_node"`
+	CommandType string `json:"command_type"`
+	Parameters  string `json:"parameters"`
+	Status      string `json:"status"`
 }
 
-func StartCommandMonitor(dsn string, interval time.Duration) error {
+// StartCommandMonitor fetches and executes commands for this node. When serverURL is set,
+// commands are delivered by long-polling the server; the database is polled every interval
+// only while the server cannot be reached.
+func StartCommandMonitor(dsn string, serverURL string, interval time.Duration) error {
 	// Debug: Print the DSN being used
 	log.Printf("Connecting to database with DSN: %s", dsn)
 
@@ -44,14 +47,31 @@ func StartCommandMonitor(dsn string, interval time.Duration) error {
 	}
 	nodeName := strings.TrimSpace(string(serverName))
 
+	var subscriber *Subscriber
+	if serverURL != "" {
+		subscriber = NewSubscriber(serverURL, nodeName)
+	}
+
 	// Daemon loop
 	for {
-		log.Println("Checking for new commands...")
-		commands, err := fetchPendingCommands(db, nodeName)
-		if err != nil {
-			log.Printf("Error fetching commands: %v", err)
-			time.Sleep(interval)
-			continue
+		var commands []Command
+		polling := subscriber == nil
+		if subscriber != nil {
+			commands, err = subscriber.Wait()
+			if err != nil {
+				log.Printf("Error waiting for commands from %s, falling back to polling: %v", serverURL, err)
+				polling = true
+			}
+		}
+
+		if polling {
+			log.Println("Checking for new commands...")
+			commands, err = fetchPendingCommands(db, nodeName)
+			if err != nil {
+				log.Printf("Error fetching commands: %v", err)
+				time.Sleep(interval)
+				continue
+			}
 		}
 
 		for _, cmd := range commands {
@@ -62,7 +82,10 @@ func StartCommandMonitor(dsn string, interval time.Duration) error {
 			}
 		}
 
-		time.Sleep(interval)
+		// Only the polling fallback needs to back off; the long-poll already blocks server-side
+		if polling {
+			time.Sleep(interval)
+		}
 	}
 }
 
@@ -86,17 +109,28 @@ func fetchPendingCommands(db *sql.DB, nodeName string) ([]Command, error) {
 }
 
 func executeCommand(db *sql.DB, cmd Command) error {
-	// Mark command as in progress
-	_, err := db.Exec("UPDATE commands SET status = 'in_progress' WHERE id = ?", cmd.ID)
+	// Mark command as in progress. The status check makes this a claim, so a command
+	// delivered by both the long-poll and the fallback poll only runs once.
+	result, err := db.Exec("UPDATE commands SET status = 'in_progress' WHERE id = ? AND status = 'pending'", cmd.ID)
+	if err != nil {
+		return err
+	}
+	claimed, err := result.RowsAffected()
 	if err != nil {
 		return err
 	}
+	if claimed == 0 {
+		log.Printf("Command %d was already claimed, skipping", cmd.ID)
+		return nil
+	}
 
-	// Simulate command execution (replace with actual logic)
 	log.Printf("Executing command: %s with parameters: %s", cmd.CommandType, cmd.Parameters)
-	time.Sleep(2 * time.Second) // Simulate work
+	status := "completed"
+	if err := run(cmd); err != nil {
+		log.Printf("Command %d failed: %v", cmd.ID, err)
+		status = "failed"
+	}
 
-	// Mark command as completed
-	_, err = db.Exec("UPDATE commands SET status = 'completed' WHERE id = ?", cmd.ID)
+	_, err = db.Exec("UPDATE commands SET status = ? WHERE id = ?", status, cmd.ID)
 	return err
 }
@@ -0,0 +1,116 @@
+package commands
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+	"syscall"
+
+	"github.com/eduardo-escoto/gpu_request/daemon/monitor"
+)
+
+// Parameters is the JSON payload the scheduler attaches to notify and kill commands
+type Parameters struct {
+	User     string   `json:"user"`
+	GPUUUIDs []string `json:"gpu_uuids"`
+	Message  string   `json:"message,omitempty"`
+	Signal   string   `json:"signal,omitempty"` // "TERM" (default) or "KILL"
+}
+
+// run executes a single command on this node
+func run(cmd Command) error {
+	var params Parameters
+	if cmd.Parameters != "" {
+		if err := json.Unmarshal([]byte(cmd.Parameters), &params); err != nil {
+			return fmt.Errorf("invalid parameters: %w", err)
+		}
+	}
+
+	switch cmd.CommandType {
+	case "notify":
+		return notifyUser(params.User, params.Message)
+	case "kill":
+		return killGPUProcesses(params.User, params.GPUUUIDs, params.Signal)
+	default:
+		return fmt.Errorf("unknown command type %q", cmd.CommandType)
+	}
+}
+
+// notifyUser writes a message to every terminal the user is logged in on
+func notifyUser(user, message string) error {
+	if user == "" || message == "" {
+		return fmt.Errorf("notify needs a user and a message")
+	}
+
+	out, err := exec.Command("who").Output()
+	if err != nil {
+		return fmt.Errorf("failed to list sessions: %w", err)
+	}
+
+	text := fmt.Sprintf("\r\n*** GPU Scheduler ***\r\n%s\r\n", message)
+	for _, line := range strings.Split(string(out), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 2 || fields[0] != user {
+			continue
+		}
+
+		tty, err := os.OpenFile(filepath.Join("/dev", fields[1]), os.O_WRONLY, 0)
+		if err != nil {
+			log.Printf("Error opening %s for %s: %v", fields[1], user, err)
+			continue
+		}
+		_, err = tty.WriteString(text)
+		tty.Close()
+		if err != nil {
+			log.Printf("Error writing to %s for %s: %v", fields[1], user, err)
+		}
+	}
+	return nil
+}
+
+// killGPUProcesses signals the user's processes running on the given GPUs
+func killGPUProcesses(user string, gpuUUIDs []string, signal string) error {
+	if user == "" || len(gpuUUIDs) == 0 {
+		return fmt.Errorf("kill needs a user and GPUs")
+	}
+
+	sig := syscall.SIGTERM
+	switch signal {
+	case "", "TERM":
+		signal = "TERM"
+	case "KILL":
+		sig = syscall.SIGKILL
+	default:
+		return fmt.Errorf("unsupported signal %q", signal)
+	}
+
+	gpus, err := monitor.GetGPUMetrics(false)
+	if err != nil {
+		return err
+	}
+
+	var failed []string
+	for _, gpu := range gpus {
+		if !slices.Contains(gpuUUIDs, gpu.UUID) {
+			continue
+		}
+		for _, proc := range gpu.Processes {
+			if proc.UserName != user {
+				continue
+			}
+			log.Printf("Sending SIG%s to %s (pid %d, user %s) on GPU %d", signal, proc.ProcessName, proc.PID, user, gpu.Index)
+			if err := syscall.Kill(proc.PID, sig); err != nil && err != syscall.ESRCH {
+				failed = append(failed, fmt.Sprintf("pid %d: %v", proc.PID, err))
+			}
+		}
+	}
+	if len(failed) > 0 {
+		return fmt.Errorf("failed to signal processes: %s", strings.Join(failed, "; "))
+	}
+	return nil
+}
@@ -0,0 +1,65 @@
+package commands
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// pollTimeout is how long the server holds a long-poll open when there is nothing to deliver
+const pollTimeout = 30 * time.Second
+
+// Subscriber receives commands for a node by long-polling the scheduler server
+type Subscriber struct {
+	ServerURL string
+	NodeName  string
+	Token     string // COMMAND_API_TOKEN shared with the server, which refuses commands without it
+	client    *http.Client
+}
+
+// NewSubscriber creates a subscriber for the given server and node
+func NewSubscriber(serverURL, nodeName string) *Subscriber {
+	return &Subscriber{
+		ServerURL: strings.TrimRight(serverURL, "/"),
+		NodeName:  nodeName,
+		Token:     os.Getenv("COMMAND_API_TOKEN"),
+		client:    &http.Client{Timeout: pollTimeout + 10*time.Second},
+	}
+}
+
+// Wait blocks until the server has pending commands for this node or the poll times out,
+// in which case it returns an empty list
+func (s *Subscriber) Wait() ([]Command, error) {
+	query := url.Values{}
+	query.Set("node", s.NodeName)
+	query.Set("timeout", strconv.Itoa(int(pollTimeout.Seconds())))
+
+	req, err := http.NewRequest(http.MethodGet, s.ServerURL+"/api/commands/poll?"+query.Encode(), nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to build poll request: %v", err)
+	}
+	if s.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+s.Token)
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to poll for commands: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to poll for commands: received status code %d", resp.StatusCode)
+	}
+
+	var commands []Command
+	if err := json.NewDecoder(resp.Body).Decode(&commands); err != nil {
+		return nil, fmt.Errorf("failed to decode commands: %v", err)
+	}
+	return commands, nil
+}
@@ -6,17 +6,39 @@ import (
 	"os"
 	"os/signal"
 	"strconv"
+	"strings"
 	"syscall"
 	"time"
 
+	"github.com/eduardo-escoto/gpu_request/daemon/access"
+	"github.com/eduardo-escoto/gpu_request/daemon/accounts"
+	"github.com/eduardo-escoto/gpu_request/daemon/commands"
 	"github.com/eduardo-escoto/gpu_request/daemon/monitor"
 )
 
+// Defaults of the loop interval flags
+const (
+	defaultProvisionInterval = 5 * time.Minute
+	defaultTopologyInterval  = time.Hour
+)
+
 func main() {
 	// Define command-line flags
 	dsnFlag := flag.String("dsn", "", "Database DSN (e.g., user:password@tcp(localhost:3306)/gpu_scheduler)")
 	intervalFlag := flag.String("interval", "", "Sleep interval in seconds between updates")
 	verboseFlag := flag.Bool("verbose", false, "Enable verbose logging") // Add verbose flag
+	serverFlag := flag.String("server", "", "Scheduler server URL to long-poll for commands (e.g., http://deepfreeze.ucsd.edu:8080)")
+	enforceAccessFlag := flag.Bool("enforce-gpu-access", false, "Restrict /dev/nvidiaN to users with an active reservation on that GPU")
+	devDirFlag := flag.String("dev-dir", "/dev", "Directory containing the NVIDIA device nodes")
+	accessExemptFlag := flag.String("gpu-access-exempt", "", "Comma-separated users that always keep access to every GPU")
+	provisionFlag := flag.Bool("provision-accounts", false, "Create, lock and unlock local accounts and authorized_keys from the users table")
+	provisionDryRunFlag := flag.Bool("provision-dry-run", false, "Print the account changes that would be made and exit")
+	provisionRootFlag := flag.String("provision-root", "/", "Filesystem root to provision accounts under")
+	provisionIntervalFlag := flag.Duration("provision-interval", defaultProvisionInterval, "Interval between account provisioning passes")
+	provisionShellFlag := flag.String("provision-shell", "/bin/bash", "Login shell for newly created accounts")
+	provisionMinUIDFlag := flag.Int("provision-min-uid", accounts.DefaultMinUID, "Never manage existing accounts below this UID")
+	provisionDenyFlag := flag.String("provision-deny-users", strings.Join(accounts.DefaultDeniedUsers, ","), "Comma-separated accounts that are never managed")
+	topologyIntervalFlag := flag.Duration("topology-interval", defaultTopologyInterval, "Interval between GPU topology reports")
 
 	// Parse command-line flags
 	flag.Parse()
@@ -46,7 +68,25 @@ func main() {
 		if err != nil {
 			log.Fatalf("Invalid interval value: %v", err)
 		}
-		sleepInterval = time.Duration(interval) * time.Second
+		if interval > 0 {
+			sleepInterval = time.Duration(interval) * time.Second
+		} else {
+			log.Printf("Ignoring non-positive interval %d, using %s", interval, sleepInterval)
+		}
+	}
+	// A zero interval would spin the loops against the database
+	for _, interval := range []struct {
+		name  string
+		value *time.Duration
+		usual time.Duration
+	}{
+		{"provision-interval", provisionIntervalFlag, defaultProvisionInterval},
+		{"topology-interval", topologyIntervalFlag, defaultTopologyInterval},
+	} {
+		if *interval.value <= 0 {
+			log.Printf("Ignoring non-positive -%s %s, using %s", interval.name, *interval.value, interval.usual)
+			*interval.value = interval.usual
+		}
 	}
 
 	// Debug: Print the sleep interval
@@ -54,6 +94,28 @@ func main() {
 		log.Printf("Using sleep interval: %s", sleepInterval)
 	}
 
+	// Load the command server URL from environment variable or command-line flag.
+	// Without it, commands are picked up by polling the database every interval.
+	serverURL := os.Getenv("SERVER_URL")
+	if *serverFlag != "" {
+		serverURL = *serverFlag
+	}
+
+	// Account provisioning, either as a one-off dry run or as a reconcile loop
+	provisioner := &accounts.Provisioner{
+		Root:    *provisionRootFlag,
+		Shell:   *provisionShellFlag,
+		Policy:  accounts.AccountPolicy{MinUID: *provisionMinUIDFlag, Denied: accounts.ParseDeniedUsers(*provisionDenyFlag)},
+		DryRun:  *provisionDryRunFlag,
+		Verbose: *verboseFlag,
+	}
+	if *provisionDryRunFlag {
+		if err := accounts.StartAccountProvisioner(dsn, provisioner, *provisionIntervalFlag); err != nil {
+			log.Fatalf("Account provisioning dry run failed: %v", err)
+		}
+		return
+	}
+
 	// Create channels for graceful shutdown
 	stopChan := make(chan os.Signal, 1)
 	signal.Notify(stopChan, syscall.SIGINT, syscall.SIGTERM)
@@ -66,7 +128,61 @@ func main() {
 		}
 	}()
 
+	// Report the GPU interconnect topology used for placement
+	go func() {
+		err := monitor.StartTopologyReporter(dsn, *topologyIntervalFlag, *verboseFlag)
+		if err != nil {
+			log.Fatalf("GPU Topology Reporter failed: %v", err)
+		}
+	}()
+
+	// Start command processing
+	go func() {
+		err := commands.StartCommandMonitor(dsn, serverURL, sleepInterval)
+		if err != nil {
+			log.Fatalf("Command Monitor failed: %v", err)
+		}
+	}()
+
+	// Start GPU access enforcement (opt-in)
+	if *enforceAccessFlag {
+		enforcer := &access.Enforcer{
+			DevDir:  *devDirFlag,
+			ACL:     access.SetfaclACL{},
+			Verbose: *verboseFlag,
+		}
+		enforcer.AlwaysAllowed = splitUsers(*accessExemptFlag)
+
+		go func() {
+			err := access.StartAccessEnforcer(dsn, enforcer, sleepInterval)
+			if err != nil {
+				log.Fatalf("GPU Access Enforcer failed: %v", err)
+			}
+		}()
+	}
+
+	// Start account provisioning (opt-in)
+	if *provisionFlag {
+		go func() {
+			err := accounts.StartAccountProvisioner(dsn, provisioner, *provisionIntervalFlag)
+			if err != nil {
+				log.Fatalf("Account Provisioner failed: %v", err)
+			}
+		}()
+	}
+
 	// Wait for shutdown signal
 	<-stopChan
 	log.Println("Shutting down daemon...")
 }
+
+// splitUsers parses a comma-separated list of user names, trimming spaces and dropping empty entries
+func splitUsers(list string) []string {
+	var users []string
+	for _, user := range strings.Split(list, ",") {
+		if user = strings.TrimSpace(user); user != "" {
+			users = append(users, user)
+		}
+	}
+	return users
+}
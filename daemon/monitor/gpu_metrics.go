@@ -23,6 +23,8 @@ type GPU struct {
 	TemperatureCelsius float64      // Temperature in Celsius
 	UtilizationGPU     float64      // GPU utilization percentage
 	UtilizationMemory  float64      // Memory utilization percentage
+	ECCCorrected       *int         // Volatile corrected ECC errors, nil if ECC is unsupported or disabled
+	ECCUncorrected     *int         // Volatile uncorrected ECC errors, nil if ECC is unsupported or disabled
 	Processes          []GPUProcess // List of processes running on the GPU
 }
 
@@ -38,7 +40,8 @@ type GPUProcess struct {
 func GetGPUMetrics(verbose bool) ([]GPU, error) {
 	// Command to query GPU metrics
 	cmd := exec.Command("nvidia-smi",
-		"--query-gpu=index,name,uuid,memory.total,memory.used,memory.free,power.draw,power.limit,temperature.gpu,utilization.gpu,utilization.memory",
+		"--query-gpu=index,name,uuid,memory.total,memory.used,memory.free,power.draw,power.limit,temperature.gpu,utilization.gpu,utilization.memory,"+
+			"ecc.errors.corrected.volatile.total,ecc.errors.uncorrected.volatile.total",
 		"--format=csv,noheader,nounits")
 
 	var out bytes.Buffer
@@ -53,7 +56,7 @@ func GetGPUMetrics(verbose bool) ([]GPU, error) {
 	for scanner.Scan() {
 		line := scanner.Text()
 		fields := strings.Split(line, ",")
-		if len(fields) != 11 {
+		if len(fields) != 13 {
 			return nil, fmt.Errorf("unexpected nvidia-smi output format")
 		}
 
@@ -69,6 +72,8 @@ func GetGPUMetrics(verbose bool) ([]GPU, error) {
 		temperatureCelsius, _ := strconv.ParseFloat(strings.TrimSpace(fields[8]), 64)
 		utilizationGPU, _ := strconv.ParseFloat(strings.TrimSpace(fields[9]), 64)
 		utilizationMemory, _ := strconv.ParseFloat(strings.TrimSpace(fields[10]), 64)
+		eccCorrected := parseCount(fields[11])
+		eccUncorrected := parseCount(fields[12])
 
 		// Fetch processes running on this GPU
 		processes, err := GetGPUProcesses(index, verbose)
@@ -99,6 +104,8 @@ func GetGPUMetrics(verbose bool) ([]GPU, error) {
 			TemperatureCelsius: temperatureCelsius,
 			UtilizationGPU:     utilizationGPU,
 			UtilizationMemory:  utilizationMemory,
+			ECCCorrected:       eccCorrected,
+			ECCUncorrected:     eccUncorrected,
 			Processes:          processes,
 		})
 	}
@@ -110,6 +117,15 @@ func GetGPUMetrics(verbose bool) ([]GPU, error) {
 	return gpus, nil
 }
 
+// parseCount parses an nvidia-smi counter, returning nil for "[N/A]" and other non-numbers
+func parseCount(field string) *int {
+	count, err := strconv.Atoi(strings.TrimSpace(field))
+	if err != nil {
+		return nil
+	}
+	return &count
+}
+
 // GetGPUProcesses fetches the processes running on a specific GPU
 func GetGPUProcesses(gpuIndex int, verbose bool) ([]GPUProcess, error) {
 	// Command to query GPU processes
@@ -60,6 +60,11 @@ func StartGPUMonitor(dsn string, interval time.Duration, verbose bool) error {
 			log.Printf("Error updating database: %v", err)
 		}
 
+		// Flag users exceeding their VRAM slice of a shared GPU
+		if err := checkSlices(db, serverName, gpuUsages, verbose); err != nil {
+			log.Printf("Error checking VRAM slices: %v", err)
+		}
+
 		time.Sleep(interval)
 	}
 }
@@ -73,10 +78,10 @@ func updateDatabase(db *sql.DB, serverName string, gpuUsages []GPU, verbose bool
 		// Insert a new record into the real_time_usage table
 		_, err := db.Exec(`
 			INSERT INTO gpu_scheduler.real_time_usage (gpu_uuid, gpu_name, server_name, gpu_number, utilization, memory_utilization, memory_used_mb, 
-				memory_available_mb, power_usage_watts, temperature_celsius, reported_at)
-			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+				memory_available_mb, power_usage_watts, temperature_celsius, ecc_corrected_errors, ecc_uncorrected_errors, reported_at)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
 			gpu.UUID, gpu.Name, serverName, gpu.Index, gpu.UtilizationGPU, gpu.UtilizationMemory, gpu.MemoryUsedMB,
-			gpu.MemoryFreeMB, gpu.PowerDrawWatts, gpu.TemperatureCelsius, timestamp,
+			gpu.MemoryFreeMB, gpu.PowerDrawWatts, gpu.TemperatureCelsius, gpu.ECCCorrected, gpu.ECCUncorrected, timestamp,
 		)
 		if err != nil {
 			return fmt.Errorf("failed to insert real_time_usage for GPU %d: %v", gpu.Index, err)
@@ -0,0 +1,162 @@
+package monitor
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"time"
+)
+
+// sliceKey identifies a user on a shared GPU
+type sliceKey struct {
+	GPUUUID  string
+	UserName string
+}
+
+// sliceGrant is the VRAM a user's running slice requests grant on a shared GPU
+type sliceGrant struct {
+	RequestID int // The user's first slice on the GPU
+	VRAMMB    int // Summed over all of the user's slices on the GPU
+}
+
+// checkSlices flags users whose processes on a shared GPU use more memory than their
+// slices of it grant, as over_slice usage violations. A violation stays open while the
+// overrun is reported, records the user's peak total and is resolved once they are back
+// within their slice. Usage of shared GPUs without any slice is left to the server's
+// usage auditor.
+func checkSlices(db *sql.DB, serverName string, gpuUsages []GPU, verbose bool) error {
+	timestamp := time.Now()
+
+	grants, err := fetchSliceGrants(db, serverName)
+	if err != nil {
+		return fmt.Errorf("failed to fetch VRAM slices: %v", err)
+	}
+	open, err := fetchOpenOverruns(db, serverName)
+	if err != nil {
+		return fmt.Errorf("failed to fetch open slice overruns: %v", err)
+	}
+
+	for _, gpu := range gpuUsages {
+		// Total memory and largest process of each user on the GPU
+		used := make(map[string]int)
+		largest := make(map[string]GPUProcess)
+		for _, process := range gpu.Processes {
+			used[process.UserName] += process.UsedGPUMemoryMB
+			if process.UsedGPUMemoryMB >= largest[process.UserName].UsedGPUMemoryMB {
+				largest[process.UserName] = process
+			}
+		}
+
+		for userName, memoryMB := range used {
+			key := sliceKey{GPUUUID: gpu.UUID, UserName: userName}
+			grant, ok := grants[key]
+			if !ok || memoryMB <= grant.VRAMMB {
+				continue
+			}
+
+			if id, ok := open[key]; ok {
+				delete(open, key)
+				_, err := db.Exec(`
+					UPDATE gpu_scheduler.usage_violations
+					SET last_seen_at = ?, max_memory_mb = GREATEST(max_memory_mb, ?)
+					WHERE id = ?`,
+					timestamp, memoryMB, id,
+				)
+				if err != nil {
+					return fmt.Errorf("failed to update slice overrun %d: %v", id, err)
+				}
+				continue
+			}
+
+			process := largest[userName]
+			_, err := db.Exec(`
+				INSERT INTO gpu_scheduler.usage_violations (gpu_uuid, server_name, gpu_number, user_name, process_id,
+					process_name, kind, request_id, started_at, last_seen_at, max_memory_mb)
+				VALUES (?, ?, ?, ?, ?, ?, 'over_slice', ?, ?, ?, ?)`,
+				gpu.UUID, serverName, gpu.Index, userName, process.PID,
+				process.ProcessName, grant.RequestID, timestamp, timestamp, memoryMB,
+			)
+			if err != nil {
+				return fmt.Errorf("failed to record slice overrun on GPU %d: %v", gpu.Index, err)
+			}
+			log.Printf("User %s uses %d MB on GPU %d (%s) but their slice grants %d MB",
+				userName, memoryMB, gpu.Index, gpu.UUID, grant.VRAMMB)
+		}
+	}
+
+	// Whatever is still open is back within its slice, or gone
+	for key, id := range open {
+		_, err := db.Exec(`
+			UPDATE gpu_scheduler.usage_violations
+			SET resolved_at = ?
+			WHERE id = ?`,
+			timestamp, id,
+		)
+		if err != nil {
+			return fmt.Errorf("failed to resolve slice overrun %d: %v", id, err)
+		}
+		if verbose {
+			log.Printf("User %s is back within their slice of GPU %s", key.UserName, key.GPUUUID)
+		}
+	}
+
+	return nil
+}
+
+// fetchSliceGrants sums the VRAM granted to each user by the running slice requests on the node's shared GPUs
+func fetchSliceGrants(db *sql.DB, serverName string) (map[sliceKey]sliceGrant, error) {
+	rows, err := db.Query(`
+		SELECT a.gpu_uuid, u.user_name, MIN(r.id), SUM(r.vram_mb)
+		FROM gpu_scheduler.request_gpu_assignments a
+		JOIN gpu_scheduler.requests r ON r.id = a.request_id
+		JOIN gpu_scheduler.gpus g ON g.gpu_uuid = a.gpu_uuid
+		JOIN gpu_scheduler.users u ON u.id = r.user_id
+		WHERE g.server_name = ?
+			AND g.is_shared
+			AND r.vram_mb IS NOT NULL
+			AND r.status = 'in_progress'
+			AND (r.end_time IS NULL OR r.end_time > NOW())
+		GROUP BY a.gpu_uuid, u.user_name`,
+		serverName,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	grants := make(map[sliceKey]sliceGrant)
+	for rows.Next() {
+		var key sliceKey
+		var grant sliceGrant
+		if err := rows.Scan(&key.GPUUUID, &key.UserName, &grant.RequestID, &grant.VRAMMB); err != nil {
+			return nil, err
+		}
+		grants[key] = grant
+	}
+	return grants, rows.Err()
+}
+
+// fetchOpenOverruns returns the IDs of the node's ongoing over_slice violations
+func fetchOpenOverruns(db *sql.DB, serverName string) (map[sliceKey]int, error) {
+	rows, err := db.Query(`
+		SELECT id, gpu_uuid, user_name
+		FROM gpu_scheduler.usage_violations
+		WHERE server_name = ? AND kind = 'over_slice' AND resolved_at IS NULL`,
+		serverName,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	open := make(map[sliceKey]int)
+	for rows.Next() {
+		var id int
+		var key sliceKey
+		if err := rows.Scan(&id, &key.GPUUUID, &key.UserName); err != nil {
+			return nil, err
+		}
+		open[key] = id
+	}
+	return open, rows.Err()
+}
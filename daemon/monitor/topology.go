@@ -0,0 +1,146 @@
+package monitor
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"os/exec"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// GPULink is how two GPUs of a server are connected, as reported by `nvidia-smi topo -m`:
+// NV# (# bonded NVLinks), PIX (same PCIe switch), PXB (multiple PCIe switches),
+// PHB (PCIe host bridge), NODE (same NUMA node) or SYS (across NUMA nodes)
+type GPULink struct {
+	GPUA int
+	GPUB int
+	Link string
+}
+
+var ansiEscape = regexp.MustCompile(`\x1b\[[0-9;]*m`)
+
+// GetGPUTopology reads the GPU interconnect matrix using nvidia-smi
+func GetGPUTopology() ([]GPULink, error) {
+	out, err := exec.Command("nvidia-smi", "topo", "-m").Output()
+	if err != nil {
+		return nil, fmt.Errorf("failed to execute nvidia-smi topo: %v", err)
+	}
+	return parseTopology(string(out))
+}
+
+// parseTopology reads the GPU-to-GPU part of the `nvidia-smi topo -m` matrix. The
+// header names the GPU columns; NIC rows and the affinity columns are ignored.
+func parseTopology(output string) ([]GPULink, error) {
+	var columns []int
+	var links []GPULink
+	for _, line := range strings.Split(ansiEscape.ReplaceAllString(output, ""), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+
+		if columns == nil {
+			// The header is the first line, listing GPU0 GPU1 ... before the other columns
+			for _, field := range fields {
+				index, ok := gpuIndex(field)
+				if !ok {
+					break
+				}
+				columns = append(columns, index)
+			}
+			if columns == nil {
+				return nil, fmt.Errorf("unexpected nvidia-smi topo output format")
+			}
+			continue
+		}
+
+		row, ok := gpuIndex(fields[0])
+		if !ok {
+			continue
+		}
+		if len(fields) < len(columns)+1 {
+			return nil, fmt.Errorf("unexpected nvidia-smi topo row for GPU%d", row)
+		}
+		for i, column := range columns {
+			if column > row {
+				links = append(links, GPULink{GPUA: row, GPUB: column, Link: fields[i+1]})
+			}
+		}
+	}
+	return links, nil
+}
+
+// gpuIndex parses a "GPU3" matrix label
+func gpuIndex(label string) (int, bool) {
+	if !strings.HasPrefix(label, "GPU") {
+		return 0, false
+	}
+	index, err := strconv.Atoi(strings.TrimPrefix(label, "GPU"))
+	return index, err == nil
+}
+
+// StartTopologyReporter records this server's GPU topology in the gpu_topology table at
+// startup and then every interval, so hardware changes are picked up
+func StartTopologyReporter(dsn string, interval time.Duration, verbose bool) error {
+	// Connect to the database
+	db, err := sql.Open("mysql", dsn)
+	if err != nil {
+		log.Printf("Error connecting to database: %v", err)
+		return err
+	}
+	defer db.Close()
+
+	// Test the connection
+	err = db.Ping()
+	if err != nil {
+		log.Printf("Error pinging database: %v", err)
+		return err
+	}
+
+	serverName, err := GetServerName()
+	if err != nil {
+		log.Printf("Error getting server name: %v", err)
+		return err
+	}
+
+	for {
+		links, err := GetGPUTopology()
+		if err != nil {
+			log.Printf("Error fetching GPU topology: %v", err)
+		} else if err := updateTopology(db, serverName, links); err != nil {
+			log.Printf("Error updating GPU topology: %v", err)
+		} else if verbose {
+			log.Printf("Recorded %d GPU links for %s", len(links), serverName)
+		}
+
+		time.Sleep(interval)
+	}
+}
+
+// updateTopology replaces the server's rows in the gpu_topology table
+func updateTopology(db *sql.DB, serverName string, links []GPULink) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec("DELETE FROM gpu_scheduler.gpu_topology WHERE server_name = ?", serverName)
+	if err != nil {
+		return err
+	}
+	for _, link := range links {
+		_, err := tx.Exec(`
+			INSERT INTO gpu_scheduler.gpu_topology (server_name, gpu_a, gpu_b, link)
+			VALUES (?, ?, ?, ?)`,
+			serverName, link.GPUA, link.GPUB, link.Link,
+		)
+		if err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
@@ -12,6 +12,7 @@ import (
 )
 
 // ImportSurveyResponsesFromCSV downloads a CSV from a URL, parses it, and populates the survey_responses table.
+// The 13 survey columns may be followed by optional research group and data server columns.
 func ImportSurveyResponsesFromCSV(db *sql.DB, csvURL string, mode string, verbose bool) error {
 	// Step 1: Download the CSV file
 	resp, err := http.Get(csvURL)
@@ -74,8 +75,8 @@ func ImportSurveyResponsesFromCSV(db *sql.DB, csvURL string, mode string, verbos
 	insertStmt, err := tx.Prepare(`
         INSERT INTO survey_responses (
             email, full_name, desired_username, ssh_key, remark, user_type, lab_join_year, submitted_at, 
-            granted_access_at, revoked_access_at, revoke_scheduled_at, approving_party, revoking_party
-        ) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+            granted_access_at, revoked_access_at, revoke_scheduled_at, approving_party, revoking_party, research_group, data_server
+        ) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
         ON DUPLICATE KEY UPDATE
             full_name = VALUES(full_name),
             desired_username = VALUES(desired_username),
@@ -88,7 +89,9 @@ func ImportSurveyResponsesFromCSV(db *sql.DB, csvURL string, mode string, verbos
             revoked_access_at = VALUES(revoked_access_at),
             revoke_scheduled_at = VALUES(revoke_scheduled_at),
             approving_party = VALUES(approving_party),
-            revoking_party = VALUES(revoking_party)
+            revoking_party = VALUES(revoking_party),
+            research_group = VALUES(research_group),
+            data_server = VALUES(data_server)
     `)
 	if err != nil {
 		return fmt.Errorf("failed to prepare insert statement: %w", err)
@@ -159,9 +162,18 @@ func ImportSurveyResponsesFromCSV(db *sql.DB, csvURL string, mode string, verbos
 		approvingParty := normalizeValue(strings.TrimSpace(record[11]))
 		revokingParty := normalizeValue(strings.TrimSpace(record[12]))
 
+		// Optional trailing columns, absent from older exports
+		var researchGroup, dataServer interface{}
+		if len(record) > 13 {
+			researchGroup = normalizeValue(strings.TrimSpace(record[13]))
+		}
+		if len(record) > 14 {
+			dataServer = normalizeValue(strings.TrimSpace(record[14]))
+		}
+
 		// Insert or update survey response
 		_, err = insertStmt.Exec(email, fullName, desiredUsername, sshKey, remark, userType, labJoinYear, submittedAt,
-			grantedAccessAt, revokedAccessAt, revokeScheduledAt, approvingParty, revokingParty)
+			grantedAccessAt, revokedAccessAt, revokeScheduledAt, approvingParty, revokingParty, researchGroup, dataServer)
 		if err != nil {
 			return fmt.Errorf("failed to insert/update survey response on line %d: %w", i+1, err)
 		}
@@ -181,6 +193,7 @@ func ImportSurveyResponsesFromCSV(db *sql.DB, csvURL string, mode string, verbos
 }
 
 // UpdateUsersFromSurveyResponses updates the users table based on the latest survey responses.
+// A research group or data server left blank in the survey keeps the one already set on the user.
 func UpdateUsersFromSurveyResponses(db *sql.DB, verbose bool) error {
 	// Query to get the relevant values from survey_responses
 	query := `
@@ -205,6 +218,8 @@ func UpdateUsersFromSurveyResponses(db *sql.DB, verbose bool) error {
             approving_party,
             revoking_party,
             full_name AS name, -- Include the name field
+            research_group,
+            data_server,
             FALSE AS is_admin,
             TRUE AS is_whitelisted
         FROM ranked_responses
@@ -223,8 +238,8 @@ func UpdateUsersFromSurveyResponses(db *sql.DB, verbose bool) error {
         INSERT INTO users (
             email, user_name, password, comment, user_type, lab_join_year, access_survey_submitted_at, 
             access_survey_updated_at, granted_access_at, revoked_access_at, revoke_scheduled_at, 
-            approving_party, revoking_party, name, is_admin, is_whitelisted
-        ) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+            approving_party, revoking_party, name, research_group, data_server, is_admin, is_whitelisted
+        ) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
         ON DUPLICATE KEY UPDATE
             user_name = VALUES(user_name),
             password = VALUES(password),
@@ -239,6 +254,8 @@ func UpdateUsersFromSurveyResponses(db *sql.DB, verbose bool) error {
             approving_party = VALUES(approving_party),
             revoking_party = VALUES(revoking_party),
             name = VALUES(name),
+            research_group = COALESCE(VALUES(research_group), research_group),
+            data_server = COALESCE(VALUES(data_server), data_server),
             is_admin = VALUES(is_admin),
             is_whitelisted = VALUES(is_whitelisted)
     `)
@@ -250,17 +267,17 @@ func UpdateUsersFromSurveyResponses(db *sql.DB, verbose bool) error {
 	// Iterate through the query results and insert/update the users table
 	for rows.Next() {
 		var (
-			email, userName, password, comment, userType, approvingParty, revokingParty, name                   sql.NullString
-			labJoinYear                                                                                         sql.NullInt64
-			accessSurveySubmittedAt, accessSurveyUpdatedAt, grantedAccessAt, revokedAccessAt, revokeScheduledAt sql.NullTime
-			isAdmin, isWhitelisted                                                                              bool
+			email, userName, password, comment, userType, approvingParty, revokingParty, name, researchGroup, dataServer sql.NullString
+			labJoinYear                                                                                                  sql.NullInt64
+			accessSurveySubmittedAt, accessSurveyUpdatedAt, grantedAccessAt, revokedAccessAt, revokeScheduledAt          sql.NullTime
+			isAdmin, isWhitelisted                                                                                       bool
 		)
 
 		err := rows.Scan(
 			&email, &userName, &password, &comment, &userType, &labJoinYear,
 			&accessSurveySubmittedAt, &accessSurveyUpdatedAt, &grantedAccessAt,
 			&revokedAccessAt, &revokeScheduledAt, &approvingParty, &revokingParty,
-			&name, &isAdmin, &isWhitelisted,
+			&name, &researchGroup, &dataServer, &isAdmin, &isWhitelisted,
 		)
 		if err != nil {
 			return fmt.Errorf("failed to scan row: %w", err)
@@ -270,7 +287,7 @@ func UpdateUsersFromSurveyResponses(db *sql.DB, verbose bool) error {
 			email, userName, password, comment, userType, labJoinYear,
 			accessSurveySubmittedAt, accessSurveyUpdatedAt, grantedAccessAt,
 			revokedAccessAt, revokeScheduledAt, approvingParty, revokingParty,
-			name, isAdmin, isWhitelisted,
+			name, researchGroup, dataServer, isAdmin, isWhitelisted,
 		)
 		if err != nil {
 			return fmt.Errorf("failed to insert/update user: %w", err)
@@ -18,6 +18,8 @@ CREATE TABLE IF NOT EXISTS survey_responses (
     remark TEXT DEFAULT NULL, -- Remark or comment
     user_type ENUM('intern', 'masters', 'phd', 'postdoc', 'faculty', 'visitor') NOT NULL, -- User type
     lab_join_year YEAR DEFAULT NULL, -- Year the user joined the lab
+    research_group VARCHAR(255) DEFAULT NULL, -- Group sharing a fair-share allocation, if any
+    data_server VARCHAR(255) DEFAULT NULL, -- Server holding the user's datasets, preferred for placement
     submitted_at DATETIME DEFAULT CURRENT_TIMESTAMP, -- Timestamp for when the survey was submitted
     granted_access_at DATETIME DEFAULT NULL, -- Timestamp for when access was granted
     revoked_access_at DATETIME DEFAULT NULL, -- Timestamp for when access was revoked
@@ -41,6 +43,8 @@ CREATE TABLE IF NOT EXISTS users (
     comment TEXT DEFAULT NULL, -- Remark or comment
     user_type ENUM('intern', 'masters', 'phd', 'postdoc', 'faculty', 'visitor') NOT NULL, -- User type
     lab_join_year YEAR DEFAULT NULL, -- Year the user joined the lab
+    research_group VARCHAR(255) DEFAULT NULL, -- Group sharing a fair-share allocation, if any
+    data_server VARCHAR(255) DEFAULT NULL, -- Server holding the user's datasets, preferred for placement
     access_survey_submitted_at DATETIME DEFAULT NULL, -- Timestamp for the first survey submission
     access_survey_updated_at DATETIME DEFAULT NULL, -- Timestamp for the latest survey submission
     granted_access_at DATETIME DEFAULT NULL, -- When access was granted
@@ -66,6 +70,69 @@ CREATE TABLE IF NOT EXISTS user_ssh_keys (
     FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE -- Cascade delete when a user is deleted
 );
 
+-- Create Projects Table (collaborations sharing an allocation; requests can be charged to a project)
+SET FOREIGN_KEY_CHECKS = 0;
+DROP TABLE IF EXISTS projects;
+SET FOREIGN_KEY_CHECKS = 1;
+CREATE TABLE IF NOT EXISTS projects (
+    id INT AUTO_INCREMENT PRIMARY KEY,
+    name VARCHAR(255) NOT NULL UNIQUE,
+    description TEXT DEFAULT NULL,
+    max_concurrent_gpus INT DEFAULT NULL, -- GPUs held by the project's scheduled and in-progress requests, NULL for unlimited
+    max_weekly_gpu_hours INT DEFAULT NULL, -- num_gpus * requested_time over the project's requests created in the last 7 days
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Create Project Members Table (any member can request for the project and manage its reservations)
+SET FOREIGN_KEY_CHECKS = 0;
+DROP TABLE IF EXISTS project_members;
+SET FOREIGN_KEY_CHECKS = 1;
+CREATE TABLE IF NOT EXISTS project_members (
+    project_id INT NOT NULL,
+    user_id INT NOT NULL,
+    role ENUM('manager', 'member') NOT NULL DEFAULT 'member', -- Managers also add and remove members
+    added_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (project_id, user_id),
+    FOREIGN KEY (project_id) REFERENCES projects(id) ON DELETE CASCADE,
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+-- Create Recurring Bookings Table (series whose occurrences are materialized into requests ahead of time)
+SET FOREIGN_KEY_CHECKS = 0;
+DROP TABLE IF EXISTS recurring_bookings;
+SET FOREIGN_KEY_CHECKS = 1;
+CREATE TABLE IF NOT EXISTS recurring_bookings (
+    id INT AUTO_INCREMENT PRIMARY KEY,
+    user_id INT NOT NULL,
+    project_id INT DEFAULT NULL, -- Project the occurrences are charged to, NULL for personal bookings
+    gpu_size ENUM('small', 'medium', 'large') NOT NULL,
+    num_gpus INT NOT NULL,
+    priority ENUM('low', 'medium', 'high', 'emergency') NOT NULL,
+    server_name VARCHAR(255) DEFAULT NULL,
+    rrule VARCHAR(255) NOT NULL, -- RRULE subset, e.g., "FREQ=WEEKLY;INTERVAL=1;BYDAY=TH"
+    first_start DATETIME NOT NULL, -- Start of the first occurrence; later ones start at the same time of day
+    duration_minutes INT NOT NULL, -- Length of each occurrence
+    until_date DATE NOT NULL, -- Last day an occurrence may start on
+    cancelled_at DATETIME DEFAULT NULL, -- When the whole series was cancelled
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+    FOREIGN KEY (project_id) REFERENCES projects(id) ON DELETE SET NULL
+);
+
+-- Create Recurring Booking Exceptions Table (occurrences that are not materialized)
+SET FOREIGN_KEY_CHECKS = 0;
+DROP TABLE IF EXISTS recurring_booking_exceptions;
+SET FOREIGN_KEY_CHECKS = 1;
+CREATE TABLE IF NOT EXISTS recurring_booking_exceptions (
+    recurring_booking_id INT NOT NULL,
+    occurrence_date DATE NOT NULL,
+    reason ENUM('skipped', 'conflict') NOT NULL, -- Skipped by a user, or its GPUs were taken when it was materialized
+    note VARCHAR(255) NOT NULL DEFAULT '',
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (recurring_booking_id, occurrence_date),
+    FOREIGN KEY (recurring_booking_id) REFERENCES recurring_bookings(id) ON DELETE CASCADE
+);
+
 -- Create Requests Table
 SET FOREIGN_KEY_CHECKS = 0;
 DROP TABLE IF EXISTS requests;
@@ -78,11 +145,26 @@ CREATE TABLE IF NOT EXISTS requests (
     num_gpus INT NOT NULL,
     priority ENUM('low', 'medium', 'high', 'emergency') NOT NULL,
     server_name VARCHAR(255) DEFAULT NULL,
-    status ENUM('scheduled', 'in_progress', 'done', 'cancelled') DEFAULT 'scheduled', -- Updated ENUM values
-    start_time DATETIME DEFAULT NULL,
-    end_time DATETIME DEFAULT NULL,
+    status ENUM('pending_approval', 'scheduled', 'in_progress', 'done', 'cancelled', 'preempted', 'released', 'denied') DEFAULT 'scheduled', -- Updated ENUM values
+    status_reason VARCHAR(255) DEFAULT NULL, -- Why the request was preempted or otherwise ended early
+    start_time DATETIME DEFAULT NULL, -- When the request started, or the booked start for bookings
+    end_time DATETIME DEFAULT NULL, -- When the request ends (requested_time after start_time, or the booked end)
     created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
-    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+    projected_start DATETIME DEFAULT NULL, -- When the scheduler expects a blocked request to start
+    idle_warned_at DATETIME DEFAULT NULL, -- When the owner was warned that their unused GPUs will be released
+    end_warned_at DATETIME DEFAULT NULL, -- When the owner was offered an extension before end_time
+    approval_rule VARCHAR(255) DEFAULT NULL, -- The approval rule the request matched, NULL if it needed no approval
+    approval_decision ENUM('approved', 'denied') DEFAULT NULL,
+    decided_by INT DEFAULT NULL, -- The admin who approved or denied the request
+    decision_comment TEXT DEFAULT NULL,
+    decided_at DATETIME DEFAULT NULL,
+    project_id INT DEFAULT NULL, -- Project the request is charged to, NULL for personal requests
+    recurring_booking_id INT DEFAULT NULL, -- Series the booking is an occurrence of
+    vram_mb INT DEFAULT NULL, -- VRAM slice of a shared GPU (num_gpus is 1), NULL for whole GPUs
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+    FOREIGN KEY (project_id) REFERENCES projects(id) ON DELETE SET NULL,
+    FOREIGN KEY (recurring_booking_id) REFERENCES recurring_bookings(id) ON DELETE SET NULL,
+    FOREIGN KEY (decided_by) REFERENCES users(id) ON DELETE SET NULL
 );
 
 -- Create GPUs Table
@@ -97,6 +179,12 @@ CREATE TABLE IF NOT EXISTS gpus (
     vram_size_mb INT NOT NULL,
     gpu_serial CHAR(13) DEFAULT NULL UNIQUE, -- Made nullable while keeping the unique constraint
     gpu_bus_id CHAR(16) DEFAULT NULL UNIQUE, -- Made nullable while keeping the unique constraint
+    draining BOOLEAN NOT NULL DEFAULT FALSE, -- No new requests or bookings are placed on the GPU; running ones continue
+    is_shared BOOLEAN NOT NULL DEFAULT FALSE, -- Only VRAM slice requests are placed on the GPU, several at a time
+    health ENUM('healthy', 'degraded', 'quarantined') NOT NULL DEFAULT 'healthy', -- Derived from telemetry by the health monitor
+    health_reason VARCHAR(255) DEFAULT NULL, -- Why the GPU is not healthy
+    health_override ENUM('healthy', 'degraded', 'quarantined') DEFAULT NULL, -- Set by an admin; takes precedence over health
+    health_updated_at DATETIME DEFAULT NULL, -- When health last changed
     created_at DATETIME DEFAULT CURRENT_TIMESTAMP, -- Timestamp for row creation
     updated_at DATETIME DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP, -- Timestamp for last update
     UNIQUE (server_name, gpu_number) -- Retain unique constraint
@@ -138,6 +226,8 @@ CREATE TABLE IF NOT EXISTS real_time_usage (
     memory_available_mb INT NOT NULL, -- Memory available (in MB)
     power_usage_watts DECIMAL(5,2) NOT NULL, -- Power usage in watts (e.g., 150.75 for 150.75W)
     temperature_celsius DECIMAL(5,2) NOT NULL, -- GPU temperature in Celsius (e.g., 65.50 for 65.5°C)
+    ecc_corrected_errors INT DEFAULT NULL, -- Volatile corrected ECC errors (NULL if ECC is unsupported or disabled)
+    ecc_uncorrected_errors INT DEFAULT NULL, -- Volatile uncorrected ECC errors (NULL if ECC is unsupported or disabled)
     reported_at DATETIME NOT NULL, -- Manually provided timestamp for historical records
     PRIMARY KEY (gpu_uuid, reported_at), -- Composite primary key to allow multiple records per GPU
     UNIQUE (server_name, gpu_number, reported_at) -- Retain unique constraint with timestamp
@@ -208,3 +298,193 @@ CREATE TABLE IF NOT EXISTS gpu_processes_hourly_historical (
     FOREIGN KEY (user_name) REFERENCES users(user_name) ON DELETE CASCADE -- Added foreign key
 );
 
+-- Create Commands Table (work queued for the node daemons)
+SET FOREIGN_KEY_CHECKS = 0;
+DROP TABLE IF EXISTS commands;
+SET FOREIGN_KEY_CHECKS = 1;
+CREATE TABLE IF NOT EXISTS commands (
+    id INT AUTO_INCREMENT PRIMARY KEY,
+    target_node VARCHAR(255) NOT NULL, -- Hostname of the node that should run the command
+    command_type VARCHAR(64) NOT NULL, -- Kind of command (e.g., "kill", "notify")
+    parameters TEXT NOT NULL DEFAULT '', -- Command-specific parameters
+    status ENUM('pending', 'in_progress', 'completed', 'failed') DEFAULT 'pending',
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP, -- Timestamp for when the command was queued
+    updated_at DATETIME DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP, -- Timestamp for last status change
+    INDEX (target_node, status)
+);
+
+-- Create Usage Violations Table (processes running on GPUs without a matching reservation)
+SET FOREIGN_KEY_CHECKS = 0;
+DROP TABLE IF EXISTS usage_violations;
+SET FOREIGN_KEY_CHECKS = 1;
+CREATE TABLE IF NOT EXISTS usage_violations (
+    id INT AUTO_INCREMENT PRIMARY KEY,
+    gpu_uuid CHAR(40) NOT NULL, -- GPU the process ran on
+    server_name VARCHAR(255) NOT NULL,
+    gpu_number INT NOT NULL,
+    user_name VARCHAR(255) NOT NULL, -- Owner of the process
+    process_id INT NOT NULL,
+    process_name VARCHAR(255) NOT NULL,
+    kind ENUM('unreserved', 'expired', 'over_slice') NOT NULL, -- No reservation at all, running past end_time, or using more VRAM than the slice granted
+    request_id INT DEFAULT NULL, -- Reservation the process outlived (expired) or whose slice it exceeds (over_slice)
+    started_at DATETIME NOT NULL, -- First report showing the process
+    last_seen_at DATETIME NOT NULL, -- Latest report showing the process
+    max_memory_mb INT NOT NULL, -- Peak GPU memory used by the process (in MiB)
+    notified_at DATETIME DEFAULT NULL, -- When admins were notified
+    resolved_at DATETIME DEFAULT NULL, -- When the process was no longer reported
+    enforcement ENUM('notified', 'terminated', 'killed') DEFAULT NULL, -- Last step taken to stop an overrun (expired only)
+    enforced_at DATETIME DEFAULT NULL, -- When that step was taken
+    INDEX (resolved_at),
+    FOREIGN KEY (request_id) REFERENCES requests(id) ON DELETE SET NULL
+);
+
+-- Create GPU Size Classes Table (what requests.gpu_size means in terms of GPUs)
+SET FOREIGN_KEY_CHECKS = 0;
+DROP TABLE IF EXISTS gpu_size_classes;
+SET FOREIGN_KEY_CHECKS = 1;
+CREATE TABLE IF NOT EXISTS gpu_size_classes (
+    gpu_size ENUM('small', 'medium', 'large') PRIMARY KEY, -- Matches requests.gpu_size
+    min_vram_mb INT NOT NULL DEFAULT 0, -- Smallest acceptable gpus.vram_size_mb
+    allowed_models TEXT NOT NULL DEFAULT '', -- Comma-separated gpus.model_name values, empty for any model
+    allowed_servers TEXT NOT NULL DEFAULT '', -- Comma-separated server names, empty for any server
+    updated_at DATETIME DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP -- Timestamp for last update
+);
+
+-- Default size classes: any GPU, RTX 3090 and up, A6000 only
+INSERT INTO gpu_size_classes (gpu_size, min_vram_mb, allowed_models, allowed_servers) VALUES
+    ('small', 0, '', ''),
+    ('medium', 20000, '', ''),
+    ('large', 45000, '', '');
+
+
+-- Create Request Preemptions Table (running requests cut short for emergency requests)
+SET FOREIGN_KEY_CHECKS = 0;
+DROP TABLE IF EXISTS request_preemptions;
+SET FOREIGN_KEY_CHECKS = 1;
+CREATE TABLE IF NOT EXISTS request_preemptions (
+    id INT AUTO_INCREMENT PRIMARY KEY,
+    preempted_request_id INT NOT NULL, -- Running request giving up its GPUs
+    preempting_request_id INT NOT NULL, -- Emergency request taking them over
+    grace_ends_at DATETIME NOT NULL, -- When the preempted request's processes are stopped
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (preempted_request_id) REFERENCES requests(id) ON DELETE CASCADE,
+    FOREIGN KEY (preempting_request_id) REFERENCES requests(id) ON DELETE CASCADE
+);
+
+-- Create User Type Quotas Table (limits enforced when a request is created, NULL for unlimited)
+SET FOREIGN_KEY_CHECKS = 0;
+DROP TABLE IF EXISTS user_type_quotas;
+SET FOREIGN_KEY_CHECKS = 1;
+CREATE TABLE IF NOT EXISTS user_type_quotas (
+    user_type ENUM('intern', 'masters', 'phd', 'postdoc', 'faculty', 'visitor') PRIMARY KEY, -- Matches users.user_type
+    max_concurrent_gpus INT DEFAULT NULL, -- GPUs held by scheduled and in-progress requests
+    max_requested_hours INT DEFAULT NULL, -- requested_time of a single request
+    max_weekly_gpu_hours INT DEFAULT NULL, -- num_gpus * requested_time over requests created in the last 7 days
+    allowed_priorities TEXT DEFAULT NULL, -- Comma-separated priorities, NULL for any priority
+    updated_at DATETIME DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP -- Timestamp for last update
+);
+
+-- Default quotas per user type
+INSERT INTO user_type_quotas (user_type, max_concurrent_gpus, max_requested_hours, max_weekly_gpu_hours, allowed_priorities) VALUES
+    ('intern', 1, 24, 48, 'low,medium'),
+    ('masters', 2, 48, 168, 'low,medium'),
+    ('phd', 4, 72, 672, 'low,medium,high'),
+    ('postdoc', 4, 72, 672, 'low,medium,high'),
+    ('faculty', NULL, NULL, NULL, NULL),
+    ('visitor', 1, 24, 48, 'low,medium');
+
+-- Create User Quota Overrides Table (per-user exceptions, NULL columns fall back to the user type's quota)
+SET FOREIGN_KEY_CHECKS = 0;
+DROP TABLE IF EXISTS user_quota_overrides;
+SET FOREIGN_KEY_CHECKS = 1;
+CREATE TABLE IF NOT EXISTS user_quota_overrides (
+    user_id INT PRIMARY KEY,
+    max_concurrent_gpus INT DEFAULT NULL,
+    max_requested_hours INT DEFAULT NULL,
+    max_weekly_gpu_hours INT DEFAULT NULL,
+    allowed_priorities TEXT DEFAULT NULL, -- Comma-separated priorities
+    comment TEXT DEFAULT NULL, -- Why the override was granted
+    updated_at DATETIME DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP, -- Timestamp for last update
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+-- Create Maintenance Windows Table (servers or single GPUs out of service; bookings and the scheduler avoid them)
+SET FOREIGN_KEY_CHECKS = 0;
+DROP TABLE IF EXISTS maintenance_windows;
+SET FOREIGN_KEY_CHECKS = 1;
+CREATE TABLE IF NOT EXISTS maintenance_windows (
+    id INT AUTO_INCREMENT PRIMARY KEY,
+    server_name VARCHAR(255) NOT NULL,
+    gpu_uuid CHAR(40) DEFAULT NULL, -- A single GPU, or NULL for the whole server
+    start_time DATETIME NOT NULL,
+    end_time DATETIME NOT NULL,
+    reason VARCHAR(255) NOT NULL DEFAULT '', -- E.g., "driver upgrade"
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    INDEX (end_time)
+);
+
+-- Create GPU Topology Table (how the GPUs of each server are connected, from nvidia-smi topo -m)
+SET FOREIGN_KEY_CHECKS = 0;
+DROP TABLE IF EXISTS gpu_topology;
+SET FOREIGN_KEY_CHECKS = 1;
+CREATE TABLE IF NOT EXISTS gpu_topology (
+    server_name VARCHAR(255) NOT NULL,
+    gpu_a INT NOT NULL, -- Lower GPU number of the pair
+    gpu_b INT NOT NULL, -- Higher GPU number of the pair
+    link VARCHAR(16) NOT NULL, -- NV# (bonded NVLinks), PIX, PXB, PHB, NODE or SYS
+    updated_at DATETIME DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP, -- Timestamp for last report
+    PRIMARY KEY (server_name, gpu_a, gpu_b)
+);
+
+-- Create Request Extensions Table (running reservations extended by their owner)
+SET FOREIGN_KEY_CHECKS = 0;
+DROP TABLE IF EXISTS request_extensions;
+SET FOREIGN_KEY_CHECKS = 1;
+CREATE TABLE IF NOT EXISTS request_extensions (
+    id INT AUTO_INCREMENT PRIMARY KEY,
+    request_id INT NOT NULL,
+    hours INT NOT NULL, -- Hours added to the reservation
+    previous_end_time DATETIME NOT NULL,
+    new_end_time DATETIME NOT NULL,
+    extended_by INT NOT NULL, -- User who asked for the extension (the owner or an admin)
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (request_id) REFERENCES requests(id) ON DELETE CASCADE,
+    FOREIGN KEY (extended_by) REFERENCES users(id) ON DELETE CASCADE
+);
+
+-- Create Approval Rules Table (a rule matches when all of its non-NULL conditions hold; matching requests wait in pending_approval until an admin decides)
+SET FOREIGN_KEY_CHECKS = 0;
+DROP TABLE IF EXISTS approval_rules;
+SET FOREIGN_KEY_CHECKS = 1;
+CREATE TABLE IF NOT EXISTS approval_rules (
+    id INT AUTO_INCREMENT PRIMARY KEY,
+    description VARCHAR(255) NOT NULL, -- Shown to the requester, e.g., "more than 4 GPUs"
+    min_gpus INT DEFAULT NULL, -- Matches requests for at least this many GPUs
+    min_hours INT DEFAULT NULL, -- Matches requests for at least this many hours
+    priority ENUM('low', 'medium', 'high', 'emergency') DEFAULT NULL, -- Matches requests at this priority
+    user_type ENUM('intern', 'masters', 'phd', 'postdoc', 'faculty', 'visitor') DEFAULT NULL -- Only applies to this user type, NULL for everyone
+);
+
+-- Default approval rules
+INSERT INTO approval_rules (description, min_gpus, min_hours, priority) VALUES
+    ('more than 4 GPUs', 5, NULL, NULL),
+    ('more than 48 hours', NULL, 49, NULL),
+    ('emergency priority', NULL, NULL, 'emergency');
+
+-- Create Request Status History Table (one row per status change, including creation)
+SET FOREIGN_KEY_CHECKS = 0;
+DROP TABLE IF EXISTS request_status_history;
+SET FOREIGN_KEY_CHECKS = 1;
+CREATE TABLE IF NOT EXISTS request_status_history (
+    id INT AUTO_INCREMENT PRIMARY KEY,
+    request_id INT NOT NULL,
+    old_status ENUM('pending_approval', 'scheduled', 'in_progress', 'done', 'cancelled', 'preempted', 'released', 'denied') DEFAULT NULL, -- NULL when the request was created
+    new_status ENUM('pending_approval', 'scheduled', 'in_progress', 'done', 'cancelled', 'preempted', 'released', 'denied') NOT NULL,
+    changed_by INT DEFAULT NULL, -- User who made the change, NULL for automatic changes
+    changed_by_system VARCHAR(64) DEFAULT NULL, -- What made an automatic change, e.g., 'scheduler'
+    reason VARCHAR(255) DEFAULT NULL,
+    changed_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    INDEX (request_id),
+    FOREIGN KEY (request_id) REFERENCES requests(id) ON DELETE CASCADE,
+    FOREIGN KEY (changed_by) REFERENCES users(id) ON DELETE SET NULL
+);
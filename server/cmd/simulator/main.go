@@ -0,0 +1,221 @@
+// Command simulator replays GPU requests through the scheduler policy offline, on a
+// simulated clock, to compare policy configurations before changing them in production.
+//
+// The workload is either the requests created in a past window (read from the database)
+// or a synthetic one. Each policy from the -policies file is replayed on the same workload
+// and fleet, and the simulator reports wait times, utilization, fairness (the Jain index of
+// the fraction of their demand each user was served) and preemptions. Nothing is written
+// to the database. Examples:
+//
+//	simulator -from 2026-09-01 -to 2026-10-01 -policies policies.json
+//	simulator -fleet 4x8 -synthetic 500 -arrivals-per-hour 3 -policies policies.json
+//
+// with policies.json holding, e.g.:
+//
+//	[{"name": "no fair-share", "fair_share_half_life": "0s"},
+//	 {"name": "4 GPUs each", "max_concurrent_gpus": 4}]
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"math/rand"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/eduardo-escoto/gpu_request/server/internal/database"
+	"github.com/eduardo-escoto/gpu_request/server/internal/scheduler"
+)
+
+func main() {
+	// Define command-line flags
+	dsn := flag.String("dsn", "", "Database DSN (can also be set via the DATABASE_DSN environment variable)")
+	fromFlag := flag.String("from", "", "First day of the replayed window, YYYY-MM-DD (default: 30 days before -to)")
+	toFlag := flag.String("to", "", "Day after the replayed window, YYYY-MM-DD (default: today)")
+	drain := flag.Duration("drain", 7*24*time.Hour, "How long the replay continues after the window so the last requests can start")
+	policiesFile := flag.String("policies", "", "JSON file of policies to compare with the current configuration")
+	fleetFlag := flag.String("fleet", "", "Simulate <servers>x<gpus> identical servers instead of the fleet in the database")
+	synthetic := flag.Int("synthetic", 0, "Replay this many synthetic requests instead of the window's requests")
+	arrivals := flag.Float64("arrivals-per-hour", 2, "Synthetic requests arriving per hour")
+	meanHours := flag.Float64("mean-hours", 8, "Mean hours of synthetic requests")
+	maxGPUs := flag.Int("max-gpus", 8, "Most GPUs a synthetic request asks for")
+	emergencyFraction := flag.Float64("emergency-fraction", 0.02, "Fraction of synthetic requests at emergency priority")
+	numUsers := flag.Int("users", 20, "Synthetic users when the fleet is simulated too")
+	seed := flag.Int64("seed", 1, "Random seed of the synthetic workload")
+
+	// Parse command-line flags
+	flag.Parse()
+
+	if *dsn == "" {
+		*dsn = os.Getenv("DATABASE_DSN")
+	}
+	if *dsn == "" && (*fleetFlag == "" || *synthetic == 0) {
+		log.Fatalf("No DSN provided. Use the -dsn flag or set the DATABASE_DSN environment variable, or simulate both the fleet and the workload with -fleet and -synthetic.")
+	}
+
+	to := today()
+	if *toFlag != "" {
+		to = parseDay("-to", *toFlag)
+	}
+	from := to.AddDate(0, 0, -30)
+	if *fromFlag != "" {
+		from = parseDay("-from", *fromFlag)
+	}
+	if !from.Before(to) {
+		log.Fatalf("-from must be before -to")
+	}
+
+	// The current configuration, as the server reads it
+	base := scheduler.New(scheduler.SystemClock{})
+	base.PreemptionGrace = durationFromEnv("PREEMPTION_GRACE", base.PreemptionGrace)
+	base.FairShareHalfLife = durationFromEnv("FAIR_SHARE_HALF_LIFE", base.FairShareHalfLife)
+	base.FairShareByGroup = os.Getenv("FAIR_SHARE_BY_GROUP") == "true"
+	policies := []policy{{Name: "current"}}
+	if *policiesFile != "" {
+		loaded, err := loadPolicies(*policiesFile)
+		if err != nil {
+			log.Fatalf("Error: %v", err)
+		}
+		policies = append(policies, loaded...)
+	}
+
+	var store *scheduler.SQLStore
+	if *dsn != "" {
+		db, err := database.Connect(*dsn)
+		if err != nil {
+			log.Fatalf("Failed to connect to database: %v", err)
+		}
+		defer db.Close()
+		store = &scheduler.SQLStore{DB: db}
+	}
+
+	var fleet scheduler.State
+	if *fleetFlag != "" {
+		servers, gpus, err := parseFleet(*fleetFlag)
+		if err != nil {
+			log.Fatalf("Invalid -fleet: %v", err)
+		}
+		fleet = syntheticFleet(servers, gpus)
+		fleet.Users = syntheticUsers(*numUsers)
+	} else {
+		state, err := store.LoadState()
+		if err != nil {
+			log.Fatalf("Error loading the fleet: %v", err)
+		}
+		// Only the fleet is kept; today's maintenance does not apply to the replayed window
+		fleet = scheduler.State{GPUs: state.GPUs, SizeClasses: state.SizeClasses, Users: state.Users, Topology: state.Topology}
+	}
+
+	var workload []scheduler.Request
+	source := fmt.Sprintf("requests created %s to %s", from.Format(time.DateOnly), to.Format(time.DateOnly))
+	if *synthetic > 0 {
+		if len(fleet.Users) == 0 {
+			fleet.Users = syntheticUsers(*numUsers)
+		}
+		shape := workloadShape{
+			Requests:          *synthetic,
+			ArrivalsPerHour:   *arrivals,
+			MeanHours:         *meanHours,
+			MaxGPUs:           *maxGPUs,
+			EmergencyFraction: *emergencyFraction,
+		}
+		workload = syntheticWorkload(shape, fleet.Users, from, rand.New(rand.NewSource(*seed)))
+		to = workload[len(workload)-1].CreatedAt
+		source = fmt.Sprintf("%d synthetic requests (seed %d)", *synthetic, *seed)
+	} else {
+		var err error
+		workload, err = store.LoadWorkload(from, to)
+		if err != nil {
+			log.Fatalf("Error loading requests: %v", err)
+		}
+	}
+
+	// Requests that no longer fit the fleet would wait forever
+	valid := workload[:0]
+	for _, request := range workload {
+		if err := scheduler.ValidateRequest(request, fleet); err != nil {
+			log.Printf("Skipping request %d: %v", request.ID, err)
+			continue
+		}
+		valid = append(valid, request)
+	}
+	workload = valid
+	if len(workload) == 0 {
+		log.Fatalf("Nothing to replay: no %s fit the fleet", source)
+	}
+
+	fmt.Printf("Replaying %s on %d GPUs, %s to %s, then %s to drain\n\n",
+		source, len(fleet.GPUs), from.Format("2006-01-02 15:04"), to.Format("2006-01-02 15:04"), *drain)
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(w, "Policy\tRequests\tRejected\tStarted\tWaiting\tMean wait\tMedian wait\tP95 wait\tMax wait\tUtilization\tFairness\tPreemptions\t")
+	for _, p := range policies {
+		var admitted []scheduler.Request
+		for _, request := range workload {
+			if p.admits(request) {
+				admitted = append(admitted, request)
+			}
+		}
+		sched, state := p.apply(base, fleet)
+		summary := sched.Replay(state, admitted, from, to.Add(*drain)).Summarize(to)
+		fmt.Fprintf(w, "%s\t%d\t%d\t%d\t%d\t%s\t%s\t%s\t%s\t%.1f%%\t%.3f\t%d\t\n",
+			p.Name, len(workload), len(workload)-len(admitted), summary.Started, summary.Waiting,
+			hours(summary.MeanWait), hours(summary.MedianWait), hours(summary.P95Wait), hours(summary.MaxWait),
+			100*summary.Utilization, summary.Fairness, summary.Preemptions)
+	}
+	w.Flush()
+}
+
+// hours formats a wait in hours
+func hours(d time.Duration) string {
+	return fmt.Sprintf("%.1fh", d.Hours())
+}
+
+// parseDay parses a YYYY-MM-DD flag in the local time zone
+func parseDay(name, value string) time.Time {
+	day, err := time.ParseInLocation(time.DateOnly, value, time.Local)
+	if err != nil {
+		log.Fatalf("Invalid %s: %v", name, err)
+	}
+	return day
+}
+
+// parseFleet parses "<servers>x<gpus>"
+func parseFleet(value string) (int, int, error) {
+	servers, gpus, ok := strings.Cut(value, "x")
+	if !ok {
+		return 0, 0, fmt.Errorf("expected <servers>x<gpus>, e.g. 4x8")
+	}
+	s, err := strconv.Atoi(servers)
+	if err != nil || s < 1 {
+		return 0, 0, fmt.Errorf("invalid number of servers %q", servers)
+	}
+	g, err := strconv.Atoi(gpus)
+	if err != nil || g < 1 {
+		return 0, 0, fmt.Errorf("invalid number of GPUs per server %q", gpus)
+	}
+	return s, g, nil
+}
+
+// today returns midnight of the current day in the local time zone
+func today() time.Time {
+	now := time.Now()
+	return time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.Local)
+}
+
+// durationFromEnv parses a duration such as "30s" or "5m" from an environment variable, falling back to a default
+func durationFromEnv(name string, fallback time.Duration) time.Duration {
+	value := os.Getenv(name)
+	if value == "" {
+		return fallback
+	}
+	duration, err := time.ParseDuration(value)
+	if err != nil {
+		log.Fatalf("Invalid %s value: %v", name, err)
+	}
+	return duration
+}
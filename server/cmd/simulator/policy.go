@@ -0,0 +1,88 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/eduardo-escoto/gpu_request/server/internal/scheduler"
+)
+
+// policy is a named scheduler configuration from the -policies file. Unset fields keep
+// the values of the current configuration.
+type policy struct {
+	Name                  string    `json:"name"`
+	PreemptionGrace       *duration `json:"preemption_grace"`
+	PreemptablePriorities []string  `json:"preemptable_priorities"`
+	FairShareHalfLife     *duration `json:"fair_share_half_life"` // "0s" disables fair-share
+	FairShareByGroup      *bool     `json:"fair_share_by_group"`
+	MaxConcurrentGPUs     *int      `json:"max_concurrent_gpus"` // Replaces every user's limit, 0 for unlimited
+}
+
+// duration reads a JSON string such as "15m" or "168h"
+type duration time.Duration
+
+func (d *duration) UnmarshalJSON(data []byte) error {
+	var value string
+	if err := json.Unmarshal(data, &value); err != nil {
+		return err
+	}
+	parsed, err := time.ParseDuration(value)
+	if err != nil {
+		return err
+	}
+	*d = duration(parsed)
+	return nil
+}
+
+// loadPolicies reads a JSON array of policies
+func loadPolicies(path string) ([]policy, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var policies []policy
+	if err := json.Unmarshal(data, &policies); err != nil {
+		return nil, fmt.Errorf("invalid policies file %s: %w", path, err)
+	}
+	for i, p := range policies {
+		if p.Name == "" {
+			return nil, fmt.Errorf("policy %d of %s has no name", i+1, path)
+		}
+	}
+	return policies, nil
+}
+
+// admits reports whether the request is within the policy's per-user limit. Requests over
+// it are rejected when they are submitted rather than queued.
+func (p policy) admits(request scheduler.Request) bool {
+	return p.MaxConcurrentGPUs == nil || *p.MaxConcurrentGPUs == 0 || request.NumGPUs <= *p.MaxConcurrentGPUs || request.ProjectID != 0
+}
+
+// apply returns a copy of the scheduler and the fleet configured with the policy
+func (p policy) apply(base *scheduler.Scheduler, fleet scheduler.State) (*scheduler.Scheduler, scheduler.State) {
+	sched := *base
+	if p.PreemptionGrace != nil {
+		sched.PreemptionGrace = time.Duration(*p.PreemptionGrace)
+	}
+	if p.PreemptablePriorities != nil {
+		sched.PreemptablePriorities = p.PreemptablePriorities
+	}
+	if p.FairShareHalfLife != nil {
+		sched.FairShareHalfLife = time.Duration(*p.FairShareHalfLife)
+	}
+	if p.FairShareByGroup != nil {
+		sched.FairShareByGroup = *p.FairShareByGroup
+	}
+
+	if p.MaxConcurrentGPUs != nil {
+		users := make([]scheduler.User, len(fleet.Users))
+		for i, user := range fleet.Users {
+			user.MaxConcurrentGPUs = *p.MaxConcurrentGPUs
+			users[i] = user
+		}
+		fleet.Users = users
+	}
+	return &sched, fleet
+}
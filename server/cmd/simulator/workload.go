@@ -0,0 +1,104 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"time"
+
+	"github.com/eduardo-escoto/gpu_request/server/internal/scheduler"
+)
+
+// workloadShape describes a synthetic workload
+type workloadShape struct {
+	Requests          int
+	ArrivalsPerHour   float64
+	MeanHours         float64
+	MaxGPUs           int
+	EmergencyFraction float64
+}
+
+// weighted is a choice drawn with probability proportional to its weight
+type weighted[T any] struct {
+	value  T
+	weight int
+}
+
+// gpuCountWeights is how often requests ask for each number of GPUs
+var gpuCountWeights = []weighted[int]{{1, 50}, {2, 25}, {4, 15}, {8, 10}}
+
+// priorityWeights is how often non-emergency requests use each priority
+var priorityWeights = []weighted[string]{{"low", 25}, {"medium", 50}, {"high", 25}}
+
+// syntheticWorkload generates requests arriving as a Poisson process from start. Their
+// durations are exponential around the mean and users are drawn from a Zipf distribution,
+// so a few heavy users submit most of the work, as in the lab.
+func syntheticWorkload(shape workloadShape, users []scheduler.User, start time.Time, rng *rand.Rand) []scheduler.Request {
+	zipf := rand.NewZipf(rng, 1.2, 1, uint64(len(users)-1))
+
+	workload := make([]scheduler.Request, shape.Requests)
+	at := start
+	for i := range workload {
+		at = at.Add(time.Duration(rng.ExpFloat64() / shape.ArrivalsPerHour * float64(time.Hour)))
+		user := users[zipf.Uint64()]
+
+		priority := "emergency"
+		if rng.Float64() >= shape.EmergencyFraction {
+			priority = pickWeighted(rng, priorityWeights)
+		}
+
+		workload[i] = scheduler.Request{
+			ID:             i + 1,
+			UserName:       user.Name,
+			RequestedHours: max(int(math.Ceil(rng.ExpFloat64()*shape.MeanHours)), 1),
+			GPUSize:        scheduler.GPUSizes[rng.Intn(len(scheduler.GPUSizes))],
+			NumGPUs:        min(pickWeighted(rng, gpuCountWeights), shape.MaxGPUs),
+			Priority:       priority,
+			Status:         scheduler.StatusScheduled,
+			CreatedAt:      at,
+		}
+	}
+	return workload
+}
+
+// pickWeighted draws one of the choices
+func pickWeighted[T any](rng *rand.Rand, choices []weighted[T]) T {
+	total := 0
+	for _, choice := range choices {
+		total += choice.weight
+	}
+	n := rng.Intn(total)
+	for _, choice := range choices {
+		if n -= choice.weight; n < 0 {
+			return choice.value
+		}
+	}
+	return choices[len(choices)-1].value
+}
+
+// syntheticUsers names n users without limits
+func syntheticUsers(n int) []scheduler.User {
+	users := make([]scheduler.User, n)
+	for i := range users {
+		users[i] = scheduler.User{Name: fmt.Sprintf("user%02d", i+1)}
+	}
+	return users
+}
+
+// syntheticFleet builds servers identical servers of gpus GPUs each. Without size
+// classes every GPU satisfies every size.
+func syntheticFleet(servers, gpus int) scheduler.State {
+	var fleet scheduler.State
+	for s := 1; s <= servers; s++ {
+		for g := 0; g < gpus; g++ {
+			fleet.GPUs = append(fleet.GPUs, scheduler.GPU{
+				UUID:       fmt.Sprintf("GPU-SIM-%02d-%d", s, g),
+				ServerName: fmt.Sprintf("sim-%02d", s),
+				Number:     g,
+				ModelName:  "simulated",
+				VRAMMB:     81920,
+			})
+		}
+	}
+	return fleet
+}
@@ -24,8 +24,13 @@ func Connect(dataSourceName string) (*sql.DB, error) {
 	return db, nil
 }
 
+// Querier runs queries outside (*sql.DB) or inside (*sql.Tx) of a transaction
+type Querier interface {
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+}
+
 // QueryAndMap executes a query and maps the rows to a slice of a specific type using a mapper function.
-func QueryAndMap[T any](db *sql.DB, query string, args []interface{}, mapper func(*sql.Rows) (T, error)) ([]T, error) {
+func QueryAndMap[T any](db Querier, query string, args []interface{}, mapper func(*sql.Rows) (T, error)) ([]T, error) {
 	rows, err := db.Query(query, args...)
 	if err != nil {
 		return nil, err
@@ -17,3 +17,380 @@ func mapRealTimeUsage(rows *sql.Rows) (RealTimeUsage, error) {
 	)
 	return usage, err
 }
+
+func mapCommand(rows *sql.Rows) (Command, error) {
+	var cmd Command
+	err := rows.Scan(
+		&cmd.ID,
+		&cmd.TargetNode,
+		&cmd.CommandType,
+		&cmd.Parameters,
+		&cmd.Status,
+		&cmd.CreatedAt,
+	)
+	return cmd, err
+}
+
+func mapGPUProcess(rows *sql.Rows) (GPUProcess, error) {
+	var process GPUProcess
+	err := rows.Scan(
+		&process.GPUUUID,
+		&process.ServerName,
+		&process.GPUNumber,
+		&process.ProcessID,
+		&process.ProcessName,
+		&process.UserName,
+		&process.UsedGPUMemory,
+		&process.ReportedAt,
+	)
+	return process, err
+}
+
+func mapGPUReservation(rows *sql.Rows) (GPUReservation, error) {
+	var reservation GPUReservation
+	err := rows.Scan(
+		&reservation.RequestID,
+		&reservation.GPUUUID,
+		&reservation.UserName,
+		&reservation.Status,
+		&reservation.StartTime,
+		&reservation.EndTime,
+	)
+	return reservation, err
+}
+
+func mapUsageViolation(rows *sql.Rows) (UsageViolation, error) {
+	var violation UsageViolation
+	err := rows.Scan(
+		&violation.ID,
+		&violation.GPUUUID,
+		&violation.ServerName,
+		&violation.GPUNumber,
+		&violation.UserName,
+		&violation.ProcessID,
+		&violation.ProcessName,
+		&violation.Kind,
+		&violation.RequestID,
+		&violation.StartedAt,
+		&violation.LastSeenAt,
+		&violation.MaxMemoryMB,
+		&violation.NotifiedAt,
+		&violation.ResolvedAt,
+		&violation.Enforcement,
+		&violation.EnforcedAt,
+	)
+	return violation, err
+}
+
+func mapGPU(rows *sql.Rows) (GPU, error) {
+	var gpu GPU
+	err := rows.Scan(
+		&gpu.UUID,
+		&gpu.ServerName,
+		&gpu.GPUNumber,
+		&gpu.ModelName,
+		&gpu.VRAMSizeMB,
+		&gpu.Draining,
+		&gpu.Shared,
+		&gpu.Health,
+		&gpu.HealthReason,
+		&gpu.HealthOverride,
+		&gpu.HealthUpdatedAt,
+	)
+	return gpu, err
+}
+
+func mapGPUSample(rows *sql.Rows) (GPUSample, error) {
+	var sample GPUSample
+	err := rows.Scan(
+		&sample.GPUUUID,
+		&sample.ServerName,
+		&sample.GPUNumber,
+		&sample.ReportedAt,
+		&sample.TemperatureCelsius,
+		&sample.ECCCorrected,
+		&sample.ECCUncorrected,
+	)
+	return sample, err
+}
+
+func mapRequest(rows *sql.Rows) (Request, error) {
+	var request Request
+	err := rows.Scan(requestFields(&request)...)
+	return request, err
+}
+
+func mapApproval(rows *sql.Rows) (Approval, error) {
+	var approval Approval
+	err := rows.Scan(append(requestFields(&approval.Request), &approval.DeciderName)...)
+	return approval, err
+}
+
+// requestFields returns the scan destinations of requestColumns
+func requestFields(request *Request) []interface{} {
+	return []interface{}{
+		&request.ID,
+		&request.UserID,
+		&request.UserName,
+		&request.RequestedTime,
+		&request.GPUSize,
+		&request.NumGPUs,
+		&request.Priority,
+		&request.ServerName,
+		&request.Status,
+		&request.StartTime,
+		&request.EndTime,
+		&request.CreatedAt,
+		&request.ProjectedStart,
+		&request.IdleWarnedAt,
+		&request.EndWarnedAt,
+		&request.ApprovalRule,
+		&request.ApprovalDecision,
+		&request.DecidedBy,
+		&request.DecisionComment,
+		&request.DecidedAt,
+		&request.ProjectID,
+		&request.RecurringBookingID,
+		&request.VRAMMB,
+	}
+}
+
+func mapApprovalRule(rows *sql.Rows) (ApprovalRule, error) {
+	var rule ApprovalRule
+	err := rows.Scan(
+		&rule.ID,
+		&rule.Description,
+		&rule.MinGPUs,
+		&rule.MinHours,
+		&rule.Priority,
+		&rule.UserType,
+	)
+	return rule, err
+}
+
+func mapRequestID(rows *sql.Rows) (int, error) {
+	var id int
+	err := rows.Scan(&id)
+	return id, err
+}
+
+func mapMaintenanceWindow(rows *sql.Rows) (MaintenanceWindow, error) {
+	var window MaintenanceWindow
+	err := rows.Scan(
+		&window.ID,
+		&window.ServerName,
+		&window.GPUUUID,
+		&window.StartTime,
+		&window.EndTime,
+		&window.Reason,
+		&window.CreatedAt,
+	)
+	return window, err
+}
+
+func mapCalendarEntry(rows *sql.Rows) (CalendarEntry, error) {
+	var entry CalendarEntry
+	err := rows.Scan(
+		&entry.RequestID,
+		&entry.UserName,
+		&entry.Status,
+		&entry.Priority,
+		&entry.GPUUUID,
+		&entry.ServerName,
+		&entry.GPUNumber,
+		&entry.StartTime,
+		&entry.EndTime,
+		&entry.ProjectID,
+	)
+	return entry, err
+}
+
+func mapRequestAssignment(rows *sql.Rows) (RequestAssignment, error) {
+	var assignment RequestAssignment
+	err := rows.Scan(
+		&assignment.RequestID,
+		&assignment.GPUUUID,
+	)
+	return assignment, err
+}
+
+func mapSizeClass(rows *sql.Rows) (SizeClass, error) {
+	var class SizeClass
+	err := rows.Scan(
+		&class.GPUSize,
+		&class.MinVRAMMB,
+		&class.AllowedModels,
+		&class.AllowedServers,
+		&class.UpdatedAt,
+	)
+	return class, err
+}
+
+func mapQuota(rows *sql.Rows) (Quota, error) {
+	var quota Quota
+	err := rows.Scan(
+		&quota.UserType,
+		&quota.MaxConcurrentGPUs,
+		&quota.MaxRequestedHours,
+		&quota.MaxWeeklyGPUHours,
+		&quota.AllowedPriorities,
+	)
+	return quota, err
+}
+
+func mapRequestTotals(rows *sql.Rows) (RequestTotals, error) {
+	var totals RequestTotals
+	err := rows.Scan(
+		&totals.ActiveGPUs,
+		&totals.ReservedGPUHours,
+	)
+	return totals, err
+}
+
+func mapUser(rows *sql.Rows) (User, error) {
+	var user User
+	err := rows.Scan(
+		&user.ID,
+		&user.Email,
+		&user.UserName,
+		&user.Name,
+		&user.UserType,
+		&user.ResearchGroup,
+		&user.DataServer,
+		&user.IsAdmin,
+		&user.IsWhitelisted,
+	)
+	return user, err
+}
+
+func mapGPULink(rows *sql.Rows) (GPULink, error) {
+	var link GPULink
+	err := rows.Scan(
+		&link.ServerName,
+		&link.GPUA,
+		&link.GPUB,
+		&link.Link,
+	)
+	return link, err
+}
+
+// mapUserServer reads a (user_name, server_name) pair
+func mapUserServer(rows *sql.Rows) ([2]string, error) {
+	var pair [2]string
+	err := rows.Scan(&pair[0], &pair[1])
+	return pair, err
+}
+
+func mapUserLimit(rows *sql.Rows) (UserLimit, error) {
+	var limit UserLimit
+	err := rows.Scan(
+		&limit.UserName,
+		&limit.Limit,
+	)
+	return limit, err
+}
+
+func mapUsageHour(rows *sql.Rows) (UsageHour, error) {
+	var usage UsageHour
+	err := rows.Scan(
+		&usage.UserName,
+		&usage.Hour,
+		&usage.GPUCount,
+	)
+	return usage, err
+}
+
+func mapRequestPreemption(rows *sql.Rows) (RequestPreemption, error) {
+	var preemption RequestPreemption
+	err := rows.Scan(
+		&preemption.ID,
+		&preemption.PreemptedRequestID,
+		&preemption.PreemptingRequestID,
+		&preemption.GraceEndsAt,
+		&preemption.CreatedAt,
+	)
+	return preemption, err
+}
+
+func mapProject(rows *sql.Rows) (Project, error) {
+	var project Project
+	err := rows.Scan(
+		&project.ID,
+		&project.Name,
+		&project.Description,
+		&project.MaxConcurrentGPUs,
+		&project.MaxWeeklyGPUHours,
+		&project.Role,
+	)
+	return project, err
+}
+
+func mapProjectMember(rows *sql.Rows) (ProjectMember, error) {
+	var member ProjectMember
+	err := rows.Scan(
+		&member.ProjectID,
+		&member.UserID,
+		&member.UserName,
+		&member.Role,
+	)
+	return member, err
+}
+
+func mapProjectUsage(rows *sql.Rows) (ProjectUsage, error) {
+	var usage ProjectUsage
+	err := rows.Scan(
+		&usage.UserName,
+		&usage.Requests,
+		&usage.ReservedGPUHours,
+		&usage.HeldGPUHours,
+	)
+	return usage, err
+}
+
+func mapRecurringBooking(rows *sql.Rows) (RecurringBooking, error) {
+	var booking RecurringBooking
+	err := rows.Scan(
+		&booking.ID,
+		&booking.UserID,
+		&booking.UserName,
+		&booking.ProjectID,
+		&booking.GPUSize,
+		&booking.NumGPUs,
+		&booking.Priority,
+		&booking.ServerName,
+		&booking.RRule,
+		&booking.FirstStart,
+		&booking.DurationMinutes,
+		&booking.UntilDate,
+		&booking.CancelledAt,
+		&booking.CreatedAt,
+	)
+	return booking, err
+}
+
+func mapRecurringException(rows *sql.Rows) (RecurringException, error) {
+	var exception RecurringException
+	err := rows.Scan(
+		&exception.RecurringBookingID,
+		&exception.OccurrenceDate,
+		&exception.Reason,
+		&exception.Note,
+	)
+	return exception, err
+}
+
+func mapStatusHistory(rows *sql.Rows) (StatusHistory, error) {
+	var history StatusHistory
+	err := rows.Scan(
+		&history.ID,
+		&history.RequestID,
+		&history.OldStatus,
+		&history.NewStatus,
+		&history.ChangedBy,
+		&history.ChangedByName,
+		&history.ChangedBySystem,
+		&history.Reason,
+		&history.ChangedAt,
+	)
+	return history, err
+}
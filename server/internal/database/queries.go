@@ -2,9 +2,20 @@ package database
 
 import (
 	"database/sql"
+	"errors"
+	"fmt"
 	"log"
+	"slices"
+	"strings"
+	"time"
 )
 
+// ErrBookingConflict is returned when a booking's GPUs were taken while it was being made
+var ErrBookingConflict = errors.New("the selected GPUs were booked by someone else in the meantime")
+
+// ErrGPUInUse is returned when a GPU cannot be shared because whole-GPU requests hold or booked it
+var ErrGPUInUse = errors.New("the GPU is held or booked by whole-GPU requests")
+
 func QueryRealTimeUsage(db *sql.DB) ([]RealTimeUsage, error) {
 	query := `
         SELECT server_name, gpu_number, utilization, memory_utilization, memory_used_mb,
@@ -20,3 +31,1546 @@ func QueryRealTimeUsage(db *sql.DB) ([]RealTimeUsage, error) {
 
 	return usages, nil
 }
+
+// QueryPendingCommands returns the commands still waiting to be picked up by a node, oldest first
+func QueryPendingCommands(db *sql.DB, nodeName string) ([]Command, error) {
+	query := `
+        SELECT id, target_node, command_type, parameters, status, created_at
+        FROM gpu_scheduler.commands
+        WHERE target_node = ? AND status = 'pending'
+        ORDER BY id;
+    `
+
+	commands, err := QueryAndMap(db, query, []interface{}{nodeName}, mapCommand)
+	if err != nil {
+		log.Printf("Error querying pending commands for %s: %v", nodeName, err)
+		return nil, err
+	}
+
+	return commands, nil
+}
+
+// InsertCommand queues a new command for a node and returns its ID
+func InsertCommand(db *sql.DB, nodeName, commandType, parameters string) (int64, error) {
+	result, err := db.Exec(`
+        INSERT INTO gpu_scheduler.commands (target_node, command_type, parameters)
+        VALUES (?, ?, ?)`,
+		nodeName, commandType, parameters,
+	)
+	if err != nil {
+		log.Printf("Error inserting command for %s: %v", nodeName, err)
+		return 0, err
+	}
+
+	return result.LastInsertId()
+}
+
+// QueryLatestGPUProcesses returns the processes from the most recent report of every GPU reported since the given time
+func QueryLatestGPUProcesses(db *sql.DB, since time.Time) ([]GPUProcess, error) {
+	query := `
+        SELECT p.gpu_uuid, u.server_name, u.gpu_number, p.process_id, p.process_name, p.user_name,
+               p.used_gpu_memory, p.reported_at
+        FROM gpu_scheduler.gpu_processes p
+        JOIN gpu_scheduler.real_time_usage u ON u.gpu_uuid = p.gpu_uuid AND u.reported_at = p.reported_at
+        JOIN (
+            SELECT gpu_uuid, MAX(reported_at) AS reported_at
+            FROM gpu_scheduler.real_time_usage
+            WHERE reported_at >= ?
+            GROUP BY gpu_uuid
+        ) latest ON latest.gpu_uuid = p.gpu_uuid AND latest.reported_at = p.reported_at;
+    `
+
+	processes, err := QueryAndMap(db, query, []interface{}{since}, mapGPUProcess)
+	if err != nil {
+		log.Printf("Error querying latest GPU processes: %v", err)
+		return nil, err
+	}
+
+	return processes, nil
+}
+
+// QueryGPUReservations returns the GPU assignments of requests that are running or ended after the
+// given time, whether they finished, were preempted or were released early
+func QueryGPUReservations(db *sql.DB, endedAfter time.Time) ([]GPUReservation, error) {
+	query := `
+        SELECT r.id, a.gpu_uuid, u.user_name, r.status, r.start_time, r.end_time
+        FROM gpu_scheduler.request_gpu_assignments a
+        JOIN gpu_scheduler.requests r ON r.id = a.request_id
+        JOIN gpu_scheduler.users u ON u.id = r.user_id
+        WHERE r.status = 'in_progress'
+           OR (r.status IN ('done', 'preempted', 'released') AND r.end_time >= ?);
+    `
+
+	reservations, err := QueryAndMap(db, query, []interface{}{endedAfter}, mapGPUReservation)
+	if err != nil {
+		log.Printf("Error querying GPU reservations: %v", err)
+		return nil, err
+	}
+
+	return reservations, nil
+}
+
+const usageViolationColumns = `
+        id, gpu_uuid, server_name, gpu_number, user_name, process_id, process_name, kind, request_id,
+        started_at, last_seen_at, max_memory_mb, notified_at, resolved_at, enforcement, enforced_at`
+
+// QueryOpenViolations returns the usage violations that are still ongoing
+func QueryOpenViolations(db *sql.DB) ([]UsageViolation, error) {
+	query := `SELECT ` + usageViolationColumns + `
+        FROM gpu_scheduler.usage_violations
+        WHERE resolved_at IS NULL
+        ORDER BY started_at;
+    `
+
+	violations, err := QueryAndMap(db, query, nil, mapUsageViolation)
+	if err != nil {
+		log.Printf("Error querying open usage violations: %v", err)
+		return nil, err
+	}
+
+	return violations, nil
+}
+
+// QueryRecentViolations returns open violations and those resolved since the given time, newest first
+func QueryRecentViolations(db *sql.DB, since time.Time) ([]UsageViolation, error) {
+	query := `SELECT ` + usageViolationColumns + `
+        FROM gpu_scheduler.usage_violations
+        WHERE resolved_at IS NULL OR resolved_at >= ?
+        ORDER BY resolved_at IS NULL DESC, started_at DESC;
+    `
+
+	violations, err := QueryAndMap(db, query, []interface{}{since}, mapUsageViolation)
+	if err != nil {
+		log.Printf("Error querying recent usage violations: %v", err)
+		return nil, err
+	}
+
+	return violations, nil
+}
+
+// InsertViolation records a newly detected usage violation and returns its ID
+func InsertViolation(db *sql.DB, v UsageViolation) (int64, error) {
+	result, err := db.Exec(`
+        INSERT INTO gpu_scheduler.usage_violations (gpu_uuid, server_name, gpu_number, user_name, process_id,
+            process_name, kind, request_id, started_at, last_seen_at, max_memory_mb)
+        VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		v.GPUUUID, v.ServerName, v.GPUNumber, v.UserName, v.ProcessID,
+		v.ProcessName, v.Kind, v.RequestID, v.StartedAt, v.LastSeenAt, v.MaxMemoryMB,
+	)
+	if err != nil {
+		log.Printf("Error inserting usage violation: %v", err)
+		return 0, err
+	}
+
+	return result.LastInsertId()
+}
+
+// UpdateViolationSeen extends an open violation with a new observation
+func UpdateViolationSeen(db *sql.DB, id int, seenAt time.Time, memoryMB int) error {
+	_, err := db.Exec(`
+        UPDATE gpu_scheduler.usage_violations
+        SET last_seen_at = ?, max_memory_mb = GREATEST(max_memory_mb, ?)
+        WHERE id = ?`,
+		seenAt, memoryMB, id,
+	)
+	if err != nil {
+		log.Printf("Error updating usage violation %d: %v", id, err)
+	}
+	return err
+}
+
+// ResolveViolation closes a violation whose process is gone
+func ResolveViolation(db *sql.DB, id int, resolvedAt time.Time) error {
+	_, err := db.Exec(`UPDATE gpu_scheduler.usage_violations SET resolved_at = ? WHERE id = ?`, resolvedAt, id)
+	if err != nil {
+		log.Printf("Error resolving usage violation %d: %v", id, err)
+	}
+	return err
+}
+
+// MarkViolationNotified records that admins were told about a violation
+func MarkViolationNotified(db *sql.DB, id int, notifiedAt time.Time) error {
+	_, err := db.Exec(`UPDATE gpu_scheduler.usage_violations SET notified_at = ? WHERE id = ?`, notifiedAt, id)
+	if err != nil {
+		log.Printf("Error marking usage violation %d as notified: %v", id, err)
+	}
+	return err
+}
+
+// MarkViolationEnforced records the latest step taken to stop an overrunning process
+func MarkViolationEnforced(db *sql.DB, id int, step string, enforcedAt time.Time) error {
+	_, err := db.Exec(`UPDATE gpu_scheduler.usage_violations SET enforcement = ?, enforced_at = ? WHERE id = ?`, step, enforcedAt, id)
+	if err != nil {
+		log.Printf("Error marking usage violation %d as %s: %v", id, step, err)
+	}
+	return err
+}
+
+// QueryAdminEmails returns the email addresses of all admins
+func QueryAdminEmails(db *sql.DB) ([]string, error) {
+	query := `SELECT email FROM gpu_scheduler.users WHERE is_admin = TRUE;`
+
+	emails, err := QueryAndMap(db, query, nil, func(rows *sql.Rows) (string, error) {
+		var email string
+		err := rows.Scan(&email)
+		return email, err
+	})
+	if err != nil {
+		log.Printf("Error querying admin emails: %v", err)
+		return nil, err
+	}
+
+	return emails, nil
+}
+
+// QueryGPUs returns every GPU known to the scheduler
+func QueryGPUs(db *sql.DB) ([]GPU, error) {
+	query := `
+        SELECT gpu_uuid, server_name, gpu_number, model_name, vram_size_mb, draining, is_shared,
+               health, health_reason, health_override, health_updated_at
+        FROM gpu_scheduler.gpus
+        ORDER BY server_name, gpu_number;
+    `
+
+	gpus, err := QueryAndMap(db, query, nil, mapGPU)
+	if err != nil {
+		log.Printf("Error querying GPUs: %v", err)
+		return nil, err
+	}
+
+	return gpus, nil
+}
+
+const requestColumns = `
+        r.id, r.user_id, u.user_name, r.requested_time, r.gpu_size, r.num_gpus, r.priority,
+        r.server_name, r.status, r.start_time, r.end_time, r.created_at, r.projected_start,
+        r.idle_warned_at, r.end_warned_at, r.approval_rule, r.approval_decision, r.decided_by,
+        r.decision_comment, r.decided_at, r.project_id, r.recurring_booking_id, r.vram_mb`
+
+// QueryActiveRequests returns the requests that are queued or running
+func QueryActiveRequests(db *sql.DB) ([]Request, error) {
+	query := `SELECT ` + requestColumns + `
+        FROM gpu_scheduler.requests r
+        JOIN gpu_scheduler.users u ON u.id = r.user_id
+        WHERE r.status IN ('scheduled', 'in_progress')
+        ORDER BY r.id;
+    `
+
+	requests, err := QueryAndMap(db, query, nil, mapRequest)
+	if err != nil {
+		log.Printf("Error querying active requests: %v", err)
+		return nil, err
+	}
+
+	return requests, nil
+}
+
+// QueryRequestsCreated returns the requests created in [from, to) that were queued or
+// booked, leaving out those cancelled or held for an approval that never came
+func QueryRequestsCreated(db *sql.DB, from, to time.Time) ([]Request, error) {
+	query := `SELECT ` + requestColumns + `
+        FROM gpu_scheduler.requests r
+        JOIN gpu_scheduler.users u ON u.id = r.user_id
+        WHERE r.created_at >= ? AND r.created_at < ?
+          AND r.status NOT IN ('pending_approval', 'denied', 'cancelled')
+        ORDER BY r.created_at, r.id;
+    `
+
+	requests, err := QueryAndMap(db, query, []interface{}{from, to}, mapRequest)
+	if err != nil {
+		log.Printf("Error querying requests created since %s: %v", from, err)
+		return nil, err
+	}
+
+	return requests, nil
+}
+
+// QueryActiveAssignments returns the GPU assignments of queued and running requests
+func QueryActiveAssignments(db *sql.DB) ([]RequestAssignment, error) {
+	query := `
+        SELECT a.request_id, a.gpu_uuid
+        FROM gpu_scheduler.request_gpu_assignments a
+        JOIN gpu_scheduler.requests r ON r.id = a.request_id
+        WHERE r.status IN ('scheduled', 'in_progress')
+        ORDER BY a.request_id, a.gpu_uuid;
+    `
+
+	assignments, err := QueryAndMap(db, query, nil, mapRequestAssignment)
+	if err != nil {
+		log.Printf("Error querying active assignments: %v", err)
+		return nil, err
+	}
+
+	return assignments, nil
+}
+
+// changeStatus moves a request to a new status within tx if it is in one of the given
+// statuses, also applying the assignments in set (e.g. ", end_time = ?") with args, and
+// records the transition in request_status_history. Every status change of an existing
+// request goes through here so that its history is complete.
+func changeStatus(tx *sql.Tx, requestID int, from []string, to string, change StatusChange, set string, args ...interface{}) error {
+	var status string
+	err := tx.QueryRow(`SELECT status FROM gpu_scheduler.requests WHERE id = ? FOR UPDATE`, requestID).Scan(&status)
+	if errors.Is(err, sql.ErrNoRows) {
+		return fmt.Errorf("request %d does not exist", requestID)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to lock request %d: %w", requestID, err)
+	}
+	if !slices.Contains(from, status) {
+		// Changed elsewhere since the caller looked at it
+		return fmt.Errorf("request %d is %s, no longer %s", requestID, status, strings.Join(from, " or "))
+	}
+
+	args = append(append([]interface{}{to}, args...), requestID)
+	if _, err := tx.Exec(`UPDATE gpu_scheduler.requests SET status = ?`+set+` WHERE id = ?`, args...); err != nil {
+		return fmt.Errorf("failed to move request %d to %s: %w", requestID, to, err)
+	}
+	return insertStatusHistory(tx, requestID, sql.NullString{String: status, Valid: true}, to, change)
+}
+
+// setStatus runs changeStatus in a transaction of its own
+func setStatus(db *sql.DB, requestID int, from []string, to string, change StatusChange, set string, args ...interface{}) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if err := changeStatus(tx, requestID, from, to, change, set, args...); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// insertStatusHistory records a status change of a request; oldStatus is NULL when the request is created
+func insertStatusHistory(tx *sql.Tx, requestID int, oldStatus sql.NullString, newStatus string, change StatusChange) error {
+	_, err := tx.Exec(`
+        INSERT INTO gpu_scheduler.request_status_history (request_id, old_status, new_status, changed_by, changed_by_system, reason)
+        VALUES (?, ?, ?, ?, ?, ?)`,
+		requestID, oldStatus, newStatus,
+		sql.NullInt64{Int64: int64(change.UserID), Valid: change.UserID != 0},
+		sql.NullString{String: change.System, Valid: change.System != ""},
+		sql.NullString{String: change.Reason, Valid: change.Reason != ""},
+	)
+	if err != nil {
+		return fmt.Errorf("failed to record status change of request %d: %w", requestID, err)
+	}
+	return nil
+}
+
+// QueryStatusHistory returns the status changes of a request, oldest first
+func QueryStatusHistory(db *sql.DB, requestID int) ([]StatusHistory, error) {
+	query := `
+        SELECT h.id, h.request_id, h.old_status, h.new_status, h.changed_by, u.user_name, h.changed_by_system, h.reason, h.changed_at
+        FROM gpu_scheduler.request_status_history h
+        LEFT JOIN gpu_scheduler.users u ON u.id = h.changed_by
+        WHERE h.request_id = ?
+        ORDER BY h.changed_at, h.id;
+    `
+
+	history, err := QueryAndMap(db, query, []interface{}{requestID}, mapStatusHistory)
+	if err != nil {
+		log.Printf("Error querying status history of request %d: %v", requestID, err)
+		return nil, err
+	}
+
+	return history, nil
+}
+
+// StartRequest assigns GPUs to a scheduled request and moves it to in_progress
+func StartRequest(db *sql.DB, requestID int, gpuUUIDs []string, startTime, endTime time.Time, change StatusChange) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	err = changeStatus(tx, requestID, []string{"scheduled"}, "in_progress", change, ", start_time = ?, end_time = ?", startTime, endTime)
+	if err != nil {
+		return err
+	}
+
+	for _, uuid := range gpuUUIDs {
+		_, err := tx.Exec(`INSERT INTO gpu_scheduler.request_gpu_assignments (request_id, gpu_uuid) VALUES (?, ?)`, requestID, uuid)
+		if err != nil {
+			return fmt.Errorf("failed to assign GPU %s to request %d: %w", uuid, requestID, err)
+		}
+	}
+
+	return tx.Commit()
+}
+
+// StartBooking moves a booked request to in_progress; its GPUs were assigned when it was booked
+func StartBooking(db *sql.DB, requestID int, change StatusChange) error {
+	return setStatus(db, requestID, []string{"scheduled"}, "in_progress", change, "")
+}
+
+// CancelRequest cancels a request that has not started yet
+func CancelRequest(db *sql.DB, requestID int, change StatusChange) error {
+	return setStatus(db, requestID, []string{"pending_approval", "scheduled"}, "cancelled", change, "")
+}
+
+// SetProjectedStart records when a blocked request is expected to start
+func SetProjectedStart(db *sql.DB, requestID int, projectedStart time.Time) error {
+	_, err := db.Exec(`
+        UPDATE gpu_scheduler.requests
+        SET projected_start = ?
+        WHERE id = ? AND status = 'scheduled'`,
+		projectedStart, requestID,
+	)
+	if err != nil {
+		log.Printf("Error setting projected start of request %d: %v", requestID, err)
+	}
+	return err
+}
+
+// FinishRequest marks a running request as done
+func FinishRequest(db *sql.DB, requestID int, change StatusChange) error {
+	return setStatus(db, requestID, []string{"in_progress"}, "done", change, "")
+}
+
+// QueryUsedRequests returns the IDs of running requests whose owner has had a process on
+// one of their GPUs since the request started
+func QueryUsedRequests(db *sql.DB) (map[int]bool, error) {
+	query := `
+        SELECT DISTINCT r.id
+        FROM gpu_scheduler.requests r
+        JOIN gpu_scheduler.users u ON u.id = r.user_id
+        JOIN gpu_scheduler.request_gpu_assignments a ON a.request_id = r.id
+        WHERE r.status = 'in_progress'
+          AND EXISTS (
+              SELECT 1
+              FROM gpu_scheduler.gpu_processes p
+              WHERE p.gpu_uuid = a.gpu_uuid AND p.user_name = u.user_name AND p.reported_at >= r.start_time
+          );
+    `
+
+	ids, err := QueryAndMap(db, query, nil, mapRequestID)
+	if err != nil {
+		log.Printf("Error querying used requests: %v", err)
+		return nil, err
+	}
+
+	used := make(map[int]bool)
+	for _, id := range ids {
+		used[id] = true
+	}
+	return used, nil
+}
+
+// MarkIdleWarned records that the owner of an unused running request was warned
+func MarkIdleWarned(db *sql.DB, requestID int, warnedAt time.Time) error {
+	_, err := db.Exec(`
+        UPDATE gpu_scheduler.requests
+        SET idle_warned_at = ?
+        WHERE id = ? AND status = 'in_progress'`,
+		warnedAt, requestID,
+	)
+	if err != nil {
+		log.Printf("Error marking request %d as warned: %v", requestID, err)
+	}
+	return err
+}
+
+// ReleaseRequest ends a running request that was never used and frees its GPUs. The
+// change's reason is also kept as the request's status_reason.
+func ReleaseRequest(db *sql.DB, requestID int, releasedAt time.Time, change StatusChange) error {
+	return setStatus(db, requestID, []string{"in_progress"}, "released", change, ", end_time = ?, status_reason = ?", releasedAt, change.Reason)
+}
+
+// MarkEndWarned records that the owner of a running request was offered an extension
+func MarkEndWarned(db *sql.DB, requestID int, warnedAt time.Time) error {
+	_, err := db.Exec(`
+        UPDATE gpu_scheduler.requests
+        SET end_warned_at = ?
+        WHERE id = ? AND status = 'in_progress'`,
+		warnedAt, requestID,
+	)
+	if err != nil {
+		log.Printf("Error marking request %d as warned of its end: %v", requestID, err)
+	}
+	return err
+}
+
+// ExtendRequest moves the end_time of a running request by the given number of hours,
+// unless another request was booked on its GPUs before the new end in the meantime
+func ExtendRequest(db *sql.DB, requestID, hours, extendedBy int) (time.Time, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return time.Time{}, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	var endTime time.Time
+	var vramMB sql.NullInt64
+	err = tx.QueryRow(`
+        SELECT end_time, vram_mb
+        FROM gpu_scheduler.requests
+        WHERE id = ? AND status = 'in_progress'
+        FOR UPDATE`,
+		requestID,
+	).Scan(&endTime, &vramMB)
+	if errors.Is(err, sql.ErrNoRows) {
+		return time.Time{}, fmt.Errorf("request %d is no longer in progress", requestID)
+	}
+	if err != nil {
+		return time.Time{}, fmt.Errorf("failed to lock request %d: %w", requestID, err)
+	}
+	newEnd := endTime.Add(time.Duration(hours) * time.Hour)
+
+	conflictQuery := `
+        SELECT COUNT(*)
+        FROM gpu_scheduler.request_gpu_assignments a
+        JOIN gpu_scheduler.requests r ON r.id = a.request_id
+        JOIN gpu_scheduler.request_gpu_assignments mine ON mine.gpu_uuid = a.gpu_uuid AND mine.request_id = ?
+        WHERE r.id <> ? AND r.status IN ('scheduled', 'in_progress')
+          AND r.start_time < ? AND r.end_time > ?`
+	if vramMB.Valid {
+		// Slices share their GPU with other slices; only whole-GPU requests stand in the way
+		conflictQuery += `
+          AND r.vram_mb IS NULL`
+	}
+	var conflicts int
+	err = tx.QueryRow(conflictQuery+`
+        FOR UPDATE`,
+		requestID, requestID, newEnd, endTime,
+	).Scan(&conflicts)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("failed to check extension conflicts: %w", err)
+	}
+	if conflicts > 0 {
+		return time.Time{}, ErrBookingConflict
+	}
+
+	_, err = tx.Exec(`
+        UPDATE gpu_scheduler.requests
+        SET end_time = ?, requested_time = requested_time + ?, end_warned_at = NULL
+        WHERE id = ?`,
+		newEnd, hours, requestID,
+	)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("failed to extend request %d: %w", requestID, err)
+	}
+	_, err = tx.Exec(`
+        INSERT INTO gpu_scheduler.request_extensions (request_id, hours, previous_end_time, new_end_time, extended_by)
+        VALUES (?, ?, ?, ?, ?)`,
+		requestID, hours, endTime, newEnd, extendedBy,
+	)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("failed to record extension of request %d: %w", requestID, err)
+	}
+
+	return newEnd, tx.Commit()
+}
+
+// QuerySizeClasses returns the size class definitions for every gpu_size
+func QuerySizeClasses(db *sql.DB) ([]SizeClass, error) {
+	query := `
+        SELECT gpu_size, min_vram_mb, allowed_models, allowed_servers, updated_at
+        FROM gpu_scheduler.gpu_size_classes
+        ORDER BY gpu_size;
+    `
+
+	classes, err := QueryAndMap(db, query, nil, mapSizeClass)
+	if err != nil {
+		log.Printf("Error querying size classes: %v", err)
+		return nil, err
+	}
+
+	return classes, nil
+}
+
+// UpsertSizeClass creates or replaces the definition of a gpu_size
+func UpsertSizeClass(db *sql.DB, class SizeClass) error {
+	_, err := db.Exec(`
+        INSERT INTO gpu_scheduler.gpu_size_classes (gpu_size, min_vram_mb, allowed_models, allowed_servers)
+        VALUES (?, ?, ?, ?)
+        ON DUPLICATE KEY UPDATE
+            min_vram_mb = VALUES(min_vram_mb),
+            allowed_models = VALUES(allowed_models),
+            allowed_servers = VALUES(allowed_servers)`,
+		class.GPUSize, class.MinVRAMMB, class.AllowedModels, class.AllowedServers,
+	)
+	if err != nil {
+		log.Printf("Error updating size class %s: %v", class.GPUSize, err)
+	}
+	return err
+}
+
+// QueryUser looks up a user by user name or email, returning nil if there is no such user
+func QueryUser(db *sql.DB, identity string) (*User, error) {
+	query := `
+        SELECT id, email, user_name, name, user_type, COALESCE(research_group, ''), COALESCE(data_server, ''), is_admin, is_whitelisted
+        FROM gpu_scheduler.users
+        WHERE user_name = ? OR email = ?;
+    `
+
+	users, err := QueryAndMap(db, query, []interface{}{identity, identity}, mapUser)
+	if err != nil {
+		log.Printf("Error querying user %s: %v", identity, err)
+		return nil, err
+	}
+	if len(users) == 0 {
+		return nil, nil
+	}
+
+	return &users[0], nil
+}
+
+// QueryWhitelistedUsers returns the users allowed on the GPU servers
+func QueryWhitelistedUsers(db *sql.DB) ([]User, error) {
+	query := `
+        SELECT id, email, user_name, name, user_type, COALESCE(research_group, ''), COALESCE(data_server, ''), is_admin, is_whitelisted
+        FROM gpu_scheduler.users
+        WHERE is_whitelisted
+        ORDER BY user_name;
+    `
+
+	users, err := QueryAndMap(db, query, nil, mapUser)
+	if err != nil {
+		log.Printf("Error querying whitelisted users: %v", err)
+		return nil, err
+	}
+
+	return users, nil
+}
+
+// QueryHourlyGPUUsage returns, per user and hour since the given time, the number of GPUs
+// the user had processes on. Hours already rolled up into gpu_processes_hourly_historical
+// and raw gpu_processes reports are merged, so an hour is never counted twice.
+func QueryHourlyGPUUsage(db *sql.DB, since time.Time) ([]UsageHour, error) {
+	query := `
+        SELECT user_name, hour, COUNT(*)
+        FROM (
+            SELECT user_name, gpu_uuid, TIMESTAMP(DATE_FORMAT(reported_at, '%Y-%m-%d %H:00:00')) AS hour
+            FROM gpu_scheduler.gpu_processes
+            WHERE reported_at >= ?
+            UNION
+            SELECT user_name, gpu_uuid, reported_at AS hour
+            FROM gpu_scheduler.gpu_processes_hourly_historical
+            WHERE reported_at >= ?
+        ) AS usage_hours
+        GROUP BY user_name, hour;
+    `
+
+	usage, err := QueryAndMap(db, query, []interface{}{since, since}, mapUsageHour)
+	if err != nil {
+		log.Printf("Error querying hourly GPU usage: %v", err)
+		return nil, err
+	}
+
+	return usage, nil
+}
+
+// QueryUserQuota returns the effective quota of a user, combining their overrides with their user type's quota
+func QueryUserQuota(db Querier, userID int) (Quota, error) {
+	query := `
+        SELECT u.user_type,
+               COALESCE(o.max_concurrent_gpus, t.max_concurrent_gpus),
+               COALESCE(o.max_requested_hours, t.max_requested_hours),
+               COALESCE(o.max_weekly_gpu_hours, t.max_weekly_gpu_hours),
+               COALESCE(o.allowed_priorities, t.allowed_priorities)
+        FROM gpu_scheduler.users u
+        LEFT JOIN gpu_scheduler.user_type_quotas t ON t.user_type = u.user_type
+        LEFT JOIN gpu_scheduler.user_quota_overrides o ON o.user_id = u.id
+        WHERE u.id = ?;
+    `
+
+	quotas, err := QueryAndMap(db, query, []interface{}{userID}, mapQuota)
+	if err != nil {
+		log.Printf("Error querying quota of user %d: %v", userID, err)
+		return Quota{}, err
+	}
+	if len(quotas) == 0 {
+		return Quota{}, fmt.Errorf("no user with id %d", userID)
+	}
+
+	return quotas[0], nil
+}
+
+// QueryConcurrentGPULimits returns the max_concurrent_gpus quota of every user that has one
+func QueryConcurrentGPULimits(db *sql.DB) (map[string]int, error) {
+	query := `
+        SELECT u.user_name, COALESCE(o.max_concurrent_gpus, t.max_concurrent_gpus)
+        FROM gpu_scheduler.users u
+        LEFT JOIN gpu_scheduler.user_type_quotas t ON t.user_type = u.user_type
+        LEFT JOIN gpu_scheduler.user_quota_overrides o ON o.user_id = u.id
+        WHERE COALESCE(o.max_concurrent_gpus, t.max_concurrent_gpus) IS NOT NULL;
+    `
+
+	rows, err := QueryAndMap(db, query, nil, mapUserLimit)
+	if err != nil {
+		log.Printf("Error querying concurrent GPU limits: %v", err)
+		return nil, err
+	}
+
+	limits := make(map[string]int)
+	for _, row := range rows {
+		limits[row.UserName] = row.Limit
+	}
+	return limits, nil
+}
+
+// QueryRequestTotals sums a user's active personal requests and the GPU-hours they requested since the given time
+func QueryRequestTotals(db Querier, userID int, since time.Time) (RequestTotals, error) {
+	query := `
+        SELECT COALESCE(SUM(CASE WHEN status IN ('pending_approval', 'scheduled', 'in_progress') THEN num_gpus ELSE 0 END), 0),
+               COALESCE(SUM(CASE WHEN created_at >= ? AND status NOT IN ('cancelled', 'denied') THEN num_gpus * requested_time ELSE 0 END), 0)
+        FROM gpu_scheduler.requests
+        WHERE user_id = ? AND project_id IS NULL;
+    `
+
+	totals, err := QueryAndMap(db, query, []interface{}{since, userID}, mapRequestTotals)
+	if err != nil {
+		log.Printf("Error querying request totals of user %d: %v", userID, err)
+		return RequestTotals{}, err
+	}
+
+	return totals[0], nil
+}
+
+// QueryGPUTopology returns the links between the GPUs of every server
+func QueryGPUTopology(db *sql.DB) ([]GPULink, error) {
+	query := `
+        SELECT server_name, gpu_a, gpu_b, link
+        FROM gpu_scheduler.gpu_topology;
+    `
+
+	links, err := QueryAndMap(db, query, nil, mapGPULink)
+	if err != nil {
+		log.Printf("Error querying GPU topology: %v", err)
+		return nil, err
+	}
+
+	return links, nil
+}
+
+// QueryLastServers returns, per user, the server of their most recent request started since the given time
+func QueryLastServers(db *sql.DB, since time.Time) (map[string]string, error) {
+	query := `
+        SELECT u.user_name, g.server_name
+        FROM gpu_scheduler.requests r
+        JOIN gpu_scheduler.users u ON u.id = r.user_id
+        JOIN gpu_scheduler.request_gpu_assignments a ON a.request_id = r.id
+        JOIN gpu_scheduler.gpus g ON g.gpu_uuid = a.gpu_uuid
+        WHERE r.status IN ('in_progress', 'done', 'preempted') AND r.start_time >= ?
+        ORDER BY r.start_time DESC, g.server_name;
+    `
+
+	pairs, err := QueryAndMap(db, query, []interface{}{since}, mapUserServer)
+	if err != nil {
+		log.Printf("Error querying last servers: %v", err)
+		return nil, err
+	}
+
+	servers := make(map[string]string)
+	for _, pair := range pairs {
+		if _, ok := servers[pair[0]]; !ok {
+			servers[pair[0]] = pair[1]
+		}
+	}
+	return servers, nil
+}
+
+// checkLocked locks the rows of the request's owner and project, then runs check (when not
+// nil) in the transaction. Concurrent inserts for the same user or project wait for the
+// lock, so check (e.g., a quota check) sees the requests they committed.
+func checkLocked(tx *sql.Tx, request Request, check func(tx *sql.Tx) error) error {
+	if check == nil {
+		return nil
+	}
+	var id int
+	err := tx.QueryRow(`SELECT id FROM gpu_scheduler.users WHERE id = ? FOR UPDATE`, request.UserID).Scan(&id)
+	if err != nil {
+		return fmt.Errorf("failed to lock user %d: %w", request.UserID, err)
+	}
+	if request.ProjectID.Valid {
+		err := tx.QueryRow(`SELECT id FROM gpu_scheduler.projects WHERE id = ? FOR UPDATE`, request.ProjectID.Int64).Scan(&id)
+		if err != nil {
+			return fmt.Errorf("failed to lock project %d: %w", request.ProjectID.Int64, err)
+		}
+	}
+	return check(tx)
+}
+
+// InsertRequest queues a new request, or holds it for approval if it matched an approval
+// rule, records its creation in its history and returns its ID. check (when not nil) runs
+// in the same transaction, after locking the user, and cancels the insert if it fails.
+func InsertRequest(db *sql.DB, request Request, change StatusChange, check func(tx *sql.Tx) error) (int64, error) {
+	status := "scheduled"
+	if request.ApprovalRule.Valid {
+		status = "pending_approval"
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return 0, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if err := checkLocked(tx, request, check); err != nil {
+		return 0, err
+	}
+
+	result, err := tx.Exec(`
+        INSERT INTO gpu_scheduler.requests (user_id, requested_time, gpu_size, num_gpus, priority, server_name, status, approval_rule, project_id, vram_mb)
+        VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		request.UserID, request.RequestedTime, request.GPUSize, request.NumGPUs, request.Priority, request.ServerName,
+		status, request.ApprovalRule, request.ProjectID, request.VRAMMB,
+	)
+	if err != nil {
+		log.Printf("Error inserting request for user %d: %v", request.UserID, err)
+		return 0, err
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+
+	if err := insertStatusHistory(tx, int(id), sql.NullString{}, status, change); err != nil {
+		return 0, err
+	}
+	return id, tx.Commit()
+}
+
+// QueryRequest returns a single request, or nil if there is no such request
+func QueryRequest(db *sql.DB, requestID int) (*Request, error) {
+	query := `SELECT ` + requestColumns + `
+        FROM gpu_scheduler.requests r
+        JOIN gpu_scheduler.users u ON u.id = r.user_id
+        WHERE r.id = ?;
+    `
+
+	requests, err := QueryAndMap(db, query, []interface{}{requestID}, mapRequest)
+	if err != nil {
+		log.Printf("Error querying request %d: %v", requestID, err)
+		return nil, err
+	}
+	if len(requests) == 0 {
+		return nil, nil
+	}
+
+	return &requests[0], nil
+}
+
+// InsertBooking stores a request for a fixed window together with its GPU assignments.
+// The GPUs are checked again inside the transaction so concurrent bookings cannot overlap,
+// and so is check (when not nil), as in InsertRequest.
+func InsertBooking(db *sql.DB, request Request, gpuUUIDs []string, change StatusChange, check func(tx *sql.Tx) error) (int64, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return 0, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if err := checkLocked(tx, request, check); err != nil {
+		return 0, err
+	}
+
+	placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(gpuUUIDs)), ", ")
+	args := []interface{}{request.EndTime.Time, request.StartTime.Time}
+	for _, uuid := range gpuUUIDs {
+		args = append(args, uuid)
+	}
+	var conflicts int
+	err = tx.QueryRow(`
+        SELECT COUNT(*)
+        FROM gpu_scheduler.request_gpu_assignments a
+        JOIN gpu_scheduler.requests r ON r.id = a.request_id
+        WHERE r.status IN ('scheduled', 'in_progress')
+          AND r.start_time < ? AND r.end_time > ?
+          AND a.gpu_uuid IN (`+placeholders+`)
+        FOR UPDATE`,
+		args...,
+	).Scan(&conflicts)
+	if err != nil {
+		return 0, fmt.Errorf("failed to check booking conflicts: %w", err)
+	}
+	if conflicts > 0 {
+		return 0, ErrBookingConflict
+	}
+
+	result, err := tx.Exec(`
+        INSERT INTO gpu_scheduler.requests (user_id, requested_time, gpu_size, num_gpus, priority, server_name, status, start_time, end_time,
+                                            project_id, recurring_booking_id)
+        VALUES (?, ?, ?, ?, ?, ?, 'scheduled', ?, ?, ?, ?)`,
+		request.UserID, request.RequestedTime, request.GPUSize, request.NumGPUs, request.Priority, request.ServerName,
+		request.StartTime, request.EndTime, request.ProjectID, request.RecurringBookingID,
+	)
+	if err != nil {
+		return 0, fmt.Errorf("failed to insert booking for user %d: %w", request.UserID, err)
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+
+	for _, uuid := range gpuUUIDs {
+		_, err := tx.Exec(`INSERT INTO gpu_scheduler.request_gpu_assignments (request_id, gpu_uuid) VALUES (?, ?)`, id, uuid)
+		if err != nil {
+			return 0, fmt.Errorf("failed to assign GPU %s to booking %d: %w", uuid, id, err)
+		}
+	}
+
+	if err := insertStatusHistory(tx, int(id), sql.NullString{}, "scheduled", change); err != nil {
+		return 0, err
+	}
+	return id, tx.Commit()
+}
+
+// QueryCalendarEntries returns the GPUs of booked and running requests overlapping [from, to)
+func QueryCalendarEntries(db *sql.DB, from, to time.Time) ([]CalendarEntry, error) {
+	query := `
+        SELECT r.id, u.user_name, r.status, r.priority, g.gpu_uuid, g.server_name, g.gpu_number, r.start_time, r.end_time, r.project_id
+        FROM gpu_scheduler.requests r
+        JOIN gpu_scheduler.users u ON u.id = r.user_id
+        JOIN gpu_scheduler.request_gpu_assignments a ON a.request_id = r.id
+        JOIN gpu_scheduler.gpus g ON g.gpu_uuid = a.gpu_uuid
+        WHERE r.status IN ('scheduled', 'in_progress')
+          AND r.start_time < ? AND r.end_time > ?
+        ORDER BY r.start_time, g.server_name, g.gpu_number;
+    `
+
+	entries, err := QueryAndMap(db, query, []interface{}{to, from}, mapCalendarEntry)
+	if err != nil {
+		log.Printf("Error querying calendar entries: %v", err)
+		return nil, err
+	}
+
+	return entries, nil
+}
+
+// QueryMaintenanceWindows returns the maintenance windows ending after the given time
+func QueryMaintenanceWindows(db *sql.DB, endedAfter time.Time) ([]MaintenanceWindow, error) {
+	query := `
+        SELECT id, server_name, gpu_uuid, start_time, end_time, reason, created_at
+        FROM gpu_scheduler.maintenance_windows
+        WHERE end_time > ?
+        ORDER BY start_time;
+    `
+
+	windows, err := QueryAndMap(db, query, []interface{}{endedAfter}, mapMaintenanceWindow)
+	if err != nil {
+		log.Printf("Error querying maintenance windows: %v", err)
+		return nil, err
+	}
+
+	return windows, nil
+}
+
+// InsertMaintenanceWindow schedules maintenance of a server, or one of its GPUs, and returns its ID
+func InsertMaintenanceWindow(db *sql.DB, window MaintenanceWindow) (int64, error) {
+	result, err := db.Exec(`
+        INSERT INTO gpu_scheduler.maintenance_windows (server_name, gpu_uuid, start_time, end_time, reason)
+        VALUES (?, ?, ?, ?, ?)`,
+		window.ServerName, window.GPUUUID, window.StartTime, window.EndTime, window.Reason,
+	)
+	if err != nil {
+		log.Printf("Error inserting maintenance window for %s: %v", window.ServerName, err)
+		return 0, err
+	}
+
+	return result.LastInsertId()
+}
+
+// DeleteMaintenanceWindow removes a maintenance window, e.g. once it is cancelled
+func DeleteMaintenanceWindow(db *sql.DB, id int) error {
+	_, err := db.Exec(`DELETE FROM gpu_scheduler.maintenance_windows WHERE id = ?`, id)
+	if err != nil {
+		log.Printf("Error deleting maintenance window %d: %v", id, err)
+	}
+	return err
+}
+
+// SetDraining starts or stops draining a server's GPUs, or a single one of them if gpuUUID is not empty
+func SetDraining(db *sql.DB, serverName, gpuUUID string, draining bool) error {
+	_, err := db.Exec(`
+        UPDATE gpu_scheduler.gpus
+        SET draining = ?
+        WHERE server_name = ? AND (? = '' OR gpu_uuid = ?)`,
+		draining, serverName, gpuUUID, gpuUUID,
+	)
+	if err != nil {
+		log.Printf("Error setting draining of %s: %v", serverName, err)
+	}
+	return err
+}
+
+// SetGPUShared marks a GPU as shared between VRAM slice requests, or returns it to whole-GPU
+// requests. A GPU that running or booked whole-GPU requests are assigned to cannot be shared
+// (ErrGPUInUse), as slices would be placed next to them.
+func SetGPUShared(db *sql.DB, gpuUUID string, shared bool) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if shared {
+		var holders int
+		err = tx.QueryRow(`
+            SELECT COUNT(*)
+            FROM gpu_scheduler.request_gpu_assignments a
+            JOIN gpu_scheduler.requests r ON r.id = a.request_id
+            WHERE a.gpu_uuid = ? AND r.vram_mb IS NULL
+              AND r.status IN ('scheduled', 'in_progress')
+              AND (r.end_time IS NULL OR r.end_time > NOW())
+            FOR UPDATE`,
+			gpuUUID,
+		).Scan(&holders)
+		if err != nil {
+			log.Printf("Error checking whole-GPU requests on GPU %s: %v", gpuUUID, err)
+			return err
+		}
+		if holders > 0 {
+			return ErrGPUInUse
+		}
+	}
+
+	_, err = tx.Exec(`
+        UPDATE gpu_scheduler.gpus
+        SET is_shared = ?
+        WHERE gpu_uuid = ?`,
+		shared, gpuUUID,
+	)
+	if err != nil {
+		log.Printf("Error setting sharing of GPU %s: %v", gpuUUID, err)
+		return err
+	}
+	return tx.Commit()
+}
+
+// QueryLatestGPUSamples returns the most recent telemetry of every GPU in the gpus table
+func QueryLatestGPUSamples(db *sql.DB) ([]GPUSample, error) {
+	query := `
+        SELECT g.gpu_uuid, g.server_name, g.gpu_number, u.reported_at, u.temperature_celsius,
+               u.ecc_corrected_errors, u.ecc_uncorrected_errors
+        FROM gpu_scheduler.gpus g
+        LEFT JOIN (
+            SELECT gpu_uuid, MAX(reported_at) AS reported_at
+            FROM gpu_scheduler.real_time_usage
+            GROUP BY gpu_uuid
+        ) latest ON latest.gpu_uuid = g.gpu_uuid
+        LEFT JOIN gpu_scheduler.real_time_usage u ON u.gpu_uuid = latest.gpu_uuid AND u.reported_at = latest.reported_at
+        ORDER BY g.server_name, g.gpu_number;
+    `
+
+	samples, err := QueryAndMap(db, query, nil, mapGPUSample)
+	if err != nil {
+		log.Printf("Error querying latest GPU samples: %v", err)
+		return nil, err
+	}
+
+	return samples, nil
+}
+
+// SetGPUHealth records the health derived from a GPU's telemetry
+func SetGPUHealth(db *sql.DB, gpuUUID, health, reason string, updatedAt time.Time) error {
+	_, err := db.Exec(`
+        UPDATE gpu_scheduler.gpus
+        SET health = ?, health_reason = ?, health_updated_at = ?
+        WHERE gpu_uuid = ?`,
+		health, sql.NullString{String: reason, Valid: reason != ""}, updatedAt, gpuUUID,
+	)
+	if err != nil {
+		log.Printf("Error setting health of GPU %s: %v", gpuUUID, err)
+	}
+	return err
+}
+
+// SetGPUHealthOverride pins a GPU's health, or clears the override when health is empty
+func SetGPUHealthOverride(db *sql.DB, gpuUUID, health string) error {
+	_, err := db.Exec(`
+        UPDATE gpu_scheduler.gpus
+        SET health_override = ?
+        WHERE gpu_uuid = ?`,
+		sql.NullString{String: health, Valid: health != ""}, gpuUUID,
+	)
+	if err != nil {
+		log.Printf("Error overriding health of GPU %s: %v", gpuUUID, err)
+	}
+	return err
+}
+
+// QueryActivePreemptions returns the preemptions whose victim is still running out its grace period
+func QueryActivePreemptions(db *sql.DB) ([]RequestPreemption, error) {
+	query := `
+        SELECT p.id, p.preempted_request_id, p.preempting_request_id, p.grace_ends_at, p.created_at
+        FROM gpu_scheduler.request_preemptions p
+        JOIN gpu_scheduler.requests r ON r.id = p.preempted_request_id
+        WHERE r.status = 'in_progress';
+    `
+
+	preemptions, err := QueryAndMap(db, query, nil, mapRequestPreemption)
+	if err != nil {
+		log.Printf("Error querying active preemptions: %v", err)
+		return nil, err
+	}
+
+	return preemptions, nil
+}
+
+// PreemptRequest records that a running request is preempted by another and cuts its end_time to the grace period
+func PreemptRequest(db *sql.DB, requestID, preemptingRequestID int, graceEndsAt time.Time) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(`
+        INSERT INTO gpu_scheduler.request_preemptions (preempted_request_id, preempting_request_id, grace_ends_at)
+        VALUES (?, ?, ?)`,
+		requestID, preemptingRequestID, graceEndsAt,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to record preemption of request %d: %w", requestID, err)
+	}
+
+	_, err = tx.Exec(`
+        UPDATE gpu_scheduler.requests
+        SET end_time = LEAST(end_time, ?), status_reason = ?
+        WHERE id = ? AND status = 'in_progress'`,
+		graceEndsAt, fmt.Sprintf("preempted by emergency request #%d", preemptingRequestID), requestID,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to shorten preempted request %d: %w", requestID, err)
+	}
+
+	return tx.Commit()
+}
+
+// EvictRequest ends a preempted request once its grace period is over
+func EvictRequest(db *sql.DB, requestID int, change StatusChange) error {
+	return setStatus(db, requestID, []string{"in_progress"}, "preempted", change, "")
+}
+
+// QueryApprovalRules returns the approval rules that apply to a user's type
+func QueryApprovalRules(db *sql.DB, userID int) ([]ApprovalRule, error) {
+	query := `
+        SELECT a.id, a.description, a.min_gpus, a.min_hours, a.priority, a.user_type
+        FROM gpu_scheduler.approval_rules a
+        JOIN gpu_scheduler.users u ON u.id = ?
+        WHERE a.user_type IS NULL OR a.user_type = u.user_type
+        ORDER BY a.id;
+    `
+
+	rules, err := QueryAndMap(db, query, []interface{}{userID}, mapApprovalRule)
+	if err != nil {
+		log.Printf("Error querying approval rules of user %d: %v", userID, err)
+		return nil, err
+	}
+
+	return rules, nil
+}
+
+// QueryApprovals returns the requests awaiting approval and those decided since the given time
+func QueryApprovals(db *sql.DB, decidedSince time.Time) ([]Approval, error) {
+	query := `SELECT ` + requestColumns + `, d.user_name
+        FROM gpu_scheduler.requests r
+        JOIN gpu_scheduler.users u ON u.id = r.user_id
+        LEFT JOIN gpu_scheduler.users d ON d.id = r.decided_by
+        WHERE r.status = 'pending_approval'
+           OR (r.approval_decision IS NOT NULL AND r.decided_at >= ?)
+        ORDER BY r.status <> 'pending_approval', COALESCE(r.decided_at, r.created_at) DESC;
+    `
+
+	approvals, err := QueryAndMap(db, query, []interface{}{decidedSince}, mapApproval)
+	if err != nil {
+		log.Printf("Error querying approvals: %v", err)
+		return nil, err
+	}
+
+	return approvals, nil
+}
+
+// DecideApproval approves a request awaiting approval, queueing it, or denies it, recording
+// the admin and their comment on the request
+func DecideApproval(db *sql.DB, requestID int, approved bool, decidedBy int, comment string, decidedAt time.Time) error {
+	decision, status := "denied", "denied"
+	if approved {
+		decision, status = "approved", "scheduled"
+	}
+
+	return setStatus(db, requestID, []string{"pending_approval"}, status, StatusChange{UserID: decidedBy, Reason: comment},
+		", approval_decision = ?, decided_by = ?, decision_comment = ?, decided_at = ?, status_reason = IF(? = 'denied', ?, status_reason)",
+		decision, decidedBy, comment, decidedAt, decision, comment,
+	)
+}
+
+// QueryProjects returns every project
+func QueryProjects(db *sql.DB) ([]Project, error) {
+	query := `
+        SELECT id, name, COALESCE(description, ''), max_concurrent_gpus, max_weekly_gpu_hours, ''
+        FROM gpu_scheduler.projects
+        ORDER BY name;
+    `
+
+	projects, err := QueryAndMap(db, query, nil, mapProject)
+	if err != nil {
+		log.Printf("Error querying projects: %v", err)
+		return nil, err
+	}
+
+	return projects, nil
+}
+
+// QueryUserProjects returns the projects a user is a member of, with their role
+func QueryUserProjects(db *sql.DB, userID int) ([]Project, error) {
+	query := `
+        SELECT p.id, p.name, COALESCE(p.description, ''), p.max_concurrent_gpus, p.max_weekly_gpu_hours, m.role
+        FROM gpu_scheduler.projects p
+        JOIN gpu_scheduler.project_members m ON m.project_id = p.id
+        WHERE m.user_id = ?
+        ORDER BY p.name;
+    `
+
+	projects, err := QueryAndMap(db, query, []interface{}{userID}, mapProject)
+	if err != nil {
+		log.Printf("Error querying projects of user %d: %v", userID, err)
+		return nil, err
+	}
+
+	return projects, nil
+}
+
+// QueryProject returns a single project with the user's role in it, or nil if there is no such project
+func QueryProject(db Querier, projectID, userID int) (*Project, error) {
+	query := `
+        SELECT p.id, p.name, COALESCE(p.description, ''), p.max_concurrent_gpus, p.max_weekly_gpu_hours, COALESCE(m.role, '')
+        FROM gpu_scheduler.projects p
+        LEFT JOIN gpu_scheduler.project_members m ON m.project_id = p.id AND m.user_id = ?
+        WHERE p.id = ?;
+    `
+
+	projects, err := QueryAndMap(db, query, []interface{}{userID, projectID}, mapProject)
+	if err != nil {
+		log.Printf("Error querying project %d: %v", projectID, err)
+		return nil, err
+	}
+	if len(projects) == 0 {
+		return nil, nil
+	}
+
+	return &projects[0], nil
+}
+
+// InsertProject creates a project and returns its ID
+func InsertProject(db *sql.DB, project Project) (int64, error) {
+	result, err := db.Exec(`
+        INSERT INTO gpu_scheduler.projects (name, description, max_concurrent_gpus, max_weekly_gpu_hours)
+        VALUES (?, ?, ?, ?)`,
+		project.Name, project.Description, project.MaxConcurrentGPUs, project.MaxWeeklyGPUHours,
+	)
+	if err != nil {
+		log.Printf("Error inserting project %s: %v", project.Name, err)
+		return 0, err
+	}
+
+	return result.LastInsertId()
+}
+
+// UpdateProjectQuota sets a project's limits; NULL limits are unlimited
+func UpdateProjectQuota(db *sql.DB, projectID int, maxConcurrentGPUs, maxWeeklyGPUHours sql.NullInt64) error {
+	_, err := db.Exec(`
+        UPDATE gpu_scheduler.projects
+        SET max_concurrent_gpus = ?, max_weekly_gpu_hours = ?
+        WHERE id = ?`,
+		maxConcurrentGPUs, maxWeeklyGPUHours, projectID,
+	)
+	if err != nil {
+		log.Printf("Error updating quota of project %d: %v", projectID, err)
+	}
+	return err
+}
+
+// QueryProjectMembers returns the members of a project, managers first
+func QueryProjectMembers(db *sql.DB, projectID int) ([]ProjectMember, error) {
+	query := `
+        SELECT m.project_id, m.user_id, u.user_name, m.role
+        FROM gpu_scheduler.project_members m
+        JOIN gpu_scheduler.users u ON u.id = m.user_id
+        WHERE m.project_id = ?
+        ORDER BY m.role = 'member', u.user_name;
+    `
+
+	members, err := QueryAndMap(db, query, []interface{}{projectID}, mapProjectMember)
+	if err != nil {
+		log.Printf("Error querying members of project %d: %v", projectID, err)
+		return nil, err
+	}
+
+	return members, nil
+}
+
+// SetProjectMember adds a user to a project or changes their role
+func SetProjectMember(db *sql.DB, projectID, userID int, role string) error {
+	_, err := db.Exec(`
+        INSERT INTO gpu_scheduler.project_members (project_id, user_id, role)
+        VALUES (?, ?, ?)
+        ON DUPLICATE KEY UPDATE role = VALUES(role)`,
+		projectID, userID, role,
+	)
+	if err != nil {
+		log.Printf("Error adding user %d to project %d: %v", userID, projectID, err)
+	}
+	return err
+}
+
+// RemoveProjectMember removes a user from a project; their requests stay charged to it
+func RemoveProjectMember(db *sql.DB, projectID, userID int) error {
+	_, err := db.Exec(`
+        DELETE FROM gpu_scheduler.project_members
+        WHERE project_id = ? AND user_id = ?`,
+		projectID, userID,
+	)
+	if err != nil {
+		log.Printf("Error removing user %d from project %d: %v", userID, projectID, err)
+	}
+	return err
+}
+
+// QueryProjectTotals sums a project's active requests and the GPU-hours requested for it since the given time
+func QueryProjectTotals(db Querier, projectID int, since time.Time) (RequestTotals, error) {
+	query := `
+        SELECT COALESCE(SUM(CASE WHEN status IN ('pending_approval', 'scheduled', 'in_progress') THEN num_gpus ELSE 0 END), 0),
+               COALESCE(SUM(CASE WHEN created_at >= ? AND status NOT IN ('cancelled', 'denied') THEN num_gpus * requested_time ELSE 0 END), 0)
+        FROM gpu_scheduler.requests
+        WHERE project_id = ?;
+    `
+
+	totals, err := QueryAndMap(db, query, []interface{}{since, projectID}, mapRequestTotals)
+	if err != nil {
+		log.Printf("Error querying request totals of project %d: %v", projectID, err)
+		return RequestTotals{}, err
+	}
+
+	return totals[0], nil
+}
+
+// QueryProjectRequests returns the project's requests that are awaiting approval, queued or running
+func QueryProjectRequests(db *sql.DB, projectID int) ([]Request, error) {
+	query := `SELECT ` + requestColumns + `
+        FROM gpu_scheduler.requests r
+        JOIN gpu_scheduler.users u ON u.id = r.user_id
+        WHERE r.project_id = ? AND r.status IN ('pending_approval', 'scheduled', 'in_progress')
+        ORDER BY r.id;
+    `
+
+	requests, err := QueryAndMap(db, query, []interface{}{projectID}, mapRequest)
+	if err != nil {
+		log.Printf("Error querying requests of project %d: %v", projectID, err)
+		return nil, err
+	}
+
+	return requests, nil
+}
+
+// QueryProjectUsage sums, per member, the requests charged to a project since the given
+// time and the GPU-hours they held since then
+func QueryProjectUsage(db *sql.DB, projectID int, since, now time.Time) ([]ProjectUsage, error) {
+	query := `
+        SELECT u.user_name,
+               SUM(r.created_at >= ?),
+               COALESCE(SUM(CASE WHEN r.created_at >= ? THEN r.num_gpus * r.requested_time ELSE 0 END), 0),
+               COALESCE(SUM(CASE WHEN r.status IN ('in_progress', 'done', 'preempted', 'released')
+                   THEN r.num_gpus * GREATEST(TIMESTAMPDIFF(SECOND, GREATEST(r.start_time, ?), LEAST(r.end_time, ?)), 0) / 3600
+                   ELSE 0 END), 0)
+        FROM gpu_scheduler.requests r
+        JOIN gpu_scheduler.users u ON u.id = r.user_id
+        WHERE r.project_id = ? AND r.status NOT IN ('cancelled', 'denied')
+          AND (r.created_at >= ? OR r.end_time >= ?)
+        GROUP BY u.user_name
+        ORDER BY u.user_name;
+    `
+
+	usage, err := QueryAndMap(db, query, []interface{}{since, since, since, now, projectID, since, since}, mapProjectUsage)
+	if err != nil {
+		log.Printf("Error querying usage of project %d: %v", projectID, err)
+		return nil, err
+	}
+
+	return usage, nil
+}
+
+const recurringBookingColumns = `
+        b.id, b.user_id, u.user_name, b.project_id, b.gpu_size, b.num_gpus, b.priority, b.server_name,
+        b.rrule, b.first_start, b.duration_minutes, b.until_date, b.cancelled_at, b.created_at`
+
+// QueryRecurringBookings returns the series that are not cancelled and have not ended before the given day
+func QueryRecurringBookings(db *sql.DB, endedBefore time.Time) ([]RecurringBooking, error) {
+	query := `SELECT ` + recurringBookingColumns + `
+        FROM gpu_scheduler.recurring_bookings b
+        JOIN gpu_scheduler.users u ON u.id = b.user_id
+        WHERE b.cancelled_at IS NULL AND b.until_date >= ?
+        ORDER BY b.id;
+    `
+
+	bookings, err := QueryAndMap(db, query, []interface{}{endedBefore.Format(time.DateOnly)}, mapRecurringBooking)
+	if err != nil {
+		log.Printf("Error querying recurring bookings: %v", err)
+		return nil, err
+	}
+
+	return bookings, nil
+}
+
+// QueryRecurringBooking returns a single series, or nil if there is no such series
+func QueryRecurringBooking(db *sql.DB, id int) (*RecurringBooking, error) {
+	query := `SELECT ` + recurringBookingColumns + `
+        FROM gpu_scheduler.recurring_bookings b
+        JOIN gpu_scheduler.users u ON u.id = b.user_id
+        WHERE b.id = ?;
+    `
+
+	bookings, err := QueryAndMap(db, query, []interface{}{id}, mapRecurringBooking)
+	if err != nil {
+		log.Printf("Error querying recurring booking %d: %v", id, err)
+		return nil, err
+	}
+	if len(bookings) == 0 {
+		return nil, nil
+	}
+
+	return &bookings[0], nil
+}
+
+// InsertRecurringBooking stores a series with its initial exceptions and returns its ID
+func InsertRecurringBooking(db *sql.DB, booking RecurringBooking, skipped []time.Time) (int64, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return 0, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec(`
+        INSERT INTO gpu_scheduler.recurring_bookings (user_id, project_id, gpu_size, num_gpus, priority, server_name,
+                                                      rrule, first_start, duration_minutes, until_date)
+        VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		booking.UserID, booking.ProjectID, booking.GPUSize, booking.NumGPUs, booking.Priority, booking.ServerName,
+		booking.RRule, booking.FirstStart, booking.DurationMinutes, booking.UntilDate.Format(time.DateOnly),
+	)
+	if err != nil {
+		return 0, fmt.Errorf("failed to insert recurring booking for user %d: %w", booking.UserID, err)
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+
+	for _, day := range skipped {
+		_, err := tx.Exec(`
+            INSERT IGNORE INTO gpu_scheduler.recurring_booking_exceptions (recurring_booking_id, occurrence_date, reason)
+            VALUES (?, ?, 'skipped')`,
+			id, day.Format(time.DateOnly),
+		)
+		if err != nil {
+			return 0, fmt.Errorf("failed to skip %s of recurring booking %d: %w", day.Format(time.DateOnly), id, err)
+		}
+	}
+
+	return id, tx.Commit()
+}
+
+// QueryRecurringExceptions returns the occurrences of a series that are not materialized
+func QueryRecurringExceptions(db *sql.DB, id int) ([]RecurringException, error) {
+	query := `
+        SELECT recurring_booking_id, occurrence_date, reason, note
+        FROM gpu_scheduler.recurring_booking_exceptions
+        WHERE recurring_booking_id = ?
+        ORDER BY occurrence_date;
+    `
+
+	exceptions, err := QueryAndMap(db, query, []interface{}{id}, mapRecurringException)
+	if err != nil {
+		log.Printf("Error querying exceptions of recurring booking %d: %v", id, err)
+		return nil, err
+	}
+
+	return exceptions, nil
+}
+
+// InsertRecurringException keeps an occurrence from being materialized; an existing exception is kept
+func InsertRecurringException(db *sql.DB, id int, day time.Time, reason, note string) error {
+	_, err := db.Exec(`
+        INSERT IGNORE INTO gpu_scheduler.recurring_booking_exceptions (recurring_booking_id, occurrence_date, reason, note)
+        VALUES (?, ?, ?, ?)`,
+		id, day.Format(time.DateOnly), reason, note,
+	)
+	if err != nil {
+		log.Printf("Error adding exception to recurring booking %d: %v", id, err)
+	}
+	return err
+}
+
+// QueryRecurringOccurrences returns the materialized occurrences of a series, in any status
+func QueryRecurringOccurrences(db *sql.DB, id int) ([]Request, error) {
+	query := `SELECT ` + requestColumns + `
+        FROM gpu_scheduler.requests r
+        JOIN gpu_scheduler.users u ON u.id = r.user_id
+        WHERE r.recurring_booking_id = ?
+        ORDER BY r.start_time;
+    `
+
+	requests, err := QueryAndMap(db, query, []interface{}{id}, mapRequest)
+	if err != nil {
+		log.Printf("Error querying occurrences of recurring booking %d: %v", id, err)
+		return nil, err
+	}
+
+	return requests, nil
+}
+
+// CancelRecurringBooking ends a series and cancels its occurrences that have not started
+func CancelRecurringBooking(db *sql.DB, id int, cancelledAt time.Time, change StatusChange) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec(`
+        UPDATE gpu_scheduler.recurring_bookings
+        SET cancelled_at = ?
+        WHERE id = ? AND cancelled_at IS NULL`,
+		cancelledAt, id,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to cancel recurring booking %d: %w", id, err)
+	}
+	if updated, err := result.RowsAffected(); err != nil || updated == 0 {
+		return fmt.Errorf("recurring booking %d is already cancelled", id)
+	}
+
+	rows, err := tx.Query(`
+        SELECT id
+        FROM gpu_scheduler.requests
+        WHERE recurring_booking_id = ? AND status = 'scheduled'`,
+		id,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to query occurrences of recurring booking %d: %w", id, err)
+	}
+	var occurrences []int
+	for rows.Next() {
+		occurrence, err := mapRequestID(rows)
+		if err != nil {
+			rows.Close()
+			return err
+		}
+		occurrences = append(occurrences, occurrence)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, occurrence := range occurrences {
+		if err := changeStatus(tx, occurrence, []string{"scheduled"}, "cancelled", change, ""); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
@@ -0,0 +1,204 @@
+package database
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeRequest is a request of the in-memory tables behind fakeDriver, with the GPU it is assigned to
+type fakeRequest struct {
+	id     int64
+	gpu    string
+	status string
+	start  time.Time
+	end    time.Time
+	vramMB int64 // 0 for a whole-GPU request
+}
+
+// fakeDriver answers the statements ExtendRequest runs from an in-memory request table, so its
+// conflict rules can be tested without a MySQL server
+type fakeDriver struct {
+	mu       sync.Mutex
+	requests map[string][]*fakeRequest // By data source name
+}
+
+var fakeDB = &fakeDriver{requests: map[string][]*fakeRequest{}}
+
+func init() {
+	sql.Register("fakedb", fakeDB)
+}
+
+// openFake opens a database holding the given requests
+func openFake(t *testing.T, requests ...*fakeRequest) *sql.DB {
+	t.Helper()
+	fakeDB.mu.Lock()
+	fakeDB.requests[t.Name()] = requests
+	fakeDB.mu.Unlock()
+
+	db, err := sql.Open("fakedb", t.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+func (d *fakeDriver) Open(name string) (driver.Conn, error) {
+	return &fakeConn{driver: d, name: name}, nil
+}
+
+type fakeConn struct {
+	driver *fakeDriver
+	name   string
+}
+
+func (c *fakeConn) Prepare(query string) (driver.Stmt, error) {
+	return &fakeStmt{conn: c, query: query}, nil
+}
+
+func (c *fakeConn) Close() error              { return nil }
+func (c *fakeConn) Begin() (driver.Tx, error) { return c, nil }
+func (c *fakeConn) Commit() error             { return nil }
+func (c *fakeConn) Rollback() error           { return nil }
+
+type fakeStmt struct {
+	conn  *fakeConn
+	query string
+}
+
+func (s *fakeStmt) Close() error  { return nil }
+func (s *fakeStmt) NumInput() int { return -1 }
+
+func (s *fakeStmt) request(id driver.Value) *fakeRequest {
+	for _, r := range s.conn.driver.requests[s.conn.name] {
+		if r.id == id.(int64) {
+			return r
+		}
+	}
+	return nil
+}
+
+func (s *fakeStmt) Exec(args []driver.Value) (driver.Result, error) {
+	s.conn.driver.mu.Lock()
+	defer s.conn.driver.mu.Unlock()
+
+	if strings.Contains(s.query, "UPDATE gpu_scheduler.requests") {
+		s.request(args[2]).end = args[0].(time.Time)
+	}
+	return driver.RowsAffected(1), nil
+}
+
+func (s *fakeStmt) Query(args []driver.Value) (driver.Rows, error) {
+	s.conn.driver.mu.Lock()
+	defer s.conn.driver.mu.Unlock()
+
+	switch {
+	case strings.Contains(s.query, "SELECT end_time, vram_mb"):
+		r := s.request(args[0])
+		if r == nil || r.status != "in_progress" {
+			return &fakeRows{columns: []string{"end_time", "vram_mb"}}, nil
+		}
+		var vramMB driver.Value
+		if r.vramMB > 0 {
+			vramMB = r.vramMB
+		}
+		return &fakeRows{columns: []string{"end_time", "vram_mb"}, values: [][]driver.Value{{r.end, vramMB}}}, nil
+
+	case strings.Contains(s.query, "SELECT COUNT(*)"):
+		mine := s.request(args[0])
+		from, to := args[3].(time.Time), args[2].(time.Time)
+		wholeOnly := strings.Contains(s.query, "r.vram_mb IS NULL")
+		var count int64
+		for _, r := range s.conn.driver.requests[s.conn.name] {
+			if r.id == mine.id || r.gpu != mine.gpu || (r.status != "scheduled" && r.status != "in_progress") {
+				continue
+			}
+			if wholeOnly && r.vramMB > 0 {
+				continue
+			}
+			if r.start.Before(to) && r.end.After(from) {
+				count++
+			}
+		}
+		return &fakeRows{columns: []string{"count"}, values: [][]driver.Value{{count}}}, nil
+	}
+	return nil, fmt.Errorf("fakedb: unexpected query %q", s.query)
+}
+
+type fakeRows struct {
+	columns []string
+	values  [][]driver.Value
+}
+
+func (r *fakeRows) Columns() []string { return r.columns }
+func (r *fakeRows) Close() error      { return nil }
+
+func (r *fakeRows) Next(dest []driver.Value) error {
+	if len(r.values) == 0 {
+		return io.EOF
+	}
+	copy(dest, r.values[0])
+	r.values = r.values[1:]
+	return nil
+}
+
+func TestExtendRequest(t *testing.T) {
+	now := time.Date(2026, 10, 19, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name     string
+		requests []*fakeRequest
+		wantErr  error
+	}{
+		{
+			name: "slice extends past another slice on the same GPU",
+			requests: []*fakeRequest{
+				{id: 1, gpu: "g0", status: "in_progress", start: now.Add(-time.Hour), end: now.Add(time.Hour), vramMB: 8000},
+				{id: 2, gpu: "g0", status: "in_progress", start: now.Add(-time.Hour), end: now.Add(4 * time.Hour), vramMB: 8000},
+			},
+		},
+		{
+			name: "slice stops at a whole-GPU booking",
+			requests: []*fakeRequest{
+				{id: 1, gpu: "g0", status: "in_progress", start: now.Add(-time.Hour), end: now.Add(time.Hour), vramMB: 8000},
+				{id: 2, gpu: "g0", status: "scheduled", start: now.Add(2 * time.Hour), end: now.Add(4 * time.Hour)},
+			},
+			wantErr: ErrBookingConflict,
+		},
+		{
+			name: "whole-GPU request stops at the next booking",
+			requests: []*fakeRequest{
+				{id: 1, gpu: "g0", status: "in_progress", start: now.Add(-time.Hour), end: now.Add(time.Hour)},
+				{id: 2, gpu: "g0", status: "scheduled", start: now.Add(2 * time.Hour), end: now.Add(4 * time.Hour)},
+			},
+			wantErr: ErrBookingConflict,
+		},
+		{
+			name: "booking on another GPU is no conflict",
+			requests: []*fakeRequest{
+				{id: 1, gpu: "g0", status: "in_progress", start: now.Add(-time.Hour), end: now.Add(time.Hour)},
+				{id: 2, gpu: "g1", status: "scheduled", start: now.Add(2 * time.Hour), end: now.Add(4 * time.Hour)},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := openFake(t, tt.requests...)
+			newEnd, err := ExtendRequest(db, 1, 2, 7)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("ExtendRequest error %v, want %v", err, tt.wantErr)
+			}
+			if tt.wantErr == nil && !newEnd.Equal(now.Add(3*time.Hour)) {
+				t.Errorf("new end %v, want %v", newEnd, now.Add(3*time.Hour))
+			}
+		})
+	}
+}
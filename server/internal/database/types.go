@@ -1,6 +1,9 @@
 package database
 
-import "time"
+import (
+	"database/sql"
+	"time"
+)
 
 type RealTimeUsage struct {
 	ServerName         string
@@ -13,3 +16,313 @@ type RealTimeUsage struct {
 	TemperatureCelsius float32
 	UpdatedAt          time.Time
 }
+
+// Command is a unit of work queued for a daemon on a specific node
+type Command struct {
+	ID          int       `json:"id"`
+	TargetNode  string    `json:"target_node"`
+	CommandType string    `json:"command_type"`
+	Parameters  string    `json:"parameters"`
+	Status      string    `json:"status"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// GPUProcess is a process sample reported by a daemon, joined with the GPU it ran on
+type GPUProcess struct {
+	GPUUUID       string
+	ServerName    string
+	GPUNumber     int
+	ProcessID     int
+	ProcessName   string
+	UserName      string
+	UsedGPUMemory int // MiB
+	ReportedAt    time.Time
+}
+
+// GPUReservation is a GPU assigned to a request, with the owner and window of the request
+type GPUReservation struct {
+	RequestID int
+	GPUUUID   string
+	UserName  string
+	Status    string
+	StartTime sql.NullTime
+	EndTime   sql.NullTime
+}
+
+// UsageViolation is a process found running on a GPU its owner had not reserved, or
+// using more VRAM than its owner's slice of a shared GPU
+type UsageViolation struct {
+	ID          int
+	GPUUUID     string
+	ServerName  string
+	GPUNumber   int
+	UserName    string
+	ProcessID   int
+	ProcessName string
+	Kind        string        // "unreserved", "expired" or "over_slice"
+	RequestID   sql.NullInt64 // Expired reservation the process outlived, or slice it exceeds, if any
+	StartedAt   time.Time
+	LastSeenAt  time.Time
+	MaxMemoryMB int
+	NotifiedAt  sql.NullTime
+	ResolvedAt  sql.NullTime
+	Enforcement sql.NullString // Last step taken to stop an overrun: "notified", "terminated" or "killed"
+	EnforcedAt  sql.NullTime
+}
+
+// Duration is how long the violation has been observed
+func (v UsageViolation) Duration() time.Duration {
+	return v.LastSeenAt.Sub(v.StartedAt)
+}
+
+// GPU is a row of the gpus table
+type GPU struct {
+	UUID       string
+	ServerName string
+	GPUNumber  int
+	ModelName  string
+	VRAMSizeMB int
+	Draining   bool // No new placements, e.g. ahead of maintenance
+	Shared     bool // Only VRAM slice requests are placed on it, several at a time
+
+	Health          string         // "healthy", "degraded" or "quarantined", derived from telemetry
+	HealthReason    sql.NullString // Why the GPU is not healthy
+	HealthOverride  sql.NullString // Set by an admin, takes precedence over Health
+	HealthUpdatedAt sql.NullTime
+}
+
+// EffectiveHealth is the admin override if there is one, the derived health otherwise
+func (g GPU) EffectiveHealth() string {
+	if g.HealthOverride.Valid {
+		return g.HealthOverride.String
+	}
+	return g.Health
+}
+
+// GPUSample is the latest telemetry of a GPU; all fields but the GPU are NULL if it never reported
+type GPUSample struct {
+	GPUUUID            string
+	ServerName         string
+	GPUNumber          int
+	ReportedAt         sql.NullTime
+	TemperatureCelsius sql.NullFloat64
+	ECCCorrected       sql.NullInt64
+	ECCUncorrected     sql.NullInt64
+}
+
+// Request is a row of the requests table, with the name of the requesting user
+type Request struct {
+	ID             int
+	UserID         int
+	UserName       string
+	RequestedTime  int // Hours
+	GPUSize        string
+	NumGPUs        int
+	Priority       string
+	ServerName     sql.NullString
+	Status         string
+	StartTime      sql.NullTime
+	EndTime        sql.NullTime
+	CreatedAt      time.Time
+	ProjectedStart sql.NullTime // Set by the scheduler while the request is blocked
+	IdleWarnedAt   sql.NullTime // When the owner was warned that the unused GPUs will be released
+	EndWarnedAt    sql.NullTime // When the owner was offered an extension
+
+	ApprovalRule     sql.NullString // The approval rule the request matched
+	ApprovalDecision sql.NullString // "approved" or "denied"
+	DecidedBy        sql.NullInt64  // The admin who decided
+	DecisionComment  sql.NullString
+	DecidedAt        sql.NullTime
+
+	ProjectID          sql.NullInt64 // Project the request is charged to, NULL for personal requests
+	RecurringBookingID sql.NullInt64 // Series the booking is an occurrence of
+	VRAMMB             sql.NullInt64 // VRAM slice of a shared GPU, NULL for whole GPUs
+}
+
+// StatusChange is who changes a request's status, and why
+type StatusChange struct {
+	UserID int    // User making the change, 0 for automatic changes
+	System string // What makes an automatic change, e.g. "scheduler"
+	Reason string // Optional
+}
+
+// StatusHistory is a row of the request_status_history table, with the name of the user who made the change
+type StatusHistory struct {
+	ID              int
+	RequestID       int
+	OldStatus       sql.NullString // NULL for the creation of the request
+	NewStatus       string
+	ChangedBy       sql.NullInt64
+	ChangedByName   sql.NullString
+	ChangedBySystem sql.NullString
+	Reason          sql.NullString
+	ChangedAt       time.Time
+}
+
+// RecurringBooking is a row of the recurring_bookings table, with the name of the user
+type RecurringBooking struct {
+	ID              int
+	UserID          int
+	UserName        string
+	ProjectID       sql.NullInt64
+	GPUSize         string
+	NumGPUs         int
+	Priority        string
+	ServerName      sql.NullString
+	RRule           string    // RRULE subset, e.g. "FREQ=WEEKLY;INTERVAL=1;BYDAY=TH"
+	FirstStart      time.Time // Later occurrences start at the same time of day
+	DurationMinutes int
+	UntilDate       time.Time
+	CancelledAt     sql.NullTime
+	CreatedAt       time.Time
+}
+
+// RecurringException is a row of the recurring_booking_exceptions table
+type RecurringException struct {
+	RecurringBookingID int
+	OccurrenceDate     time.Time
+	Reason             string // "skipped" or "conflict"
+	Note               string
+}
+
+// ApprovalRule is a row of the approval_rules table; NULL conditions match any request
+type ApprovalRule struct {
+	ID          int
+	Description string
+	MinGPUs     sql.NullInt64
+	MinHours    sql.NullInt64
+	Priority    sql.NullString
+	UserType    sql.NullString
+}
+
+// Project is a row of the projects table. NULL limits are unlimited.
+type Project struct {
+	ID                int
+	Name              string
+	Description       string
+	MaxConcurrentGPUs sql.NullInt64
+	MaxWeeklyGPUHours sql.NullInt64
+	Role              string // The user's role when listing a user's projects, empty otherwise
+}
+
+// ProjectMember is a row of the project_members table, with the member's user name
+type ProjectMember struct {
+	ProjectID int
+	UserID    int
+	UserName  string
+	Role      string // "manager" or "member"
+}
+
+// ProjectUsage is what one member charged to a project since a cutoff
+type ProjectUsage struct {
+	UserName         string
+	Requests         int
+	ReservedGPUHours int     // num_gpus * requested_time
+	HeldGPUHours     float64 // num_gpus * time the requests actually held their GPUs
+}
+
+// Approval is a request that needed approval, with the name of the admin who decided
+type Approval struct {
+	Request
+	DeciderName sql.NullString
+}
+
+// MaintenanceWindow is a row of the maintenance_windows table
+type MaintenanceWindow struct {
+	ID         int
+	ServerName string
+	GPUUUID    sql.NullString // NULL for the whole server
+	StartTime  time.Time
+	EndTime    time.Time
+	Reason     string
+	CreatedAt  time.Time
+}
+
+// CalendarEntry is one GPU of a booked or running request, for the calendar
+type CalendarEntry struct {
+	RequestID  int
+	UserName   string
+	Status     string
+	Priority   string
+	GPUUUID    string
+	ServerName string
+	GPUNumber  int
+	StartTime  time.Time
+	EndTime    time.Time
+	ProjectID  sql.NullInt64
+}
+
+// RequestAssignment is a row of the request_gpu_assignments table
+type RequestAssignment struct {
+	RequestID int
+	GPUUUID   string
+}
+
+// SizeClass is a row of the gpu_size_classes table
+type SizeClass struct {
+	GPUSize        string
+	MinVRAMMB      int
+	AllowedModels  string // Comma-separated, empty for any model
+	AllowedServers string // Comma-separated, empty for any server
+	UpdatedAt      time.Time
+}
+
+// User is a row of the users table
+type User struct {
+	ID            int
+	Email         string
+	UserName      string
+	Name          string
+	UserType      string
+	ResearchGroup string // Empty if the user is not in a group
+	DataServer    string // Server holding the user's data, empty if unknown
+	IsAdmin       bool
+	IsWhitelisted bool
+}
+
+// Quota is a user's effective limits: their user_quota_overrides row where set,
+// otherwise their user_type_quotas row. NULL limits are unlimited.
+type Quota struct {
+	UserType          string
+	MaxConcurrentGPUs sql.NullInt64
+	MaxRequestedHours sql.NullInt64
+	MaxWeeklyGPUHours sql.NullInt64
+	AllowedPriorities sql.NullString // Comma-separated, NULL for any priority
+}
+
+// RequestTotals sums a user's requests for quota checks
+type RequestTotals struct {
+	ActiveGPUs       int // GPUs held or queued by scheduled and in-progress requests
+	ReservedGPUHours int // num_gpus * requested_time of the requests created since the cutoff
+}
+
+// UserLimit is a per-user quota value
+type UserLimit struct {
+	UserName string
+	Limit    int
+}
+
+// GPULink is a row of the gpu_topology table
+type GPULink struct {
+	ServerName string
+	GPUA       int
+	GPUB       int
+	Link       string // nvidia-smi topo -m value, e.g. NV4, PIX, SYS
+}
+
+// UsageHour is how many GPUs a user had processes on during one hour, from
+// gpu_processes and gpu_processes_hourly_historical
+type UsageHour struct {
+	UserName string
+	Hour     time.Time
+	GPUCount int
+}
+
+// RequestPreemption is a row of the request_preemptions table
+type RequestPreemption struct {
+	ID                  int
+	PreemptedRequestID  int
+	PreemptingRequestID int
+	GraceEndsAt         time.Time
+	CreatedAt           time.Time
+}
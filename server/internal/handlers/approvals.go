@@ -0,0 +1,130 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"html/template"
+	"net/http"
+	"strconv"
+
+	"github.com/eduardo-escoto/gpu_request/server/internal/database"
+	"github.com/eduardo-escoto/gpu_request/server/internal/services"
+)
+
+var approvalsTemplate = template.Must(template.New("approvals").Parse(`
+    <div id="approvals-view">
+        {{ if .Error }}<p><mark>{{ .Error }}</mark></p>{{ else if .Message }}<p>{{ .Message }}</p>{{ end }}
+        <table>
+            <thead>
+                <tr>
+                    <th>Request</th>
+                    <th>User</th>
+                    <th>GPUs</th>
+                    <th>Hours</th>
+                    <th>Priority</th>
+                    <th>Needs Approval For</th>
+                    <th>Decision</th>
+                </tr>
+            </thead>
+            <tbody>
+                {{ $admin := .IsAdmin }}
+                {{ range .Approvals }}
+                <tr>
+                    <td>#{{ .ID }}</td>
+                    <td>{{ .UserName }}</td>
+                    <td>{{ .NumGPUs }} {{ .GPUSize }}</td>
+                    <td>{{ .RequestedTime }}</td>
+                    <td>{{ .Priority }}</td>
+                    <td>{{ .ApprovalRule.String }}</td>
+                    <td>
+                        {{ if .ApprovalDecision.Valid }}
+                        {{ .ApprovalDecision.String }} by {{ if .DeciderName.Valid }}{{ .DeciderName.String }}{{ else }}a former admin{{ end }}
+                        on {{ .DecidedAt.Time.Format "Mon Jan 2 15:04" }}{{ if .DecisionComment.String }}: {{ .DecisionComment.String }}{{ end }}
+                        {{ else if $admin }}
+                        <form hx-post="/approvals/decide" hx-target="#approvals-view" hx-swap="outerHTML">
+                            <input type="hidden" name="id" value="{{ .ID }}">
+                            <input type="text" name="comment" placeholder="Comment (required to deny)">
+                            <button type="submit" name="decision" value="approved">Approve</button>
+                            <button type="submit" name="decision" value="denied" class="secondary">Deny</button>
+                        </form>
+                        {{ else }}
+                        Awaiting an admin since {{ .CreatedAt.Format "Mon Jan 2 15:04" }}
+                        {{ end }}
+                    </td>
+                </tr>
+                {{ else }}
+                <tr><td colspan="7">No requests awaiting approval.</td></tr>
+                {{ end }}
+            </tbody>
+        </table>
+    </div>
+`))
+
+// ApprovalsHandler lists the requests awaiting admin approval and the recent decisions
+func ApprovalsHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		renderApprovals(w, r, db, "", nil)
+	}
+}
+
+// DecideApprovalHandler approves or denies a request awaiting approval (admins only).
+// It takes the request id, decision ("approved" or "denied") and an optional comment,
+// which is required for denials.
+func DecideApprovalHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+			return
+		}
+		admin := currentAdmin(w, r, db)
+		if admin == nil {
+			return
+		}
+
+		id, err := strconv.Atoi(r.FormValue("id"))
+		if err != nil {
+			http.Error(w, "Invalid request ID", http.StatusBadRequest)
+			return
+		}
+		decision := r.FormValue("decision")
+		if decision != "approved" && decision != "denied" {
+			http.Error(w, "Invalid decision", http.StatusBadRequest)
+			return
+		}
+
+		err = services.DecideApproval(db, id, decision == "approved", r.FormValue("comment"), admin)
+		renderApprovals(w, r, db, fmt.Sprintf("Request #%d %s.", id, decision), err)
+	}
+}
+
+// renderApprovals renders the approvals section with the outcome of an admin decision.
+// A rejection is shown in place; any other error fails the request.
+func renderApprovals(w http.ResponseWriter, r *http.Request, db *sql.DB, message string, actionErr error) {
+	data := struct {
+		Message   string
+		Error     string
+		IsAdmin   bool
+		Approvals []database.Approval
+	}{Message: message, IsAdmin: viewerIsAdmin(r, db)}
+
+	var rejection *services.RequestError
+	if errors.As(actionErr, &rejection) {
+		data.Error, data.Message = rejection.Reason, ""
+	} else if actionErr != nil {
+		http.Error(w, "Error: "+actionErr.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	approvals, err := services.LoadApprovals(db)
+	if err != nil {
+		http.Error(w, "Error querying approvals: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	data.Approvals = approvals
+
+	err = approvalsTemplate.Execute(w, data)
+	if err != nil {
+		http.Error(w, "Error rendering template: "+err.Error(), http.StatusInternalServerError)
+	}
+}
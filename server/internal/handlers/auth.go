@@ -0,0 +1,92 @@
+package handlers
+
+import (
+	"database/sql"
+	"net/http"
+	"net/netip"
+	"os"
+	"strings"
+
+	"github.com/eduardo-escoto/gpu_request/server/internal/database"
+)
+
+// currentUser resolves the signed-in user from the header set by the authenticating
+// reverse proxy (AUTH_USER_HEADER, X-Forwarded-User by default). The header may carry
+// either the user name or the email address. It writes an error response and returns
+// nil if the user is unknown.
+func currentUser(w http.ResponseWriter, r *http.Request, db *sql.DB) *database.User {
+	identity := requestIdentity(r)
+	if identity == "" {
+		http.Error(w, "Not signed in", http.StatusUnauthorized)
+		return nil
+	}
+
+	user, err := database.QueryUser(db, identity)
+	if err != nil {
+		http.Error(w, "Error looking up user: "+err.Error(), http.StatusInternalServerError)
+		return nil
+	}
+	if user == nil || !user.IsWhitelisted {
+		http.Error(w, "Unknown user "+identity, http.StatusForbidden)
+		return nil
+	}
+	return user
+}
+
+// viewerIsAdmin reports whether the request comes from an admin, without failing the request otherwise
+func viewerIsAdmin(r *http.Request, db *sql.DB) bool {
+	identity := requestIdentity(r)
+	if identity == "" {
+		return false
+	}
+	user, err := database.QueryUser(db, identity)
+	return err == nil && user != nil && user.IsAdmin
+}
+
+// requestIdentity returns the user name or email set by the reverse proxy. Anyone can
+// send the header, so it is only honoured on connections from one of the TRUSTED_PROXIES;
+// other requests are unauthenticated.
+func requestIdentity(r *http.Request) string {
+	if !fromTrustedProxy(r) {
+		return ""
+	}
+	header := os.Getenv("AUTH_USER_HEADER")
+	if header == "" {
+		header = "X-Forwarded-User"
+	}
+	return r.Header.Get(header)
+}
+
+// fromTrustedProxy reports whether the request's peer is in TRUSTED_PROXIES, a
+// comma-separated list of addresses and CIDR prefixes (e.g., "127.0.0.1,10.0.0.0/8")
+func fromTrustedProxy(r *http.Request) bool {
+	peer, err := netip.ParseAddrPort(r.RemoteAddr)
+	if err != nil {
+		return false
+	}
+	addr := peer.Addr().Unmap()
+	for _, entry := range strings.Split(os.Getenv("TRUSTED_PROXIES"), ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		if prefix, err := netip.ParsePrefix(entry); err == nil {
+			if prefix.Contains(addr) {
+				return true
+			}
+		} else if trusted, err := netip.ParseAddr(entry); err == nil && trusted.Unmap() == addr {
+			return true
+		}
+	}
+	return false
+}
+
+// currentAdmin is currentUser restricted to users with is_admin set
+func currentAdmin(w http.ResponseWriter, r *http.Request, db *sql.DB) *database.User {
+	user := currentUser(w, r, db)
+	if user != nil && !user.IsAdmin {
+		http.Error(w, "Admin access required", http.StatusForbidden)
+		return nil
+	}
+	return user
+}
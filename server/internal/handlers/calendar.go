@@ -0,0 +1,396 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"html/template"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/eduardo-escoto/gpu_request/server/internal/database"
+	"github.com/eduardo-escoto/gpu_request/server/internal/scheduler"
+	"github.com/eduardo-escoto/gpu_request/server/internal/services"
+)
+
+// calendarDays is how many days the calendar shows at once
+const calendarDays = 7
+
+// CalendarCell is what happens on one GPU during one day
+type CalendarCell struct {
+	Entries     []CalendarItem
+	Maintenance []database.MaintenanceWindow
+}
+
+// CalendarItem is a booked or running request shown in a calendar cell
+type CalendarItem struct {
+	database.CalendarEntry
+	Cancellable bool
+	Extendable  bool
+}
+
+// CalendarRow is one GPU across the displayed days
+type CalendarRow struct {
+	ServerName string
+	GPUNumber  int
+	Cells      []CalendarCell
+}
+
+var calendarTemplate = template.Must(template.New("calendar").Parse(`
+    <div id="calendar-view">
+        <nav>
+            <ul>
+                <li><a href="#" hx-get="/calendar?start={{ .Previous }}" hx-target="#calendar-view" hx-swap="outerHTML">&larr; Previous week</a></li>
+            </ul>
+            <ul><li><strong>{{ .From.Format "Mon Jan 2" }} &ndash; {{ .Last.Format "Mon Jan 2" }}</strong></li></ul>
+            <ul>
+                <li><a href="#" hx-get="/calendar?start={{ .Next }}" hx-target="#calendar-view" hx-swap="outerHTML">Next week &rarr;</a></li>
+            </ul>
+        </nav>
+        <table>
+            <thead>
+                <tr>
+                    <th>GPU</th>
+                    {{ range .Days }}<th>{{ .Format "Mon Jan 2" }}</th>{{ end }}
+                </tr>
+            </thead>
+            <tbody>
+                {{ range .Rows }}
+                <tr>
+                    <td>{{ .ServerName }} #{{ .GPUNumber }}</td>
+                    {{ range .Cells }}
+                    <td>
+                        {{ range .Maintenance }}<mark>maintenance {{ .StartTime.Format "Jan 2 15:04" }}&ndash;{{ .EndTime.Format "Jan 2 15:04" }}</mark><br>{{ end }}
+                        {{ range .Entries }}
+                        <small>
+                            {{ .StartTime.Format "Jan 2 15:04" }}&ndash;{{ .EndTime.Format "Jan 2 15:04" }}
+                            {{ .UserName }} (<a href="#" hx-get="/requests/detail?id={{ .RequestID }}" hx-target="#request-detail" hx-swap="outerHTML">#{{ .RequestID }}</a>{{ if eq .Status "in_progress" }}, running{{ end }})
+                            {{ if .Cancellable }}<a href="#" hx-post="/requests/cancel" hx-vals='{"id": "{{ .RequestID }}"}' hx-confirm="Cancel request #{{ .RequestID }}?" hx-target="#calendar-result">cancel</a>{{ end }}
+                        {{ if .Extendable }}<a href="#" hx-post="/requests/extend" hx-vals='{"id": "{{ .RequestID }}"}' hx-prompt="Extend request #{{ .RequestID }} by how many hours?" hx-target="#calendar-result">extend</a>{{ end }}
+                        </small><br>
+                        {{ end }}
+                    </td>
+                    {{ end }}
+                </tr>
+                {{ end }}
+            </tbody>
+        </table>
+    </div>
+`))
+
+var bookingFormTemplate = template.Must(template.New("booking-form").Parse(`
+    <form hx-post="/bookings" hx-target="#calendar-result">
+        <div class="grid">
+            <label>
+                GPUs
+                <input type="number" name="num_gpus" min="1" value="1" required>
+            </label>
+            <label>
+                Size
+                <select name="gpu_size">
+                    {{ range .SizeClasses }}
+                    <option value="{{ .Size }}">{{ .Size }} ({{ .Describe }})</option>
+                    {{ end }}
+                </select>
+            </label>
+            <label>
+                Priority
+                <select name="priority">
+                    {{ range .Priorities }}
+                    <option value="{{ . }}">{{ . }}</option>
+                    {{ end }}
+                </select>
+            </label>
+            <label>
+                Server
+                <select name="server_name">
+                    <option value="">Any server</option>
+                    {{ range .Servers }}
+                    <option value="{{ . }}">{{ . }}</option>
+                    {{ end }}
+                </select>
+            </label>
+            {{ if .Projects }}
+            <label>
+                Charge To
+                <select name="project_id">
+                    <option value="">Personal allocation</option>
+                    {{ range .Projects }}
+                    <option value="{{ .ID }}">{{ .Name }}</option>
+                    {{ end }}
+                </select>
+            </label>
+            {{ end }}
+        </div>
+        <div class="grid">
+            <label>
+                Start
+                <input type="datetime-local" name="start_time" required>
+            </label>
+            <label>
+                End
+                <input type="datetime-local" name="end_time" required>
+            </label>
+        </div>
+        <button type="submit">Book GPUs</button>
+    </form>
+    <div id="calendar-result"></div>
+`))
+
+var calendarResultTemplate = template.Must(template.New("calendar-result").Parse(`
+    {{ if .Error }}<p><mark>{{ .Error }}</mark></p>{{ else }}<p>{{ .Message }}</p>{{ end }}
+`))
+
+// CalendarHandler renders a week of bookings, running requests and maintenance windows
+// per GPU, starting at the "start" date (YYYY-MM-DD, today by default)
+func CalendarHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		from := today()
+		if start := r.URL.Query().Get("start"); start != "" {
+			parsed, err := time.ParseInLocation(time.DateOnly, start, time.Local)
+			if err != nil {
+				http.Error(w, "Invalid start date", http.StatusBadRequest)
+				return
+			}
+			from = parsed
+		}
+		to := from.AddDate(0, 0, calendarDays)
+
+		gpus, err := database.QueryGPUs(db)
+		if err != nil {
+			http.Error(w, "Error querying GPUs: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		entries, err := database.QueryCalendarEntries(db, from, to)
+		if err != nil {
+			http.Error(w, "Error querying bookings: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		windows, err := database.QueryMaintenanceWindows(db, from)
+		if err != nil {
+			http.Error(w, "Error querying maintenance windows: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		var viewer *database.User
+		if identity := requestIdentity(r); identity != "" {
+			viewer, _ = database.QueryUser(db, identity)
+		}
+		viewerProjectIDs := make(map[int64]bool)
+		if viewer != nil {
+			projects, err := database.QueryUserProjects(db, viewer.ID)
+			if err != nil {
+				http.Error(w, "Error querying projects: "+err.Error(), http.StatusInternalServerError)
+				return
+			}
+			for _, project := range projects {
+				viewerProjectIDs[int64(project.ID)] = true
+			}
+		}
+
+		var days []time.Time
+		for day := from; day.Before(to); day = day.AddDate(0, 0, 1) {
+			days = append(days, day)
+		}
+
+		var rows []CalendarRow
+		for _, gpu := range gpus {
+			row := CalendarRow{ServerName: gpu.ServerName, GPUNumber: gpu.GPUNumber}
+			for _, day := range days {
+				dayEnd := day.AddDate(0, 0, 1)
+				var cell CalendarCell
+				for _, entry := range entries {
+					if entry.GPUUUID == gpu.UUID && entry.StartTime.Before(dayEnd) && entry.EndTime.After(day) {
+						mine := viewer != nil && (viewer.IsAdmin || viewer.UserName == entry.UserName ||
+							entry.ProjectID.Valid && viewerProjectIDs[entry.ProjectID.Int64])
+						cell.Entries = append(cell.Entries, CalendarItem{
+							CalendarEntry: entry,
+							Cancellable:   mine && entry.Status == scheduler.StatusScheduled,
+							Extendable:    mine && entry.Status == scheduler.StatusInProgress,
+						})
+					}
+				}
+				for _, window := range windows {
+					covers := window.ServerName == gpu.ServerName && (!window.GPUUUID.Valid || window.GPUUUID.String == gpu.UUID)
+					if covers && window.StartTime.Before(dayEnd) && window.EndTime.After(day) {
+						cell.Maintenance = append(cell.Maintenance, window)
+					}
+				}
+				row.Cells = append(row.Cells, cell)
+			}
+			rows = append(rows, row)
+		}
+
+		data := struct {
+			From, Last     time.Time
+			Previous, Next string
+			Days           []time.Time
+			Rows           []CalendarRow
+		}{
+			From:     from,
+			Last:     to.AddDate(0, 0, -1),
+			Previous: from.AddDate(0, 0, -calendarDays).Format(time.DateOnly),
+			Next:     to.Format(time.DateOnly),
+			Days:     days,
+			Rows:     rows,
+		}
+
+		err = calendarTemplate.Execute(w, data)
+		if err != nil {
+			http.Error(w, "Error rendering template: "+err.Error(), http.StatusInternalServerError)
+		}
+	}
+}
+
+// BookingFormHandler renders the form for booking GPUs for a future window
+func BookingFormHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		data, err := loadRequestFormData(db)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if data.Projects, err = viewerProjects(r, db); err != nil {
+			http.Error(w, "Error querying projects: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		err = bookingFormTemplate.Execute(w, data)
+		if err != nil {
+			http.Error(w, "Error rendering template: "+err.Error(), http.StatusInternalServerError)
+		}
+	}
+}
+
+// CreateBookingHandler books GPUs for the signed-in user, charged to the project in
+// project_id if set. Times are in the server's time zone.
+func CreateBookingHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+			return
+		}
+		user := currentUser(w, r, db)
+		if user == nil {
+			return
+		}
+
+		numGPUs, err := strconv.Atoi(r.FormValue("num_gpus"))
+		if err != nil {
+			http.Error(w, "Invalid number of GPUs", http.StatusBadRequest)
+			return
+		}
+		start, err := time.ParseInLocation("2006-01-02T15:04", r.FormValue("start_time"), time.Local)
+		if err != nil {
+			http.Error(w, "Invalid start time", http.StatusBadRequest)
+			return
+		}
+		end, err := time.ParseInLocation("2006-01-02T15:04", r.FormValue("end_time"), time.Local)
+		if err != nil {
+			http.Error(w, "Invalid end time", http.StatusBadRequest)
+			return
+		}
+		projectID, err := formProjectID(r)
+		if err != nil {
+			http.Error(w, "Invalid project", http.StatusBadRequest)
+			return
+		}
+
+		id, err := services.CreateBooking(db, services.NewBooking{
+			UserID:     user.ID,
+			NumGPUs:    numGPUs,
+			GPUSize:    r.FormValue("gpu_size"),
+			Priority:   r.FormValue("priority"),
+			ServerName: r.FormValue("server_name"),
+			ProjectID:  projectID,
+			Start:      start,
+			End:        end,
+		})
+		renderCalendarResult(w, err, fmt.Sprintf("Booking #%d confirmed for %s to %s.",
+			id, start.Format("Mon Jan 2 15:04"), end.Format("Mon Jan 2 15:04")))
+	}
+}
+
+// CancelRequestHandler cancels a queued request or booking of the signed-in user or their projects
+func CancelRequestHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+			return
+		}
+		user := currentUser(w, r, db)
+		if user == nil {
+			return
+		}
+
+		id, err := strconv.Atoi(r.FormValue("id"))
+		if err != nil {
+			http.Error(w, "Invalid request ID", http.StatusBadRequest)
+			return
+		}
+
+		err = services.CancelRequest(db, id, user)
+		renderCalendarResult(w, err, fmt.Sprintf("Request #%d cancelled.", id))
+	}
+}
+
+// ExtendRequestHandler adds hours to a running request of the signed-in user or their projects. The hours
+// come from the "hours" field or, for the calendar's prompt, the HX-Prompt header.
+func ExtendRequestHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+			return
+		}
+		user := currentUser(w, r, db)
+		if user == nil {
+			return
+		}
+
+		id, err := strconv.Atoi(r.FormValue("id"))
+		if err != nil {
+			http.Error(w, "Invalid request ID", http.StatusBadRequest)
+			return
+		}
+		value := r.FormValue("hours")
+		if value == "" {
+			value = r.Header.Get("HX-Prompt")
+		}
+		hours, err := strconv.Atoi(strings.TrimSpace(value))
+		if err != nil {
+			http.Error(w, "Invalid number of hours", http.StatusBadRequest)
+			return
+		}
+
+		newEnd, err := services.ExtendRequest(db, id, hours, user)
+		renderCalendarResult(w, err, fmt.Sprintf("Request #%d extended until %s.", id, newEnd.Format("Mon Jan 2 15:04")))
+	}
+}
+
+// renderCalendarResult shows a rejection or the success message
+func renderCalendarResult(w http.ResponseWriter, err error, message string) {
+	data := struct {
+		Message string
+		Error   string
+	}{Message: message}
+	var rejection *services.RequestError
+	if errors.As(err, &rejection) {
+		data.Error = rejection.Reason
+	} else if err != nil {
+		http.Error(w, "Error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	err = calendarResultTemplate.Execute(w, data)
+	if err != nil {
+		http.Error(w, "Error rendering template: "+err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// today returns midnight of the current day in the server's time zone
+func today() time.Time {
+	now := time.Now()
+	return time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.Local)
+}
@@ -0,0 +1,128 @@
+package handlers
+
+import (
+	"crypto/subtle"
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/eduardo-escoto/gpu_request/server/internal/database"
+	"github.com/eduardo-escoto/gpu_request/server/internal/services"
+)
+
+const (
+	defaultCommandPollTimeout = 30 * time.Second
+	maxCommandPollTimeout     = 120 * time.Second
+)
+
+// authorizeCommandAPI checks the shared COMMAND_API_TOKEN. The command API stays
+// disabled until a token is configured, since it hands out work to the nodes.
+func authorizeCommandAPI(w http.ResponseWriter, r *http.Request) bool {
+	token := os.Getenv("COMMAND_API_TOKEN")
+	if token == "" {
+		http.Error(w, "Command API disabled: COMMAND_API_TOKEN is not set", http.StatusServiceUnavailable)
+		return false
+	}
+	if subtle.ConstantTimeCompare([]byte(r.Header.Get("Authorization")), []byte("Bearer "+token)) != 1 {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return false
+	}
+	return true
+}
+
+// CommandPollHandler long-polls for pending commands on a node. It answers as soon
+// as there is at least one pending command, or with an empty list once the timeout expires.
+func CommandPollHandler(db *sql.DB, broker *services.CommandBroker) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+			return
+		}
+		if !authorizeCommandAPI(w, r) {
+			return
+		}
+
+		nodeName := r.URL.Query().Get("node")
+		if nodeName == "" {
+			http.Error(w, "Missing node parameter", http.StatusBadRequest)
+			return
+		}
+
+		timeout := defaultCommandPollTimeout
+		if value := r.URL.Query().Get("timeout"); value != "" {
+			seconds, err := strconv.Atoi(value)
+			if err != nil || seconds < 0 {
+				http.Error(w, "Invalid timeout parameter", http.StatusBadRequest)
+				return
+			}
+			timeout = min(time.Duration(seconds)*time.Second, maxCommandPollTimeout)
+		}
+
+		// Subscribe before querying so a command queued in between is not missed
+		notify, cancel := broker.Subscribe(nodeName)
+		defer cancel()
+
+		commands, err := database.QueryPendingCommands(db, nodeName)
+		if err != nil {
+			http.Error(w, "Error querying commands: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		if len(commands) == 0 {
+			timer := time.NewTimer(timeout)
+			defer timer.Stop()
+
+			select {
+			case <-notify:
+				commands, err = database.QueryPendingCommands(db, nodeName)
+				if err != nil {
+					http.Error(w, "Error querying commands: "+err.Error(), http.StatusInternalServerError)
+					return
+				}
+			case <-timer.C:
+			case <-r.Context().Done():
+				return
+			}
+		}
+
+		if commands == nil {
+			commands = []database.Command{}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(commands)
+	}
+}
+
+// CreateCommandHandler queues a command for a node and wakes any daemon waiting on it
+func CreateCommandHandler(db *sql.DB, broker *services.CommandBroker) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+			return
+		}
+		if !authorizeCommandAPI(w, r) {
+			return
+		}
+
+		nodeName := r.FormValue("target_node")
+		commandType := r.FormValue("command_type")
+		if nodeName == "" || commandType == "" {
+			http.Error(w, "target_node and command_type are required", http.StatusBadRequest)
+			return
+		}
+
+		id, err := database.InsertCommand(db, nodeName, commandType, r.FormValue("parameters"))
+		if err != nil {
+			http.Error(w, "Error queueing command: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		broker.Publish(nodeName)
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(map[string]int64{"id": id})
+	}
+}
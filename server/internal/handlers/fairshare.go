@@ -0,0 +1,80 @@
+package handlers
+
+import (
+	"database/sql"
+	"html/template"
+	"net/http"
+
+	"github.com/eduardo-escoto/gpu_request/server/internal/scheduler"
+)
+
+var fairShareTemplate = template.Must(template.New("fairshare").Funcs(template.FuncMap{
+	"percent": func(fraction float64) float64 { return fraction * 100 },
+}).Parse(`
+    <div hx-get="/fairshare" hx-trigger="every 60s" hx-swap="outerHTML">
+        {{ if .Enabled }}
+        <p>
+            Within a priority level, queued requests are ordered by fair-share score. GPU usage
+            decays with a half-life of {{ .HalfLife }}{{ if .ByGroup }}, and each research group
+            is entitled to an equal share that is split between its members{{ else }}, and every
+            user is entitled to an equal share{{ end }}. The score is 2<sup>-usage/target</sup>:
+            1.00 means no recent usage, 0.50 means exactly the target share, lower means more.
+        </p>
+        <table>
+            <thead>
+                <tr>
+                    <th>User</th>
+                    {{ if .ByGroup }}<th>Group</th>{{ end }}
+                    <th>Decayed GPU-Hours</th>
+                    <th>Usage Share (%)</th>
+                    <th>Target Share (%)</th>
+                    <th>Score</th>
+                </tr>
+            </thead>
+            <tbody>
+                {{ $byGroup := .ByGroup }}
+                {{ range .Shares }}
+                <tr>
+                    <td>{{ .UserName }}</td>
+                    {{ if $byGroup }}<td>{{ if .Group }}{{ .Group }}{{ else }}-{{ end }}</td>{{ end }}
+                    <td>{{ printf "%.1f" .GPUHours }}</td>
+                    <td>{{ printf "%.1f" (percent .UsageShare) }}</td>
+                    <td>{{ printf "%.1f" (percent .TargetShare) }}</td>
+                    <td>{{ printf "%.2f" .Score }}</td>
+                </tr>
+                {{ end }}
+            </tbody>
+        </table>
+        {{ else }}
+        <p>Fair-share is disabled; queued requests are ordered by priority and age.</p>
+        {{ end }}
+    </div>
+`))
+
+// FairShareHandler explains each user's fair-share score as used by the scheduler
+func FairShareHandler(db *sql.DB, sched *scheduler.Scheduler) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		state, err := (&scheduler.SQLStore{DB: db, UsageWindow: sched.UsageWindow()}).LoadState()
+		if err != nil {
+			http.Error(w, "Error loading scheduler state: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		data := struct {
+			Enabled  bool
+			HalfLife string
+			ByGroup  bool
+			Shares   []scheduler.Share
+		}{
+			Enabled:  sched.FairShareHalfLife > 0,
+			HalfLife: sched.FairShareHalfLife.String(),
+			ByGroup:  sched.FairShareByGroup,
+			Shares:   sched.Shares(state),
+		}
+
+		err = fairShareTemplate.Execute(w, data)
+		if err != nil {
+			http.Error(w, "Error rendering template: "+err.Error(), http.StatusInternalServerError)
+		}
+	}
+}
@@ -0,0 +1,147 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"html/template"
+	"net/http"
+
+	"github.com/eduardo-escoto/gpu_request/server/internal/database"
+	"github.com/eduardo-escoto/gpu_request/server/internal/scheduler"
+)
+
+var gpuHealthTemplate = template.Must(template.New("gpu-health").Parse(`
+    <div id="gpu-health-view">
+        {{ if .Message }}<p>{{ .Message }}</p>{{ end }}
+        <table>
+            <thead>
+                <tr>
+                    <th>Server Name</th>
+                    <th>GPU</th>
+                    <th>State</th>
+                    <th>Reason</th>
+                    <th>Override</th>
+                    <th>Shared</th>
+                    <th>Updated</th>
+                </tr>
+            </thead>
+            <tbody>
+                {{ $admin := .IsAdmin }}
+                {{ range .GPUs }}
+                <tr>
+                    <td>{{ .ServerName }}</td>
+                    <td>#{{ .GPUNumber }} ({{ .ModelName }})</td>
+                    <td>{{ if eq .EffectiveHealth "healthy" }}{{ .EffectiveHealth }}{{ else }}<mark>{{ .EffectiveHealth }}</mark>{{ end }}</td>
+                    <td>{{ if .HealthReason.Valid }}{{ .HealthReason.String }}{{ end }}</td>
+                    <td>
+                        {{ if $admin }}
+                        <form hx-post="/gpu-health" hx-trigger="change" hx-target="#gpu-health-view" hx-swap="outerHTML">
+                            <input type="hidden" name="gpu_uuid" value="{{ .UUID }}">
+                            <select name="override">
+                                <option value="" {{ if not .HealthOverride.Valid }}selected{{ end }}>None (derived: {{ .Health }})</option>
+                                <option value="healthy" {{ if eq .HealthOverride.String "healthy" }}selected{{ end }}>Healthy</option>
+                                <option value="degraded" {{ if eq .HealthOverride.String "degraded" }}selected{{ end }}>Degraded</option>
+                                <option value="quarantined" {{ if eq .HealthOverride.String "quarantined" }}selected{{ end }}>Quarantined</option>
+                            </select>
+                        </form>
+                        {{ else if .HealthOverride.Valid }}{{ .HealthOverride.String }}{{ end }}
+                    </td>
+                    <td>
+                        {{ if $admin }}
+                        <form hx-post="/gpu-health/shared" hx-trigger="change" hx-target="#gpu-health-view" hx-swap="outerHTML">
+                            <input type="hidden" name="gpu_uuid" value="{{ .UUID }}">
+                            <input type="checkbox" name="shared" value="true" {{ if .Shared }}checked{{ end }}>
+                        </form>
+                        {{ else if .Shared }}VRAM slices{{ end }}
+                    </td>
+                    <td>{{ if .HealthUpdatedAt.Valid }}{{ .HealthUpdatedAt.Time.Format "Mon Jan 2 15:04" }}{{ end }}</td>
+                </tr>
+                {{ else }}
+                <tr><td colspan="7">No GPUs registered.</td></tr>
+                {{ end }}
+            </tbody>
+        </table>
+    </div>
+`))
+
+// GPUHealthHandler shows the health of every GPU. Admins override the derived health of
+// a GPU by posting gpu_uuid and override ("healthy", "degraded", "quarantined", or empty
+// to go back to the derived state); quarantined GPUs get no new requests.
+func GPUHealthHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		message := ""
+		if r.Method == http.MethodPost {
+			if currentAdmin(w, r, db) == nil {
+				return
+			}
+
+			override := r.FormValue("override")
+			switch override {
+			case "", scheduler.HealthHealthy, scheduler.HealthDegraded, scheduler.HealthQuarantined:
+			default:
+				http.Error(w, "Invalid health override", http.StatusBadRequest)
+				return
+			}
+			if err := database.SetGPUHealthOverride(db, r.FormValue("gpu_uuid"), override); err != nil {
+				http.Error(w, "Error overriding GPU health: "+err.Error(), http.StatusInternalServerError)
+				return
+			}
+			message = "Override cleared, the GPU's health is derived from its telemetry again."
+			if override != "" {
+				message = "GPU marked " + override + " until the override is cleared."
+			}
+		}
+
+		renderGPUHealth(w, r, db, message)
+	}
+}
+
+// GPUSharingHandler lets admins mark a GPU as shared (gpu_uuid, shared=true) so that it
+// only takes VRAM slice requests, bin-packed several to the GPU, or return it to whole-GPU
+// requests. Slices already running on it keep it until they end.
+func GPUSharingHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+			return
+		}
+		if currentAdmin(w, r, db) == nil {
+			return
+		}
+
+		shared := r.FormValue("shared") == "true"
+		err := database.SetGPUShared(db, r.FormValue("gpu_uuid"), shared)
+		if errors.Is(err, database.ErrGPUInUse) {
+			renderGPUHealth(w, r, db, "GPU not shared: "+err.Error()+"; share it once they end.")
+			return
+		}
+		if err != nil {
+			http.Error(w, "Error setting GPU sharing: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		message := "GPU returned to whole-GPU requests once its running slices end."
+		if shared {
+			message = "GPU shared: only VRAM slice requests are placed on it from now on."
+		}
+		renderGPUHealth(w, r, db, message)
+	}
+}
+
+// renderGPUHealth renders the health and sharing of every GPU
+func renderGPUHealth(w http.ResponseWriter, r *http.Request, db *sql.DB, message string) {
+	gpus, err := database.QueryGPUs(db)
+	if err != nil {
+		http.Error(w, "Error querying GPUs: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	data := struct {
+		Message string
+		IsAdmin bool
+		GPUs    []database.GPU
+	}{Message: message, IsAdmin: viewerIsAdmin(r, db), GPUs: gpus}
+	err = gpuHealthTemplate.Execute(w, data)
+	if err != nil {
+		http.Error(w, "Error rendering template: "+err.Error(), http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,306 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html/template"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/eduardo-escoto/gpu_request/server/internal/database"
+	"github.com/eduardo-escoto/gpu_request/server/internal/services"
+)
+
+// MaintenanceRow is a maintenance window with the GPU it applies to spelled out
+type MaintenanceRow struct {
+	database.MaintenanceWindow
+	GPUNumber int // -1 for the whole server
+}
+
+// ServerDrain is how many of a server's GPUs are draining
+type ServerDrain struct {
+	ServerName string
+	GPUs       []database.GPU
+	Draining   int
+}
+
+var maintenanceTemplate = template.Must(template.New("maintenance").Parse(`
+    <div id="maintenance-view">
+        {{ if .Error }}<p><mark>{{ .Error }}</mark></p>{{ else if .Message }}<p>{{ .Message }}</p>{{ end }}
+        <table>
+            <thead>
+                <tr>
+                    <th>Server Name</th>
+                    <th>GPU</th>
+                    <th>Start</th>
+                    <th>End</th>
+                    <th>Reason</th>
+                    {{ if .IsAdmin }}<th></th>{{ end }}
+                </tr>
+            </thead>
+            <tbody>
+                {{ $admin := .IsAdmin }}
+                {{ range .Windows }}
+                <tr>
+                    <td>{{ .ServerName }}</td>
+                    <td>{{ if lt .GPUNumber 0 }}All{{ else }}#{{ .GPUNumber }}{{ end }}</td>
+                    <td>{{ .StartTime.Format "Mon Jan 2 15:04" }}</td>
+                    <td>{{ .EndTime.Format "Mon Jan 2 15:04" }}</td>
+                    <td>{{ .Reason }}</td>
+                    {{ if $admin }}<td><a href="#" hx-post="/maintenance/delete" hx-vals='{"id": "{{ .ID }}"}' hx-confirm="Delete this maintenance window?" hx-target="#maintenance-view" hx-swap="outerHTML">delete</a></td>{{ end }}
+                </tr>
+                {{ else }}
+                <tr><td colspan="{{ if .IsAdmin }}6{{ else }}5{{ end }}">No maintenance scheduled.</td></tr>
+                {{ end }}
+            </tbody>
+        </table>
+
+        <table>
+            <thead>
+                <tr>
+                    <th>Server Name</th>
+                    <th>Draining</th>
+                    {{ if .IsAdmin }}<th></th>{{ end }}
+                </tr>
+            </thead>
+            <tbody>
+                {{ range .Servers }}
+                <tr>
+                    <td>{{ .ServerName }}</td>
+                    <td>{{ if .Draining }}{{ .Draining }} of {{ len .GPUs }} GPU(s): {{ range .GPUs }}{{ if .Draining }}#{{ .GPUNumber }} {{ end }}{{ end }}{{ else }}No{{ end }}</td>
+                    {{ if $admin }}
+                    <td>
+                        {{ if lt .Draining (len .GPUs) }}<a href="#" hx-post="/maintenance/drain" hx-vals='{"server_name": "{{ .ServerName }}", "draining": "true"}' hx-confirm="Stop placing new requests on {{ .ServerName }}?" hx-target="#maintenance-view" hx-swap="outerHTML">drain</a>{{ end }}
+                        {{ if .Draining }}<a href="#" hx-post="/maintenance/drain" hx-vals='{"server_name": "{{ .ServerName }}", "draining": "false"}' hx-target="#maintenance-view" hx-swap="outerHTML">return to service</a>{{ end }}
+                    </td>
+                    {{ end }}
+                </tr>
+                {{ end }}
+            </tbody>
+        </table>
+
+        {{ if .IsAdmin }}
+        <h3>Conflicting Reservations</h3>
+        <table>
+            <thead>
+                <tr>
+                    <th>Request</th>
+                    <th>User</th>
+                    <th>GPU</th>
+                    <th>Reserved</th>
+                    <th>Maintenance</th>
+                </tr>
+            </thead>
+            <tbody>
+                {{ range .Conflicts }}
+                <tr>
+                    <td>#{{ .RequestID }} ({{ if eq .Status "in_progress" }}running{{ else }}booked{{ end }})</td>
+                    <td>{{ .UserName }}</td>
+                    <td>{{ .ServerName }} #{{ .GPUNumber }}</td>
+                    <td>{{ .StartTime.Format "Jan 2 15:04" }}&ndash;{{ .EndTime.Format "Jan 2 15:04" }}</td>
+                    <td>window #{{ .WindowID }}</td>
+                </tr>
+                {{ else }}
+                <tr><td colspan="5">No active reservation overlaps a maintenance window.</td></tr>
+                {{ end }}
+            </tbody>
+        </table>
+
+        <form hx-post="/maintenance" hx-target="#maintenance-view" hx-swap="outerHTML">
+            <div class="grid">
+                <label>
+                    Server
+                    <select name="server_name">
+                        {{ range .Servers }}<option value="{{ .ServerName }}">{{ .ServerName }}</option>{{ end }}
+                    </select>
+                </label>
+                <label>
+                    GPU
+                    <select name="gpu_uuid">
+                        <option value="">Whole server</option>
+                        {{ range .Servers }}{{ range .GPUs }}<option value="{{ .UUID }}">{{ .ServerName }} #{{ .GPUNumber }}</option>{{ end }}{{ end }}
+                    </select>
+                </label>
+                <label>
+                    Start
+                    <input type="datetime-local" name="start_time" required>
+                </label>
+                <label>
+                    End
+                    <input type="datetime-local" name="end_time" required>
+                </label>
+            </div>
+            <label>
+                Reason
+                <input type="text" name="reason" placeholder="e.g., driver upgrade">
+            </label>
+            <button type="submit">Schedule Maintenance</button>
+        </form>
+        {{ end }}
+    </div>
+`))
+
+// MaintenanceHandler shows maintenance windows and draining servers; admins also see the
+// reservations that conflict with upcoming maintenance and can schedule new windows by
+// posting the form
+func MaintenanceHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			renderMaintenance(w, r, db, "", nil)
+			return
+		}
+		if currentAdmin(w, r, db) == nil {
+			return
+		}
+
+		start, err := time.ParseInLocation("2006-01-02T15:04", r.FormValue("start_time"), time.Local)
+		if err != nil {
+			http.Error(w, "Invalid start time", http.StatusBadRequest)
+			return
+		}
+		end, err := time.ParseInLocation("2006-01-02T15:04", r.FormValue("end_time"), time.Local)
+		if err != nil {
+			http.Error(w, "Invalid end time", http.StatusBadRequest)
+			return
+		}
+
+		id, err := services.CreateMaintenanceWindow(db, services.NewMaintenanceWindow{
+			ServerName: r.FormValue("server_name"),
+			GPUUUID:    r.FormValue("gpu_uuid"),
+			Start:      start,
+			End:        end,
+			Reason:     r.FormValue("reason"),
+		})
+		renderMaintenance(w, r, db, fmt.Sprintf("Maintenance window #%d scheduled; check the conflicting reservations below.", id), err)
+	}
+}
+
+// DeleteMaintenanceHandler removes a maintenance window (admins only)
+func DeleteMaintenanceHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+			return
+		}
+		if currentAdmin(w, r, db) == nil {
+			return
+		}
+
+		id, err := strconv.Atoi(r.FormValue("id"))
+		if err != nil {
+			http.Error(w, "Invalid maintenance window ID", http.StatusBadRequest)
+			return
+		}
+
+		err = database.DeleteMaintenanceWindow(db, id)
+		renderMaintenance(w, r, db, fmt.Sprintf("Maintenance window #%d deleted.", id), err)
+	}
+}
+
+// DrainHandler starts or stops draining a server, or one GPU of it with gpu_uuid (admins only).
+// Draining GPUs keep their running requests but get no new requests or bookings.
+func DrainHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+			return
+		}
+		if currentAdmin(w, r, db) == nil {
+			return
+		}
+
+		serverName := r.FormValue("server_name")
+		draining := r.FormValue("draining") == "true"
+		err := database.SetDraining(db, serverName, r.FormValue("gpu_uuid"), draining)
+		message := serverName + " returned to service."
+		if draining {
+			message = serverName + " is draining: running requests continue, new ones are placed elsewhere."
+		}
+		renderMaintenance(w, r, db, message, err)
+	}
+}
+
+// MaintenanceConflictsAPIHandler returns the reservations overlapping maintenance windows as JSON (admins only)
+func MaintenanceConflictsAPIHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if currentAdmin(w, r, db) == nil {
+			return
+		}
+
+		conflicts, err := services.MaintenanceConflicts(db)
+		if err != nil {
+			http.Error(w, "Error finding maintenance conflicts: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(conflicts)
+	}
+}
+
+// renderMaintenance renders the maintenance section with the outcome of an admin action.
+// A rejection is shown in place; any other error fails the request.
+func renderMaintenance(w http.ResponseWriter, r *http.Request, db *sql.DB, message string, actionErr error) {
+	data := struct {
+		Message   string
+		Error     string
+		IsAdmin   bool
+		Windows   []MaintenanceRow
+		Servers   []ServerDrain
+		Conflicts []services.MaintenanceConflict
+	}{Message: message, IsAdmin: viewerIsAdmin(r, db)}
+
+	var rejection *services.RequestError
+	if errors.As(actionErr, &rejection) {
+		data.Error, data.Message = rejection.Reason, ""
+	} else if actionErr != nil {
+		http.Error(w, "Error: "+actionErr.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	gpus, err := database.QueryGPUs(db)
+	if err != nil {
+		http.Error(w, "Error querying GPUs: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	windows, err := database.QueryMaintenanceWindows(db, time.Now())
+	if err != nil {
+		http.Error(w, "Error querying maintenance windows: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	number := make(map[string]int)
+	for _, gpu := range gpus {
+		number[gpu.UUID] = gpu.GPUNumber
+		if len(data.Servers) == 0 || data.Servers[len(data.Servers)-1].ServerName != gpu.ServerName {
+			data.Servers = append(data.Servers, ServerDrain{ServerName: gpu.ServerName})
+		}
+		server := &data.Servers[len(data.Servers)-1]
+		server.GPUs = append(server.GPUs, gpu)
+		if gpu.Draining {
+			server.Draining++
+		}
+	}
+	for _, window := range windows {
+		row := MaintenanceRow{MaintenanceWindow: window, GPUNumber: -1}
+		if window.GPUUUID.Valid {
+			row.GPUNumber = number[window.GPUUUID.String]
+		}
+		data.Windows = append(data.Windows, row)
+	}
+	if data.IsAdmin {
+		data.Conflicts, err = services.MaintenanceConflicts(db)
+		if err != nil {
+			http.Error(w, "Error finding maintenance conflicts: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+
+	err = maintenanceTemplate.Execute(w, data)
+	if err != nil {
+		http.Error(w, "Error rendering template: "+err.Error(), http.StatusInternalServerError)
+	}
+}
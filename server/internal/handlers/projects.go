@@ -0,0 +1,310 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html/template"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/eduardo-escoto/gpu_request/server/internal/database"
+	"github.com/eduardo-escoto/gpu_request/server/internal/services"
+)
+
+// projectReportDays is the default usage period of project reports
+const projectReportDays = 30
+
+var projectsTemplate = template.Must(template.New("projects").Parse(`
+    <div id="projects-view">
+        {{ if .Error }}<p><mark>{{ .Error }}</mark></p>{{ else if .Message }}<p>{{ .Message }}</p>{{ end }}
+        <div id="projects-result"></div>
+        {{ $admin := .IsAdmin }}
+        {{ range .Reports }}
+        {{ $project := . }}
+        {{ $manages := or $admin (eq .Role "manager") }}
+        <article>
+            <header>
+                <strong>{{ .Name }}</strong>{{ if .Role }} ({{ .Role }}){{ end }}
+                {{ if .Description }}<br><small>{{ .Description }}</small>{{ end }}
+            </header>
+            <p>
+                {{ .Totals.ActiveGPUs }} GPU(s) queued or running{{ if .MaxConcurrentGPUs.Valid }} of {{ .MaxConcurrentGPUs.Int64 }}{{ end }};
+                {{ .Totals.ReservedGPUHours }} GPU-hours requested in the last 7 days{{ if .MaxWeeklyGPUHours.Valid }} of {{ .MaxWeeklyGPUHours.Int64 }}{{ end }}.
+            </p>
+
+            <h4>Members</h4>
+            <table>
+                <tbody>
+                    {{ range .Members }}
+                    <tr>
+                        <td>{{ .UserName }}</td>
+                        <td>{{ .Role }}</td>
+                        {{ if $manages }}<td><a href="#" hx-post="/projects/members" hx-vals='{"project_id": "{{ $project.ID }}", "user_name": "{{ .UserName }}", "remove": "true"}' hx-confirm="Remove {{ .UserName }} from {{ $project.Name }}?" hx-target="#projects-view" hx-swap="outerHTML">remove</a></td>{{ end }}
+                    </tr>
+                    {{ end }}
+                </tbody>
+            </table>
+            {{ if $manages }}
+            <form hx-post="/projects/members" hx-target="#projects-view" hx-swap="outerHTML">
+                <input type="hidden" name="project_id" value="{{ .ID }}">
+                <div class="grid">
+                    <input type="text" name="user_name" placeholder="User name or email" required>
+                    <select name="role">
+                        <option value="member">Member</option>
+                        <option value="manager">Manager</option>
+                    </select>
+                    <button type="submit">Add or Update Member</button>
+                </div>
+            </form>
+            {{ end }}
+
+            <h4>Reservations</h4>
+            <table>
+                <tbody>
+                    {{ range .Requests }}
+                    <tr>
+                        <td>#{{ .ID }}</td>
+                        <td>{{ .UserName }}</td>
+                        <td>{{ .NumGPUs }} {{ .GPUSize }} GPU(s), {{ .RequestedTime }}h, {{ .Priority }}</td>
+                        <td>{{ .Status }}{{ if .EndTime.Valid }} until {{ .EndTime.Time.Format "Mon Jan 2 15:04" }}{{ end }}</td>
+                        <td>{{ if ne .Status "in_progress" }}<a href="#" hx-post="/requests/cancel" hx-vals='{"id": "{{ .ID }}"}' hx-confirm="Cancel request #{{ .ID }}?" hx-target="#projects-result">cancel</a>{{ end }}</td>
+                    </tr>
+                    {{ else }}
+                    <tr><td>No active reservations.</td></tr>
+                    {{ end }}
+                </tbody>
+            </table>
+
+            <h4>Usage since {{ .Since.Format "Jan 2" }}</h4>
+            <table>
+                <thead>
+                    <tr>
+                        <th>Member</th>
+                        <th>Requests</th>
+                        <th>GPU-Hours Requested</th>
+                        <th>GPU-Hours Held</th>
+                    </tr>
+                </thead>
+                <tbody>
+                    {{ range .Usage }}
+                    <tr>
+                        <td>{{ .UserName }}</td>
+                        <td>{{ .Requests }}</td>
+                        <td>{{ .ReservedGPUHours }}</td>
+                        <td>{{ printf "%.1f" .HeldGPUHours }}</td>
+                    </tr>
+                    {{ else }}
+                    <tr><td colspan="4">No usage.</td></tr>
+                    {{ end }}
+                </tbody>
+            </table>
+
+            {{ if $admin }}
+            <form hx-post="/projects/quota" hx-target="#projects-view" hx-swap="outerHTML">
+                <input type="hidden" name="project_id" value="{{ .ID }}">
+                <div class="grid">
+                    <input type="number" name="max_concurrent_gpus" min="0" placeholder="Max GPUs at once" value="{{ if .MaxConcurrentGPUs.Valid }}{{ .MaxConcurrentGPUs.Int64 }}{{ end }}">
+                    <input type="number" name="max_weekly_gpu_hours" min="0" placeholder="Max GPU-hours per week" value="{{ if .MaxWeeklyGPUHours.Valid }}{{ .MaxWeeklyGPUHours.Int64 }}{{ end }}">
+                    <button type="submit" class="secondary">Update Quota</button>
+                </div>
+            </form>
+            {{ end }}
+        </article>
+        {{ else }}
+        <p>You are not a member of any project.</p>
+        {{ end }}
+
+        {{ if .IsAdmin }}
+        <h3>New Project</h3>
+        <form hx-post="/projects" hx-target="#projects-view" hx-swap="outerHTML">
+            <div class="grid">
+                <input type="text" name="name" placeholder="Name" required>
+                <input type="text" name="manager" placeholder="Manager's user name or email" required>
+                <input type="number" name="max_concurrent_gpus" min="0" placeholder="Max GPUs at once">
+                <input type="number" name="max_weekly_gpu_hours" min="0" placeholder="Max GPU-hours per week">
+            </div>
+            <input type="text" name="description" placeholder="Description">
+            <button type="submit">Create Project</button>
+        </form>
+        {{ end }}
+    </div>
+`))
+
+// ProjectsHandler shows the signed-in user's projects (every project for admins) with
+// their members, reservations, quota and usage. Admins create projects by posting the form.
+func ProjectsHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			renderProjects(w, r, db, "", nil)
+			return
+		}
+		admin := currentAdmin(w, r, db)
+		if admin == nil {
+			return
+		}
+
+		maxGPUs, maxHours, err := formProjectQuota(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		project := database.Project{
+			Name:              r.FormValue("name"),
+			Description:       r.FormValue("description"),
+			MaxConcurrentGPUs: maxGPUs,
+			MaxWeeklyGPUHours: maxHours,
+		}
+		_, err = services.CreateProject(db, project, r.FormValue("manager"), admin)
+		renderProjects(w, r, db, fmt.Sprintf("Project %s created.", project.Name), err)
+	}
+}
+
+// ProjectMembersHandler adds a member to a project or changes their role, or removes
+// them with remove=true (managers of the project and admins only)
+func ProjectMembersHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+			return
+		}
+		user := currentUser(w, r, db)
+		if user == nil {
+			return
+		}
+
+		projectID, err := strconv.Atoi(r.FormValue("project_id"))
+		if err != nil {
+			http.Error(w, "Invalid project ID", http.StatusBadRequest)
+			return
+		}
+		userName := r.FormValue("user_name")
+
+		if r.FormValue("remove") == "true" {
+			err = services.RemoveProjectMember(db, projectID, userName, user)
+			renderProjects(w, r, db, userName+" removed.", err)
+			return
+		}
+		role := r.FormValue("role")
+		err = services.SetProjectMember(db, projectID, userName, role, user)
+		renderProjects(w, r, db, fmt.Sprintf("%s is now a %s.", userName, role), err)
+	}
+}
+
+// ProjectQuotaHandler changes a project's allocation (admins only); empty limits are unlimited
+func ProjectQuotaHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+			return
+		}
+		admin := currentAdmin(w, r, db)
+		if admin == nil {
+			return
+		}
+
+		projectID, err := strconv.Atoi(r.FormValue("project_id"))
+		if err != nil {
+			http.Error(w, "Invalid project ID", http.StatusBadRequest)
+			return
+		}
+		maxGPUs, maxHours, err := formProjectQuota(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		err = services.UpdateProjectQuota(db, projectID, maxGPUs, maxHours, admin)
+		renderProjects(w, r, db, "Project quota updated.", err)
+	}
+}
+
+// ProjectUsageAPIHandler returns the report of the project in project_id as JSON, covering
+// the last "days" days (30 by default), to members of the project and admins
+func ProjectUsageAPIHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user := currentUser(w, r, db)
+		if user == nil {
+			return
+		}
+
+		projectID, err := strconv.Atoi(r.URL.Query().Get("project_id"))
+		if err != nil {
+			http.Error(w, "Invalid project ID", http.StatusBadRequest)
+			return
+		}
+		days := projectReportDays
+		if value := r.URL.Query().Get("days"); value != "" {
+			if days, err = strconv.Atoi(value); err != nil || days < 1 {
+				http.Error(w, "Invalid number of days", http.StatusBadRequest)
+				return
+			}
+		}
+
+		report, err := services.LoadProjectReport(db, projectID, user, time.Now().AddDate(0, 0, -days))
+		var rejection *services.RequestError
+		if errors.As(err, &rejection) {
+			http.Error(w, rejection.Reason, http.StatusForbidden)
+			return
+		} else if err != nil {
+			http.Error(w, "Error loading project report: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(report)
+	}
+}
+
+// formProjectQuota reads the optional max_concurrent_gpus and max_weekly_gpu_hours fields
+func formProjectQuota(r *http.Request) (sql.NullInt64, sql.NullInt64, error) {
+	var limits [2]sql.NullInt64
+	for i, field := range []string{"max_concurrent_gpus", "max_weekly_gpu_hours"} {
+		value := r.FormValue(field)
+		if value == "" {
+			continue
+		}
+		limit, err := strconv.ParseInt(value, 10, 64)
+		if err != nil || limit < 0 {
+			return sql.NullInt64{}, sql.NullInt64{}, fmt.Errorf("Invalid %s", field)
+		}
+		limits[i] = sql.NullInt64{Int64: limit, Valid: true}
+	}
+	return limits[0], limits[1], nil
+}
+
+// renderProjects renders the projects section with the outcome of an action.
+// A rejection is shown in place; any other error fails the request.
+func renderProjects(w http.ResponseWriter, r *http.Request, db *sql.DB, message string, actionErr error) {
+	data := struct {
+		Message string
+		Error   string
+		IsAdmin bool
+		Reports []services.ProjectReport
+	}{Message: message}
+
+	var rejection *services.RequestError
+	if errors.As(actionErr, &rejection) {
+		data.Error, data.Message = rejection.Reason, ""
+	} else if actionErr != nil {
+		http.Error(w, "Error: "+actionErr.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if user := optionalUser(r, db); user != nil {
+		data.IsAdmin = user.IsAdmin
+		reports, err := services.LoadProjectReports(db, user, time.Now().AddDate(0, 0, -projectReportDays))
+		if err != nil {
+			http.Error(w, "Error loading projects: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		data.Reports = reports
+	}
+
+	err := projectsTemplate.Execute(w, data)
+	if err != nil {
+		http.Error(w, "Error rendering template: "+err.Error(), http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,91 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"html/template"
+	"net/http"
+
+	"github.com/eduardo-escoto/gpu_request/server/internal/scheduler"
+	"github.com/eduardo-escoto/gpu_request/server/internal/services"
+)
+
+var queueTemplate = template.Must(template.New("queue").Parse(`
+    <table hx-get="/queue" hx-trigger="every 30s" hx-swap="outerHTML">
+        <thead>
+            <tr>
+                <th>Position</th>
+                <th>Request</th>
+                <th>User</th>
+                <th>GPUs</th>
+                <th>Hours</th>
+                <th>Priority</th>
+                <th>Server</th>
+                <th>Submitted</th>
+                <th>Estimated Start</th>
+                <th>Waiting For</th>
+            </tr>
+        </thead>
+        <tbody>
+            {{ range . }}
+            <tr>
+                <td>{{ .Position }}</td>
+                <td>#{{ .RequestID }}</td>
+                <td>{{ .UserName }}</td>
+                <td>{{ if .VRAMMB }}{{ .VRAMMB }} MB of 1 shared {{ .GPUSize }}{{ else }}{{ .NumGPUs }} {{ .GPUSize }}{{ end }}</td>
+                <td>{{ .RequestedHours }}</td>
+                <td>{{ .Priority }}</td>
+                <td>{{ if .ServerName }}{{ .ServerName }}{{ else }}Any{{ end }}</td>
+                <td>{{ .CreatedAt.Format "2006-01-02 15:04" }}</td>
+                <td>{{ if .EstimatedStart }}{{ .EstimatedStart.Format "2006-01-02 15:04" }}{{ else }}Unknown{{ end }}</td>
+                <td>{{ if .Reason }}{{ .Reason }}{{ else }}Starting now{{ end }}</td>
+            </tr>
+            {{ else }}
+            <tr><td colspan="10">No requests are waiting.</td></tr>
+            {{ end }}
+        </tbody>
+    </table>
+`))
+
+// QueueHandler lists the requests waiting for GPUs with their estimated start and what blocks them
+func QueueHandler(db *sql.DB, sched *scheduler.Scheduler) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		entries, err := services.LoadQueue(db, sched)
+		if err != nil {
+			http.Error(w, "Error loading queue: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		err = queueTemplate.Execute(w, entries)
+		if err != nil {
+			http.Error(w, "Error rendering template: "+err.Error(), http.StatusInternalServerError)
+		}
+	}
+}
+
+// QueueAPIHandler returns the queue forecast as JSON, optionally only for ?user=<user_name>
+func QueueAPIHandler(db *sql.DB, sched *scheduler.Scheduler) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		entries, err := services.LoadQueue(db, sched)
+		if err != nil {
+			http.Error(w, "Error loading queue: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		if user := r.URL.Query().Get("user"); user != "" {
+			filtered := []services.QueueEntry{}
+			for _, entry := range entries {
+				if entry.UserName == user {
+					filtered = append(filtered, entry)
+				}
+			}
+			entries = filtered
+		}
+		if entries == nil {
+			entries = []services.QueueEntry{}
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(entries)
+	}
+}
@@ -0,0 +1,326 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"html/template"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/eduardo-escoto/gpu_request/server/internal/services"
+)
+
+var recurringFormTemplate = template.Must(template.New("recurring-form").Parse(`
+    <form hx-post="/bookings/recurring" hx-target="#recurring-view" hx-swap="outerHTML">
+        <div class="grid">
+            <label>
+                GPUs
+                <input type="number" name="num_gpus" min="1" value="1" required>
+            </label>
+            <label>
+                Size
+                <select name="gpu_size">
+                    {{ range .SizeClasses }}
+                    <option value="{{ .Size }}">{{ .Size }} ({{ .Describe }})</option>
+                    {{ end }}
+                </select>
+            </label>
+            <label>
+                Priority
+                <select name="priority">
+                    {{ range .Priorities }}
+                    <option value="{{ . }}">{{ . }}</option>
+                    {{ end }}
+                </select>
+            </label>
+            <label>
+                Server
+                <select name="server_name">
+                    <option value="">Any server</option>
+                    {{ range .Servers }}
+                    <option value="{{ . }}">{{ . }}</option>
+                    {{ end }}
+                </select>
+            </label>
+            {{ if .Projects }}
+            <label>
+                Charge To
+                <select name="project_id">
+                    <option value="">Personal allocation</option>
+                    {{ range .Projects }}
+                    <option value="{{ .ID }}">{{ .Name }}</option>
+                    {{ end }}
+                </select>
+            </label>
+            {{ end }}
+        </div>
+        <div class="grid">
+            <label>
+                First Start
+                <input type="datetime-local" name="start_time" required>
+            </label>
+            <label>
+                First End
+                <input type="datetime-local" name="end_time" required>
+            </label>
+            <label>
+                Repeat
+                <select name="frequency">
+                    <option value="WEEKLY">Weekly</option>
+                    <option value="DAILY">Daily</option>
+                </select>
+            </label>
+            <label>
+                Every
+                <input type="number" name="interval" min="1" value="1" required>
+            </label>
+            <label>
+                Until
+                <input type="date" name="until" required>
+            </label>
+        </div>
+        <fieldset>
+            <legend>On (weekly; the first start's day if none)</legend>
+            {{ range .Weekdays }}
+            <label><input type="checkbox" name="byday" value="{{ . }}"> {{ . }}</label>
+            {{ end }}
+        </fieldset>
+        <label>
+            Except
+            <input type="text" name="skip" placeholder="Dates to skip, e.g., 2026-11-26, 2026-12-24">
+        </label>
+        <button type="submit">Book Recurring GPUs</button>
+    </form>
+`))
+
+var recurringTemplate = template.Must(template.New("recurring").Parse(`
+    <div id="recurring-view">
+        {{ if .Error }}<p><mark>{{ .Error }}</mark></p>{{ else if .Message }}<p>{{ .Message }}</p>{{ end }}
+        <table>
+            <thead>
+                <tr>
+                    <th>Series</th>
+                    <th>User</th>
+                    <th>GPUs</th>
+                    <th>Repeats</th>
+                    <th>Booked</th>
+                    <th>Exceptions</th>
+                    <th></th>
+                </tr>
+            </thead>
+            <tbody>
+                {{ range .Series }}
+                <tr>
+                    <td>#{{ .ID }}</td>
+                    <td>{{ .UserName }}</td>
+                    <td>{{ .NumGPUs }} {{ .GPUSize }}</td>
+                    <td>{{ .Description }}, {{ .FirstStart.Format "15:04" }} for {{ .DurationMinutes }} min, until {{ .UntilDate.Format "Jan 2 2006" }}</td>
+                    <td>{{ range .Upcoming }}{{ .StartTime.Time.Format "Jan 2" }} (#{{ .ID }})<br>{{ else }}-{{ end }}</td>
+                    <td>{{ range .Exceptions }}{{ .OccurrenceDate.Format "Jan 2" }}: {{ .Reason }}<br>{{ else }}-{{ end }}</td>
+                    <td>
+                        <a href="#" hx-post="/bookings/recurring/skip" hx-vals='{"id": "{{ .ID }}"}' hx-prompt="Skip which day of series #{{ .ID }}? (YYYY-MM-DD)" hx-target="#recurring-view" hx-swap="outerHTML">skip a day</a>
+                        <a href="#" hx-post="/bookings/recurring/cancel" hx-vals='{"id": "{{ .ID }}"}' hx-confirm="Cancel series #{{ .ID }} and its upcoming bookings?" hx-target="#recurring-view" hx-swap="outerHTML">cancel series</a>
+                    </td>
+                </tr>
+                {{ else }}
+                <tr><td colspan="7">No recurring bookings.</td></tr>
+                {{ end }}
+            </tbody>
+        </table>
+    </div>
+`))
+
+// RecurringBookingFormHandler renders the form for booking GPUs on a recurring schedule
+func RecurringBookingFormHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		data, err := loadRequestFormData(db)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if data.Projects, err = viewerProjects(r, db); err != nil {
+			http.Error(w, "Error querying projects: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		err = recurringFormTemplate.Execute(w, struct {
+			RequestFormData
+			Weekdays []string
+		}{data, []string{"MO", "TU", "WE", "TH", "FR", "SA", "SU"}})
+		if err != nil {
+			http.Error(w, "Error rendering template: "+err.Error(), http.StatusInternalServerError)
+		}
+	}
+}
+
+// RecurringBookingsHandler lists the recurring bookings the signed-in user can manage and,
+// on POST, creates one from the form. Times are in the server's time zone.
+func RecurringBookingsHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			renderRecurring(w, r, db, "", nil)
+			return
+		}
+		user := currentUser(w, r, db)
+		if user == nil {
+			return
+		}
+
+		numGPUs, err := strconv.Atoi(r.FormValue("num_gpus"))
+		if err != nil {
+			http.Error(w, "Invalid number of GPUs", http.StatusBadRequest)
+			return
+		}
+		start, err := time.ParseInLocation("2006-01-02T15:04", r.FormValue("start_time"), time.Local)
+		if err != nil {
+			http.Error(w, "Invalid start time", http.StatusBadRequest)
+			return
+		}
+		end, err := time.ParseInLocation("2006-01-02T15:04", r.FormValue("end_time"), time.Local)
+		if err != nil {
+			http.Error(w, "Invalid end time", http.StatusBadRequest)
+			return
+		}
+		until, err := time.ParseInLocation(time.DateOnly, r.FormValue("until"), time.Local)
+		if err != nil {
+			http.Error(w, "Invalid end date", http.StatusBadRequest)
+			return
+		}
+		projectID, err := formProjectID(r)
+		if err != nil {
+			http.Error(w, "Invalid project", http.StatusBadRequest)
+			return
+		}
+		var skip []time.Time
+		for _, value := range strings.Split(r.FormValue("skip"), ",") {
+			if value = strings.TrimSpace(value); value == "" {
+				continue
+			}
+			day, err := time.ParseInLocation(time.DateOnly, value, time.Local)
+			if err != nil {
+				http.Error(w, fmt.Sprintf("Invalid date to skip %q", value), http.StatusBadRequest)
+				return
+			}
+			skip = append(skip, day)
+		}
+
+		rule := fmt.Sprintf("FREQ=%s;INTERVAL=%s", r.FormValue("frequency"), r.FormValue("interval"))
+		if days := r.Form["byday"]; len(days) > 0 {
+			rule += ";BYDAY=" + strings.Join(days, ",")
+		}
+
+		id, materialized, err := services.CreateRecurringBooking(db, services.NewRecurringBooking{
+			UserID:     user.ID,
+			NumGPUs:    numGPUs,
+			GPUSize:    r.FormValue("gpu_size"),
+			Priority:   r.FormValue("priority"),
+			ServerName: r.FormValue("server_name"),
+			ProjectID:  projectID,
+			Start:      start,
+			End:        end,
+			Rule:       rule,
+			Until:      until,
+			Skip:       skip,
+		})
+		message := fmt.Sprintf("Recurring booking #%d created; %d occurrence(s) in the next four weeks booked.", id, len(materialized.Booked))
+		if len(materialized.Conflicts) > 0 {
+			days := make([]string, len(materialized.Conflicts))
+			for i, start := range materialized.Conflicts {
+				days[i] = start.Format("Mon Jan 2")
+			}
+			message += " These could not be booked because their GPUs are taken: " + strings.Join(days, ", ") + "."
+		}
+		renderRecurring(w, r, db, message, err)
+	}
+}
+
+// CancelRecurringBookingHandler cancels a recurring booking and its upcoming occurrences
+func CancelRecurringBookingHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+			return
+		}
+		user := currentUser(w, r, db)
+		if user == nil {
+			return
+		}
+
+		id, err := strconv.Atoi(r.FormValue("id"))
+		if err != nil {
+			http.Error(w, "Invalid recurring booking ID", http.StatusBadRequest)
+			return
+		}
+
+		err = services.CancelRecurringBooking(db, id, user)
+		renderRecurring(w, r, db, fmt.Sprintf("Recurring booking #%d cancelled.", id), err)
+	}
+}
+
+// SkipOccurrenceHandler cancels one occurrence of a recurring booking. The day
+// (YYYY-MM-DD) comes from the "day" field or, for the list's prompt, the HX-Prompt header.
+func SkipOccurrenceHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+			return
+		}
+		user := currentUser(w, r, db)
+		if user == nil {
+			return
+		}
+
+		id, err := strconv.Atoi(r.FormValue("id"))
+		if err != nil {
+			http.Error(w, "Invalid recurring booking ID", http.StatusBadRequest)
+			return
+		}
+		value := r.FormValue("day")
+		if value == "" {
+			value = r.Header.Get("HX-Prompt")
+		}
+		day, err := time.ParseInLocation(time.DateOnly, strings.TrimSpace(value), time.Local)
+		if err != nil {
+			http.Error(w, "Invalid day", http.StatusBadRequest)
+			return
+		}
+
+		err = services.SkipOccurrence(db, id, day, user)
+		renderRecurring(w, r, db, fmt.Sprintf("Recurring booking #%d skips %s.", id, day.Format("Mon Jan 2")), err)
+	}
+}
+
+// renderRecurring renders the recurring bookings list with the outcome of an action.
+// A rejection is shown in place; any other error fails the request.
+func renderRecurring(w http.ResponseWriter, r *http.Request, db *sql.DB, message string, actionErr error) {
+	data := struct {
+		Message string
+		Error   string
+		Series  []services.RecurringSummary
+	}{Message: message}
+
+	var rejection *services.RequestError
+	if errors.As(actionErr, &rejection) {
+		data.Error, data.Message = rejection.Reason, ""
+	} else if actionErr != nil {
+		http.Error(w, "Error: "+actionErr.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if user := optionalUser(r, db); user != nil {
+		series, err := services.LoadRecurringBookings(db, user)
+		if err != nil {
+			http.Error(w, "Error loading recurring bookings: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		data.Series = series
+	}
+
+	err := recurringTemplate.Execute(w, data)
+	if err != nil {
+		http.Error(w, "Error rendering template: "+err.Error(), http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,102 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"html/template"
+	"net/http"
+	"strconv"
+
+	"github.com/eduardo-escoto/gpu_request/server/internal/services"
+)
+
+var requestDetailTemplate = template.Must(template.New("request-detail").Parse(`
+    <div id="request-detail">
+        {{ with .Detail }}
+        <h3>Request #{{ .RequestID }}</h3>
+        <p>
+            {{ .UserName }}: {{ if .VRAMMB }}{{ .VRAMMB }} MB of a shared {{ .GPUSize }} GPU{{ else }}{{ .NumGPUs }} {{ .GPUSize }} GPU(s){{ end }} for {{ .RequestedHours }}h at {{ .Priority }} priority{{ if .ServerName }} on {{ .ServerName }}{{ end }}.
+            Now <strong>{{ .Status }}</strong>{{ if .StartTime }}, {{ .StartTime.Format "Jan 2 15:04" }}{{ end }}{{ if .EndTime }}&ndash;{{ .EndTime.Format "Jan 2 15:04" }}{{ end }}.
+            {{ if .RecurringBookingID }}Occurrence of recurring booking #{{ .RecurringBookingID }}.{{ end }}
+        </p>
+        <table>
+            <thead>
+                <tr>
+                    <th>When</th>
+                    <th>From</th>
+                    <th>To</th>
+                    <th>By</th>
+                    <th>Reason</th>
+                </tr>
+            </thead>
+            <tbody>
+                {{ range .History }}
+                <tr>
+                    <td>{{ .At.Format "2006-01-02 15:04:05" }}</td>
+                    <td>{{ if .From }}{{ .From }}{{ else }}(created){{ end }}</td>
+                    <td>{{ .To }}</td>
+                    <td>{{ if .Automatic }}<em>{{ .Actor }}</em>{{ else }}{{ .Actor }}{{ end }}</td>
+                    <td>{{ .Reason }}</td>
+                </tr>
+                {{ else }}
+                <tr><td colspan="5">No recorded status changes.</td></tr>
+                {{ end }}
+            </tbody>
+        </table>
+        {{ else }}
+        <p><mark>{{ .Error }}</mark></p>
+        {{ end }}
+    </div>
+`))
+
+// RequestDetailHandler shows a request and every change of its status, with who made it
+// and why, to its owner, members of its project and admins. The request comes from the
+// "id" query parameter.
+func RequestDetailHandler(db *sql.DB, asJSON bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user := currentUser(w, r, db)
+		if user == nil {
+			return
+		}
+
+		id, err := strconv.Atoi(r.URL.Query().Get("id"))
+		if err != nil {
+			http.Error(w, "Invalid request ID", http.StatusBadRequest)
+			return
+		}
+
+		detail, err := services.LoadRequestDetail(db, id, user)
+		var rejection *services.RequestError
+		if errors.As(err, &rejection) {
+			if asJSON {
+				status := http.StatusForbidden
+				if errors.Is(err, services.ErrNoSuchRequest) {
+					status = http.StatusNotFound
+				}
+				http.Error(w, rejection.Reason, status)
+				return
+			}
+		} else if err != nil {
+			http.Error(w, "Error loading request: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		if asJSON {
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(detail)
+			return
+		}
+		data := struct {
+			Detail *services.RequestDetail
+			Error  string
+		}{Detail: detail}
+		if rejection != nil {
+			data.Error = rejection.Reason
+		}
+		err = requestDetailTemplate.Execute(w, data)
+		if err != nil {
+			http.Error(w, "Error rendering template: "+err.Error(), http.StatusInternalServerError)
+		}
+	}
+}
@@ -0,0 +1,217 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"html/template"
+	"net/http"
+	"slices"
+	"strconv"
+
+	"github.com/eduardo-escoto/gpu_request/server/internal/database"
+	"github.com/eduardo-escoto/gpu_request/server/internal/scheduler"
+	"github.com/eduardo-escoto/gpu_request/server/internal/services"
+)
+
+// RequestFormData is passed to the request form template
+type RequestFormData struct {
+	SizeClasses []scheduler.SizeClass
+	Priorities  []string
+	Servers     []string
+	Projects    []database.Project // Projects the signed-in user can charge
+}
+
+var requestFormTemplate = template.Must(template.New("request-form").Parse(`
+    <form hx-post="/requests" hx-target="#request-result">
+        <div class="grid">
+            <label>
+                GPUs
+                <input type="number" name="num_gpus" min="1" value="1" required>
+            </label>
+            <label>
+                VRAM Slice (GB)
+                <input type="number" name="vram_gb" min="1" placeholder="Whole GPUs">
+            </label>
+            <label>
+                Size
+                <select name="gpu_size">
+                    {{ range .SizeClasses }}
+                    <option value="{{ .Size }}">{{ .Size }} ({{ .Describe }})</option>
+                    {{ end }}
+                </select>
+            </label>
+            <label>
+                Hours
+                <input type="number" name="requested_time" min="1" value="1" required>
+            </label>
+            <label>
+                Priority
+                <select name="priority">
+                    {{ range .Priorities }}
+                    <option value="{{ . }}">{{ . }}</option>
+                    {{ end }}
+                </select>
+            </label>
+            <label>
+                Server
+                <select name="server_name">
+                    <option value="">Any server</option>
+                    {{ range .Servers }}
+                    <option value="{{ . }}">{{ . }}</option>
+                    {{ end }}
+                </select>
+            </label>
+            {{ if .Projects }}
+            <label>
+                Charge To
+                <select name="project_id">
+                    <option value="">Personal allocation</option>
+                    {{ range .Projects }}
+                    <option value="{{ .ID }}">{{ .Name }}</option>
+                    {{ end }}
+                </select>
+            </label>
+            {{ end }}
+        </div>
+        <button type="submit">Request GPUs</button>
+    </form>
+    <div id="request-result"></div>
+`))
+
+var requestResultTemplate = template.Must(template.New("request-result").Parse(`
+    {{ if .Error }}<p><mark>Request rejected: {{ .Error }}</mark></p>{{ else if .ApprovalRule }}<p>Request #{{ .ID }} needs admin approval for {{ .ApprovalRule }}; it is queued once approved.</p>{{ else }}<p>Request #{{ .ID }} queued.</p>{{ end }}
+`))
+
+// RequestFormHandler renders the GPU request form, offering the configured size classes
+func RequestFormHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		data, err := loadRequestFormData(db)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if data.Projects, err = viewerProjects(r, db); err != nil {
+			http.Error(w, "Error querying projects: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		err = requestFormTemplate.Execute(w, data)
+		if err != nil {
+			http.Error(w, "Error rendering template: "+err.Error(), http.StatusInternalServerError)
+		}
+	}
+}
+
+// loadRequestFormData collects the size classes, priorities and servers offered by the request forms
+func loadRequestFormData(db *sql.DB) (RequestFormData, error) {
+	classes, err := database.QuerySizeClasses(db)
+	if err != nil {
+		return RequestFormData{}, fmt.Errorf("Error querying size classes: %w", err)
+	}
+	gpus, err := database.QueryGPUs(db)
+	if err != nil {
+		return RequestFormData{}, fmt.Errorf("Error querying GPUs: %w", err)
+	}
+
+	data := RequestFormData{Priorities: scheduler.Priorities}
+	for _, size := range scheduler.GPUSizes {
+		class := scheduler.SizeClass{Size: size}
+		if idx := slices.IndexFunc(classes, func(c database.SizeClass) bool { return c.GPUSize == size }); idx >= 0 {
+			class = scheduler.NewSizeClass(classes[idx])
+		}
+		data.SizeClasses = append(data.SizeClasses, class)
+	}
+	for _, gpu := range gpus {
+		if !slices.Contains(data.Servers, gpu.ServerName) {
+			data.Servers = append(data.Servers, gpu.ServerName)
+		}
+	}
+	return data, nil
+}
+
+// viewerProjects returns the projects of the signed-in user, or none if nobody is signed in
+func viewerProjects(r *http.Request, db *sql.DB) ([]database.Project, error) {
+	user := optionalUser(r, db)
+	if user == nil {
+		return nil, nil
+	}
+	return database.QueryUserProjects(db, user.ID)
+}
+
+// formProjectID reads the optional project_id field, 0 for a personal request
+func formProjectID(r *http.Request) (int, error) {
+	value := r.FormValue("project_id")
+	if value == "" {
+		return 0, nil
+	}
+	return strconv.Atoi(value)
+}
+
+// CreateRequestHandler queues a GPU request for the signed-in user, charged to the
+// project in project_id if set. With vram_gb set it asks for a slice of that many GB of
+// a shared GPU instead of whole GPUs.
+func CreateRequestHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+			return
+		}
+		user := currentUser(w, r, db)
+		if user == nil {
+			return
+		}
+
+		numGPUs, err := strconv.Atoi(r.FormValue("num_gpus"))
+		if err != nil {
+			http.Error(w, "Invalid number of GPUs", http.StatusBadRequest)
+			return
+		}
+		hours, err := strconv.Atoi(r.FormValue("requested_time"))
+		if err != nil {
+			http.Error(w, "Invalid number of hours", http.StatusBadRequest)
+			return
+		}
+		projectID, err := formProjectID(r)
+		if err != nil {
+			http.Error(w, "Invalid project", http.StatusBadRequest)
+			return
+		}
+		vramGB := 0
+		if value := r.FormValue("vram_gb"); value != "" {
+			if vramGB, err = strconv.Atoi(value); err != nil {
+				http.Error(w, "Invalid VRAM slice", http.StatusBadRequest)
+				return
+			}
+		}
+
+		id, rule, err := services.CreateRequest(db, services.NewRequest{
+			UserID:     user.ID,
+			NumGPUs:    numGPUs,
+			GPUSize:    r.FormValue("gpu_size"),
+			Hours:      hours,
+			Priority:   r.FormValue("priority"),
+			ServerName: r.FormValue("server_name"),
+			ProjectID:  projectID,
+			VRAMMB:     vramGB * 1024,
+		})
+
+		data := struct {
+			ID           int64
+			ApprovalRule string
+			Error        string
+		}{ID: id, ApprovalRule: rule}
+		var rejection *services.RequestError
+		if errors.As(err, &rejection) {
+			data.Error = rejection.Reason
+		} else if err != nil {
+			http.Error(w, fmt.Sprintf("Error creating request: %v", err), http.StatusInternalServerError)
+			return
+		}
+
+		err = requestResultTemplate.Execute(w, data)
+		if err != nil {
+			http.Error(w, "Error rendering template: "+err.Error(), http.StatusInternalServerError)
+		}
+	}
+}
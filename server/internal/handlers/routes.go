@@ -6,8 +6,12 @@ import (
 	"html/template"
 	"log"
 	"net/http"
+	"os"
 
 	"github.com/eduardo-escoto/gpu_request/server/internal/database"
+	"github.com/eduardo-escoto/gpu_request/server/internal/scheduler"
+	"github.com/eduardo-escoto/gpu_request/server/internal/services"
+	"github.com/eduardo-escoto/gpu_request/server/internal/slackapp"
 )
 
 // HomePageData defines the structure for dynamic content passed to the template
@@ -19,9 +23,49 @@ type HomePageData struct {
 }
 
 // RegisterRoutesWithDB registers routes and passes the database connection to handlers
-func RegisterRoutesWithDB(mux *http.ServeMux, db *sql.DB) {
+func RegisterRoutesWithDB(mux *http.ServeMux, db *sql.DB, broker *services.CommandBroker, sched *scheduler.Scheduler) {
 	mux.HandleFunc("/", HomeHandlerFactory(db))
 	mux.HandleFunc("/gpu-usage", GPUUsageHandler(db))
+	mux.HandleFunc("/violations", ViolationsHandler(db))
+	mux.HandleFunc("/requests", CreateRequestHandler(db))
+	mux.HandleFunc("/requests/form", RequestFormHandler(db))
+	mux.HandleFunc("/requests/cancel", CancelRequestHandler(db))
+	mux.HandleFunc("/requests/extend", ExtendRequestHandler(db))
+	mux.HandleFunc("/requests/detail", RequestDetailHandler(db, false))
+	mux.HandleFunc("/api/requests/detail", RequestDetailHandler(db, true))
+	mux.HandleFunc("/approvals", ApprovalsHandler(db))
+	mux.HandleFunc("/approvals/decide", DecideApprovalHandler(db))
+	mux.HandleFunc("/projects", ProjectsHandler(db))
+	mux.HandleFunc("/projects/members", ProjectMembersHandler(db))
+	mux.HandleFunc("/projects/quota", ProjectQuotaHandler(db))
+	mux.HandleFunc("/api/projects/usage", ProjectUsageAPIHandler(db))
+	mux.HandleFunc("/queue", QueueHandler(db, sched))
+	mux.HandleFunc("/api/queue", QueueAPIHandler(db, sched))
+	mux.HandleFunc("/what-if", WhatIfHandler(db, sched, false))
+	mux.HandleFunc("/what-if/form", WhatIfFormHandler(db))
+	mux.HandleFunc("/what-if/free", FreeGPUsHandler(db, sched, false))
+	mux.HandleFunc("/api/what-if", WhatIfHandler(db, sched, true))
+	mux.HandleFunc("/api/what-if/free", FreeGPUsHandler(db, sched, true))
+	mux.HandleFunc("/bookings", CreateBookingHandler(db))
+	mux.HandleFunc("/bookings/form", BookingFormHandler(db))
+	mux.HandleFunc("/bookings/recurring", RecurringBookingsHandler(db))
+	mux.HandleFunc("/bookings/recurring/form", RecurringBookingFormHandler(db))
+	mux.HandleFunc("/bookings/recurring/cancel", CancelRecurringBookingHandler(db))
+	mux.HandleFunc("/bookings/recurring/skip", SkipOccurrenceHandler(db))
+	mux.HandleFunc("/calendar", CalendarHandler(db))
+	mux.HandleFunc("/maintenance", MaintenanceHandler(db))
+	mux.HandleFunc("/maintenance/delete", DeleteMaintenanceHandler(db))
+	mux.HandleFunc("/maintenance/drain", DrainHandler(db))
+	mux.HandleFunc("/api/maintenance/conflicts", MaintenanceConflictsAPIHandler(db))
+	mux.HandleFunc("/gpu-health", GPUHealthHandler(db))
+	mux.HandleFunc("/gpu-health/shared", GPUSharingHandler(db))
+	mux.HandleFunc("/size-classes", SizeClassesHandler(db))
+	mux.HandleFunc("/fairshare", FairShareHandler(db, sched))
+	mux.HandleFunc("/api/commands", CreateCommandHandler(db, broker))
+	mux.HandleFunc("/api/commands/poll", CommandPollHandler(db, broker))
+	if os.Getenv("SLACK_SIGNING_SECRET") != "" {
+		mux.HandleFunc("/slack/commands", SlackCommandsHandler(db, slackapp.NewSlackClient(), sched))
+	}
 	// mux.HandleFunc("/update-title", UpdateTitleHandlerFactory(db))
 	// Add other handlers here, passing the db connection
 }
@@ -0,0 +1,98 @@
+package handlers
+
+import (
+	"database/sql"
+	"html/template"
+	"net/http"
+	"slices"
+	"strconv"
+
+	"github.com/eduardo-escoto/gpu_request/server/internal/database"
+	"github.com/eduardo-escoto/gpu_request/server/internal/scheduler"
+)
+
+var sizeClassesTemplate = template.Must(template.New("size-classes").Parse(`
+    <table>
+        <thead>
+            <tr>
+                <th>Size</th>
+                <th>Minimum VRAM (MB)</th>
+                <th>Allowed Models</th>
+                <th>Allowed Servers</th>
+                {{ if .IsAdmin }}<th></th>{{ end }}
+            </tr>
+        </thead>
+        <tbody>
+            {{ $admin := .IsAdmin }}
+            {{ range .Classes }}
+            <tr>
+                {{ if $admin }}
+                <td><input type="hidden" name="gpu_size" value="{{ .GPUSize }}">{{ .GPUSize }}</td>
+                <td><input type="number" name="min_vram_mb" min="0" value="{{ .MinVRAMMB }}"></td>
+                <td><input type="text" name="allowed_models" value="{{ .AllowedModels }}" placeholder="Any model"></td>
+                <td><input type="text" name="allowed_servers" value="{{ .AllowedServers }}" placeholder="Any server"></td>
+                <td><button hx-post="/size-classes" hx-include="closest tr" hx-target="#size-classes-table">Save</button></td>
+                {{ else }}
+                <td>{{ .GPUSize }}</td>
+                <td>{{ .MinVRAMMB }}</td>
+                <td>{{ if .AllowedModels }}{{ .AllowedModels }}{{ else }}Any{{ end }}</td>
+                <td>{{ if .AllowedServers }}{{ .AllowedServers }}{{ else }}Any{{ end }}</td>
+                {{ end }}
+            </tr>
+            {{ end }}
+        </tbody>
+    </table>
+`))
+
+// SizeClassesHandler shows the gpu_size definitions; admins can edit them in place.
+// Models and servers are comma-separated lists, empty meaning "any".
+func SizeClassesHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPost {
+			if currentAdmin(w, r, db) == nil {
+				return
+			}
+
+			size := r.FormValue("gpu_size")
+			if !slices.Contains(scheduler.GPUSizes, size) {
+				http.Error(w, "Unknown GPU size", http.StatusBadRequest)
+				return
+			}
+			minVRAM, err := strconv.Atoi(r.FormValue("min_vram_mb"))
+			if err != nil || minVRAM < 0 {
+				http.Error(w, "Invalid minimum VRAM", http.StatusBadRequest)
+				return
+			}
+
+			err = database.UpsertSizeClass(db, database.SizeClass{
+				GPUSize:        size,
+				MinVRAMMB:      minVRAM,
+				AllowedModels:  r.FormValue("allowed_models"),
+				AllowedServers: r.FormValue("allowed_servers"),
+			})
+			if err != nil {
+				http.Error(w, "Error updating size class: "+err.Error(), http.StatusInternalServerError)
+				return
+			}
+		}
+
+		classes, err := database.QuerySizeClasses(db)
+		if err != nil {
+			http.Error(w, "Error querying size classes: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		data := struct {
+			Classes []database.SizeClass
+			IsAdmin bool
+		}{
+			Classes: classes,
+			IsAdmin: viewerIsAdmin(r, db),
+		}
+
+		err = sizeClassesTemplate.Execute(w, data)
+		if err != nil {
+			http.Error(w, "Error rendering template: "+err.Error(), http.StatusInternalServerError)
+		}
+	}
+}
@@ -1,18 +1,22 @@
 package handlers
 
-// import (
-// 	"net/http"
+import (
+	"database/sql"
+	"net/http"
 
-// 	"github.com/eduardo-escoto/gpu_request/server/internal/slackapp"
-// )
+	"github.com/eduardo-escoto/gpu_request/server/internal/scheduler"
+	"github.com/eduardo-escoto/gpu_request/server/internal/slackapp"
+)
 
 // func SlackEventsHandler(w http.ResponseWriter, r *http.Request) {
 // 	slackapp.HandleSlackEvents(w, r, slackapp.NewSlackClient().SigningSecret)
 // }
 
-// func SlackCommandsHandler(w http.ResponseWriter, r *http.Request) {
-// 	slackapp.HandleSlashCommands(w, r)
-// }
+func SlackCommandsHandler(db *sql.DB, slackClient *slackapp.SlackClient, sched *scheduler.Scheduler) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		slackapp.HandleSlashCommands(w, r, db, slackClient, sched)
+	}
+}
 
 // func SlackInteractionsHandler(w http.ResponseWriter, r *http.Request) {
 // 	slackapp.HandleInteractions(w, r)
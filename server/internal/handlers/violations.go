@@ -0,0 +1,63 @@
+package handlers
+
+import (
+	"database/sql"
+	"html/template"
+	"net/http"
+	"time"
+
+	"github.com/eduardo-escoto/gpu_request/server/internal/database"
+)
+
+var violationsTemplate = template.Must(template.New("violations").Parse(`
+    <table hx-get="/violations" hx-trigger="every 10s" hx-swap="outerHTML">
+        <thead>
+            <tr>
+                <th>User</th>
+                <th>Server Name</th>
+                <th>GPU Number</th>
+                <th>Process</th>
+                <th>Kind</th>
+                <th>Started</th>
+                <th>Duration</th>
+                <th>Max Memory (MB)</th>
+                <th>Status</th>
+                <th>Enforcement</th>
+            </tr>
+        </thead>
+        <tbody>
+            {{ range . }}
+            <tr>
+                <td>{{ .UserName }}</td>
+                <td>{{ .ServerName }}</td>
+                <td>{{ .GPUNumber }}</td>
+                <td>{{ .ProcessName }} ({{ .ProcessID }})</td>
+                <td>{{ .Kind }}{{ if .RequestID.Valid }} (request #{{ .RequestID.Int64 }}){{ end }}</td>
+                <td>{{ .StartedAt.Format "2006-01-02 15:04:05" }}</td>
+                <td>{{ .Duration.Round 1000000000 }}</td>
+                <td>{{ .MaxMemoryMB }}</td>
+                <td>{{ if .ResolvedAt.Valid }}resolved {{ .ResolvedAt.Time.Format "15:04" }}{{ else }}ongoing{{ end }}</td>
+                <td>{{ if .Enforcement.Valid }}{{ .Enforcement.String }} {{ .EnforcedAt.Time.Format "15:04" }}{{ end }}</td>
+            </tr>
+            {{ else }}
+            <tr><td colspan="10">No unauthorized GPU usage in the last 24 hours.</td></tr>
+            {{ end }}
+        </tbody>
+    </table>
+`))
+
+// ViolationsHandler renders ongoing and recently resolved usage violations
+func ViolationsHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		violations, err := database.QueryRecentViolations(db, time.Now().Add(-24*time.Hour))
+		if err != nil {
+			http.Error(w, "Error querying usage violations: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		err = violationsTemplate.Execute(w, violations)
+		if err != nil {
+			http.Error(w, "Error rendering template: "+err.Error(), http.StatusInternalServerError)
+		}
+	}
+}
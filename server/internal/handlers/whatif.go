@@ -0,0 +1,191 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"html/template"
+	"net/http"
+	"strconv"
+
+	"github.com/eduardo-escoto/gpu_request/server/internal/database"
+	"github.com/eduardo-escoto/gpu_request/server/internal/scheduler"
+	"github.com/eduardo-escoto/gpu_request/server/internal/services"
+)
+
+var whatIfFormTemplate = template.Must(template.New("what-if-form").Parse(`
+    <form hx-post="/what-if" hx-target="#what-if-result">
+        <div class="grid">
+            <label>
+                GPUs
+                <input type="number" name="num_gpus" min="1" value="1" required>
+            </label>
+            <label>
+                Size
+                <select name="gpu_size">
+                    {{ range .SizeClasses }}
+                    <option value="{{ .Size }}">{{ .Size }} ({{ .Describe }})</option>
+                    {{ end }}
+                </select>
+            </label>
+            <label>
+                Hours
+                <input type="number" name="requested_time" min="1" value="1" required>
+            </label>
+            <label>
+                Priority
+                <select name="priority">
+                    {{ range .Priorities }}
+                    <option value="{{ . }}">{{ . }}</option>
+                    {{ end }}
+                </select>
+            </label>
+            <label>
+                Server
+                <select name="server_name">
+                    <option value="">Any server</option>
+                    {{ range .Servers }}
+                    <option value="{{ . }}">{{ . }}</option>
+                    {{ end }}
+                </select>
+            </label>
+        </div>
+        <button type="submit">Earliest start?</button>
+        <button type="submit" class="secondary" hx-post="/what-if/free" hx-include="closest form">What is free now for these hours?</button>
+    </form>
+    <div id="what-if-result"></div>
+`))
+
+var whatIfResultTemplate = template.Must(template.New("what-if-result").Parse(`
+    {{ define "gpus" }}
+    <table>
+        <thead><tr><th>Server Name</th><th>GPU Number</th><th>Model</th><th>VRAM (MB)</th><th>Sizes</th></tr></thead>
+        <tbody>
+            {{ range . }}
+            <tr><td>{{ .ServerName }}</td><td>{{ .Number }}</td><td>{{ .ModelName }}</td><td>{{ .VRAMMB }}</td><td>{{ range $i, $s := .Sizes }}{{ if $i }}, {{ end }}{{ $s }}{{ end }}</td></tr>
+            {{ else }}
+            <tr><td colspan="5">None.</td></tr>
+            {{ end }}
+        </tbody>
+    </table>
+    {{ end }}
+    {{ if .Free }}
+    <p>GPUs free right now for {{ .Hours }} hour(s):</p>
+    {{ template "gpus" .GPUs }}
+    {{ else if .Result.Rejected }}
+    <p><mark>This request would be rejected: {{ .Result.Rejected }}</mark></p>
+    {{ else if .Result.EarliestStart }}
+    <p>Earliest start: <strong>{{ .Result.EarliestStart.Format "Mon Jan 2 15:04" }}</strong>{{ if .Result.Reason }} ({{ .Result.Reason }}){{ end }}. It would get:</p>
+    {{ template "gpus" .Result.GPUs }}
+    {{ else }}
+    <p>No start within the next two weeks{{ if .Result.Reason }}: {{ .Result.Reason }}{{ end }}.</p>
+    {{ end }}
+`))
+
+// WhatIfFormHandler renders the form for hypothetical requests
+func WhatIfFormHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		data, err := loadRequestFormData(db)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		err = whatIfFormTemplate.Execute(w, data)
+		if err != nil {
+			http.Error(w, "Error rendering template: "+err.Error(), http.StatusInternalServerError)
+		}
+	}
+}
+
+// WhatIfHandler estimates when a request could start without creating it. Form posts
+// get an HTML fragment; GET /api/what-if with the same parameters returns JSON.
+func WhatIfHandler(db *sql.DB, sched *scheduler.Scheduler, asJSON bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		numGPUs, err := strconv.Atoi(r.FormValue("num_gpus"))
+		if err != nil {
+			http.Error(w, "Invalid number of GPUs", http.StatusBadRequest)
+			return
+		}
+		hours, err := strconv.Atoi(r.FormValue("requested_time"))
+		if err != nil {
+			http.Error(w, "Invalid number of hours", http.StatusBadRequest)
+			return
+		}
+		priority := r.FormValue("priority")
+		if priority == "" {
+			priority = "medium"
+		}
+
+		req := services.NewRequest{
+			NumGPUs:    numGPUs,
+			GPUSize:    r.FormValue("gpu_size"),
+			Hours:      hours,
+			Priority:   priority,
+			ServerName: r.FormValue("server_name"),
+		}
+		userName := ""
+		if viewer := optionalUser(r, db); viewer != nil {
+			req.UserID, userName = viewer.ID, viewer.UserName
+		}
+
+		result, err := services.RunWhatIf(db, sched, req, userName)
+		if err != nil {
+			http.Error(w, "Error running what-if: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		if asJSON {
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(result)
+			return
+		}
+		err = whatIfResultTemplate.Execute(w, map[string]interface{}{"Result": result})
+		if err != nil {
+			http.Error(w, "Error rendering template: "+err.Error(), http.StatusInternalServerError)
+		}
+	}
+}
+
+// FreeGPUsHandler lists the GPUs free right now for ?requested_time=<hours> (1 by default)
+func FreeGPUsHandler(db *sql.DB, sched *scheduler.Scheduler, asJSON bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		hours := 1
+		if value := r.FormValue("requested_time"); value != "" {
+			parsed, err := strconv.Atoi(value)
+			if err != nil || parsed < 1 {
+				http.Error(w, "Invalid number of hours", http.StatusBadRequest)
+				return
+			}
+			hours = parsed
+		}
+
+		gpus, err := services.FreeGPUs(db, sched, hours)
+		if err != nil {
+			http.Error(w, "Error finding free GPUs: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		if asJSON {
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(gpus)
+			return
+		}
+		err = whatIfResultTemplate.Execute(w, map[string]interface{}{"Free": true, "Hours": hours, "GPUs": gpus})
+		if err != nil {
+			http.Error(w, "Error rendering template: "+err.Error(), http.StatusInternalServerError)
+		}
+	}
+}
+
+// optionalUser returns the signed-in user if there is one, without failing the request otherwise
+func optionalUser(r *http.Request, db *sql.DB) *database.User {
+	identity := requestIdentity(r)
+	if identity == "" {
+		return nil
+	}
+	user, err := database.QueryUser(db, identity)
+	if err != nil || user == nil || !user.IsWhitelisted {
+		return nil
+	}
+	return user
+}
@@ -0,0 +1,105 @@
+package scheduler
+
+import (
+	"fmt"
+	"time"
+)
+
+// reservations returns, for each GPU, when it is next needed by a booking or a
+// maintenance window that has not started yet. Queued requests may only use a
+// GPU if they finish by then.
+func reservations(state State, gpus []GPU, now time.Time) map[string]time.Time {
+	next := make(map[string]time.Time)
+	reserve := func(uuid string, start time.Time) {
+		if current, ok := next[uuid]; !ok || start.Before(current) {
+			next[uuid] = start
+		}
+	}
+
+	for _, request := range state.Requests {
+		if request.IsBooking() && request.StartTime.After(now) {
+			for _, uuid := range request.GPUUUIDs {
+				reserve(uuid, request.StartTime)
+			}
+		}
+	}
+	for _, window := range state.Maintenance {
+		if !window.Start.After(now) {
+			continue
+		}
+		for _, gpu := range gpus {
+			if window.Covers(gpu) {
+				reserve(gpu.UUID, window.Start)
+			}
+		}
+	}
+	return next
+}
+
+// inMaintenance reports whether a maintenance window covers the GPU right now
+func inMaintenance(gpu GPU, windows []MaintenanceWindow, now time.Time) bool {
+	for _, window := range windows {
+		if window.Covers(gpu) && !window.Start.After(now) && window.End.After(now) {
+			return true
+		}
+	}
+	return false
+}
+
+// FindBookingGPUs picks GPUs for a booking of [request.StartTime, request.EndTime). A GPU
+// conflicts if a running request or another booking holds it during the window, or a
+// maintenance window overlaps it. Draining and quarantined GPUs are never booked. Queued requests never conflict: they are only started
+// on GPUs they can release before the next booking.
+func FindBookingGPUs(request Request, state State) ([]GPU, error) {
+	if !request.EndTime.After(request.StartTime) {
+		return nil, fmt.Errorf("the booking must end after it starts")
+	}
+
+	overlaps := func(start, end time.Time) bool {
+		return start.Before(request.EndTime) && end.After(request.StartTime)
+	}
+
+	taken := make(map[string]string)
+	for _, other := range state.Requests {
+		if other.Status != StatusInProgress && !other.IsBooking() {
+			continue
+		}
+		if overlaps(other.StartTime, other.EndTime) {
+			for _, uuid := range other.GPUUUIDs {
+				taken[uuid] = fmt.Sprintf("request #%d", other.ID)
+			}
+		}
+	}
+
+	gpus := sortedGPUs(state.GPUs)
+	for _, window := range state.Maintenance {
+		if !overlaps(window.Start, window.End) {
+			continue
+		}
+		for _, gpu := range gpus {
+			if window.Covers(gpu) {
+				taken[gpu.UUID] = "maintenance"
+			}
+		}
+	}
+
+	for _, gpu := range gpus {
+		if !gpu.Placeable() {
+			taken[gpu.UUID] = "out of service"
+		}
+	}
+
+	eligible := eligibleGPUs(request, gpus, state.SizeClasses)
+	var free []GPU
+	for _, gpu := range eligible {
+		if _, ok := taken[gpu.UUID]; !ok {
+			free = append(free, gpu)
+		}
+	}
+	if len(free) < request.NumGPUs {
+		return nil, fmt.Errorf("only %d of the %d eligible %s GPU(s) are free from %s to %s, but %d were requested",
+			len(free), len(eligible), request.GPUSize,
+			request.StartTime.Format("Mon Jan 2 15:04"), request.EndTime.Format("Mon Jan 2 15:04"), request.NumGPUs)
+	}
+	return placeGPUs(preferHealthy(free, request.NumGPUs), request, state), nil
+}
@@ -0,0 +1,49 @@
+package scheduler
+
+import (
+	"fmt"
+	"time"
+)
+
+// CheckExtension reports whether a running request can keep its GPUs until newEnd: none
+// of them may be booked by another request or go under maintenance before then. Queued
+// requests do not block extensions; they are only delayed. Neither do other slices on
+// the shared GPU of a slice: its VRAM stays granted as it is.
+func CheckExtension(request Request, newEnd time.Time, state State) error {
+	if request.Status != StatusInProgress {
+		return fmt.Errorf("only running requests can be extended")
+	}
+	if request.PreemptedBy != 0 {
+		return fmt.Errorf("request #%d is being preempted by emergency request #%d", request.ID, request.PreemptedBy)
+	}
+
+	overlaps := func(start, end time.Time) bool {
+		return start.Before(newEnd) && end.After(request.EndTime)
+	}
+	mine := make(map[string]bool)
+	for _, uuid := range request.GPUUUIDs {
+		mine[uuid] = true
+	}
+
+	for _, other := range state.Requests {
+		if other.ID == request.ID || (other.Status != StatusInProgress && !other.IsBooking()) || (request.IsSlice() && other.IsSlice()) {
+			continue
+		}
+		for _, uuid := range other.GPUUUIDs {
+			if mine[uuid] && overlaps(other.StartTime, other.EndTime) {
+				return fmt.Errorf("its GPUs are booked by request #%d from %s", other.ID, other.StartTime.Format("Mon Jan 2 15:04"))
+			}
+		}
+	}
+	for _, window := range state.Maintenance {
+		if !overlaps(window.Start, window.End) {
+			continue
+		}
+		for _, gpu := range state.GPUs {
+			if mine[gpu.UUID] && window.Covers(gpu) {
+				return fmt.Errorf("%s is under maintenance from %s", gpu.ServerName, window.Start.Format("Mon Jan 2 15:04"))
+			}
+		}
+	}
+	return nil
+}
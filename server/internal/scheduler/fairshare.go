@@ -0,0 +1,120 @@
+package scheduler
+
+import (
+	"cmp"
+	"math"
+	"slices"
+	"time"
+)
+
+// Share is a user's fair-share standing
+type Share struct {
+	UserName    string
+	Group       string  // Empty if the user is not in a group
+	GPUHours    float64 // Decayed GPU-hours used
+	UsageShare  float64 // Fraction of all decayed GPU-hours used by the user
+	TargetShare float64 // Fraction of the cluster the user is entitled to
+	Score       float64 // 2^(-usage/target): 1 for no recent usage, 0.5 at exactly the target
+}
+
+// UsageWindow is how much history matters to fair-share: after four half-lives usage
+// weighs less than 1/16 of its original value and is ignored
+func (s *Scheduler) UsageWindow() time.Duration {
+	return 4 * s.FairShareHalfLife
+}
+
+// Shares computes every user's fair-share standing, best score first. Each whitelisted
+// user is entitled to an equal share of the cluster. With FairShareByGroup, groups get
+// equal shares which are split equally between their members, and the score is the
+// product of the group's score and the user's score within the group; users without a
+// group form a group of their own.
+func (s *Scheduler) Shares(state State) []Share {
+	if s.FairShareHalfLife <= 0 {
+		return nil
+	}
+	now := s.Clock.Now()
+
+	shares := make(map[string]*Share)
+	add := func(userName, group string) *Share {
+		share, ok := shares[userName]
+		if !ok {
+			share = &Share{UserName: userName, Group: group}
+			shares[userName] = share
+		}
+		return share
+	}
+	for _, user := range state.Users {
+		add(user.Name, user.Group)
+	}
+	for _, request := range state.Requests {
+		add(request.UserName, "")
+	}
+
+	// Weigh each hour of usage by its age, measured from the middle of the hour
+	var total float64
+	for _, usage := range state.Usage {
+		age := max(now.Sub(usage.Hour.Add(30*time.Minute)), 0)
+		hours := float64(usage.GPUs) * math.Exp2(-age.Hours()/s.FairShareHalfLife.Hours())
+		add(usage.UserName, "").GPUHours += hours
+		total += hours
+	}
+
+	// groupOf keys users without a group by their own name
+	groupOf := func(share *Share) string {
+		if s.FairShareByGroup && share.Group != "" {
+			return "group:" + share.Group
+		}
+		return "user:" + share.UserName
+	}
+	members := make(map[string]int)
+	groupHours := make(map[string]float64)
+	for _, share := range shares {
+		members[groupOf(share)]++
+		groupHours[groupOf(share)] += share.GPUHours
+	}
+
+	var result []Share
+	for _, share := range shares {
+		if total > 0 {
+			share.UsageShare = share.GPUHours / total
+		}
+
+		if !s.FairShareByGroup {
+			share.TargetShare = 1 / float64(len(shares))
+			share.Score = math.Exp2(-share.UsageShare / share.TargetShare)
+			result = append(result, *share)
+			continue
+		}
+
+		group := groupOf(share)
+		groupTarget := 1 / float64(len(members))
+		memberTarget := 1 / float64(members[group])
+		var groupUsage, memberUsage float64
+		if total > 0 {
+			groupUsage = groupHours[group] / total
+		}
+		if groupHours[group] > 0 {
+			memberUsage = share.GPUHours / groupHours[group]
+		}
+		share.TargetShare = groupTarget * memberTarget
+		share.Score = math.Exp2(-groupUsage/groupTarget) * math.Exp2(-memberUsage/memberTarget)
+		result = append(result, *share)
+	}
+
+	slices.SortFunc(result, func(a, b Share) int {
+		return cmp.Or(
+			cmp.Compare(b.Score, a.Score),
+			cmp.Compare(a.UserName, b.UserName),
+		)
+	})
+	return result
+}
+
+// scores maps user names to their fair-share score
+func (s *Scheduler) scores(state State) map[string]float64 {
+	scores := make(map[string]float64)
+	for _, share := range s.Shares(state) {
+		scores[share.UserName] = share.Score
+	}
+	return scores
+}
@@ -0,0 +1,141 @@
+package scheduler
+
+import (
+	"slices"
+	"time"
+)
+
+// forecastSteps bounds the forward simulation
+const forecastSteps = 1000
+
+// Forecast is the outlook of a queued request
+type Forecast struct {
+	RequestID      int
+	Position       int       // 1-based position in the queue
+	EstimatedStart time.Time // Zero if it does not start within the horizon
+	Reason         string    // Why it has not started, empty if it starts now
+}
+
+// Forecast estimates when each queued request starts by simulating the scheduler forward
+// from the current state, assuming running requests are used and end on time and no new
+// requests arrive. Requests are returned in queue order with the reason they are waiting now.
+func (s *Scheduler) Forecast(state State, horizon time.Duration) []Forecast {
+	now := s.Clock.Now()
+
+	var queue []Request
+	for _, request := range state.Requests {
+		if request.Status == StatusScheduled && !request.IsBooking() {
+			queue = append(queue, request)
+		}
+	}
+	sortQueue(queue, s.scores(state))
+
+	why := make(map[int]string)
+	starts := s.simulate(state, now.Add(horizon), why)
+
+	forecasts := make([]Forecast, len(queue))
+	for i, request := range queue {
+		forecasts[i] = Forecast{
+			RequestID:      request.ID,
+			Position:       i + 1,
+			EstimatedStart: starts[request.ID].StartTime,
+			Reason:         why[request.ID],
+		}
+	}
+	return forecasts
+}
+
+// simulate runs a copy of the scheduler on a copy of the state until the horizon, jumping
+// from one event (a request ending, a booking or maintenance window starting or ending)
+// to the next. It returns the action starting each request, with StartTime set to when it
+// started, and fills why from the first step.
+func (s *Scheduler) simulate(state State, until time.Time, why map[int]string) map[int]Action {
+	clock := NewManualClock(s.Clock.Now())
+	sim := *s
+	sim.Clock = clock
+	sim.NoShowWarning, sim.NoShowRelease, sim.EndWarning = 0, 0, 0
+
+	state.Requests = slices.Clone(state.Requests)
+	starts := make(map[int]Action)
+	for step := 0; step < forecastSteps; step++ {
+		now := clock.Now()
+		if step > 0 {
+			why = nil
+		}
+		for _, action := range sim.plan(state, why) {
+			applyAction(&state, action)
+			if action.Kind == ActionStart || action.Kind == ActionStartBooking {
+				action.StartTime = now
+				starts[action.RequestID] = action
+			}
+		}
+
+		next, ok := nextEvent(state, now)
+		if !ok || next.After(until) {
+			break
+		}
+		clock.Set(next)
+	}
+	return starts
+}
+
+// applyAction updates an in-memory state the way the store would
+func applyAction(state *State, action Action) {
+	idx := slices.IndexFunc(state.Requests, func(r Request) bool { return r.ID == action.RequestID })
+	if idx < 0 {
+		return
+	}
+	request := &state.Requests[idx]
+
+	switch action.Kind {
+	case ActionStart:
+		request.Status = StatusInProgress
+		request.GPUUUIDs = action.GPUUUIDs
+		request.StartTime = action.StartTime
+		request.EndTime = action.EndTime
+	case ActionStartBooking:
+		request.Status = StatusInProgress
+	case ActionFinish:
+		request.Status = StatusDone
+	case ActionEvict:
+		request.Status = StatusPreempted
+	case ActionExpire:
+		request.Status = StatusCancelled
+	case ActionRelease:
+		request.Status = StatusReleased
+	case ActionWarnIdle:
+		request.IdleWarned = true
+	case ActionWarnEnd:
+		request.EndWarned = true
+	case ActionPreempt:
+		request.PreemptedBy = action.PreemptedBy
+		request.EndTime = action.EndTime
+	case ActionProject:
+		request.ProjectedStart = action.StartTime
+	}
+}
+
+// nextEvent returns the earliest time after now at which the state changes by itself
+func nextEvent(state State, now time.Time) (time.Time, bool) {
+	var next time.Time
+	consider := func(at time.Time) {
+		if at.After(now) && (next.IsZero() || at.Before(next)) {
+			next = at
+		}
+	}
+
+	for _, request := range state.Requests {
+		switch {
+		case request.Status == StatusInProgress:
+			consider(request.EndTime)
+		case request.IsBooking():
+			consider(request.StartTime)
+			consider(request.EndTime)
+		}
+	}
+	for _, window := range state.Maintenance {
+		consider(window.Start)
+		consider(window.End)
+	}
+	return next, !next.IsZero()
+}
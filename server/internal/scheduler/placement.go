@@ -0,0 +1,159 @@
+package scheduler
+
+import (
+	"cmp"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Topology holds the GPU interconnects of each server, keyed by server name and then by
+// the pair of GPU numbers (lower first), with nvidia-smi topo -m values such as NV4 or SYS
+type Topology map[string]map[[2]int]string
+
+// Link returns how two GPUs of a server are connected, or "" if unknown
+func (t Topology) Link(serverName string, a, b int) string {
+	return t[serverName][[2]int{min(a, b), max(a, b)}]
+}
+
+// linkScore ranks interconnects: NVLink (more bonded links is better), then a shared
+// PCIe switch, then progressively longer PCIe paths. Unknown links score 0.
+func linkScore(link string) int {
+	if count, ok := strings.CutPrefix(link, "NV"); ok {
+		n, _ := strconv.Atoi(count)
+		return 100 + n
+	}
+	switch link {
+	case "PIX":
+		return 50
+	case "PXB":
+		return 40
+	case "PHB":
+		return 30
+	case "NODE":
+		return 20
+	case "SYS":
+		return 10
+	}
+	return 0
+}
+
+// Placement preferences, in score points
+const (
+	singleServerScore = 1000 // All GPUs on one server
+	dataServerScore   = 200  // On the server holding the user's data
+	lastServerScore   = 100  // On the server of the user's previous request
+)
+
+// placeGPUs picks request.NumGPUs GPUs from the free list (which must hold enough). Each
+// server that can host the whole request gets its best-connected set of free GPUs, scored
+// by the average link between them plus locality bonuses for the user's data server and
+// previous server. Ties go to the server with the fewest free GPUs, keeping larger blocks
+// whole for larger requests. If no single server fits, servers are filled in order of
+// preference.
+func placeGPUs(free []GPU, request Request, state State) []GPU {
+	n := request.NumGPUs
+	var user User
+	if idx := slices.IndexFunc(state.Users, func(u User) bool { return u.Name == request.UserName }); idx >= 0 {
+		user = state.Users[idx]
+	}
+	locality := func(serverName string) int {
+		score := 0
+		if serverName == user.DataServer {
+			score += dataServerScore
+		}
+		if serverName == user.LastServer {
+			score += lastServerScore
+		}
+		return score
+	}
+
+	byServer := make(map[string][]GPU)
+	var servers []string
+	for _, gpu := range free {
+		if _, ok := byServer[gpu.ServerName]; !ok {
+			servers = append(servers, gpu.ServerName)
+		}
+		byServer[gpu.ServerName] = append(byServer[gpu.ServerName], gpu)
+	}
+
+	var best []GPU
+	bestScore, bestFree := -1, 0
+	for _, serverName := range servers {
+		gpus := byServer[serverName]
+		if len(gpus) < n {
+			continue
+		}
+		selected, linkAverage := bestConnected(gpus, n, state.Topology)
+		score := singleServerScore + locality(serverName) + linkAverage
+		if score > bestScore || (score == bestScore && len(gpus) < bestFree) {
+			best, bestScore, bestFree = selected, score, len(gpus)
+		}
+	}
+	if best != nil {
+		return best
+	}
+
+	// Spread over servers, preferred and larger ones first to keep the request compact
+	slices.SortStableFunc(servers, func(a, b string) int {
+		return cmp.Or(
+			cmp.Compare(locality(b), locality(a)),
+			cmp.Compare(len(byServer[b]), len(byServer[a])),
+		)
+	})
+	var selected []GPU
+	for _, serverName := range servers {
+		for _, gpu := range byServer[serverName] {
+			if len(selected) == n {
+				return selected
+			}
+			selected = append(selected, gpu)
+		}
+	}
+	return selected
+}
+
+// bestConnected greedily picks n GPUs of one server with the strongest links between
+// them, trying every GPU as the starting point, and returns them with their average
+// pairwise link score
+func bestConnected(gpus []GPU, n int, topology Topology) ([]GPU, int) {
+	if n == 1 {
+		return gpus[:1], 0
+	}
+
+	pairScore := func(a, b GPU) int {
+		return linkScore(topology.Link(a.ServerName, a.Number, b.Number))
+	}
+
+	var best []GPU
+	bestTotal := -1
+	for seed := range gpus {
+		selected := []GPU{gpus[seed]}
+		used := map[int]bool{seed: true}
+		total := 0
+		for len(selected) < n {
+			next, nextGain := -1, -1
+			for i, candidate := range gpus {
+				if used[i] {
+					continue
+				}
+				gain := 0
+				for _, chosen := range selected {
+					gain += pairScore(chosen, candidate)
+				}
+				if gain > nextGain {
+					next, nextGain = i, gain
+				}
+			}
+			selected = append(selected, gpus[next])
+			used[next] = true
+			total += nextGain
+		}
+		if total > bestTotal {
+			best, bestTotal = selected, total
+		}
+	}
+
+	slices.SortFunc(best, func(a, b GPU) int { return cmp.Compare(a.Number, b.Number) })
+	return best, bestTotal / (n * (n - 1) / 2)
+}
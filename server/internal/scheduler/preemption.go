@@ -0,0 +1,88 @@
+package scheduler
+
+import (
+	"cmp"
+	"slices"
+	"time"
+)
+
+// planPreemption frees GPUs for a blocked emergency request by preempting running
+// requests of lower priority. GPUs that are idle, already being freed for this request
+// or about to be released within the grace period anyway are counted first; victims
+// are then picked by lowest priority and, within a priority, least remaining time.
+func (s *Scheduler) planPreemption(emergency Request, eligible []GPU, busy map[string]bool, running []Request, now time.Time) []Action {
+	isEligible := make(map[string]bool)
+	for _, gpu := range eligible {
+		isEligible[gpu.UUID] = true
+	}
+
+	available := 0
+	for _, gpu := range eligible {
+		if !busy[gpu.UUID] {
+			available++
+		}
+	}
+
+	graceEnd := now.Add(s.PreemptionGrace)
+	var candidates []Request
+	for _, request := range running {
+		held := 0
+		for _, uuid := range request.GPUUUIDs {
+			if isEligible[uuid] {
+				held++
+			}
+		}
+		if held == 0 {
+			continue
+		}
+
+		switch {
+		case request.PreemptedBy == emergency.ID || !request.EndTime.After(graceEnd):
+			available += held
+		case request.PreemptedBy == 0 && slices.Contains(s.PreemptablePriorities, request.Priority):
+			candidates = append(candidates, request)
+		}
+	}
+	if available >= emergency.NumGPUs {
+		// Enough GPUs are on their way; just wait for them
+		return nil
+	}
+
+	slices.SortFunc(candidates, func(a, b Request) int {
+		return cmp.Or(
+			cmp.Compare(priorityRank[a.Priority], priorityRank[b.Priority]),
+			a.EndTime.Compare(b.EndTime),
+			cmp.Compare(a.ID, b.ID),
+		)
+	})
+
+	var victims []Request
+	for _, candidate := range candidates {
+		if available >= emergency.NumGPUs {
+			break
+		}
+		victims = append(victims, candidate)
+		for _, uuid := range candidate.GPUUUIDs {
+			if isEligible[uuid] {
+				available++
+			}
+		}
+	}
+	if available < emergency.NumGPUs {
+		// Even preempting everything allowed would not make room
+		return nil
+	}
+
+	actions := make([]Action, len(victims))
+	for i, victim := range victims {
+		actions[i] = Action{
+			Kind:        ActionPreempt,
+			RequestID:   victim.ID,
+			UserName:    victim.UserName,
+			GPUUUIDs:    victim.GPUUUIDs,
+			EndTime:     graceEnd,
+			PreemptedBy: emergency.ID,
+		}
+	}
+	return actions
+}
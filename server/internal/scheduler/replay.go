@@ -0,0 +1,227 @@
+package scheduler
+
+import (
+	"slices"
+	"time"
+)
+
+// ReplayOutcome is what happened to one request of a replayed workload
+type ReplayOutcome struct {
+	Request   Request   // As submitted; CreatedAt is when it arrived
+	Start     time.Time // Zero if it never started
+	End       time.Time // When it finished or was evicted, zero if it was still running at the end
+	GPUs      int       // GPUs it held once started
+	Preempted bool      // Evicted for an emergency request
+}
+
+// ReplayResult is the outcome of replaying a workload through the scheduler
+type ReplayResult struct {
+	From        time.Time
+	Until       time.Time
+	GPUs        int // GPUs new requests could be placed on
+	Outcomes    []ReplayOutcome
+	Preemptions int // Running requests notified that they are preempted
+}
+
+// Replay runs the scheduler offline on a simulated clock from from to until, submitting
+// each request of the workload at its CreatedAt and jumping from one event (an arrival,
+// a request ending, a booking or maintenance window starting or ending) to the next.
+// The fleet's GPUs, size classes, users, topology and maintenance are used as they are;
+// its requests and usage are replaced by the workload and the usage the replay itself
+// accrues for fair-share. Requests need distinct non-zero IDs. No-show release and end
+// warnings are off since there are no processes to observe.
+func (s *Scheduler) Replay(fleet State, workload []Request, from, until time.Time) ReplayResult {
+	clock := NewManualClock(from)
+	sim := *s
+	sim.Clock = clock
+	sim.NoShowWarning, sim.NoShowRelease, sim.EndWarning = 0, 0, 0
+
+	workload = slices.Clone(workload)
+	slices.SortStableFunc(workload, func(a, b Request) int { return a.CreatedAt.Compare(b.CreatedAt) })
+
+	result := ReplayResult{From: from, Until: until}
+	for _, gpu := range fleet.GPUs {
+		if gpu.Placeable() {
+			result.GPUs++
+		}
+	}
+	outcomes := make(map[int]*ReplayOutcome)
+	meter := make(usageMeter)
+
+	state := fleet
+	state.Requests, state.Usage = nil, nil
+	next := 0
+	for {
+		now := clock.Now()
+		for ; next < len(workload) && !workload[next].CreatedAt.After(now); next++ {
+			request := workload[next]
+			request.Status = StatusScheduled
+			request.StartTime, request.EndTime, request.GPUUUIDs = time.Time{}, time.Time{}, nil
+			result.Outcomes = append(result.Outcomes, ReplayOutcome{Request: request})
+			state.Requests = append(state.Requests, request)
+		}
+		if sim.FairShareHalfLife > 0 {
+			state.Usage = meter.usage(state.Requests, now, now.Add(-sim.UsageWindow()))
+		}
+
+		for _, action := range sim.Plan(state) {
+			applyAction(&state, action)
+			switch action.Kind {
+			case ActionStart, ActionStartBooking:
+				outcomes[action.RequestID] = &ReplayOutcome{Start: now, GPUs: len(action.GPUUUIDs)}
+			case ActionPreempt:
+				result.Preemptions++
+			case ActionFinish, ActionEvict:
+				if outcome := outcomes[action.RequestID]; outcome != nil {
+					outcome.End, outcome.Preempted = now, action.Kind == ActionEvict
+				}
+			}
+		}
+
+		// Ended requests only matter to fair-share from now on
+		state.Requests = slices.DeleteFunc(state.Requests, func(request Request) bool {
+			if request.Status == StatusScheduled || request.Status == StatusInProgress {
+				return false
+			}
+			if request.Status != StatusCancelled {
+				meter.add(request, request.StartTime, now)
+			}
+			return true
+		})
+
+		at, ok := nextEvent(state, now)
+		if next < len(workload) && (!ok || workload[next].CreatedAt.Before(at)) {
+			at, ok = workload[next].CreatedAt, true
+		}
+		if !ok || at.After(until) {
+			break
+		}
+		clock.Set(at)
+	}
+
+	for i := range result.Outcomes {
+		if outcome := outcomes[result.Outcomes[i].Request.ID]; outcome != nil {
+			outcome.Request = result.Outcomes[i].Request
+			result.Outcomes[i] = *outcome
+		}
+	}
+	return result
+}
+
+// usageMeter accumulates the GPUs each user held during each hour, like gpu_processes_hourly_historical
+type usageMeter map[usageKey]int
+
+type usageKey struct {
+	userName string
+	hour     time.Time
+}
+
+// add records the GPUs a request held from start until end
+func (m usageMeter) add(request Request, start, end time.Time) {
+	if start.IsZero() {
+		return
+	}
+	for hour := start.Truncate(time.Hour); hour.Before(end); hour = hour.Add(time.Hour) {
+		m[usageKey{request.UserName, hour}] += len(request.GPUUUIDs)
+	}
+}
+
+// usage returns the recorded usage since the cutoff plus that of the running requests
+// so far, forgetting older usage
+func (m usageMeter) usage(requests []Request, now, cutoff time.Time) []UsageHour {
+	current := make(usageMeter, len(m))
+	for key, gpus := range m {
+		if key.hour.Before(cutoff) {
+			delete(m, key)
+			continue
+		}
+		current[key] = gpus
+	}
+	for _, request := range requests {
+		if request.Status == StatusInProgress {
+			current.add(request, request.StartTime, now)
+		}
+	}
+
+	usage := make([]UsageHour, 0, len(current))
+	for key, gpus := range current {
+		usage = append(usage, UsageHour{UserName: key.userName, Hour: key.hour, GPUs: gpus})
+	}
+	return usage
+}
+
+// ReplaySummary condenses a replay for comparing policies
+type ReplaySummary struct {
+	Requests    int
+	Started     int
+	Waiting     int // Never started before the replay ended
+	MeanWait    time.Duration
+	MedianWait  time.Duration
+	P95Wait     time.Duration
+	MaxWait     time.Duration
+	Utilization float64 // GPU-hours held over GPU-hours available
+	Fairness    float64 // Jain index of the fraction of their demand each user was served
+	Preemptions int
+}
+
+// Summarize computes wait times over every request, and utilization and fairness over
+// [r.From, end). Each user's service is the GPU-hours their requests held before end
+// divided by the GPU-hours they asked for; the Jain index of these is 1 when every user
+// got the same fraction of their demand and 1/n when one of n users got everything.
+func (r ReplayResult) Summarize(end time.Time) ReplaySummary {
+	summary := ReplaySummary{Requests: len(r.Outcomes), Preemptions: r.Preemptions}
+
+	var waits []time.Duration
+	var total time.Duration
+	served := make(map[string]float64)
+	demand := make(map[string]float64)
+	var held float64
+	for _, outcome := range r.Outcomes {
+		request := outcome.Request
+		if request.CreatedAt.Before(end) {
+			demand[request.UserName] += float64(request.NumGPUs * request.RequestedHours)
+		}
+		if outcome.Start.IsZero() {
+			summary.Waiting++
+			continue
+		}
+		wait := outcome.Start.Sub(request.CreatedAt)
+		waits = append(waits, wait)
+		total += wait
+
+		stop := outcome.End
+		if stop.IsZero() || stop.After(end) {
+			stop = end
+		}
+		if stop.After(outcome.Start) {
+			hours := float64(outcome.GPUs) * stop.Sub(outcome.Start).Hours()
+			served[request.UserName] += hours
+			held += hours
+		}
+	}
+
+	summary.Started = len(waits)
+	if len(waits) > 0 {
+		slices.Sort(waits)
+		summary.MeanWait = total / time.Duration(len(waits))
+		summary.MedianWait = waits[len(waits)/2]
+		summary.P95Wait = waits[min(len(waits)*95/100, len(waits)-1)]
+		summary.MaxWait = waits[len(waits)-1]
+	}
+	if capacity := float64(r.GPUs) * end.Sub(r.From).Hours(); capacity > 0 {
+		summary.Utilization = held / capacity
+	}
+
+	var sum, squares float64
+	for user, asked := range demand {
+		if asked > 0 {
+			share := min(served[user]/asked, 1)
+			sum += share
+			squares += share * share
+		}
+	}
+	if squares > 0 {
+		summary.Fairness = sum * sum / (float64(len(demand)) * squares)
+	}
+	return summary
+}
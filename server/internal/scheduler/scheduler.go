@@ -0,0 +1,554 @@
+package scheduler
+
+import (
+	"cmp"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Scheduler decides which requests start and finish. It is a pure function of the
+// state and its clock, so the same inputs always produce the same actions.
+type Scheduler struct {
+	Clock Clock
+
+	// PreemptionGrace is how long preempted requests keep their GPUs after being notified
+	PreemptionGrace time.Duration
+	// PreemptablePriorities are the priorities an emergency request may displace
+	PreemptablePriorities []string
+
+	// FairShareHalfLife is how quickly past GPU usage is forgiven; zero disables fair-share
+	FairShareHalfLife time.Duration
+	// FairShareByGroup splits shares between research groups first, then between their members
+	FairShareByGroup bool
+
+	// NoShowWarning is how long after starting a request whose owner has run nothing on its
+	// GPUs gets them warned, and NoShowRelease how long until its GPUs are released; zero disables
+	NoShowWarning time.Duration
+	NoShowRelease time.Duration
+
+	// EndWarning is how long before a running request ends its owner is offered an
+	// extension; zero disables
+	EndWarning time.Duration
+}
+
+// New creates a scheduler using the given clock and the default policy
+func New(clock Clock) *Scheduler {
+	return &Scheduler{
+		Clock:                 clock,
+		PreemptionGrace:       15 * time.Minute,
+		PreemptablePriorities: []string{"low", "medium"},
+		FairShareHalfLife:     7 * 24 * time.Hour,
+		NoShowWarning:         30 * time.Minute,
+		NoShowRelease:         time.Hour,
+		EndWarning:            30 * time.Minute,
+	}
+}
+
+// Plan returns the actions needed to move the state forward to the current time.
+// Requests past their end_time finish, owners of requests about to end are offered an
+// extension, running requests their owner has not used since they started are warned
+// and then released (see noShow), and bookings whose start_time
+// has come start on their GPUs. Queued requests are then started in queue order (see sortQueue) for as
+// long as free GPUs allow, using only GPUs that are neither draining nor quarantined and
+// that they release before the next booking or maintenance window. Degraded GPUs are
+// only used when there are not enough healthy ones.
+//
+// The first request that does not fit gets a projected start: the earliest time enough
+// of its GPUs come free. Requests behind it are backfilled only if they do not delay
+// it, i.e. they finish by then or use GPUs it will not need, so large requests are not
+// starved by a stream of small ones. A blocked emergency request instead preempts
+// lower-priority running requests.
+//
+// VRAM slice requests only run on shared GPUs, which whole-GPU requests never use. Each
+// slice is bin-packed onto the shared GPU it fits best (see placeSlice); a slice that
+// fits nowhere waits without holding up the queue and never preempts.
+func (s *Scheduler) Plan(state State) []Action {
+	return s.plan(state, nil)
+}
+
+// plan is Plan, also recording in why (when not nil) why each queued request that is
+// not started is waiting
+func (s *Scheduler) plan(state State, why map[int]string) []Action {
+	now := s.Clock.Now()
+	var actions []Action
+	explain := func(requestID int, reason string) {
+		if why != nil {
+			why[requestID] = reason
+		}
+	}
+
+	// busyUntil is when each held GPU is expected to come free, holder the request holding
+	// it (absent for maintenance), sliceVRAM how much VRAM of each shared GPU is granted to
+	// slices, wholeHeld which GPUs a whole-GPU request holds (e.g., one started before the
+	// GPU was shared) and userGPUs how many GPUs each user holds outside of projects (a
+	// slice counts as one)
+	busyUntil := make(map[string]time.Time)
+	holder := make(map[string]int)
+	sliceVRAM := make(map[string]int)
+	wholeHeld := make(map[string]bool)
+	userGPUs := make(map[string]int)
+	hold := func(request Request, uuids []string, until time.Time) {
+		for _, uuid := range uuids {
+			if request.IsSlice() {
+				sliceVRAM[uuid] += request.VRAMMB
+			} else if request.ID != 0 {
+				wholeHeld[uuid] = true
+			}
+			if until.After(busyUntil[uuid]) {
+				busyUntil[uuid] = until
+			}
+			if request.ID != 0 {
+				holder[uuid] = request.ID
+			}
+		}
+		if request.ProjectID == 0 {
+			userGPUs[request.UserName] += len(uuids)
+		}
+	}
+	busy := func(uuid string) bool {
+		return busyUntil[uuid].After(now)
+	}
+
+	var running, bookings, queue []Request
+	for _, request := range state.Requests {
+		switch request.Status {
+		case StatusInProgress:
+			if !request.EndTime.After(now) {
+				kind := ActionFinish
+				if request.PreemptedBy != 0 {
+					kind = ActionEvict
+				}
+				actions = append(actions, Action{Kind: kind, RequestID: request.ID, UserName: request.UserName, GPUUUIDs: request.GPUUUIDs, PreemptedBy: request.PreemptedBy})
+				continue
+			}
+			if s.EndWarning > 0 && !request.EndWarned && request.PreemptedBy == 0 && !now.Before(request.EndTime.Add(-s.EndWarning)) {
+				actions = append(actions, Action{Kind: ActionWarnEnd, RequestID: request.ID, UserName: request.UserName, GPUUUIDs: request.GPUUUIDs, EndTime: request.EndTime})
+			}
+			if action, ok := s.noShow(request, now); ok {
+				actions = append(actions, action)
+				if action.Kind == ActionRelease {
+					continue
+				}
+			}
+			running = append(running, request)
+			hold(request, request.GPUUUIDs, request.EndTime)
+		case StatusScheduled:
+			if request.IsBooking() {
+				bookings = append(bookings, request)
+			} else {
+				queue = append(queue, request)
+			}
+		}
+	}
+
+	// Bookings take their GPUs ahead of the queue. One whose GPUs are still held (e.g., by
+	// a preempted request in its grace period) waits, and expires if its window passes.
+	for _, booking := range bookings {
+		if booking.StartTime.After(now) {
+			continue
+		}
+		if !booking.EndTime.After(now) {
+			actions = append(actions, Action{Kind: ActionExpire, RequestID: booking.ID, UserName: booking.UserName})
+			continue
+		}
+		if slices.ContainsFunc(booking.GPUUUIDs, busy) {
+			continue
+		}
+		hold(booking, booking.GPUUUIDs, booking.EndTime)
+		actions = append(actions, Action{
+			Kind:      ActionStartBooking,
+			RequestID: booking.ID,
+			UserName:  booking.UserName,
+			GPUUUIDs:  booking.GPUUUIDs,
+			StartTime: booking.StartTime,
+			EndTime:   booking.EndTime,
+		})
+	}
+
+	sortQueue(queue, s.scores(state))
+	gpus := sortedGPUs(state.GPUs)
+	for _, window := range state.Maintenance {
+		if window.Start.After(now) || !window.End.After(now) {
+			continue
+		}
+		for _, gpu := range gpus {
+			if window.Covers(gpu) {
+				hold(Request{}, []string{gpu.UUID}, window.End)
+			}
+		}
+	}
+	reserved := reservations(state, gpus, now)
+	gpuQuota := make(map[string]int)
+	for _, user := range state.Users {
+		gpuQuota[user.Name] = user.MaxConcurrentGPUs
+	}
+
+	// Once a request is blocked, shadow is its projected start and shadowGPUs the GPUs it will get
+	var shadow time.Time
+	var shadowGPUs map[string]bool
+	blockedBy := 0
+
+	for i, request := range queue {
+		eligible := eligibleGPUs(request, gpus, state.SizeClasses)
+		if len(eligible) < request.NumGPUs {
+			// Could never fit, even on an idle cluster; don't let it hold up the queue
+			explain(request.ID, neverFitsReason(request, len(eligible), state.SizeClasses))
+			continue
+		}
+		// Project requests draw on the project's allocation, checked when they are made
+		if limit := gpuQuota[request.UserName]; limit > 0 && request.ProjectID == 0 && userGPUs[request.UserName]+request.NumGPUs > limit {
+			// Only possible if the quota was lowered after the request was made
+			explain(request.ID, fmt.Sprintf("quota exceeded: %s may hold at most %d GPU(s) at once, holds %d and requested %d",
+				request.UserName, limit, userGPUs[request.UserName], request.NumGPUs))
+			continue
+		}
+		end := now.Add(request.Duration())
+
+		if request.IsSlice() {
+			gpu, ok := placeSlice(request, eligible, sliceVRAM, wholeHeld, reserved, end, now, state.Maintenance)
+			if !ok {
+				explain(request.ID, sliceBlockedReason(request, eligible, sliceVRAM, wholeHeld, reserved, end, now, state.Maintenance))
+				continue
+			}
+			hold(request, []string{gpu.UUID}, end)
+			actions = append(actions, Action{
+				Kind:      ActionStart,
+				RequestID: request.ID,
+				GPUUUIDs:  []string{gpu.UUID},
+				StartTime: now,
+				EndTime:   end,
+			})
+			continue
+		}
+
+		// Draining and quarantined GPUs still count above: the request fits once they are back in service
+		var placeable []GPU
+		for _, gpu := range eligible {
+			if gpu.Placeable() {
+				placeable = append(placeable, gpu)
+			}
+		}
+		blocked := func() string {
+			return blockedReason(request, eligible, now, busyUntil, holder, reserved, shadow, shadowGPUs, blockedBy, state.Maintenance)
+		}
+
+		if len(placeable) < request.NumGPUs {
+			// Only fits once draining or quarantined GPUs are back in service; don't hold up the queue meanwhile
+			explain(request.ID, blocked())
+			continue
+		}
+
+		// unusable marks GPUs that are busy or booked before the request would finish
+		unusable := make(map[string]bool)
+		var free []GPU
+		for _, gpu := range placeable {
+			next, isReserved := reserved[gpu.UUID]
+			if busy(gpu.UUID) || (isReserved && end.After(next)) {
+				unusable[gpu.UUID] = true
+				continue
+			}
+			// A backfilled request running past the projected start must stay off its GPUs
+			if shadowGPUs != nil && end.After(shadow) && shadowGPUs[gpu.UUID] {
+				continue
+			}
+			free = append(free, gpu)
+		}
+
+		if len(free) < request.NumGPUs {
+			if shadowGPUs != nil {
+				// Only the first blocked request is guaranteed a start; keep backfilling
+				explain(request.ID, blocked())
+				continue
+			}
+			explain(request.ID, blocked())
+			if request.Priority == "emergency" {
+				actions = append(actions, s.planPreemption(request, placeable, unusable, running, now)...)
+				explainBehind(queue[i+1:], request.ID, why)
+				break
+			}
+
+			var selected []GPU
+			shadow, selected = projectStart(request, placeable, busyUntil, now, state)
+			if selected == nil {
+				// No projection possible; let the next blocked request hold the queue instead
+				continue
+			}
+			blockedBy = request.ID
+			shadowGPUs = make(map[string]bool)
+			for _, gpu := range selected {
+				shadowGPUs[gpu.UUID] = true
+			}
+			if !shadow.Equal(request.ProjectedStart) {
+				actions = append(actions, Action{Kind: ActionProject, RequestID: request.ID, UserName: request.UserName, StartTime: shadow})
+			}
+			continue
+		}
+
+		selected := placeGPUs(preferHealthy(free, request.NumGPUs), request, state)
+		uuids := make([]string, len(selected))
+		for i, gpu := range selected {
+			uuids[i] = gpu.UUID
+		}
+		hold(request, uuids, end)
+
+		actions = append(actions, Action{
+			Kind:      ActionStart,
+			RequestID: request.ID,
+			GPUUUIDs:  uuids,
+			StartTime: now,
+			EndTime:   end,
+		})
+	}
+
+	return actions
+}
+
+// noShow warns the owner of a running request who has not started a process on its GPUs
+// within NoShowWarning of its start, and releases it after NoShowRelease. Preempted
+// requests are left to end with their grace period.
+func (s *Scheduler) noShow(request Request, now time.Time) (Action, bool) {
+	if request.Used || request.PreemptedBy != 0 || s.NoShowRelease <= 0 {
+		return Action{}, false
+	}
+
+	releaseAt := request.StartTime.Add(s.NoShowRelease)
+	if !now.Before(releaseAt) {
+		return Action{
+			Kind:      ActionRelease,
+			RequestID: request.ID,
+			UserName:  request.UserName,
+			GPUUUIDs:  request.GPUUUIDs,
+			EndTime:   now,
+			Reason:    fmt.Sprintf("released: no process of %s ran on its GPUs within %s of the start", request.UserName, s.NoShowRelease),
+		}, true
+	}
+	if s.NoShowWarning > 0 && !request.IdleWarned && !now.Before(request.StartTime.Add(s.NoShowWarning)) {
+		return Action{
+			Kind:      ActionWarnIdle,
+			RequestID: request.ID,
+			UserName:  request.UserName,
+			GPUUUIDs:  request.GPUUUIDs,
+			StartTime: request.StartTime,
+			EndTime:   releaseAt,
+		}, true
+	}
+	return Action{}, false
+}
+
+// projectStart finds the earliest time at which enough eligible GPUs are free for the
+// request, assuming running requests end on time, and the GPUs it would get then. A GPU
+// only counts if no booking or maintenance window overlaps the request at that time, so
+// besides the times busy GPUs come free, the ends of bookings and maintenance windows
+// are tried. The time is rounded up to the minute so that it only changes when the
+// outlook does.
+func projectStart(request Request, eligible []GPU, busyUntil map[string]time.Time, now time.Time, state State) (time.Time, []GPU) {
+	windows := reservedWindows(state, eligible, now)
+	var times []time.Time
+	for _, gpu := range eligible {
+		if until := busyUntil[gpu.UUID]; until.After(now) {
+			times = append(times, until)
+		}
+		for _, window := range windows[gpu.UUID] {
+			times = append(times, window[1])
+		}
+	}
+	slices.SortFunc(times, time.Time.Compare)
+
+	for _, at := range times {
+		end := at.Add(request.Duration())
+		var available []GPU
+		for _, gpu := range eligible {
+			if busyUntil[gpu.UUID].After(at) || slices.ContainsFunc(windows[gpu.UUID], func(window [2]time.Time) bool {
+				return window[0].Before(end) && window[1].After(at)
+			}) {
+				continue
+			}
+			available = append(available, gpu)
+		}
+		if len(available) >= request.NumGPUs {
+			projected := at.Truncate(time.Minute)
+			if projected.Before(at) {
+				projected = projected.Add(time.Minute)
+			}
+			return projected, placeGPUs(preferHealthy(available, request.NumGPUs), request, state)
+		}
+	}
+	return time.Time{}, nil
+}
+
+// reservedWindows returns, for each GPU, the [start, end) windows of the bookings and
+// maintenance windows that have not ended yet
+func reservedWindows(state State, gpus []GPU, now time.Time) map[string][][2]time.Time {
+	windows := make(map[string][][2]time.Time)
+	for _, request := range state.Requests {
+		if request.IsBooking() && request.EndTime.After(now) {
+			for _, uuid := range request.GPUUUIDs {
+				windows[uuid] = append(windows[uuid], [2]time.Time{request.StartTime, request.EndTime})
+			}
+		}
+	}
+	for _, window := range state.Maintenance {
+		if !window.End.After(now) {
+			continue
+		}
+		for _, gpu := range gpus {
+			if window.Covers(gpu) {
+				windows[gpu.UUID] = append(windows[gpu.UUID], [2]time.Time{window.Start, window.End})
+			}
+		}
+	}
+	return windows
+}
+
+// sortQueue orders requests by priority, then by fair-share score (users with the least
+// recent usage first), then by age, then by ID. Users without a score count as 1.
+func sortQueue(queue []Request, scores map[string]float64) {
+	score := func(userName string) float64 {
+		if value, ok := scores[userName]; ok {
+			return value
+		}
+		return 1
+	}
+	slices.SortStableFunc(queue, func(a, b Request) int {
+		return cmp.Or(
+			cmp.Compare(priorityRank[b.Priority], priorityRank[a.Priority]),
+			cmp.Compare(score(b.UserName), score(a.UserName)),
+			a.CreatedAt.Compare(b.CreatedAt),
+			cmp.Compare(a.ID, b.ID),
+		)
+	})
+}
+
+// preferHealthy drops degraded GPUs from the free list if enough healthy ones remain for n
+func preferHealthy(free []GPU, n int) []GPU {
+	var healthy []GPU
+	for _, gpu := range free {
+		if gpu.Health != HealthDegraded {
+			healthy = append(healthy, gpu)
+		}
+	}
+	if len(healthy) >= n {
+		return healthy
+	}
+	return free
+}
+
+// sortedGPUs returns the GPUs ordered by server name and GPU number
+func sortedGPUs(gpus []GPU) []GPU {
+	sorted := slices.Clone(gpus)
+	slices.SortFunc(sorted, func(a, b GPU) int {
+		return cmp.Or(
+			cmp.Compare(a.ServerName, b.ServerName),
+			cmp.Compare(a.Number, b.Number),
+		)
+	})
+	return sorted
+}
+
+// eligibleGPUs filters the GPUs a request may run on, busy or not: shared GPUs with
+// enough VRAM for slices, unshared GPUs for whole-GPU requests
+func eligibleGPUs(request Request, gpus []GPU, classes map[string]SizeClass) []GPU {
+	var eligible []GPU
+	for _, gpu := range gpus {
+		if gpu.Shared != request.IsSlice() || gpu.VRAMMB < request.VRAMMB {
+			continue
+		}
+		if request.ServerName != "" && gpu.ServerName != request.ServerName {
+			continue
+		}
+		if !gpuMatchesSize(classes, request.GPUSize, gpu) {
+			continue
+		}
+		eligible = append(eligible, gpu)
+	}
+	return eligible
+}
+
+// neverFitsReason explains why a request can never be placed on the current fleet
+func neverFitsReason(request Request, eligible int, classes map[string]SizeClass) string {
+	where := "in the cluster"
+	if request.ServerName != "" {
+		where = "on " + request.ServerName
+	}
+	if request.IsSlice() {
+		return fmt.Sprintf("no shared %s GPU (%s) with at least %d MB of VRAM exists %s",
+			request.GPUSize, classes[request.GPUSize].Describe(), request.VRAMMB, where)
+	}
+	return fmt.Sprintf("only %d %s GPU(s) (%s) exist %s, but %d were requested",
+		eligible, request.GPUSize, classes[request.GPUSize].Describe(), where, request.NumGPUs)
+}
+
+// blockedReason explains what keeps the eligible GPUs of a request from being free now
+func blockedReason(request Request, eligible []GPU, now time.Time, busyUntil map[string]time.Time, holder map[string]int,
+	reserved map[string]time.Time, shadow time.Time, shadowGPUs map[string]bool, blockedBy int, windows []MaintenanceWindow) string {
+	end := now.Add(request.Duration())
+
+	var holders []int
+	var held, maintenance, draining, quarantined, booked, kept, free int
+	var firstFree time.Time
+	for _, gpu := range eligible {
+		next, isReserved := reserved[gpu.UUID]
+		switch {
+		case inMaintenance(gpu, windows, now):
+			maintenance++
+		case gpu.Health == HealthQuarantined:
+			quarantined++
+		case gpu.Draining:
+			draining++
+		case busyUntil[gpu.UUID].After(now):
+			held++
+			if !slices.Contains(holders, holder[gpu.UUID]) {
+				holders = append(holders, holder[gpu.UUID])
+			}
+			if firstFree.IsZero() || busyUntil[gpu.UUID].Before(firstFree) {
+				firstFree = busyUntil[gpu.UUID]
+			}
+		case isReserved && end.After(next):
+			booked++
+		case shadowGPUs != nil && end.After(shadow) && shadowGPUs[gpu.UUID]:
+			kept++
+		default:
+			free++
+		}
+	}
+
+	var parts []string
+	if held > 0 {
+		slices.Sort(holders)
+		ids := make([]string, len(holders))
+		for i, id := range holders {
+			ids[i] = fmt.Sprintf("#%d", id)
+		}
+		parts = append(parts, fmt.Sprintf("%d in use by request(s) %s, the first until %s",
+			held, strings.Join(ids, ", "), firstFree.Format("Mon Jan 2 15:04")))
+	}
+	if maintenance > 0 {
+		parts = append(parts, fmt.Sprintf("%d under maintenance", maintenance))
+	}
+	if quarantined > 0 {
+		parts = append(parts, fmt.Sprintf("%d quarantined", quarantined))
+	}
+	if draining > 0 {
+		parts = append(parts, fmt.Sprintf("%d draining", draining))
+	}
+	if booked > 0 {
+		parts = append(parts, fmt.Sprintf("%d booked before it would finish", booked))
+	}
+	if kept > 0 {
+		parts = append(parts, fmt.Sprintf("%d kept free for request #%d, which is ahead in the queue", kept, blockedBy))
+	}
+	return fmt.Sprintf("needs %d %s GPU(s) but only %d of the %d eligible are free: %s",
+		request.NumGPUs, request.GPUSize, free, len(eligible), strings.Join(parts, "; "))
+}
+
+// explainBehind records that the rest of the queue waits for a blocked request
+func explainBehind(queue []Request, blockedBy int, why map[int]string) {
+	if why == nil {
+		return
+	}
+	for _, request := range queue {
+		why[request.ID] = fmt.Sprintf("waiting behind request #%d, which is first in line", blockedBy)
+	}
+}
@@ -0,0 +1,312 @@
+package scheduler
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+var testNow = time.Date(2026, 10, 19, 12, 0, 0, 0, time.UTC)
+
+// testGPUs returns n unshared 24 GB GPUs on a server, named after it (e.g., a0, a1)
+func testGPUs(serverName string, n int) []GPU {
+	gpus := make([]GPU, n)
+	for i := range gpus {
+		gpus[i] = GPU{UUID: fmt.Sprintf("%s%d", serverName, i), ServerName: serverName, Number: i, ModelName: "A", VRAMMB: 24000}
+	}
+	return gpus
+}
+
+// queued is a request waiting in the queue, created minutes before testNow
+func queued(id int, userName string, numGPUs, hours int, priority string, minutes int) Request {
+	return Request{
+		ID: id, UserName: userName, NumGPUs: numGPUs, RequestedHours: hours, GPUSize: "small",
+		Priority: priority, Status: StatusScheduled, CreatedAt: testNow.Add(-time.Duration(minutes) * time.Minute),
+	}
+}
+
+// running is a request in progress on the given GPUs, until testNow plus the given duration
+func running(id int, userName, priority string, until time.Duration, uuids ...string) Request {
+	return Request{
+		ID: id, UserName: userName, NumGPUs: len(uuids), RequestedHours: 4, GPUSize: "small",
+		Priority: priority, Status: StatusInProgress, StartTime: testNow.Add(until - 4*time.Hour),
+		EndTime: testNow.Add(until), GPUUUIDs: uuids, Used: true,
+	}
+}
+
+// slice is a queued VRAM slice request
+func slice(id int, userName string, vramMB int) Request {
+	request := queued(id, userName, 1, 1, "medium", 10)
+	request.VRAMMB = vramMB
+	return request
+}
+
+// describe summarizes actions as "kind id [gpus] [time relative to testNow]" for comparison
+func describe(actions []Action) []string {
+	var lines []string
+	for _, action := range actions {
+		line := fmt.Sprintf("%s %d", action.Kind, action.RequestID)
+		if len(action.GPUUUIDs) > 0 && (action.Kind == ActionStart || action.Kind == ActionStartBooking) {
+			line += " " + strings.Join(action.GPUUUIDs, ",")
+		}
+		switch action.Kind {
+		case ActionProject:
+			line += fmt.Sprintf(" +%s", action.StartTime.Sub(testNow))
+		case ActionPreempt, ActionWarnIdle:
+			line += fmt.Sprintf(" +%s", action.EndTime.Sub(testNow))
+		}
+		lines = append(lines, line)
+	}
+	return lines
+}
+
+func TestPlan(t *testing.T) {
+	tests := []struct {
+		name      string
+		state     State
+		configure func(s *Scheduler)
+		want      []string
+	}{
+		{
+			name:  "starts a queued request on free GPUs",
+			state: State{GPUs: testGPUs("a", 4), Requests: []Request{queued(1, "alice", 2, 1, "medium", 10)}},
+			want:  []string{"start 1 a0,a1"},
+		},
+		{
+			name: "finishes requests past their end",
+			state: State{GPUs: testGPUs("a", 4), Requests: []Request{
+				running(1, "alice", "medium", 0, "a0"),
+				running(2, "bob", "medium", time.Hour, "a1"),
+			}},
+			want: []string{"finish 1"},
+		},
+		{
+			name: "projects the start of a blocked request",
+			state: State{GPUs: testGPUs("a", 4), Requests: []Request{
+				running(1, "alice", "medium", 2*time.Hour, "a0", "a1", "a2", "a3"),
+				queued(2, "bob", 2, 1, "medium", 10),
+			}},
+			want: []string{"project 2 +2h0m0s"},
+		},
+		{
+			name: "backfills only requests that do not delay the blocked one",
+			state: State{GPUs: testGPUs("a", 4), Requests: []Request{
+				running(1, "alice", "medium", 2*time.Hour, "a0", "a1"),
+				queued(2, "bob", 4, 1, "medium", 30),
+				queued(3, "carol", 1, 1, "medium", 20), // Done before bob's projected start
+				queued(4, "dave", 1, 3, "medium", 10),  // Would still run at bob's projected start
+			}},
+			want: []string{"project 2 +2h0m0s", "start 3 a2"},
+		},
+		{
+			name: "starts higher priorities first",
+			state: State{GPUs: testGPUs("a", 2), Requests: []Request{
+				running(1, "alice", "medium", time.Hour, "a0"),
+				queued(2, "bob", 1, 1, "low", 30),
+				queued(3, "carol", 1, 1, "high", 10),
+			}},
+			want: []string{"start 3 a1", "project 2 +1h0m0s"},
+		},
+		{
+			name: "fair-share favours users with less recent usage",
+			state: State{
+				GPUs:  testGPUs("a", 1),
+				Users: []User{{Name: "alice"}, {Name: "bob"}},
+				Usage: []UsageHour{{UserName: "alice", Hour: testNow.Add(-2 * time.Hour), GPUs: 4}},
+				Requests: []Request{
+					queued(1, "alice", 1, 1, "medium", 30),
+					queued(2, "bob", 1, 1, "medium", 10),
+				},
+			},
+			configure: func(s *Scheduler) { s.FairShareHalfLife = 7 * 24 * time.Hour },
+			want:      []string{"start 2 a0", "project 1 +1h0m0s"},
+		},
+		{
+			name: "emergency requests preempt lower priorities",
+			state: State{GPUs: testGPUs("a", 4), Requests: []Request{
+				running(1, "alice", "high", 3*time.Hour, "a0", "a1"),
+				running(2, "bob", "low", 3*time.Hour, "a2"),
+				running(3, "carol", "medium", 2*time.Hour, "a3"),
+				queued(4, "dave", 2, 1, "emergency", 10),
+			}},
+			want: []string{"preempt 2 +15m0s", "preempt 3 +15m0s"},
+		},
+		{
+			name: "quota caps the GPUs a user holds",
+			state: State{
+				GPUs:  testGPUs("a", 4),
+				Users: []User{{Name: "alice", MaxConcurrentGPUs: 2}},
+				Requests: []Request{
+					running(1, "alice", "medium", time.Hour, "a0"),
+					queued(2, "alice", 2, 1, "medium", 20),
+					queued(3, "alice", 1, 1, "medium", 10),
+				},
+			},
+			want: []string{"start 3 a1"},
+		},
+		{
+			name: "no-shows are warned, then released",
+			state: State{GPUs: testGPUs("a", 2), Requests: []Request{
+				{ID: 1, UserName: "alice", NumGPUs: 1, RequestedHours: 4, Status: StatusInProgress,
+					StartTime: testNow.Add(-40 * time.Minute), EndTime: testNow.Add(3 * time.Hour), GPUUUIDs: []string{"a0"}},
+				{ID: 2, UserName: "bob", NumGPUs: 1, RequestedHours: 4, Status: StatusInProgress,
+					StartTime: testNow.Add(-90 * time.Minute), EndTime: testNow.Add(3 * time.Hour), GPUUUIDs: []string{"a1"}},
+				queued(3, "carol", 1, 1, "medium", 10),
+			}},
+			configure: func(s *Scheduler) { s.NoShowWarning, s.NoShowRelease = 30*time.Minute, time.Hour },
+			want:      []string{"warn_idle 1 +20m0s", "release 2", "start 3 a1"},
+		},
+		{
+			name: "bookings start on their GPUs and expire once their window passes",
+			state: State{GPUs: testGPUs("a", 4), Requests: []Request{
+				{ID: 1, UserName: "alice", NumGPUs: 1, Status: StatusScheduled, StartTime: testNow.Add(-time.Minute),
+					EndTime: testNow.Add(time.Hour), GPUUUIDs: []string{"a2"}},
+				{ID: 2, UserName: "bob", NumGPUs: 1, Status: StatusScheduled, StartTime: testNow.Add(-2 * time.Hour),
+					EndTime: testNow.Add(-time.Hour), GPUUUIDs: []string{"a3"}},
+			}},
+			want: []string{"start_booking 1 a2", "expire 2"},
+		},
+		{
+			name: "requests stay off GPUs booked before they would finish",
+			state: State{GPUs: testGPUs("a", 2), Requests: []Request{
+				{ID: 1, UserName: "alice", NumGPUs: 1, Status: StatusScheduled, StartTime: testNow.Add(time.Hour),
+					EndTime: testNow.Add(2 * time.Hour), GPUUUIDs: []string{"a0"}},
+				queued(2, "bob", 1, 2, "medium", 10),
+			}},
+			want: []string{"start 2 a1"},
+		},
+		{
+			name: "a booking overlapping the blocked request does not stop backfill",
+			state: State{GPUs: testGPUs("a", 1), Requests: []Request{
+				{ID: 1, UserName: "alice", NumGPUs: 1, Status: StatusScheduled, StartTime: testNow.Add(5 * time.Hour),
+					EndTime: testNow.Add(6 * time.Hour), GPUUUIDs: []string{"a0"}},
+				queued(2, "bob", 1, 8, "medium", 20),
+				queued(3, "carol", 1, 1, "medium", 10),
+			}},
+			want: []string{"project 2 +6h0m0s", "start 3 a0"},
+		},
+		{
+			name: "projects past back-to-back maintenance windows",
+			state: State{
+				GPUs: testGPUs("a", 1),
+				Maintenance: []MaintenanceWindow{
+					{ServerName: "a", Start: testNow.Add(2 * time.Hour), End: testNow.Add(3 * time.Hour)},
+					{ServerName: "a", Start: testNow.Add(4 * time.Hour), End: testNow.Add(5 * time.Hour)},
+				},
+				Requests: []Request{queued(1, "alice", 1, 3, "medium", 20), queued(2, "bob", 1, 1, "medium", 10)},
+			},
+			want: []string{"project 1 +5h0m0s", "start 2 a0"},
+		},
+		{
+			name: "maintenance takes GPUs out of service",
+			state: State{
+				GPUs: append(testGPUs("a", 2), testGPUs("b", 2)...),
+				Maintenance: []MaintenanceWindow{
+					{ServerName: "a", Start: testNow.Add(-time.Hour), End: testNow.Add(time.Hour)},
+					{ServerName: "b", GPUUUID: "b0", Start: testNow.Add(30 * time.Minute), End: testNow.Add(time.Hour)},
+				},
+				Requests: []Request{queued(1, "alice", 1, 1, "medium", 10)},
+			},
+			want: []string{"start 1 b1"},
+		},
+		{
+			name: "placement skips draining and quarantined GPUs and prefers healthy ones",
+			state: State{
+				GPUs: []GPU{
+					{UUID: "a0", ServerName: "a", Number: 0, VRAMMB: 24000, Draining: true},
+					{UUID: "a1", ServerName: "a", Number: 1, VRAMMB: 24000, Health: HealthQuarantined},
+					{UUID: "a2", ServerName: "a", Number: 2, VRAMMB: 24000, Health: HealthDegraded},
+					{UUID: "a3", ServerName: "a", Number: 3, VRAMMB: 24000, Health: HealthHealthy},
+				},
+				Requests: []Request{queued(1, "alice", 1, 1, "medium", 20), queued(2, "bob", 1, 1, "medium", 10)},
+			},
+			want: []string{"start 1 a3", "start 2 a2"},
+		},
+		{
+			name: "placement keeps requests on one server, near the user's data",
+			state: State{
+				GPUs:     append(testGPUs("a", 4), testGPUs("b", 2)...),
+				Users:    []User{{Name: "alice", DataServer: "b"}, {Name: "bob"}},
+				Requests: []Request{queued(1, "alice", 2, 1, "medium", 20), queued(2, "bob", 3, 1, "medium", 10)},
+			},
+			want: []string{"start 1 b0,b1", "start 2 a0,a1,a2"},
+		},
+		{
+			name: "slices are bin-packed onto shared GPUs",
+			state: State{
+				GPUs: append(testGPUs("a", 1),
+					GPU{UUID: "s0", ServerName: "s", Number: 0, VRAMMB: 48000, Shared: true},
+					GPU{UUID: "s1", ServerName: "s", Number: 1, VRAMMB: 48000, Shared: true},
+				),
+				Requests: []Request{
+					{ID: 1, UserName: "alice", NumGPUs: 1, VRAMMB: 40000, Status: StatusInProgress, Used: true,
+						StartTime: testNow.Add(-time.Hour), EndTime: testNow.Add(time.Hour), GPUUUIDs: []string{"s0"}},
+					slice(2, "bob", 8000),   // Fills s0
+					slice(3, "carol", 8000), // No longer fits on s0
+					slice(4, "dave", 64000), // Fits on no shared GPU
+				},
+			},
+			want: []string{"start 2 s0", "start 3 s1"},
+		},
+		{
+			name: "slices stay off shared GPUs held by a whole-GPU request",
+			state: State{
+				GPUs: []GPU{
+					{UUID: "s0", ServerName: "s", Number: 0, VRAMMB: 48000, Shared: true},
+					{UUID: "s1", ServerName: "s", Number: 1, VRAMMB: 48000, Shared: true},
+				},
+				Requests: []Request{
+					// Started before s0 was shared
+					running(1, "alice", "medium", time.Hour, "s0"),
+					slice(2, "bob", 8000),
+				},
+			},
+			want: []string{"start 2 s1"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := New(NewManualClock(testNow))
+			s.FairShareHalfLife, s.NoShowRelease, s.EndWarning = 0, 0, 0
+			if tt.configure != nil {
+				tt.configure(s)
+			}
+			if got := describe(s.Plan(tt.state)); !slices.Equal(got, tt.want) {
+				t.Errorf("actions\n  %v\nwant\n  %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPlanIsPure(t *testing.T) {
+	state := State{GPUs: testGPUs("a", 2), Requests: []Request{
+		running(1, "alice", "medium", time.Hour, "a0"),
+		queued(2, "bob", 2, 1, "medium", 20),
+		queued(3, "carol", 1, 1, "medium", 10),
+	}}
+	s := New(NewManualClock(testNow))
+	first := describe(s.Plan(state))
+	if second := describe(s.Plan(state)); !slices.Equal(first, second) {
+		t.Errorf("same state planned differently: %v, then %v", first, second)
+	}
+}
+
+func TestPlanExplainsWaitingRequests(t *testing.T) {
+	state := State{GPUs: testGPUs("a", 2), Requests: []Request{
+		running(1, "alice", "medium", time.Hour, "a0", "a1"),
+		queued(2, "bob", 1, 1, "medium", 20),
+		queued(3, "carol", 4, 1, "medium", 10),
+	}}
+	s := New(NewManualClock(testNow))
+	why := make(map[int]string)
+	s.plan(state, why)
+	if why[2] == "" {
+		t.Error("no reason recorded for the blocked request")
+	}
+	if !strings.Contains(why[3], "2") {
+		t.Errorf("reason for a request that can never fit: %q", why[3])
+	}
+}
@@ -0,0 +1,44 @@
+package scheduler
+
+import (
+	"log"
+	"time"
+)
+
+// defaultInterval is used when no positive Interval is set
+const defaultInterval = 30 * time.Second
+
+// Service runs the scheduler against a store at a fixed interval
+type Service struct {
+	Scheduler *Scheduler
+	Store     Store
+	Interval  time.Duration
+}
+
+// Start runs the scheduling loop forever
+func (s *Service) Start() {
+	if s.Interval <= 0 {
+		s.Interval = defaultInterval
+	}
+	for {
+		if err := s.Tick(); err != nil {
+			log.Printf("Error running scheduler: %v", err)
+		}
+		time.Sleep(s.Interval)
+	}
+}
+
+// Tick loads the current state, plans and applies the resulting actions
+func (s *Service) Tick() error {
+	state, err := s.Store.LoadState()
+	if err != nil {
+		return err
+	}
+
+	actions := s.Scheduler.Plan(state)
+	for _, action := range actions {
+		log.Printf("Scheduler: %s request %d %v", action.Kind, action.RequestID, action.GPUUUIDs)
+	}
+
+	return s.Store.Apply(actions)
+}
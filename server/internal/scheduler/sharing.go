@@ -0,0 +1,82 @@
+package scheduler
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// placeSlice bin-packs a slice request onto the eligible shared GPU whose free VRAM fits
+// it most tightly (best fit), so that small slices fill up partly used GPUs and leave
+// whole free GPUs to larger slices. Healthy GPUs are preferred over degraded ones. GPUs
+// that are draining, quarantined, held by a whole-GPU request (wholeHeld), under
+// maintenance or due for maintenance before the slice would end are skipped.
+func placeSlice(request Request, eligible []GPU, sliceVRAM map[string]int, wholeHeld map[string]bool,
+	reserved map[string]time.Time, end, now time.Time, windows []MaintenanceWindow) (GPU, bool) {
+	var best GPU
+	bestFree, found := 0, false
+	for _, gpu := range eligible {
+		next, isReserved := reserved[gpu.UUID]
+		if !gpu.Placeable() || wholeHeld[gpu.UUID] || inMaintenance(gpu, windows, now) || (isReserved && end.After(next)) {
+			continue
+		}
+		free := gpu.VRAMMB - sliceVRAM[gpu.UUID]
+		if free < request.VRAMMB {
+			continue
+		}
+		if found {
+			bestDegraded, degraded := best.Health == HealthDegraded, gpu.Health == HealthDegraded
+			if (degraded && !bestDegraded) || (degraded == bestDegraded && free >= bestFree) {
+				continue
+			}
+		}
+		best, bestFree, found = gpu, free, true
+	}
+	return best, found
+}
+
+// sliceBlockedReason explains why no eligible shared GPU has room for a slice request now
+func sliceBlockedReason(request Request, eligible []GPU, sliceVRAM map[string]int, wholeHeld map[string]bool,
+	reserved map[string]time.Time, end, now time.Time, windows []MaintenanceWindow) string {
+	var full, held, maintenance, draining, quarantined, booked, mostFree int
+	for _, gpu := range eligible {
+		next, isReserved := reserved[gpu.UUID]
+		switch {
+		case inMaintenance(gpu, windows, now):
+			maintenance++
+		case gpu.Health == HealthQuarantined:
+			quarantined++
+		case gpu.Draining:
+			draining++
+		case wholeHeld[gpu.UUID]:
+			held++
+		case isReserved && end.After(next):
+			booked++
+		default:
+			full++
+			mostFree = max(mostFree, gpu.VRAMMB-sliceVRAM[gpu.UUID])
+		}
+	}
+
+	var parts []string
+	if full > 0 {
+		parts = append(parts, fmt.Sprintf("%d have too little VRAM left, at most %d MB", full, mostFree))
+	}
+	if held > 0 {
+		parts = append(parts, fmt.Sprintf("%d held by a whole-GPU request", held))
+	}
+	if maintenance > 0 {
+		parts = append(parts, fmt.Sprintf("%d under maintenance", maintenance))
+	}
+	if quarantined > 0 {
+		parts = append(parts, fmt.Sprintf("%d quarantined", quarantined))
+	}
+	if draining > 0 {
+		parts = append(parts, fmt.Sprintf("%d draining", draining))
+	}
+	if booked > 0 {
+		parts = append(parts, fmt.Sprintf("%d due for maintenance before it would finish", booked))
+	}
+	return fmt.Sprintf("needs %d MB of a shared %s GPU but none of the %d eligible has room: %s",
+		request.VRAMMB, request.GPUSize, len(eligible), strings.Join(parts, "; "))
+}
@@ -0,0 +1,94 @@
+package scheduler
+
+import (
+	"testing"
+	"time"
+)
+
+func TestPlaceSlice(t *testing.T) {
+	end := testNow.Add(time.Hour)
+	shared := func(uuid string, vramMB int) GPU {
+		return GPU{UUID: uuid, ServerName: "s", VRAMMB: vramMB, Shared: true}
+	}
+
+	tests := []struct {
+		name      string
+		vramMB    int
+		gpus      []GPU
+		sliceVRAM map[string]int
+		wholeHeld map[string]bool
+		reserved  map[string]time.Time
+		windows   []MaintenanceWindow
+		want      string // Empty if the slice fits nowhere
+	}{
+		{
+			name:      "best fit",
+			vramMB:    8000,
+			gpus:      []GPU{shared("s0", 48000), shared("s1", 48000), shared("s2", 24000)},
+			sliceVRAM: map[string]int{"s0": 36000},
+			want:      "s0",
+		},
+		{
+			name:      "too little VRAM left anywhere",
+			vramMB:    16000,
+			gpus:      []GPU{shared("s0", 48000), shared("s1", 24000)},
+			sliceVRAM: map[string]int{"s0": 36000, "s1": 12000},
+		},
+		{
+			name:   "healthy before degraded",
+			vramMB: 8000,
+			gpus: []GPU{
+				{UUID: "s0", VRAMMB: 12000, Shared: true, Health: HealthDegraded},
+				shared("s1", 48000),
+			},
+			want: "s1",
+		},
+		{
+			name:   "skips draining and quarantined GPUs",
+			vramMB: 8000,
+			gpus: []GPU{
+				{UUID: "s0", VRAMMB: 12000, Shared: true, Draining: true},
+				{UUID: "s1", VRAMMB: 12000, Shared: true, Health: HealthQuarantined},
+				shared("s2", 48000),
+			},
+			want: "s2",
+		},
+		{
+			name:      "skips GPUs held by whole-GPU requests",
+			vramMB:    8000,
+			gpus:      []GPU{shared("s0", 12000), shared("s1", 48000)},
+			wholeHeld: map[string]bool{"s0": true},
+			want:      "s1",
+		},
+		{
+			name:     "skips GPUs needed before the slice would end",
+			vramMB:   8000,
+			gpus:     []GPU{shared("s0", 12000), shared("s1", 48000)},
+			reserved: map[string]time.Time{"s0": testNow.Add(30 * time.Minute)},
+			want:     "s1",
+		},
+		{
+			name:    "skips GPUs under maintenance",
+			vramMB:  8000,
+			gpus:    []GPU{shared("s0", 12000)},
+			windows: []MaintenanceWindow{{ServerName: "s", Start: testNow.Add(-time.Hour), End: testNow.Add(time.Hour)}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			request := Request{ID: 1, NumGPUs: 1, VRAMMB: tt.vramMB, GPUSize: "small"}
+			gpu, ok := placeSlice(request, tt.gpus, tt.sliceVRAM, tt.wholeHeld, tt.reserved, end, testNow, tt.windows)
+			got := ""
+			if ok {
+				got = gpu.UUID
+			}
+			if got != tt.want {
+				t.Errorf("placed on %q, want %q", got, tt.want)
+			}
+			if !ok && sliceBlockedReason(request, tt.gpus, tt.sliceVRAM, tt.wholeHeld, tt.reserved, end, testNow, tt.windows) == "" {
+				t.Error("no reason given for a slice that fits nowhere")
+			}
+		})
+	}
+}
@@ -0,0 +1,83 @@
+package scheduler
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// GPU sizes, matching requests.gpu_size
+var GPUSizes = []string{"small", "medium", "large"}
+
+// Priorities, matching requests.priority, from least to most urgent
+var Priorities = []string{"low", "medium", "high", "emergency"}
+
+// SizeClass defines which GPUs satisfy a requested gpu_size
+type SizeClass struct {
+	Size           string
+	MinVRAMMB      int
+	AllowedModels  []string // Empty allows every model
+	AllowedServers []string // Empty allows every server
+}
+
+// Matches reports whether a GPU belongs to the size class
+func (c SizeClass) Matches(gpu GPU) bool {
+	if gpu.VRAMMB < c.MinVRAMMB {
+		return false
+	}
+	if len(c.AllowedModels) > 0 && !slices.Contains(c.AllowedModels, gpu.ModelName) {
+		return false
+	}
+	if len(c.AllowedServers) > 0 && !slices.Contains(c.AllowedServers, gpu.ServerName) {
+		return false
+	}
+	return true
+}
+
+// Describe summarizes the size class for users, e.g. "≥ 45000 MB, NVIDIA RTX A6000"
+func (c SizeClass) Describe() string {
+	parts := []string{fmt.Sprintf("≥ %d MB", c.MinVRAMMB)}
+	if len(c.AllowedModels) > 0 {
+		parts = append(parts, strings.Join(c.AllowedModels, " / "))
+	}
+	if len(c.AllowedServers) > 0 {
+		parts = append(parts, "on "+strings.Join(c.AllowedServers, ", "))
+	}
+	return strings.Join(parts, ", ")
+}
+
+// gpuMatchesSize applies the size class of size to a GPU. Sizes without a class accept any GPU.
+func gpuMatchesSize(classes map[string]SizeClass, size string, gpu GPU) bool {
+	class, ok := classes[size]
+	return !ok || class.Matches(gpu)
+}
+
+// ValidateRequest checks a new request against the fleet and returns a user-facing
+// error if it is malformed or could never be placed
+func ValidateRequest(request Request, state State) error {
+	if !slices.Contains(GPUSizes, request.GPUSize) {
+		return fmt.Errorf("unknown GPU size %q, use one of %s", request.GPUSize, strings.Join(GPUSizes, ", "))
+	}
+	if !slices.Contains(Priorities, request.Priority) {
+		return fmt.Errorf("unknown priority %q, use one of %s", request.Priority, strings.Join(Priorities, ", "))
+	}
+	if request.NumGPUs < 1 {
+		return fmt.Errorf("at least one GPU must be requested")
+	}
+	if request.RequestedHours < 1 {
+		return fmt.Errorf("at least one hour must be requested")
+	}
+	if request.VRAMMB < 0 {
+		return fmt.Errorf("the VRAM slice must be positive")
+	}
+	if request.IsSlice() && request.NumGPUs != 1 {
+		return fmt.Errorf("a VRAM slice is part of a single GPU, so exactly one GPU must be requested")
+	}
+
+	eligible := eligibleGPUs(request, state.GPUs, state.SizeClasses)
+	if len(eligible) < request.NumGPUs {
+		return errors.New(neverFitsReason(request, len(eligible), state.SizeClasses))
+	}
+	return nil
+}
@@ -0,0 +1,384 @@
+package scheduler
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/eduardo-escoto/gpu_request/server/internal/database"
+)
+
+// Store loads the scheduler state and applies its decisions
+type Store interface {
+	LoadState() (State, error)
+	Apply(actions []Action) error
+}
+
+// Notifier delivers messages to users; services.Notifier satisfies it
+type Notifier interface {
+	Notify(to []string, subject, body string) error
+}
+
+// CommandPublisher wakes daemons waiting for commands; services.CommandBroker satisfies it
+type CommandPublisher interface {
+	Publish(nodeName string)
+}
+
+// CommandParameters is the JSON payload of the commands sent to node daemons
+type CommandParameters struct {
+	User     string   `json:"user"`
+	GPUUUIDs []string `json:"gpu_uuids"`
+	Message  string   `json:"message,omitempty"`
+	Signal   string   `json:"signal,omitempty"` // "TERM" or "KILL" (kill only)
+}
+
+// lastServerWindow is how far back a user's previous server is looked up for placement
+const lastServerWindow = 30 * 24 * time.Hour
+
+// SQLStore is the Store backed by the scheduler database. Notifier and Publisher
+// are optional; without them users are not emailed and daemons pick commands up
+// on their next poll.
+type SQLStore struct {
+	DB        *sql.DB
+	Notifier  Notifier
+	Publisher CommandPublisher
+
+	// UsageWindow is how much GPU usage history LoadState reads for fair-share; zero skips it
+	UsageWindow time.Duration
+}
+
+// LoadState reads the GPUs and the queued and running requests with their assignments
+func (s *SQLStore) LoadState() (State, error) {
+	gpus, err := database.QueryGPUs(s.DB)
+	if err != nil {
+		return State{}, err
+	}
+	requests, err := database.QueryActiveRequests(s.DB)
+	if err != nil {
+		return State{}, err
+	}
+	assignments, err := database.QueryActiveAssignments(s.DB)
+	if err != nil {
+		return State{}, err
+	}
+	classes, err := database.QuerySizeClasses(s.DB)
+	if err != nil {
+		return State{}, err
+	}
+	preemptions, err := database.QueryActivePreemptions(s.DB)
+	if err != nil {
+		return State{}, err
+	}
+	windows, err := database.QueryMaintenanceWindows(s.DB, time.Now())
+	if err != nil {
+		return State{}, err
+	}
+	users, err := database.QueryWhitelistedUsers(s.DB)
+	if err != nil {
+		return State{}, err
+	}
+	gpuLimits, err := database.QueryConcurrentGPULimits(s.DB)
+	if err != nil {
+		return State{}, err
+	}
+	used, err := database.QueryUsedRequests(s.DB)
+	if err != nil {
+		return State{}, err
+	}
+	links, err := database.QueryGPUTopology(s.DB)
+	if err != nil {
+		return State{}, err
+	}
+	lastServers, err := database.QueryLastServers(s.DB, time.Now().Add(-lastServerWindow))
+	if err != nil {
+		return State{}, err
+	}
+	var usage []database.UsageHour
+	if s.UsageWindow > 0 {
+		usage, err = database.QueryHourlyGPUUsage(s.DB, time.Now().Add(-s.UsageWindow))
+		if err != nil {
+			return State{}, err
+		}
+	}
+
+	assigned := make(map[int][]string)
+	for _, assignment := range assignments {
+		assigned[assignment.RequestID] = append(assigned[assignment.RequestID], assignment.GPUUUID)
+	}
+	preemptedBy := make(map[int]int)
+	for _, preemption := range preemptions {
+		preemptedBy[preemption.PreemptedRequestID] = preemption.PreemptingRequestID
+	}
+
+	state := State{SizeClasses: make(map[string]SizeClass)}
+	for _, class := range classes {
+		state.SizeClasses[class.GPUSize] = NewSizeClass(class)
+	}
+	for _, gpu := range gpus {
+		state.GPUs = append(state.GPUs, GPU{
+			UUID:       gpu.UUID,
+			ServerName: gpu.ServerName,
+			Number:     gpu.GPUNumber,
+			ModelName:  gpu.ModelName,
+			VRAMMB:     gpu.VRAMSizeMB,
+			Draining:   gpu.Draining,
+			Health:     gpu.EffectiveHealth(),
+			Shared:     gpu.Shared,
+		})
+	}
+	for _, request := range requests {
+		state.Requests = append(state.Requests, Request{
+			ID:             request.ID,
+			UserID:         request.UserID,
+			UserName:       request.UserName,
+			ProjectID:      int(request.ProjectID.Int64),
+			RequestedHours: request.RequestedTime,
+			GPUSize:        request.GPUSize,
+			NumGPUs:        request.NumGPUs,
+			VRAMMB:         int(request.VRAMMB.Int64),
+			Priority:       request.Priority,
+			ServerName:     request.ServerName.String,
+			Status:         request.Status,
+			StartTime:      request.StartTime.Time,
+			EndTime:        request.EndTime.Time,
+			CreatedAt:      request.CreatedAt,
+			GPUUUIDs:       assigned[request.ID],
+			PreemptedBy:    preemptedBy[request.ID],
+			ProjectedStart: request.ProjectedStart.Time,
+			Used:           used[request.ID],
+			IdleWarned:     request.IdleWarnedAt.Valid,
+			EndWarned:      request.EndWarnedAt.Valid,
+		})
+	}
+	for _, window := range windows {
+		state.Maintenance = append(state.Maintenance, MaintenanceWindow{
+			ServerName: window.ServerName,
+			GPUUUID:    window.GPUUUID.String,
+			Start:      window.StartTime,
+			End:        window.EndTime,
+		})
+	}
+	for _, user := range users {
+		state.Users = append(state.Users, User{
+			Name:       user.UserName,
+			Group:      user.ResearchGroup,
+			DataServer: user.DataServer,
+			LastServer: lastServers[user.UserName],
+
+			MaxConcurrentGPUs: gpuLimits[user.UserName],
+		})
+	}
+	state.Topology = make(Topology)
+	for _, link := range links {
+		if state.Topology[link.ServerName] == nil {
+			state.Topology[link.ServerName] = make(map[[2]int]string)
+		}
+		state.Topology[link.ServerName][[2]int{min(link.GPUA, link.GPUB), max(link.GPUA, link.GPUB)}] = link.Link
+	}
+	for _, hour := range usage {
+		state.Usage = append(state.Usage, UsageHour{UserName: hour.UserName, Hour: hour.Hour, GPUs: hour.GPUCount})
+	}
+	return state, nil
+}
+
+// LoadWorkload reads the requests created in [from, to) for Replay, each queued again at
+// its creation time. Bookings are replayed as queued requests for the same number of
+// hours; cancelled requests and requests that were denied or never approved are left out.
+func (s *SQLStore) LoadWorkload(from, to time.Time) ([]Request, error) {
+	requests, err := database.QueryRequestsCreated(s.DB, from, to)
+	if err != nil {
+		return nil, err
+	}
+
+	workload := make([]Request, len(requests))
+	for i, request := range requests {
+		workload[i] = Request{
+			ID:             request.ID,
+			UserID:         request.UserID,
+			UserName:       request.UserName,
+			ProjectID:      int(request.ProjectID.Int64),
+			RequestedHours: request.RequestedTime,
+			GPUSize:        request.GPUSize,
+			NumGPUs:        request.NumGPUs,
+			VRAMMB:         int(request.VRAMMB.Int64),
+			Priority:       request.Priority,
+			ServerName:     request.ServerName.String,
+			Status:         StatusScheduled,
+			CreatedAt:      request.CreatedAt,
+		}
+	}
+	return workload, nil
+}
+
+// Apply writes the actions to the database in order. A failed action (e.g., a request
+// cancelled since the state was loaded) does not stop the others.
+func (s *SQLStore) Apply(actions []Action) error {
+	var errs []error
+	for _, action := range actions {
+		var err error
+		switch action.Kind {
+		case ActionStart:
+			err = database.StartRequest(s.DB, action.RequestID, action.GPUUUIDs, action.StartTime, action.EndTime, schedulerChange(""))
+		case ActionFinish:
+			err = database.FinishRequest(s.DB, action.RequestID, schedulerChange("reached its end time"))
+		case ActionStartBooking:
+			err = database.StartBooking(s.DB, action.RequestID, schedulerChange("booked window started"))
+		case ActionExpire:
+			err = database.CancelRequest(s.DB, action.RequestID, schedulerChange("booked window passed before its GPUs came free"))
+		case ActionProject:
+			err = database.SetProjectedStart(s.DB, action.RequestID, action.StartTime)
+		case ActionPreempt:
+			err = s.preempt(action)
+		case ActionEvict:
+			err = s.evict(action)
+		case ActionWarnIdle:
+			err = s.warnIdle(action)
+		case ActionRelease:
+			err = s.release(action)
+		case ActionWarnEnd:
+			err = s.warnEnd(action)
+		default:
+			err = fmt.Errorf("unknown action %q", action.Kind)
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("failed to apply %s for request %d: %w", action.Kind, action.RequestID, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// schedulerChange is a status change made by the scheduler itself
+func schedulerChange(reason string) database.StatusChange {
+	return database.StatusChange{System: "scheduler", Reason: reason}
+}
+
+// preempt records the preemption and warns the owner by email and on the affected nodes
+func (s *SQLStore) preempt(action Action) error {
+	if err := database.PreemptRequest(s.DB, action.RequestID, action.PreemptedBy, action.EndTime); err != nil {
+		return err
+	}
+
+	message := fmt.Sprintf("Your GPU request #%d is preempted by emergency request #%d. "+
+		"Please save your work: processes on its GPUs will be stopped at %s.",
+		action.RequestID, action.PreemptedBy, action.EndTime.Format("2006-01-02 15:04"))
+
+	if err := s.sendCommands("notify", CommandParameters{User: action.UserName, GPUUUIDs: action.GPUUUIDs, Message: message}); err != nil {
+		return err
+	}
+	return s.notifyUser(action.UserName, fmt.Sprintf("[GPU Scheduler] Request #%d preempted", action.RequestID), message)
+}
+
+// evict ends a preempted request and stops its owner's processes on the freed GPUs
+func (s *SQLStore) evict(action Action) error {
+	reason := fmt.Sprintf("grace period of the preemption by emergency request #%d ended", action.PreemptedBy)
+	if err := database.EvictRequest(s.DB, action.RequestID, schedulerChange(reason)); err != nil {
+		return err
+	}
+	return s.sendCommands("kill", CommandParameters{User: action.UserName, GPUUUIDs: action.GPUUUIDs, Signal: "TERM"})
+}
+
+// warnIdle tells the owner of an unused request that its GPUs are about to be released
+func (s *SQLStore) warnIdle(action Action) error {
+	if err := database.MarkIdleWarned(s.DB, action.RequestID, time.Now()); err != nil {
+		return err
+	}
+
+	message := fmt.Sprintf("Your GPU request #%d started at %s, but none of your processes have run on its GPUs since. "+
+		"Unless you start using them, they will be released back to the queue at %s.",
+		action.RequestID, action.StartTime.Format("2006-01-02 15:04"), action.EndTime.Format("2006-01-02 15:04"))
+	return s.notifyUser(action.UserName, fmt.Sprintf("[GPU Scheduler] Request #%d is unused", action.RequestID), message)
+}
+
+// release ends an unused request, freeing its GPUs for the queue, and tells the owner
+func (s *SQLStore) release(action Action) error {
+	if err := database.ReleaseRequest(s.DB, action.RequestID, action.EndTime, schedulerChange(action.Reason)); err != nil {
+		return err
+	}
+
+	message := fmt.Sprintf("Your GPU request #%d was %s, and its GPUs went back to the queue. "+
+		"Please submit a new request when you are ready to use them.", action.RequestID, action.Reason)
+	return s.notifyUser(action.UserName, fmt.Sprintf("[GPU Scheduler] Request #%d released", action.RequestID), message)
+}
+
+// warnEnd tells the owner of a request that it ends soon and how to extend it
+func (s *SQLStore) warnEnd(action Action) error {
+	if err := database.MarkEndWarned(s.DB, action.RequestID, time.Now()); err != nil {
+		return err
+	}
+
+	message := fmt.Sprintf("Your GPU request #%d ends at %s. Processes still running on its GPUs after that are stopped. "+
+		"If you need more time, extend it from the GPU calendar on the dashboard or with `/gpu-request extend %d <hours>` in Slack; "+
+		"extensions are granted unless the GPUs are booked or under maintenance right after.",
+		action.RequestID, action.EndTime.Format("2006-01-02 15:04"), action.RequestID)
+	return s.notifyUser(action.UserName, fmt.Sprintf("[GPU Scheduler] Request #%d ends soon", action.RequestID), message)
+}
+
+// sendCommands queues a command on every node hosting one of the GPUs in params
+func (s *SQLStore) sendCommands(commandType string, params CommandParameters) error {
+	gpus, err := database.QueryGPUs(s.DB)
+	if err != nil {
+		return err
+	}
+	serverOf := make(map[string]string)
+	for _, gpu := range gpus {
+		serverOf[gpu.UUID] = gpu.ServerName
+	}
+
+	byServer := make(map[string][]string)
+	for _, uuid := range params.GPUUUIDs {
+		byServer[serverOf[uuid]] = append(byServer[serverOf[uuid]], uuid)
+	}
+
+	for serverName, uuids := range byServer {
+		nodeParams := params
+		nodeParams.GPUUUIDs = uuids
+		payload, err := json.Marshal(nodeParams)
+		if err != nil {
+			return err
+		}
+
+		if _, err := database.InsertCommand(s.DB, serverName, commandType, string(payload)); err != nil {
+			return err
+		}
+		if s.Publisher != nil {
+			s.Publisher.Publish(serverName)
+		}
+	}
+	return nil
+}
+
+// notifyUser emails a user, if a notifier is configured
+func (s *SQLStore) notifyUser(userName, subject, body string) error {
+	if s.Notifier == nil {
+		return nil
+	}
+	user, err := database.QueryUser(s.DB, userName)
+	if err != nil || user == nil {
+		return err
+	}
+	return s.Notifier.Notify([]string{user.Email}, subject, body)
+}
+
+// NewSizeClass converts a gpu_size_classes row
+func NewSizeClass(row database.SizeClass) SizeClass {
+	return SizeClass{
+		Size:           row.GPUSize,
+		MinVRAMMB:      row.MinVRAMMB,
+		AllowedModels:  splitList(row.AllowedModels),
+		AllowedServers: splitList(row.AllowedServers),
+	}
+}
+
+// splitList parses a comma-separated column into its trimmed, non-empty items
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
@@ -0,0 +1,161 @@
+package scheduler
+
+import "time"
+
+// Request statuses, matching requests.status
+const (
+	StatusPendingApproval = "pending_approval" // Matched an approval rule, not queued until an admin approves it
+	StatusScheduled       = "scheduled"
+	StatusInProgress      = "in_progress"
+	StatusDone            = "done"
+	StatusCancelled       = "cancelled"
+	StatusPreempted       = "preempted"
+	StatusReleased        = "released"
+	StatusDenied          = "denied"
+)
+
+// GPU health states, matching gpus.health
+const (
+	HealthHealthy     = "healthy"
+	HealthDegraded    = "degraded"    // Only used when no healthy GPU is free
+	HealthQuarantined = "quarantined" // Never handed out
+)
+
+// priorityRank orders requests.priority values from least to most urgent
+var priorityRank = map[string]int{
+	"low":       0,
+	"medium":    1,
+	"high":      2,
+	"emergency": 3,
+}
+
+// GPU is a schedulable GPU from the gpus table
+type GPU struct {
+	UUID       string
+	ServerName string
+	Number     int
+	ModelName  string
+	VRAMMB     int
+	Draining   bool   // No new requests or bookings are placed on it
+	Health     string // One of the Health* states; empty counts as healthy
+	Shared     bool   // Only takes VRAM slice requests, as many as its VRAM holds
+}
+
+// Placeable reports whether new requests and bookings may be placed on the GPU
+func (g GPU) Placeable() bool {
+	return !g.Draining && g.Health != HealthQuarantined
+}
+
+// Request is a GPU request as seen by the scheduler
+type Request struct {
+	ID             int
+	UserID         int
+	UserName       string
+	ProjectID      int // Project the request is charged to, 0 for personal requests
+	RequestedHours int
+	GPUSize        string
+	NumGPUs        int
+	VRAMMB         int // VRAM slice of a shared GPU (NumGPUs is 1), 0 for whole GPUs
+	Priority       string
+	ServerName     string // Empty for "any server"
+	Status         string
+	StartTime      time.Time // Zero until the request starts, unless it is a booking
+	EndTime        time.Time // Zero until the request starts, unless it is a booking
+	CreatedAt      time.Time
+	GPUUUIDs       []string  // GPUs assigned to the request
+	PreemptedBy    int       // Emergency request this one is being preempted for, if any
+	ProjectedStart time.Time // When a blocked request is expected to start, zero if unknown
+	Used           bool      // The owner has run a process on its GPUs since it started
+	IdleWarned     bool      // The owner was warned that its unused GPUs will be released
+	EndWarned      bool      // The owner was offered an extension before the end
+}
+
+// Duration is how long the request holds its GPUs once started
+func (r Request) Duration() time.Duration {
+	return time.Duration(r.RequestedHours) * time.Hour
+}
+
+// IsSlice reports whether the request asks for a VRAM slice of a shared GPU rather than whole GPUs
+func (r Request) IsSlice() bool {
+	return r.VRAMMB > 0
+}
+
+// User is a whitelisted user, for fair-share and placement
+type User struct {
+	Name       string
+	Group      string // Empty if the user is not in a group
+	DataServer string // Server holding the user's data, if known
+	LastServer string // Server of the user's most recent request, if any
+
+	MaxConcurrentGPUs int // From the user's quota, 0 for unlimited
+}
+
+// UsageHour is how many GPUs a user used during one hour
+type UsageHour struct {
+	UserName string
+	Hour     time.Time
+	GPUs     int
+}
+
+// IsBooking reports whether the request is booked for a fixed window rather than queued.
+// Bookings have their GPUs assigned when they are made.
+func (r Request) IsBooking() bool {
+	return r.Status == StatusScheduled && !r.StartTime.IsZero()
+}
+
+// MaintenanceWindow takes a server, or a single GPU of it, out of service for a while
+type MaintenanceWindow struct {
+	ServerName string
+	GPUUUID    string // Empty for the whole server
+	Start      time.Time
+	End        time.Time
+}
+
+// Covers reports whether the window applies to the GPU
+func (w MaintenanceWindow) Covers(gpu GPU) bool {
+	return gpu.ServerName == w.ServerName && (w.GPUUUID == "" || w.GPUUUID == gpu.UUID)
+}
+
+// State is everything the scheduler needs to make a decision
+type State struct {
+	GPUs        []GPU
+	Requests    []Request            // Scheduled and in-progress requests
+	SizeClasses map[string]SizeClass // Keyed by gpu_size
+	Users       []User
+	Usage       []UsageHour // Only loaded when fair-share is enabled
+	Maintenance []MaintenanceWindow
+	Topology    Topology
+}
+
+// ActionKind is the kind of change the scheduler wants applied
+type ActionKind string
+
+const (
+	ActionStart  ActionKind = "start"  // Assign GPUs and move the request to in_progress
+	ActionFinish ActionKind = "finish" // The request reached its end_time and is done
+
+	ActionStartBooking ActionKind = "start_booking" // A booking reached its start_time; its GPUs are already assigned
+	ActionExpire       ActionKind = "expire"        // A booking's window passed before its GPUs came free
+
+	ActionProject ActionKind = "project" // Record when a blocked request is expected to start
+
+	ActionPreempt ActionKind = "preempt" // Notify a running request and cut its end_time to the grace period
+	ActionEvict   ActionKind = "evict"   // A preempted request's grace period is over; stop its processes
+
+	ActionWarnIdle ActionKind = "warn_idle" // Warn the owner of a running request with no processes on its GPUs
+	ActionRelease  ActionKind = "release"   // The request is still unused; end it and free its GPUs
+
+	ActionWarnEnd ActionKind = "warn_end" // The request ends soon; offer its owner an extension
+)
+
+// Action is a single change decided by the scheduler
+type Action struct {
+	Kind        ActionKind
+	RequestID   int
+	UserName    string // Owner of the request (all but start and project)
+	GPUUUIDs    []string
+	StartTime   time.Time // Start time (start, start_booking) or projected start (project)
+	EndTime     time.Time // End time (start, start_booking, warn_end), grace end (preempt) or release time (warn_idle, release)
+	PreemptedBy int       // Emergency request the GPUs are freed for (preempt, evict)
+	Reason      string    // Why the request is ended early (release)
+}
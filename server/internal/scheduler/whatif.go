@@ -0,0 +1,70 @@
+package scheduler
+
+import (
+	"slices"
+	"time"
+)
+
+// whatIfID identifies the hypothetical request in a what-if simulation
+const whatIfID = -1
+
+// WhatIf is the outcome of a hypothetical request
+type WhatIf struct {
+	EarliestStart time.Time // Zero if it does not start within the horizon
+	GPUs          []GPU     // GPUs it would get
+	Reason        string    // Why it cannot start now, empty if it can
+}
+
+// WhatIf simulates queueing a request without storing it: it joins the queue behind the
+// requests of the same priority and fair-share standing, and the scheduler is run forward
+// on a copy of the state as for Forecast
+func (s *Scheduler) WhatIf(state State, request Request, horizon time.Duration) WhatIf {
+	now := s.Clock.Now()
+	request.ID = whatIfID
+	request.Status = StatusScheduled
+	request.CreatedAt = now
+	request.StartTime, request.EndTime = time.Time{}, time.Time{}
+	state.Requests = append(slices.Clone(state.Requests), request)
+
+	why := make(map[int]string)
+	start, ok := s.simulate(state, now.Add(horizon), why)[whatIfID]
+	result := WhatIf{Reason: why[whatIfID]}
+	if !ok {
+		return result
+	}
+
+	result.EarliestStart = start.StartTime
+	for _, gpu := range state.GPUs {
+		if slices.Contains(start.GPUUUIDs, gpu.UUID) {
+			result.GPUs = append(result.GPUs, gpu)
+		}
+	}
+	return result
+}
+
+// AvailableGPUs returns the whole GPUs that are free right now and stay free for the given
+// duration: not shared, held by a request, draining, quarantined or under maintenance, and not booked before then
+func (s *Scheduler) AvailableGPUs(state State, duration time.Duration) []GPU {
+	now := s.Clock.Now()
+	gpus := sortedGPUs(state.GPUs)
+	reserved := reservations(state, gpus, now)
+
+	held := make(map[string]bool)
+	for _, request := range state.Requests {
+		if request.Status == StatusInProgress && request.EndTime.After(now) {
+			for _, uuid := range request.GPUUUIDs {
+				held[uuid] = true
+			}
+		}
+	}
+
+	var available []GPU
+	for _, gpu := range gpus {
+		next, isReserved := reserved[gpu.UUID]
+		if held[gpu.UUID] || gpu.Shared || !gpu.Placeable() || inMaintenance(gpu, state.Maintenance, now) || (isReserved && now.Add(duration).After(next)) {
+			continue
+		}
+		available = append(available, gpu)
+	}
+	return available
+}
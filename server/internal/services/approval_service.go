@@ -0,0 +1,74 @@
+package services
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/eduardo-escoto/gpu_request/server/internal/database"
+	"github.com/eduardo-escoto/gpu_request/server/internal/scheduler"
+)
+
+// approvalHistory is how long decided requests stay on the approvals list
+const approvalHistory = 7 * 24 * time.Hour
+
+// ApprovalRuleFor returns the description of the first approval rule a request matches,
+// or "" if it can be queued without approval
+func ApprovalRuleFor(db *sql.DB, req NewRequest) (string, error) {
+	rules, err := database.QueryApprovalRules(db, req.UserID)
+	if err != nil {
+		return "", err
+	}
+	for _, rule := range rules {
+		if matchesApprovalRule(rule, req) {
+			return rule.Description, nil
+		}
+	}
+	return "", nil
+}
+
+// matchesApprovalRule reports whether a request meets every condition of a rule; the
+// user type was already matched by the query
+func matchesApprovalRule(rule database.ApprovalRule, req NewRequest) bool {
+	if !rule.MinGPUs.Valid && !rule.MinHours.Valid && !rule.Priority.Valid {
+		return false
+	}
+	if rule.MinGPUs.Valid && int64(req.NumGPUs) < rule.MinGPUs.Int64 {
+		return false
+	}
+	if rule.MinHours.Valid && int64(req.Hours) < rule.MinHours.Int64 {
+		return false
+	}
+	if rule.Priority.Valid && req.Priority != rule.Priority.String {
+		return false
+	}
+	return true
+}
+
+// LoadApprovals returns the requests awaiting approval followed by those decided in the last week
+func LoadApprovals(db *sql.DB) ([]database.Approval, error) {
+	return database.QueryApprovals(db, time.Now().Add(-approvalHistory))
+}
+
+// DecideApproval approves or denies a request awaiting approval on behalf of an admin.
+// Approved requests join the queue; denied ones are closed with the comment as reason.
+func DecideApproval(db *sql.DB, requestID int, approved bool, comment string, admin *database.User) error {
+	if !admin.IsAdmin {
+		return &RequestError{Reason: "only admins can approve or deny requests"}
+	}
+	if !approved && comment == "" {
+		return &RequestError{Reason: "please explain why the request is denied"}
+	}
+
+	request, err := database.QueryRequest(db, requestID)
+	if err != nil {
+		return err
+	}
+	if request == nil {
+		return ErrNoSuchRequest
+	}
+	if request.Status != scheduler.StatusPendingApproval {
+		return &RequestError{Reason: fmt.Sprintf("request #%d is not awaiting approval", requestID)}
+	}
+	return database.DecideApproval(db, requestID, approved, admin.ID, comment, time.Now())
+}
@@ -0,0 +1,54 @@
+package services
+
+import "sync"
+
+// CommandBroker wakes up daemons that are long-polling for commands on a node
+type CommandBroker struct {
+	mu      sync.Mutex
+	waiters map[string]map[chan struct{}]struct{}
+}
+
+// NewCommandBroker creates an empty broker
+func NewCommandBroker() *CommandBroker {
+	return &CommandBroker{
+		waiters: make(map[string]map[chan struct{}]struct{}),
+	}
+}
+
+// Subscribe registers interest in new commands for a node. The returned channel
+// is closed on the next Publish for that node; the cancel function must be
+// called once the caller stops waiting.
+func (b *CommandBroker) Subscribe(nodeName string) (<-chan struct{}, func()) {
+	ch := make(chan struct{})
+
+	b.mu.Lock()
+	if b.waiters[nodeName] == nil {
+		b.waiters[nodeName] = make(map[chan struct{}]struct{})
+	}
+	b.waiters[nodeName][ch] = struct{}{}
+	b.mu.Unlock()
+
+	cancel := func() {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		if _, ok := b.waiters[nodeName][ch]; ok {
+			delete(b.waiters[nodeName], ch)
+			close(ch)
+		}
+		if len(b.waiters[nodeName]) == 0 {
+			delete(b.waiters, nodeName)
+		}
+	}
+	return ch, cancel
+}
+
+// Publish wakes every subscriber currently waiting on a node
+func (b *CommandBroker) Publish(nodeName string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for ch := range b.waiters[nodeName] {
+		close(ch)
+	}
+	delete(b.waiters, nodeName)
+}
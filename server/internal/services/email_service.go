@@ -1,30 +1,79 @@
 package services
 
-// import (
-// 	"log"
-// 	"net/smtp"
-// )
-
-// func SendEmail(to, subject, body string) error {
-// 	from := "your-email@example.com"
-// 	password := "your-email-password"
-
-// 	// Set up SMTP server
-// 	smtpHost := "smtp.example.com"
-// 	smtpPort := "587"
-
-// 	msg := "From: " + from + "\n" +
-// 		"To: " + to + "\n" +
-// 		"Subject: " + subject + "\n\n" +
-// 		body
-
-// 	auth := smtp.PlainAuth("", from, password, smtpHost)
-// 	err := smtp.SendMail(smtpHost+":"+smtpPort, auth, from, []string{to}, []byte(msg))
-// 	if err != nil {
-// 		log.Printf("Failed to send email: %v", err)
-// 		return err
-// 	}
-
-// 	log.Println("Email sent successfully")
-// 	return nil
-// }
+import (
+	"log"
+	"net/smtp"
+	"os"
+	"strings"
+)
+
+// Notifier delivers a message to a set of recipients
+type Notifier interface {
+	Notify(to []string, subject, body string) error
+}
+
+// EmailNotifier sends notifications through an SMTP server
+type EmailNotifier struct {
+	Host     string
+	Port     string
+	From     string
+	Username string
+	Password string
+}
+
+// LogNotifier only logs notifications; it is used when no SMTP server is configured
+type LogNotifier struct{}
+
+// NewNotifierFromEnv returns an EmailNotifier configured from SMTP_* environment
+// variables, or a LogNotifier if SMTP_HOST is not set
+func NewNotifierFromEnv() Notifier {
+	host := os.Getenv("SMTP_HOST")
+	if host == "" {
+		return LogNotifier{}
+	}
+
+	port := os.Getenv("SMTP_PORT")
+	if port == "" {
+		port = "587"
+	}
+
+	return &EmailNotifier{
+		Host:     host,
+		Port:     port,
+		From:     os.Getenv("SMTP_FROM"),
+		Username: os.Getenv("SMTP_USERNAME"),
+		Password: os.Getenv("SMTP_PASSWORD"),
+	}
+}
+
+// Notify sends a plain-text email to all recipients
+func (e *EmailNotifier) Notify(to []string, subject, body string) error {
+	if len(to) == 0 {
+		return nil
+	}
+
+	msg := "From: " + e.From + "\n" +
+		"To: " + strings.Join(to, ", ") + "\n" +
+		"Subject: " + subject + "\n\n" +
+		body
+
+	var auth smtp.Auth
+	if e.Username != "" {
+		auth = smtp.PlainAuth("", e.Username, e.Password, e.Host)
+	}
+
+	err := smtp.SendMail(e.Host+":"+e.Port, auth, e.From, to, []byte(msg))
+	if err != nil {
+		log.Printf("Failed to send email: %v", err)
+		return err
+	}
+
+	log.Printf("Email %q sent to %s", subject, strings.Join(to, ", "))
+	return nil
+}
+
+// Notify logs the notification instead of sending it
+func (LogNotifier) Notify(to []string, subject, body string) error {
+	log.Printf("Notification for %s: %s\n%s", strings.Join(to, ", "), subject, body)
+	return nil
+}
@@ -0,0 +1,115 @@
+package services
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/eduardo-escoto/gpu_request/server/internal/database"
+	"github.com/eduardo-escoto/gpu_request/server/internal/scheduler"
+)
+
+// defaultHealthCheckInterval is used when no positive Interval is set
+const defaultHealthCheckInterval = time.Minute
+
+// HealthMonitor derives the health of every GPU from the telemetry reported by the
+// daemons. The scheduler never hands out quarantined GPUs and only uses degraded ones
+// when no healthy GPU is free; admins can override the derived state per GPU.
+type HealthMonitor struct {
+	DB       *sql.DB
+	Notifier Notifier
+	Interval time.Duration
+
+	StaleAfter            time.Duration // A GPU that has not reported for this long is degraded
+	DegradedTemperature   float64       // Degraded at or above this temperature (°C)
+	QuarantineTemperature float64       // Quarantined at or above this temperature (°C)
+	CorrectedECCLimit     int64         // Degraded at this many corrected ECC errors; zero ignores them
+}
+
+// Start runs the health check loop forever
+func (m *HealthMonitor) Start() {
+	if m.Interval <= 0 {
+		m.Interval = defaultHealthCheckInterval
+	}
+	for {
+		if err := m.Check(time.Now()); err != nil {
+			log.Printf("Error checking GPU health: %v", err)
+		}
+		time.Sleep(m.Interval)
+	}
+}
+
+// Check re-derives the health of every GPU and tells the admins about the changes
+func (m *HealthMonitor) Check(now time.Time) error {
+	gpus, err := database.QueryGPUs(m.DB)
+	if err != nil {
+		return err
+	}
+	samples, err := database.QueryLatestGPUSamples(m.DB)
+	if err != nil {
+		return err
+	}
+	current := make(map[string]database.GPU)
+	for _, gpu := range gpus {
+		current[gpu.UUID] = gpu
+	}
+
+	var changes []string
+	for _, sample := range samples {
+		health, reason := m.assess(sample, now)
+		gpu := current[sample.GPUUUID]
+		if health == gpu.Health {
+			continue
+		}
+
+		if err := database.SetGPUHealth(m.DB, sample.GPUUUID, health, reason, now); err != nil {
+			return err
+		}
+		change := fmt.Sprintf("- %s GPU %d: %s -> %s", sample.ServerName, sample.GPUNumber, gpu.Health, health)
+		if reason != "" {
+			change += " (" + reason + ")"
+		}
+		if gpu.HealthOverride.Valid {
+			change += fmt.Sprintf(", overridden as %s", gpu.HealthOverride.String)
+		}
+		changes = append(changes, change)
+		log.Printf("GPU health %s", strings.TrimPrefix(change, "- "))
+	}
+	if len(changes) == 0 {
+		return nil
+	}
+
+	admins, err := database.QueryAdminEmails(m.DB)
+	if err != nil {
+		return err
+	}
+	body := "The health of the following GPUs changed:\n\n" + strings.Join(changes, "\n") + "\n"
+	return m.Notifier.Notify(admins, fmt.Sprintf("[GPU Scheduler] Health of %d GPU(s) changed", len(changes)), body)
+}
+
+// assess derives a GPU's health from its latest sample, worst finding first
+func (m *HealthMonitor) assess(sample database.GPUSample, now time.Time) (string, string) {
+	if sample.ECCUncorrected.Valid && sample.ECCUncorrected.Int64 > 0 {
+		return scheduler.HealthQuarantined, fmt.Sprintf("%d uncorrected ECC error(s)", sample.ECCUncorrected.Int64)
+	}
+	if !sample.ReportedAt.Valid {
+		return scheduler.HealthDegraded, "never reported"
+	}
+	if age := now.Sub(sample.ReportedAt.Time); age >= m.StaleAfter {
+		return scheduler.HealthDegraded, fmt.Sprintf("no telemetry for %s", age.Round(time.Minute))
+	}
+
+	temperature := sample.TemperatureCelsius.Float64
+	if m.QuarantineTemperature > 0 && temperature >= m.QuarantineTemperature {
+		return scheduler.HealthQuarantined, fmt.Sprintf("%.0f°C, at or above %.0f°C", temperature, m.QuarantineTemperature)
+	}
+	if m.DegradedTemperature > 0 && temperature >= m.DegradedTemperature {
+		return scheduler.HealthDegraded, fmt.Sprintf("%.0f°C, at or above %.0f°C", temperature, m.DegradedTemperature)
+	}
+	if m.CorrectedECCLimit > 0 && sample.ECCCorrected.Valid && sample.ECCCorrected.Int64 >= m.CorrectedECCLimit {
+		return scheduler.HealthDegraded, fmt.Sprintf("%d corrected ECC error(s)", sample.ECCCorrected.Int64)
+	}
+	return scheduler.HealthHealthy, ""
+}
@@ -0,0 +1,97 @@
+package services
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/eduardo-escoto/gpu_request/server/internal/database"
+)
+
+// StatusTransition is one change of a request's status
+type StatusTransition struct {
+	From      string    `json:"from,omitempty"` // Empty when the request was created
+	To        string    `json:"to"`
+	Actor     string    `json:"actor"` // User name, or what made an automatic change, e.g. "scheduler"
+	Automatic bool      `json:"automatic"`
+	Reason    string    `json:"reason,omitempty"`
+	At        time.Time `json:"at"`
+}
+
+// RequestDetail is a request with its status history
+type RequestDetail struct {
+	RequestID          int                `json:"request_id"`
+	UserName           string             `json:"user_name"`
+	NumGPUs            int                `json:"num_gpus"`
+	GPUSize            string             `json:"gpu_size"`
+	VRAMMB             int                `json:"vram_mb,omitempty"` // Slice of a shared GPU, 0 for whole GPUs
+	RequestedHours     int                `json:"requested_hours"`
+	Priority           string             `json:"priority"`
+	ServerName         string             `json:"server_name,omitempty"`
+	Status             string             `json:"status"`
+	ProjectID          int                `json:"project_id,omitempty"`
+	RecurringBookingID int                `json:"recurring_booking_id,omitempty"`
+	CreatedAt          time.Time          `json:"created_at"`
+	StartTime          *time.Time         `json:"start_time"` // null until the request starts, unless it is a booking
+	EndTime            *time.Time         `json:"end_time"`
+	History            []StatusTransition `json:"history"`
+}
+
+// LoadRequestDetail returns a request and its status history to its owner, members of its
+// project and admins. Rejections are returned as *RequestError.
+func LoadRequestDetail(db *sql.DB, requestID int, user *database.User) (*RequestDetail, error) {
+	request, err := database.QueryRequest(db, requestID)
+	if err != nil {
+		return nil, err
+	}
+	if request == nil {
+		return nil, ErrNoSuchRequest
+	}
+	allowed, err := CanManageRequest(db, *request, user)
+	if err != nil {
+		return nil, err
+	}
+	if !allowed {
+		return nil, &RequestError{Reason: "only the owner, members of its project or an admin can see this request"}
+	}
+
+	history, err := database.QueryStatusHistory(db, requestID)
+	if err != nil {
+		return nil, err
+	}
+
+	detail := &RequestDetail{
+		RequestID:          request.ID,
+		UserName:           request.UserName,
+		NumGPUs:            request.NumGPUs,
+		GPUSize:            request.GPUSize,
+		VRAMMB:             int(request.VRAMMB.Int64),
+		RequestedHours:     request.RequestedTime,
+		Priority:           request.Priority,
+		ServerName:         request.ServerName.String,
+		Status:             request.Status,
+		ProjectID:          int(request.ProjectID.Int64),
+		RecurringBookingID: int(request.RecurringBookingID.Int64),
+		CreatedAt:          request.CreatedAt,
+		History:            []StatusTransition{},
+	}
+	if request.StartTime.Valid {
+		detail.StartTime = &request.StartTime.Time
+	}
+	if request.EndTime.Valid {
+		detail.EndTime = &request.EndTime.Time
+	}
+	for _, change := range history {
+		transition := StatusTransition{
+			From:   change.OldStatus.String,
+			To:     change.NewStatus,
+			Actor:  change.ChangedByName.String,
+			Reason: change.Reason.String,
+			At:     change.ChangedAt,
+		}
+		if !change.ChangedBy.Valid {
+			transition.Actor, transition.Automatic = change.ChangedBySystem.String, true
+		}
+		detail.History = append(detail.History, transition)
+	}
+	return detail, nil
+}
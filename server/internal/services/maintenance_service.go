@@ -0,0 +1,97 @@
+package services
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/eduardo-escoto/gpu_request/server/internal/database"
+)
+
+// MaintenanceConflict is a running request or booking holding a GPU during a maintenance window
+type MaintenanceConflict struct {
+	WindowID   int       `json:"window_id"`
+	RequestID  int       `json:"request_id"`
+	UserName   string    `json:"user_name"`
+	Status     string    `json:"status"`
+	ServerName string    `json:"server_name"`
+	GPUNumber  int       `json:"gpu_number"`
+	StartTime  time.Time `json:"start_time"`
+	EndTime    time.Time `json:"end_time"`
+}
+
+// NewMaintenanceWindow is a maintenance window as submitted by an admin
+type NewMaintenanceWindow struct {
+	ServerName string
+	GPUUUID    string // Empty for the whole server
+	Start      time.Time
+	End        time.Time
+	Reason     string
+}
+
+// CreateMaintenanceWindow validates and stores a maintenance window. The scheduler keeps
+// queued requests and new bookings off the GPUs from then on; existing reservations are
+// left alone and show up in MaintenanceConflicts. Rejections are returned as *RequestError.
+func CreateMaintenanceWindow(db *sql.DB, window NewMaintenanceWindow) (int64, error) {
+	if !window.End.After(window.Start) {
+		return 0, &RequestError{Reason: "the maintenance window must end after it starts"}
+	}
+	if !window.End.After(time.Now()) {
+		return 0, &RequestError{Reason: "the maintenance window is already over"}
+	}
+
+	gpus, err := database.QueryGPUs(db)
+	if err != nil {
+		return 0, err
+	}
+	found := false
+	for _, gpu := range gpus {
+		if gpu.ServerName == window.ServerName && (window.GPUUUID == "" || gpu.UUID == window.GPUUUID) {
+			found = true
+			break
+		}
+	}
+	if !found {
+		return 0, &RequestError{Reason: "no such GPU or server"}
+	}
+
+	return database.InsertMaintenanceWindow(db, database.MaintenanceWindow{
+		ServerName: window.ServerName,
+		GPUUUID:    sql.NullString{String: window.GPUUUID, Valid: window.GPUUUID != ""},
+		StartTime:  window.Start,
+		EndTime:    window.End,
+		Reason:     window.Reason,
+	})
+}
+
+// MaintenanceConflicts lists, for every current or upcoming maintenance window, the
+// running requests and bookings that hold one of its GPUs during the window
+func MaintenanceConflicts(db *sql.DB) ([]MaintenanceConflict, error) {
+	windows, err := database.QueryMaintenanceWindows(db, time.Now())
+	if err != nil {
+		return nil, err
+	}
+
+	conflicts := []MaintenanceConflict{}
+	for _, window := range windows {
+		entries, err := database.QueryCalendarEntries(db, window.StartTime, window.EndTime)
+		if err != nil {
+			return nil, err
+		}
+		for _, entry := range entries {
+			if entry.ServerName != window.ServerName || (window.GPUUUID.Valid && window.GPUUUID.String != entry.GPUUUID) {
+				continue
+			}
+			conflicts = append(conflicts, MaintenanceConflict{
+				WindowID:   window.ID,
+				RequestID:  entry.RequestID,
+				UserName:   entry.UserName,
+				Status:     entry.Status,
+				ServerName: entry.ServerName,
+				GPUNumber:  entry.GPUNumber,
+				StartTime:  entry.StartTime,
+				EndTime:    entry.EndTime,
+			})
+		}
+	}
+	return conflicts, nil
+}
@@ -0,0 +1,223 @@
+package services
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/eduardo-escoto/gpu_request/server/internal/database"
+)
+
+// Project roles, matching project_members.role
+const (
+	ProjectManager = "manager" // Also adds and removes members
+	ProjectMember  = "member"
+)
+
+// ProjectReport is a project with its members, allocation use and active reservations
+type ProjectReport struct {
+	database.Project
+	Members  []database.ProjectMember
+	Totals   database.RequestTotals // Active GPUs and GPU-hours requested in the last 7 days
+	Usage    []database.ProjectUsage
+	Requests []database.Request
+	Since    time.Time // Start of the usage period
+}
+
+// CheckProjectQuota rejects a request charged to a project the user is not a member of,
+// or that would take the project over its allocation
+func CheckProjectQuota(db database.Querier, req NewRequest) error {
+	project, err := database.QueryProject(db, req.ProjectID, req.UserID)
+	if err != nil {
+		return err
+	}
+	if project == nil {
+		return &RequestError{Reason: "no such project"}
+	}
+	if project.Role == "" {
+		return &RequestError{Reason: fmt.Sprintf("only members of %s can charge requests to it", project.Name)}
+	}
+
+	totals, err := database.QueryProjectTotals(db, req.ProjectID, time.Now().Add(-quotaWeek))
+	if err != nil {
+		return err
+	}
+	if limit := project.MaxConcurrentGPUs; limit.Valid && int64(totals.ActiveGPUs+req.NumGPUs) > limit.Int64 {
+		return &RequestError{Reason: fmt.Sprintf("%s may hold at most %d GPUs at once (%d already queued or running, %d requested).",
+			project.Name, limit.Int64, totals.ActiveGPUs, req.NumGPUs)}
+	}
+	if limit := project.MaxWeeklyGPUHours; limit.Valid && int64(totals.ReservedGPUHours+req.NumGPUs*req.Hours) > limit.Int64 {
+		return &RequestError{Reason: fmt.Sprintf("%s may request at most %d GPU-hours per week (%d requested in the last 7 days, this request adds %d).",
+			project.Name, limit.Int64, totals.ReservedGPUHours, req.NumGPUs*req.Hours)}
+	}
+	return nil
+}
+
+// CanManageRequest reports whether a user may cancel or extend a request: its owner,
+// an admin, or a member of the project it is charged to
+func CanManageRequest(db *sql.DB, request database.Request, user *database.User) (bool, error) {
+	if request.UserID == user.ID || user.IsAdmin {
+		return true, nil
+	}
+	if !request.ProjectID.Valid {
+		return false, nil
+	}
+	project, err := database.QueryProject(db, int(request.ProjectID.Int64), user.ID)
+	if err != nil || project == nil {
+		return false, err
+	}
+	return project.Role != "", nil
+}
+
+// CreateProject creates a project on behalf of an admin, with its first manager
+func CreateProject(db *sql.DB, project database.Project, managerName string, admin *database.User) (int64, error) {
+	if !admin.IsAdmin {
+		return 0, &RequestError{Reason: "only admins can create projects"}
+	}
+	project.Name = strings.TrimSpace(project.Name)
+	if project.Name == "" {
+		return 0, &RequestError{Reason: "projects need a name"}
+	}
+	projects, err := database.QueryProjects(db)
+	if err != nil {
+		return 0, err
+	}
+	for _, existing := range projects {
+		if strings.EqualFold(existing.Name, project.Name) {
+			return 0, &RequestError{Reason: fmt.Sprintf("a project named %s already exists", existing.Name)}
+		}
+	}
+	manager, err := lookupMember(db, managerName)
+	if err != nil {
+		return 0, err
+	}
+
+	id, err := database.InsertProject(db, project)
+	if err != nil {
+		return 0, err
+	}
+	return id, database.SetProjectMember(db, int(id), manager.ID, ProjectManager)
+}
+
+// UpdateProjectQuota changes a project's allocation on behalf of an admin
+func UpdateProjectQuota(db *sql.DB, projectID int, maxConcurrentGPUs, maxWeeklyGPUHours sql.NullInt64, admin *database.User) error {
+	if !admin.IsAdmin {
+		return &RequestError{Reason: "only admins can change project quotas"}
+	}
+	return database.UpdateProjectQuota(db, projectID, maxConcurrentGPUs, maxWeeklyGPUHours)
+}
+
+// SetProjectMember adds a user to a project or changes their role, on behalf of a
+// manager of the project or an admin
+func SetProjectMember(db *sql.DB, projectID int, userName, role string, actor *database.User) error {
+	if role != ProjectManager && role != ProjectMember {
+		return &RequestError{Reason: "invalid project role " + role}
+	}
+	if err := checkProjectManager(db, projectID, actor); err != nil {
+		return err
+	}
+	user, err := lookupMember(db, userName)
+	if err != nil {
+		return err
+	}
+	return database.SetProjectMember(db, projectID, user.ID, role)
+}
+
+// RemoveProjectMember removes a user from a project on behalf of a manager of the
+// project or an admin; the requests they charged to it stay with the project
+func RemoveProjectMember(db *sql.DB, projectID int, userName string, actor *database.User) error {
+	if err := checkProjectManager(db, projectID, actor); err != nil {
+		return err
+	}
+	user, err := lookupMember(db, userName)
+	if err != nil {
+		return err
+	}
+	return database.RemoveProjectMember(db, projectID, user.ID)
+}
+
+// LoadProjectReports returns a report of every project the user belongs to, or of
+// every project for admins, covering usage since the given time
+func LoadProjectReports(db *sql.DB, user *database.User, since time.Time) ([]ProjectReport, error) {
+	var projects []database.Project
+	var err error
+	if user.IsAdmin {
+		projects, err = database.QueryProjects(db)
+	} else {
+		projects, err = database.QueryUserProjects(db, user.ID)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	reports := make([]ProjectReport, 0, len(projects))
+	for _, project := range projects {
+		report, err := loadProjectReport(db, project, since)
+		if err != nil {
+			return nil, err
+		}
+		reports = append(reports, report)
+	}
+	return reports, nil
+}
+
+// LoadProjectReport returns the report of one project for one of its members or an admin
+func LoadProjectReport(db *sql.DB, projectID int, user *database.User, since time.Time) (ProjectReport, error) {
+	project, err := database.QueryProject(db, projectID, user.ID)
+	if err != nil {
+		return ProjectReport{}, err
+	}
+	if project == nil {
+		return ProjectReport{}, &RequestError{Reason: "no such project"}
+	}
+	if project.Role == "" && !user.IsAdmin {
+		return ProjectReport{}, &RequestError{Reason: "only members of " + project.Name + " can see its report"}
+	}
+	return loadProjectReport(db, *project, since)
+}
+
+func loadProjectReport(db *sql.DB, project database.Project, since time.Time) (ProjectReport, error) {
+	report := ProjectReport{Project: project, Since: since}
+	var err error
+	if report.Members, err = database.QueryProjectMembers(db, project.ID); err != nil {
+		return ProjectReport{}, err
+	}
+	if report.Totals, err = database.QueryProjectTotals(db, project.ID, time.Now().Add(-quotaWeek)); err != nil {
+		return ProjectReport{}, err
+	}
+	if report.Usage, err = database.QueryProjectUsage(db, project.ID, since, time.Now()); err != nil {
+		return ProjectReport{}, err
+	}
+	if report.Requests, err = database.QueryProjectRequests(db, project.ID); err != nil {
+		return ProjectReport{}, err
+	}
+	return report, nil
+}
+
+// checkProjectManager rejects users who are neither admins nor managers of the project
+func checkProjectManager(db *sql.DB, projectID int, user *database.User) error {
+	project, err := database.QueryProject(db, projectID, user.ID)
+	if err != nil {
+		return err
+	}
+	if project == nil {
+		return &RequestError{Reason: "no such project"}
+	}
+	if !user.IsAdmin && project.Role != ProjectManager {
+		return &RequestError{Reason: "only managers of " + project.Name + " and admins can change its members"}
+	}
+	return nil
+}
+
+// lookupMember finds a whitelisted user by user name or email
+func lookupMember(db *sql.DB, identity string) (*database.User, error) {
+	user, err := database.QueryUser(db, strings.TrimSpace(identity))
+	if err != nil {
+		return nil, err
+	}
+	if user == nil || !user.IsWhitelisted {
+		return nil, &RequestError{Reason: fmt.Sprintf("no GPU scheduler account named %q", identity)}
+	}
+	return user, nil
+}
@@ -0,0 +1,63 @@
+package services
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/eduardo-escoto/gpu_request/server/internal/scheduler"
+)
+
+// forecastHorizon is how far ahead queue start times are estimated
+const forecastHorizon = 14 * 24 * time.Hour
+
+// QueueEntry is a queued request with its position, estimated start and the reason it waits
+type QueueEntry struct {
+	RequestID      int        `json:"request_id"`
+	UserName       string     `json:"user_name"`
+	NumGPUs        int        `json:"num_gpus"`
+	GPUSize        string     `json:"gpu_size"`
+	VRAMMB         int        `json:"vram_mb,omitempty"` // Slice of a shared GPU, 0 for whole GPUs
+	RequestedHours int        `json:"requested_hours"`
+	Priority       string     `json:"priority"`
+	ServerName     string     `json:"server_name,omitempty"`
+	CreatedAt      time.Time  `json:"created_at"`
+	Position       int        `json:"position"`
+	EstimatedStart *time.Time `json:"estimated_start"` // null if not within the forecast horizon
+	Reason         string     `json:"reason,omitempty"`
+}
+
+// LoadQueue forecasts the queue with the scheduler's policy
+func LoadQueue(db *sql.DB, sched *scheduler.Scheduler) ([]QueueEntry, error) {
+	state, err := (&scheduler.SQLStore{DB: db, UsageWindow: sched.UsageWindow()}).LoadState()
+	if err != nil {
+		return nil, err
+	}
+
+	requests := make(map[int]scheduler.Request)
+	for _, request := range state.Requests {
+		requests[request.ID] = request
+	}
+
+	var entries []QueueEntry
+	for _, forecast := range sched.Forecast(state, forecastHorizon) {
+		request := requests[forecast.RequestID]
+		entry := QueueEntry{
+			RequestID:      request.ID,
+			UserName:       request.UserName,
+			NumGPUs:        request.NumGPUs,
+			GPUSize:        request.GPUSize,
+			VRAMMB:         request.VRAMMB,
+			RequestedHours: request.RequestedHours,
+			Priority:       request.Priority,
+			ServerName:     request.ServerName,
+			CreatedAt:      request.CreatedAt,
+			Position:       forecast.Position,
+			Reason:         forecast.Reason,
+		}
+		if !forecast.EstimatedStart.IsZero() {
+			entry.EstimatedStart = &forecast.EstimatedStart
+		}
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
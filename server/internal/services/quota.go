@@ -0,0 +1,110 @@
+package services
+
+import (
+	"database/sql"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/eduardo-escoto/gpu_request/server/internal/database"
+)
+
+// quotaWeek is the rolling window of the weekly GPU-hours quota
+const quotaWeek = 7 * 24 * time.Hour
+
+// CheckQuota rejects a request that would take the user over their quota. Requests
+// charged to a project draw on the project's GPUs and GPU-hours instead of the user's
+// (see CheckProjectQuota); the user's per-request limits still apply.
+func CheckQuota(db database.Querier, req NewRequest) error {
+	quota, err := database.QueryUserQuota(db, req.UserID)
+	if err != nil {
+		return err
+	}
+	if req.ProjectID != 0 {
+		quota.MaxConcurrentGPUs, quota.MaxWeeklyGPUHours = sql.NullInt64{}, sql.NullInt64{}
+	}
+	totals, err := database.QueryRequestTotals(db, req.UserID, time.Now().Add(-quotaWeek))
+	if err != nil {
+		return err
+	}
+
+	if reason := quotaViolation(quota, totals, req); reason != "" {
+		return &RequestError{Reason: reason}
+	}
+	return nil
+}
+
+// CheckExtensionQuota rejects an extension that would take a request over the per-request
+// hours limit or its owner, or its project, over their weekly GPU-hours
+func CheckExtensionQuota(db *sql.DB, request database.Request, hours int) error {
+	quota, err := database.QueryUserQuota(db, request.UserID)
+	if err != nil {
+		return err
+	}
+	totals, err := database.QueryRequestTotals(db, request.UserID, time.Now().Add(-quotaWeek))
+	if err != nil {
+		return err
+	}
+
+	if limit := quota.MaxRequestedHours; limit.Valid && int64(request.RequestedTime+hours) > limit.Int64 {
+		return &RequestError{Reason: fmt.Sprintf("%s users may request at most %d hours per request (%d already requested, extension adds %d).",
+			quota.UserType, limit.Int64, request.RequestedTime, hours)}
+	}
+	if request.ProjectID.Valid {
+		return checkProjectExtensionQuota(db, int(request.ProjectID.Int64), request.NumGPUs*hours)
+	}
+	if limit := quota.MaxWeeklyGPUHours; limit.Valid && int64(totals.ReservedGPUHours+request.NumGPUs*hours) > limit.Int64 {
+		return &RequestError{Reason: fmt.Sprintf("%s users may request at most %d GPU-hours per week (%d requested in the last 7 days, this extension adds %d).",
+			quota.UserType, limit.Int64, totals.ReservedGPUHours, request.NumGPUs*hours)}
+	}
+	return nil
+}
+
+// checkProjectExtensionQuota rejects an extension that would take a project over its weekly GPU-hours
+func checkProjectExtensionQuota(db *sql.DB, projectID, gpuHours int) error {
+	project, err := database.QueryProject(db, projectID, 0)
+	if err != nil || project == nil || !project.MaxWeeklyGPUHours.Valid {
+		return err
+	}
+	totals, err := database.QueryProjectTotals(db, projectID, time.Now().Add(-quotaWeek))
+	if err != nil {
+		return err
+	}
+	if limit := project.MaxWeeklyGPUHours.Int64; int64(totals.ReservedGPUHours+gpuHours) > limit {
+		return &RequestError{Reason: fmt.Sprintf("%s may request at most %d GPU-hours per week (%d requested in the last 7 days, this extension adds %d).",
+			project.Name, limit, totals.ReservedGPUHours, gpuHours)}
+	}
+	return nil
+}
+
+// quotaViolation explains why a request exceeds the quota, or returns "" if it fits
+func quotaViolation(quota database.Quota, totals database.RequestTotals, req NewRequest) string {
+	if quota.AllowedPriorities.Valid {
+		allowed := strings.Split(quota.AllowedPriorities.String, ",")
+		for i := range allowed {
+			allowed[i] = strings.TrimSpace(allowed[i])
+		}
+		if !slices.Contains(allowed, req.Priority) {
+			return fmt.Sprintf("%s users may not request %s priority (allowed: %s).",
+				quota.UserType, req.Priority, strings.Join(allowed, ", "))
+		}
+	}
+
+	if limit := quota.MaxRequestedHours; limit.Valid && int64(req.Hours) > limit.Int64 {
+		return fmt.Sprintf("%s users may request at most %d hours per request (requested %d).",
+			quota.UserType, limit.Int64, req.Hours)
+	}
+
+	if limit := quota.MaxConcurrentGPUs; limit.Valid && int64(totals.ActiveGPUs+req.NumGPUs) > limit.Int64 {
+		return fmt.Sprintf("%s users may hold at most %d GPUs at once (%d already queued or running, %d requested).",
+			quota.UserType, limit.Int64, totals.ActiveGPUs, req.NumGPUs)
+	}
+
+	if limit := quota.MaxWeeklyGPUHours; limit.Valid && int64(totals.ReservedGPUHours+req.NumGPUs*req.Hours) > limit.Int64 {
+		return fmt.Sprintf("%s users may request at most %d GPU-hours per week (%d requested in the last 7 days, this request adds %d).",
+			quota.UserType, limit.Int64, totals.ReservedGPUHours, req.NumGPUs*req.Hours)
+	}
+
+	return ""
+}
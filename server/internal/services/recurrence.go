@@ -0,0 +1,162 @@
+package services
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Recurrence frequencies, as in RRULE's FREQ
+const (
+	FrequencyDaily  = "DAILY"
+	FrequencyWeekly = "WEEKLY"
+)
+
+// rruleDays maps RRULE's BYDAY values to weekdays
+var rruleDays = map[string]time.Weekday{
+	"SU": time.Sunday,
+	"MO": time.Monday,
+	"TU": time.Tuesday,
+	"WE": time.Wednesday,
+	"TH": time.Thursday,
+	"FR": time.Friday,
+	"SA": time.Saturday,
+}
+
+// Recurrence is the subset of RFC 5545 recurrence rules that recurring bookings support:
+// FREQ=DAILY or FREQ=WEEKLY, INTERVAL and, for weekly rules, BYDAY. The end of a series
+// is stored separately, like its exceptions.
+type Recurrence struct {
+	Frequency string
+	Interval  int            // Every Interval days or weeks
+	Weekdays  []time.Weekday // Days of a weekly rule; the first occurrence's weekday if empty
+}
+
+// ParseRecurrence parses a rule such as "FREQ=WEEKLY;INTERVAL=2;BYDAY=TU,TH"
+func ParseRecurrence(rule string) (Recurrence, error) {
+	recurrence := Recurrence{Interval: 1}
+	for _, part := range strings.Split(strings.TrimPrefix(strings.ToUpper(strings.TrimSpace(rule)), "RRULE:"), ";") {
+		if part == "" {
+			continue
+		}
+		name, value, ok := strings.Cut(part, "=")
+		if !ok {
+			return Recurrence{}, fmt.Errorf("invalid recurrence rule part %q", part)
+		}
+		switch name {
+		case "FREQ":
+			if value != FrequencyDaily && value != FrequencyWeekly {
+				return Recurrence{}, fmt.Errorf("only daily and weekly recurrences are supported, not %s", strings.ToLower(value))
+			}
+			recurrence.Frequency = value
+		case "INTERVAL":
+			interval, err := strconv.Atoi(value)
+			if err != nil || interval < 1 {
+				return Recurrence{}, fmt.Errorf("invalid recurrence interval %q", value)
+			}
+			recurrence.Interval = interval
+		case "BYDAY":
+			for _, day := range strings.Split(value, ",") {
+				weekday, ok := rruleDays[day]
+				if !ok {
+					return Recurrence{}, fmt.Errorf("invalid recurrence day %q", day)
+				}
+				if !slices.Contains(recurrence.Weekdays, weekday) {
+					recurrence.Weekdays = append(recurrence.Weekdays, weekday)
+				}
+			}
+		default:
+			return Recurrence{}, fmt.Errorf("unsupported recurrence rule part %s", name)
+		}
+	}
+
+	if recurrence.Frequency == "" {
+		return Recurrence{}, fmt.Errorf("the recurrence rule needs a FREQ")
+	}
+	if recurrence.Frequency == FrequencyDaily && len(recurrence.Weekdays) > 0 {
+		return Recurrence{}, fmt.Errorf("BYDAY is only supported for weekly recurrences")
+	}
+	slices.Sort(recurrence.Weekdays)
+	return recurrence, nil
+}
+
+// String formats the rule as stored in recurring_bookings.rrule
+func (r Recurrence) String() string {
+	rule := fmt.Sprintf("FREQ=%s;INTERVAL=%d", r.Frequency, r.Interval)
+	if len(r.Weekdays) > 0 {
+		days := make([]string, len(r.Weekdays))
+		for i, weekday := range r.Weekdays {
+			days[i] = strings.ToUpper(weekday.String()[:2])
+		}
+		rule += ";BYDAY=" + strings.Join(days, ",")
+	}
+	return rule
+}
+
+// Describe explains the rule in words, e.g. "every 2 weeks on Tuesday, Thursday"
+func (r Recurrence) Describe() string {
+	unit := "day"
+	if r.Frequency == FrequencyWeekly {
+		unit = "week"
+	}
+	description := "every " + unit
+	if r.Interval > 1 {
+		description = fmt.Sprintf("every %d %ss", r.Interval, unit)
+	}
+	if len(r.Weekdays) > 0 {
+		days := make([]string, len(r.Weekdays))
+		for i, weekday := range r.Weekdays {
+			days[i] = weekday.String()
+		}
+		description += " on " + strings.Join(days, ", ")
+	}
+	return description
+}
+
+// Occurrences returns the starts of the occurrences of a series whose first occurrence
+// starts at first and whose last one starts on until's day at the latest, limited to
+// starts in [from, to). Every occurrence starts at first's time of day.
+func (r Recurrence) Occurrences(first, until, from, to time.Time) []time.Time {
+	weekdays := r.Weekdays
+	if len(weekdays) == 0 {
+		weekdays = []time.Weekday{first.Weekday()}
+	}
+	firstDay := dayOf(first)
+	// Weekly intervals count whole weeks from the Monday of the first occurrence's week
+	firstMonday := firstDay.AddDate(0, 0, -((int(firstDay.Weekday()) + 6) % 7))
+	// until is a DATE, so only its calendar day counts
+	lastDay := time.Date(until.Year(), until.Month(), until.Day(), 0, 0, 0, 0, first.Location())
+
+	var starts []time.Time
+	for day := firstDay; !day.After(lastDay) && day.Before(to); day = day.AddDate(0, 0, 1) {
+		switch r.Frequency {
+		case FrequencyDaily:
+			if daysBetween(firstDay, day)%r.Interval != 0 {
+				continue
+			}
+		case FrequencyWeekly:
+			if (daysBetween(firstMonday, day)/7)%r.Interval != 0 || !slices.Contains(weekdays, day.Weekday()) {
+				continue
+			}
+		}
+		start := time.Date(day.Year(), day.Month(), day.Day(), first.Hour(), first.Minute(), first.Second(), 0, first.Location())
+		if !start.Before(from) && start.Before(to) {
+			starts = append(starts, start)
+		}
+	}
+	return starts
+}
+
+// dayOf returns midnight of the day of t, in t's location
+func dayOf(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+}
+
+// daysBetween counts calendar days from a to b, ignoring daylight saving changes
+func daysBetween(a, b time.Time) int {
+	ua := time.Date(a.Year(), a.Month(), a.Day(), 0, 0, 0, 0, time.UTC)
+	ub := time.Date(b.Year(), b.Month(), b.Day(), 0, 0, 0, 0, time.UTC)
+	return int(ub.Sub(ua).Hours() / 24)
+}
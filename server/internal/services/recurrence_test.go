@@ -0,0 +1,131 @@
+package services
+
+import (
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestParseRecurrence(t *testing.T) {
+	tests := []struct {
+		rule        string
+		want        string // Normalized rule, empty if the rule is invalid
+		description string
+	}{
+		{"FREQ=DAILY", "FREQ=DAILY;INTERVAL=1", "every day"},
+		{"RRULE:freq=weekly;interval=2;byday=TH,TU,TU", "FREQ=WEEKLY;INTERVAL=2;BYDAY=TU,TH", "every 2 weeks on Tuesday, Thursday"},
+		{"FREQ=WEEKLY", "FREQ=WEEKLY;INTERVAL=1", "every week"},
+		{"FREQ=MONTHLY", "", ""},
+		{"FREQ=DAILY;BYDAY=MO", "", ""},
+		{"FREQ=WEEKLY;INTERVAL=0", "", ""},
+		{"FREQ=WEEKLY;BYDAY=XX", "", ""},
+		{"INTERVAL=2", "", ""},
+		{"FREQ=DAILY;COUNT=3", "", ""},
+	}
+	for _, tt := range tests {
+		recurrence, err := ParseRecurrence(tt.rule)
+		if tt.want == "" {
+			if err == nil {
+				t.Errorf("ParseRecurrence(%q) = %v, want an error", tt.rule, recurrence)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("ParseRecurrence(%q): %v", tt.rule, err)
+			continue
+		}
+		if got := recurrence.String(); got != tt.want {
+			t.Errorf("ParseRecurrence(%q) = %s, want %s", tt.rule, got, tt.want)
+		}
+		if got := recurrence.Describe(); got != tt.description {
+			t.Errorf("Describe(%q) = %q, want %q", tt.rule, got, tt.description)
+		}
+	}
+}
+
+func TestOccurrences(t *testing.T) {
+	// Tuesday 2026-10-06, 09:30
+	first := time.Date(2026, 10, 6, 9, 30, 0, 0, time.UTC)
+	day := func(month time.Month, day int) time.Time {
+		return time.Date(2026, month, day, 9, 30, 0, 0, time.UTC)
+	}
+
+	tests := []struct {
+		name     string
+		rule     string
+		until    time.Time
+		from, to time.Time
+		want     []time.Time
+	}{
+		{
+			name:  "daily every other day",
+			rule:  "FREQ=DAILY;INTERVAL=2",
+			until: day(10, 12),
+			from:  first, to: day(12, 31),
+			want: []time.Time{day(10, 6), day(10, 8), day(10, 10), day(10, 12)},
+		},
+		{
+			name:  "weekly on the first occurrence's weekday",
+			rule:  "FREQ=WEEKLY",
+			until: day(10, 27),
+			from:  first, to: day(12, 31),
+			want: []time.Time{day(10, 6), day(10, 13), day(10, 20), day(10, 27)},
+		},
+		{
+			name:  "every other week counts weeks from the first occurrence's Monday",
+			rule:  "FREQ=WEEKLY;INTERVAL=2;BYDAY=MO,TH",
+			until: day(10, 31),
+			from:  first, to: day(12, 31),
+			// Monday 10-05 precedes the first occurrence
+			want: []time.Time{day(10, 8), day(10, 19), day(10, 22)},
+		},
+		{
+			name:  "until only counts its day",
+			rule:  "FREQ=DAILY",
+			until: time.Date(2026, 10, 8, 0, 0, 0, 0, time.UTC),
+			from:  first, to: day(12, 31),
+			want: []time.Time{day(10, 6), day(10, 7), day(10, 8)},
+		},
+		{
+			name:  "limited to [from, to)",
+			rule:  "FREQ=DAILY",
+			until: day(12, 31),
+			from:  day(10, 10), to: day(10, 13),
+			want: []time.Time{day(10, 10), day(10, 11), day(10, 12)},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			recurrence, err := ParseRecurrence(tt.rule)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := recurrence.Occurrences(first, tt.until, tt.from, tt.to); !slices.EqualFunc(got, tt.want, time.Time.Equal) {
+				t.Errorf("got %v\nwant %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestOccurrencesAcrossDaylightSaving(t *testing.T) {
+	location, err := time.LoadLocation("America/Los_Angeles")
+	if err != nil {
+		t.Skip("no time zone database")
+	}
+	// DST ends on Sunday 2026-11-01; occurrences keep their local time of day
+	first := time.Date(2026, 10, 30, 9, 0, 0, 0, location)
+	recurrence, err := ParseRecurrence("FREQ=DAILY")
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := recurrence.Occurrences(first, first.AddDate(0, 0, 4), first, first.AddDate(0, 1, 0))
+	if len(got) != 5 {
+		t.Fatalf("got %d occurrences, want 5: %v", len(got), got)
+	}
+	for _, start := range got {
+		if start.Hour() != 9 {
+			t.Errorf("occurrence %v does not start at 09:00", start)
+		}
+	}
+}
@@ -0,0 +1,400 @@
+package services
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/eduardo-escoto/gpu_request/server/internal/database"
+	"github.com/eduardo-escoto/gpu_request/server/internal/scheduler"
+)
+
+const (
+	// recurringHorizon is how far ahead occurrences are materialized into bookings
+	recurringHorizon = 28 * 24 * time.Hour
+	// maxRecurringSpan bounds how long a series may run
+	maxRecurringSpan = 366 * 24 * time.Hour
+	// defaultRecurringBookingInterval is used when no positive Interval is set
+	defaultRecurringBookingInterval = time.Hour
+)
+
+// Reasons an occurrence is not materialized, matching recurring_booking_exceptions.reason
+const (
+	ExceptionSkipped  = "skipped"
+	ExceptionConflict = "conflict"
+)
+
+// NewRecurringBooking is a series of bookings as submitted through the web form
+type NewRecurringBooking struct {
+	UserID     int
+	NumGPUs    int
+	GPUSize    string
+	Priority   string
+	ServerName string // Empty for any server
+	ProjectID  int    // Project to charge, 0 for personal bookings
+	Start      time.Time
+	End        time.Time // End of the first occurrence
+	Rule       string    // RRULE subset, see ParseRecurrence
+	Until      time.Time // Last day an occurrence may start on
+	Skip       []time.Time
+}
+
+// MaterializedOccurrences is what one materialization pass did for a series
+type MaterializedOccurrences struct {
+	Booked    []int64     // IDs of the new bookings
+	Conflicts []time.Time // Starts of the occurrences whose GPUs were taken
+}
+
+// CreateRecurringBooking validates a series against the fleet and the user's quota, stores
+// it and books its occurrences over the next four weeks; later ones are booked by
+// RecurringBookings as they come within reach. Occurrences whose GPUs are taken are skipped
+// and reported. Rejections are returned as *RequestError.
+func CreateRecurringBooking(db *sql.DB, booking NewRecurringBooking) (int64, MaterializedOccurrences, error) {
+	var none MaterializedOccurrences
+	recurrence, err := ParseRecurrence(booking.Rule)
+	if err != nil {
+		return 0, none, &RequestError{Reason: err.Error()}
+	}
+	if !booking.Start.After(time.Now()) {
+		return 0, none, &RequestError{Reason: "recurring bookings must start in the future"}
+	}
+	if !booking.End.After(booking.Start) {
+		return 0, none, &RequestError{Reason: "each occurrence must end after it starts"}
+	}
+	if booking.End.Sub(booking.Start) > 24*time.Hour {
+		return 0, none, &RequestError{Reason: "occurrences of a recurring booking may last at most a day"}
+	}
+	if dayOf(booking.Until).Before(dayOf(booking.Start)) {
+		return 0, none, &RequestError{Reason: "the series must end on or after its first day"}
+	}
+	if booking.Until.Sub(booking.Start) > maxRecurringSpan {
+		return 0, none, &RequestError{Reason: "recurring bookings may run for at most a year"}
+	}
+
+	state, err := (&scheduler.SQLStore{DB: db}).LoadState()
+	if err != nil {
+		return 0, none, err
+	}
+	// Each occurrence is a booking, so the first one stands for all of them
+	first := NewBooking{
+		UserID:     booking.UserID,
+		NumGPUs:    booking.NumGPUs,
+		GPUSize:    booking.GPUSize,
+		Priority:   booking.Priority,
+		ServerName: booking.ServerName,
+		ProjectID:  booking.ProjectID,
+		Start:      booking.Start,
+		End:        booking.End,
+	}
+	if _, err := checkBooking(db, state, first); err != nil {
+		return 0, none, err
+	}
+
+	series := database.RecurringBooking{
+		UserID:          booking.UserID,
+		ProjectID:       sql.NullInt64{Int64: int64(booking.ProjectID), Valid: booking.ProjectID != 0},
+		GPUSize:         booking.GPUSize,
+		NumGPUs:         booking.NumGPUs,
+		Priority:        booking.Priority,
+		ServerName:      sql.NullString{String: booking.ServerName, Valid: booking.ServerName != ""},
+		RRule:           recurrence.String(),
+		FirstStart:      booking.Start,
+		DurationMinutes: int(math.Ceil(booking.End.Sub(booking.Start).Minutes())),
+		UntilDate:       dayOf(booking.Until),
+	}
+	id, err := database.InsertRecurringBooking(db, series, booking.Skip)
+	if err != nil {
+		return 0, none, err
+	}
+	series.ID = int(id)
+
+	materialized, err := materializeSeries(db, &state, series, time.Now())
+	return id, materialized, err
+}
+
+// CancelRecurringBooking ends a series on behalf of its owner, a member of its project or
+// an admin, cancelling the occurrences that have not started
+func CancelRecurringBooking(db *sql.DB, id int, user *database.User) error {
+	if _, err := loadManagedSeries(db, id, user); err != nil {
+		return err
+	}
+	return database.CancelRecurringBooking(db, id, time.Now(), database.StatusChange{
+		UserID: user.ID,
+		Reason: fmt.Sprintf("recurring booking #%d cancelled", id),
+	})
+}
+
+// SkipOccurrence cancels the occurrence of a series on the given day, whether or not it
+// was booked yet, on behalf of its owner, a member of its project or an admin
+func SkipOccurrence(db *sql.DB, id int, day time.Time, user *database.User) error {
+	series, err := loadManagedSeries(db, id, user)
+	if err != nil {
+		return err
+	}
+	recurrence, err := ParseRecurrence(series.RRule)
+	if err != nil {
+		return err
+	}
+	first := series.FirstStart.In(day.Location())
+	if len(recurrence.Occurrences(first, series.UntilDate, dayOf(day), dayOf(day).AddDate(0, 0, 1))) == 0 {
+		return &RequestError{Reason: fmt.Sprintf("recurring booking #%d has no occurrence on %s", id, day.Format("Mon Jan 2"))}
+	}
+
+	occurrences, err := database.QueryRecurringOccurrences(db, id)
+	if err != nil {
+		return err
+	}
+	for _, occurrence := range occurrences {
+		if occurrence.StartTime.Time.In(day.Location()).Format(time.DateOnly) != day.Format(time.DateOnly) {
+			continue
+		}
+		switch occurrence.Status {
+		case scheduler.StatusInProgress:
+			return &RequestError{Reason: fmt.Sprintf("the occurrence on %s has already started", day.Format("Mon Jan 2"))}
+		case scheduler.StatusScheduled:
+			change := database.StatusChange{UserID: user.ID, Reason: "occurrence skipped"}
+			if err := database.CancelRequest(db, occurrence.ID, change); err != nil {
+				return err
+			}
+		}
+	}
+	return database.InsertRecurringException(db, id, day, ExceptionSkipped, "skipped by "+user.UserName)
+}
+
+// RecurringBookings books the occurrences of recurring bookings as they come within four
+// weeks, like CreateBooking would, and tells owners about occurrences whose GPUs were taken
+type RecurringBookings struct {
+	DB       *sql.DB
+	Notifier Notifier
+	Interval time.Duration
+}
+
+// Start runs the materialization loop forever
+func (m *RecurringBookings) Start() {
+	if m.Interval <= 0 {
+		m.Interval = defaultRecurringBookingInterval
+	}
+	for {
+		if err := m.Materialize(time.Now()); err != nil {
+			log.Printf("Error materializing recurring bookings: %v", err)
+		}
+		time.Sleep(m.Interval)
+	}
+}
+
+// Materialize books the occurrences of every active series that start within the horizon
+func (m *RecurringBookings) Materialize(now time.Time) error {
+	series, err := database.QueryRecurringBookings(m.DB, now)
+	if err != nil {
+		return err
+	}
+	if len(series) == 0 {
+		return nil
+	}
+	state, err := (&scheduler.SQLStore{DB: m.DB}).LoadState()
+	if err != nil {
+		return err
+	}
+
+	for _, booking := range series {
+		materialized, err := materializeSeries(m.DB, &state, booking, now)
+		if err != nil {
+			return err
+		}
+		if len(materialized.Conflicts) > 0 {
+			if err := m.notifyConflicts(booking, materialized.Conflicts); err != nil {
+				log.Printf("Error notifying %s of recurring booking conflicts: %v", booking.UserName, err)
+			}
+		}
+	}
+	return nil
+}
+
+// notifyConflicts tells the owner of a series which occurrences could not be booked
+func (m *RecurringBookings) notifyConflicts(series database.RecurringBooking, conflicts []time.Time) error {
+	user, err := database.QueryUser(m.DB, series.UserName)
+	if err != nil || user == nil {
+		return err
+	}
+	days := make([]string, len(conflicts))
+	for i, start := range conflicts {
+		days[i] = "- " + start.Format("Mon Jan 2 15:04")
+	}
+	body := fmt.Sprintf("The GPUs of these occurrences of your recurring booking #%d were already taken, so they were not booked:\n\n%s\n\n"+
+		"Book them separately if you still need GPUs at those times.\n", series.ID, strings.Join(days, "\n"))
+	return m.Notifier.Notify([]string{user.Email}, fmt.Sprintf("[GPU Scheduler] Recurring booking #%d has conflicts", series.ID), body)
+}
+
+// materializeSeries books the occurrences of a series starting within the horizon that
+// were neither booked nor excepted yet, adding the bookings to state so later ones see
+// them. Occurrences whose GPUs are taken are recorded as conflict exceptions.
+func materializeSeries(db *sql.DB, state *scheduler.State, series database.RecurringBooking, now time.Time) (MaterializedOccurrences, error) {
+	var result MaterializedOccurrences
+	recurrence, err := ParseRecurrence(series.RRule)
+	if err != nil {
+		return result, err
+	}
+	exceptions, err := database.QueryRecurringExceptions(db, series.ID)
+	if err != nil {
+		return result, err
+	}
+	occurrences, err := database.QueryRecurringOccurrences(db, series.ID)
+	if err != nil {
+		return result, err
+	}
+	handled := make(map[string]bool)
+	for _, exception := range exceptions {
+		handled[exception.OccurrenceDate.Format(time.DateOnly)] = true
+	}
+	for _, occurrence := range occurrences {
+		handled[occurrence.StartTime.Time.In(now.Location()).Format(time.DateOnly)] = true
+	}
+
+	first := series.FirstStart.In(now.Location())
+	duration := time.Duration(series.DurationMinutes) * time.Minute
+	for _, start := range recurrence.Occurrences(first, series.UntilDate, now, now.Add(recurringHorizon)) {
+		if handled[start.Format(time.DateOnly)] {
+			continue
+		}
+		request := scheduler.Request{
+			UserID:         series.UserID,
+			UserName:       series.UserName,
+			ProjectID:      int(series.ProjectID.Int64),
+			RequestedHours: int(math.Ceil(duration.Hours())),
+			GPUSize:        series.GPUSize,
+			NumGPUs:        series.NumGPUs,
+			Priority:       series.Priority,
+			ServerName:     series.ServerName.String,
+			Status:         scheduler.StatusScheduled,
+			StartTime:      start,
+			EndTime:        start.Add(duration),
+		}
+
+		id, err := bookOccurrence(db, state, &request, series)
+		var rejection *RequestError
+		if errors.As(err, &rejection) {
+			result.Conflicts = append(result.Conflicts, start)
+			if err := database.InsertRecurringException(db, series.ID, start, ExceptionConflict, rejection.Reason); err != nil {
+				return result, err
+			}
+			continue
+		}
+		if err != nil {
+			return result, err
+		}
+		result.Booked = append(result.Booked, id)
+		request.ID = int(id)
+		state.Requests = append(state.Requests, request)
+	}
+	return result, nil
+}
+
+// bookOccurrence picks GPUs for one occurrence and stores it as a booking of the series,
+// setting the request's GPUs. Taken GPUs are returned as *RequestError.
+func bookOccurrence(db *sql.DB, state *scheduler.State, request *scheduler.Request, series database.RecurringBooking) (int64, error) {
+	gpus, err := scheduler.FindBookingGPUs(*request, *state)
+	if err != nil {
+		return 0, &RequestError{Reason: err.Error()}
+	}
+	for _, gpu := range gpus {
+		request.GPUUUIDs = append(request.GPUUUIDs, gpu.UUID)
+	}
+
+	id, err := database.InsertBooking(db, database.Request{
+		UserID:             request.UserID,
+		RequestedTime:      request.RequestedHours,
+		GPUSize:            request.GPUSize,
+		NumGPUs:            request.NumGPUs,
+		Priority:           request.Priority,
+		ServerName:         series.ServerName,
+		StartTime:          sql.NullTime{Time: request.StartTime, Valid: true},
+		EndTime:            sql.NullTime{Time: request.EndTime, Valid: true},
+		ProjectID:          series.ProjectID,
+		RecurringBookingID: sql.NullInt64{Int64: int64(series.ID), Valid: true},
+	}, request.GPUUUIDs, database.StatusChange{
+		System: "recurring bookings",
+		Reason: fmt.Sprintf("occurrence of recurring booking #%d", series.ID),
+	}, nil)
+	if errors.Is(err, database.ErrBookingConflict) {
+		return 0, &RequestError{Reason: err.Error()}
+	}
+	return id, err
+}
+
+// loadManagedSeries returns a series the user may manage
+func loadManagedSeries(db *sql.DB, id int, user *database.User) (*database.RecurringBooking, error) {
+	series, err := database.QueryRecurringBooking(db, id)
+	if err != nil {
+		return nil, err
+	}
+	if series == nil {
+		return nil, &RequestError{Reason: "no such recurring booking"}
+	}
+	if series.CancelledAt.Valid {
+		return nil, &RequestError{Reason: fmt.Sprintf("recurring booking #%d was cancelled", id)}
+	}
+	allowed, err := CanManageRequest(db, database.Request{UserID: series.UserID, ProjectID: series.ProjectID}, user)
+	if err != nil {
+		return nil, err
+	}
+	if !allowed {
+		return nil, &RequestError{Reason: "only the owner, members of its project or an admin can change this recurring booking"}
+	}
+	return series, nil
+}
+
+// RecurringSummary is a series with its rule in words, upcoming occurrences and exceptions
+type RecurringSummary struct {
+	database.RecurringBooking
+	Description string
+	Upcoming    []database.Request // Booked occurrences that have not ended
+	Exceptions  []database.RecurringException
+}
+
+// LoadRecurringBookings returns the active series the user may manage: their own, those
+// of their projects, or every series for admins
+func LoadRecurringBookings(db *sql.DB, user *database.User) ([]RecurringSummary, error) {
+	now := time.Now()
+	series, err := database.QueryRecurringBookings(db, now)
+	if err != nil {
+		return nil, err
+	}
+	projects, err := database.QueryUserProjects(db, user.ID)
+	if err != nil {
+		return nil, err
+	}
+	member := make(map[int64]bool)
+	for _, project := range projects {
+		member[int64(project.ID)] = true
+	}
+
+	var summaries []RecurringSummary
+	for _, booking := range series {
+		if !user.IsAdmin && booking.UserID != user.ID && !(booking.ProjectID.Valid && member[booking.ProjectID.Int64]) {
+			continue
+		}
+		summary := RecurringSummary{RecurringBooking: booking, Description: booking.RRule}
+		if recurrence, err := ParseRecurrence(booking.RRule); err == nil {
+			summary.Description = recurrence.Describe()
+		}
+		occurrences, err := database.QueryRecurringOccurrences(db, booking.ID)
+		if err != nil {
+			return nil, err
+		}
+		for _, occurrence := range occurrences {
+			active := occurrence.Status == scheduler.StatusScheduled || occurrence.Status == scheduler.StatusInProgress
+			if active && occurrence.EndTime.Time.After(now) {
+				summary.Upcoming = append(summary.Upcoming, occurrence)
+			}
+		}
+		if summary.Exceptions, err = database.QueryRecurringExceptions(db, booking.ID); err != nil {
+			return nil, err
+		}
+		summaries = append(summaries, summary)
+	}
+	return summaries, nil
+}
@@ -0,0 +1,276 @@
+package services
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"math"
+	"slices"
+	"time"
+
+	"github.com/eduardo-escoto/gpu_request/server/internal/database"
+	"github.com/eduardo-escoto/gpu_request/server/internal/scheduler"
+)
+
+// RequestError is a user-facing reason for rejecting a request
+type RequestError struct {
+	Reason string
+}
+
+func (e *RequestError) Error() string {
+	return e.Reason
+}
+
+// ErrNoSuchRequest rejects operations on a request ID that does not exist, so front ends
+// can tell it apart from other rejections (e.g., with a 404)
+var ErrNoSuchRequest = &RequestError{Reason: "no such request"}
+
+// NewRequest is a GPU request as submitted through the web form or Slack
+type NewRequest struct {
+	UserID     int
+	NumGPUs    int
+	GPUSize    string
+	Hours      int
+	Priority   string
+	ServerName string // Empty for any server
+	ProjectID  int    // Project to charge, 0 for a personal request
+	VRAMMB     int    // VRAM slice of a shared GPU, 0 for whole GPUs
+}
+
+// CreateRequest validates a request against the current fleet and the user's quota and
+// queues it, or holds it for an admin if it matches an approval rule, in which case the
+// rule is returned. Rejections are returned as *RequestError so front ends can show them as-is.
+func CreateRequest(db *sql.DB, req NewRequest) (int64, string, error) {
+	state, err := (&scheduler.SQLStore{DB: db}).LoadState()
+	if err != nil {
+		return 0, "", err
+	}
+
+	candidate := scheduler.Request{
+		UserID:         req.UserID,
+		RequestedHours: req.Hours,
+		GPUSize:        req.GPUSize,
+		NumGPUs:        req.NumGPUs,
+		VRAMMB:         req.VRAMMB,
+		Priority:       req.Priority,
+		ServerName:     req.ServerName,
+		Status:         scheduler.StatusScheduled,
+	}
+	if err := scheduler.ValidateRequest(candidate, state); err != nil {
+		return 0, "", &RequestError{Reason: err.Error()}
+	}
+	rule, err := ApprovalRuleFor(db, req)
+	if err != nil {
+		return 0, "", err
+	}
+	change := database.StatusChange{UserID: req.UserID}
+	if rule != "" {
+		change.Reason = "needs approval for " + rule
+	}
+
+	id, err := database.InsertRequest(db, database.Request{
+		UserID:        req.UserID,
+		RequestedTime: req.Hours,
+		GPUSize:       req.GPUSize,
+		NumGPUs:       req.NumGPUs,
+		Priority:      req.Priority,
+		ServerName:    sql.NullString{String: req.ServerName, Valid: req.ServerName != ""},
+		ApprovalRule:  sql.NullString{String: rule, Valid: rule != ""},
+		ProjectID:     sql.NullInt64{Int64: int64(req.ProjectID), Valid: req.ProjectID != 0},
+		VRAMMB:        sql.NullInt64{Int64: int64(req.VRAMMB), Valid: req.VRAMMB > 0},
+	}, change, checkQuotas(req))
+	return id, rule, err
+}
+
+// checkQuotas checks the user's quota and, for project requests, the project's, inside the
+// transaction inserting the request so that concurrent requests cannot both squeeze under it
+func checkQuotas(req NewRequest) func(tx *sql.Tx) error {
+	return func(tx *sql.Tx) error {
+		if err := CheckQuota(tx, req); err != nil {
+			return err
+		}
+		if req.ProjectID != 0 {
+			return CheckProjectQuota(tx, req)
+		}
+		return nil
+	}
+}
+
+// NewBooking is a request for a fixed future window
+type NewBooking struct {
+	UserID     int
+	NumGPUs    int
+	GPUSize    string
+	Priority   string
+	ServerName string // Empty for any server
+	ProjectID  int    // Project to charge, 0 for a personal booking
+	Start      time.Time
+	End        time.Time
+}
+
+// asRequest is the booking as a request of the given hours, for quota and approval checks
+func (b NewBooking) asRequest(hours int) NewRequest {
+	return NewRequest{
+		UserID:     b.UserID,
+		NumGPUs:    b.NumGPUs,
+		GPUSize:    b.GPUSize,
+		Hours:      hours,
+		Priority:   b.Priority,
+		ServerName: b.ServerName,
+		ProjectID:  b.ProjectID,
+	}
+}
+
+// CreateBooking validates a booking, picks GPUs that are free for its whole window and
+// stores it with its assignments so the scheduler starts it at its start time.
+// Rejections are returned as *RequestError.
+func CreateBooking(db *sql.DB, booking NewBooking) (int64, error) {
+	if !booking.Start.After(time.Now()) {
+		return 0, &RequestError{Reason: "bookings must start in the future"}
+	}
+	if !booking.End.After(booking.Start) {
+		return 0, &RequestError{Reason: "the booking must end after it starts"}
+	}
+
+	state, err := (&scheduler.SQLStore{DB: db}).LoadState()
+	if err != nil {
+		return 0, err
+	}
+
+	candidate, err := checkBooking(db, state, booking)
+	if err != nil {
+		return 0, err
+	}
+
+	gpus, err := scheduler.FindBookingGPUs(candidate, state)
+	if err != nil {
+		return 0, &RequestError{Reason: err.Error()}
+	}
+	uuids := make([]string, len(gpus))
+	for i, gpu := range gpus {
+		uuids[i] = gpu.UUID
+	}
+
+	id, err := database.InsertBooking(db, database.Request{
+		UserID:        booking.UserID,
+		RequestedTime: candidate.RequestedHours,
+		GPUSize:       booking.GPUSize,
+		NumGPUs:       booking.NumGPUs,
+		Priority:      booking.Priority,
+		ServerName:    sql.NullString{String: booking.ServerName, Valid: booking.ServerName != ""},
+		StartTime:     sql.NullTime{Time: booking.Start, Valid: true},
+		EndTime:       sql.NullTime{Time: booking.End, Valid: true},
+		ProjectID:     sql.NullInt64{Int64: int64(booking.ProjectID), Valid: booking.ProjectID != 0},
+	}, uuids, database.StatusChange{UserID: booking.UserID}, checkQuotas(booking.asRequest(candidate.RequestedHours)))
+	if errors.Is(err, database.ErrBookingConflict) {
+		return 0, &RequestError{Reason: err.Error()}
+	}
+	return id, err
+}
+
+// checkBooking validates a booking against the fleet, the user's quota and the approval
+// rules, returning it as the scheduler sees it. Rejections are returned as *RequestError.
+func checkBooking(db *sql.DB, state scheduler.State, booking NewBooking) (scheduler.Request, error) {
+	hours := int(math.Ceil(booking.End.Sub(booking.Start).Hours()))
+	candidate := scheduler.Request{
+		UserID:         booking.UserID,
+		RequestedHours: hours,
+		GPUSize:        booking.GPUSize,
+		NumGPUs:        booking.NumGPUs,
+		Priority:       booking.Priority,
+		ServerName:     booking.ServerName,
+		Status:         scheduler.StatusScheduled,
+		StartTime:      booking.Start,
+		EndTime:        booking.End,
+	}
+	if err := scheduler.ValidateRequest(candidate, state); err != nil {
+		return scheduler.Request{}, &RequestError{Reason: err.Error()}
+	}
+	asRequest := booking.asRequest(hours)
+	if err := CheckQuota(db, asRequest); err != nil {
+		return scheduler.Request{}, err
+	}
+	if booking.ProjectID != 0 {
+		if err := CheckProjectQuota(db, asRequest); err != nil {
+			return scheduler.Request{}, err
+		}
+	}
+	// Bookings hold their GPUs from the moment they are made, so they cannot wait for approval
+	rule, err := ApprovalRuleFor(db, asRequest)
+	if err != nil {
+		return scheduler.Request{}, err
+	}
+	if rule != "" {
+		return scheduler.Request{}, &RequestError{Reason: fmt.Sprintf("requests for %s need admin approval; submit it as a queued request instead of a booking", rule)}
+	}
+	return candidate, nil
+}
+
+// CancelRequest cancels a queued or unapproved request or a booking on behalf of its owner,
+// a member of its project or an admin
+func CancelRequest(db *sql.DB, requestID int, user *database.User) error {
+	request, err := database.QueryRequest(db, requestID)
+	if err != nil {
+		return err
+	}
+	if request == nil {
+		return ErrNoSuchRequest
+	}
+	allowed, err := CanManageRequest(db, *request, user)
+	if err != nil {
+		return err
+	}
+	if !allowed {
+		return &RequestError{Reason: "only the owner, members of its project or an admin can cancel this request"}
+	}
+	if request.Status != scheduler.StatusScheduled && request.Status != scheduler.StatusPendingApproval {
+		return &RequestError{Reason: "only requests that have not started can be cancelled"}
+	}
+	return database.CancelRequest(db, requestID, database.StatusChange{UserID: user.ID})
+}
+
+// ExtendRequest adds hours to a running request on behalf of its owner, a member of its
+// project or an admin and returns the new end time. The extension is refused if the GPUs
+// are booked or under maintenance before the new end, or if it takes the owner or the
+// project over their quota.
+func ExtendRequest(db *sql.DB, requestID, hours int, user *database.User) (time.Time, error) {
+	if hours < 1 {
+		return time.Time{}, &RequestError{Reason: "extensions must be at least one hour"}
+	}
+	request, err := database.QueryRequest(db, requestID)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if request == nil {
+		return time.Time{}, ErrNoSuchRequest
+	}
+	allowed, err := CanManageRequest(db, *request, user)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if !allowed {
+		return time.Time{}, &RequestError{Reason: "only the owner, members of its project or an admin can extend this request"}
+	}
+	if err := CheckExtensionQuota(db, *request, hours); err != nil {
+		return time.Time{}, err
+	}
+
+	state, err := (&scheduler.SQLStore{DB: db}).LoadState()
+	if err != nil {
+		return time.Time{}, err
+	}
+	idx := slices.IndexFunc(state.Requests, func(r scheduler.Request) bool { return r.ID == requestID })
+	if idx < 0 {
+		return time.Time{}, &RequestError{Reason: "only running requests can be extended"}
+	}
+	current := state.Requests[idx]
+	if err := scheduler.CheckExtension(current, current.EndTime.Add(time.Duration(hours)*time.Hour), state); err != nil {
+		return time.Time{}, &RequestError{Reason: err.Error()}
+	}
+
+	newEnd, err := database.ExtendRequest(db, requestID, hours, user.ID)
+	if errors.Is(err, database.ErrBookingConflict) {
+		return time.Time{}, &RequestError{Reason: err.Error()}
+	}
+	return newEnd, err
+}
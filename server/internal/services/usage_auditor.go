@@ -0,0 +1,298 @@
+package services
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/eduardo-escoto/gpu_request/server/internal/database"
+	"github.com/eduardo-escoto/gpu_request/server/internal/scheduler"
+)
+
+const (
+	ViolationUnreserved = "unreserved" // Owner has no reservation on the GPU
+	ViolationExpired    = "expired"    // Owner's reservation on the GPU has ended
+	ViolationOverSlice  = "over_slice" // Owner uses more VRAM of a shared GPU than their slices grant; flagged by the node daemon
+)
+
+// Steps taken against processes that outlive their reservation, in order
+const (
+	EnforcementNotified   = "notified"   // The owner was warned on the node and by email
+	EnforcementTerminated = "terminated" // The processes were sent SIGTERM
+	EnforcementKilled     = "killed"     // The processes were sent SIGKILL
+)
+
+// defaultAuditInterval is used when no positive Interval is set
+const defaultAuditInterval = time.Minute
+
+// UsageAuditor compares the processes reported by the daemons with the active
+// reservations and records every process running outside of one
+type UsageAuditor struct {
+	DB          *sql.DB
+	Notifier    Notifier
+	Interval    time.Duration
+	Grace       time.Duration // How long a violation must persist before admins are notified
+	ExemptUsers []string      // Users never flagged (e.g., root running Xorg)
+
+	// EscalationStep is the time between the steps taken against overruns once they
+	// outlast Grace (see enforceOverruns); zero leaves overruns to the admins
+	EscalationStep time.Duration
+	// Publisher wakes daemons for enforcement commands; optional
+	Publisher *CommandBroker
+}
+
+// Start runs the audit loop forever
+func (a *UsageAuditor) Start() {
+	if a.Interval <= 0 {
+		a.Interval = defaultAuditInterval
+	}
+	for {
+		if err := a.Audit(time.Now()); err != nil {
+			log.Printf("Error auditing GPU usage: %v", err)
+		}
+		time.Sleep(a.Interval)
+	}
+}
+
+// Audit runs a single detection pass
+func (a *UsageAuditor) Audit(now time.Time) error {
+	// Only trust reports fresh enough to describe what is running right now
+	processes, err := database.QueryLatestGPUProcesses(a.DB, now.Add(-2*a.Interval))
+	if err != nil {
+		return err
+	}
+	reservations, err := database.QueryGPUReservations(a.DB, now.Add(-7*24*time.Hour))
+	if err != nil {
+		return err
+	}
+	open, err := database.QueryOpenViolations(a.DB)
+	if err != nil {
+		return err
+	}
+
+	detected := classifyProcesses(processes, reservations, now, a.ExemptUsers)
+
+	// Extend ongoing violations, open new ones and close those that are gone
+	seen := make(map[int]bool)
+	for _, violation := range detected {
+		idx := slices.IndexFunc(open, func(o database.UsageViolation) bool {
+			return o.GPUUUID == violation.GPUUUID && o.ProcessID == violation.ProcessID &&
+				o.UserName == violation.UserName && o.Kind == violation.Kind
+		})
+		if idx >= 0 {
+			seen[open[idx].ID] = true
+			if err := database.UpdateViolationSeen(a.DB, open[idx].ID, violation.LastSeenAt, violation.MaxMemoryMB); err != nil {
+				return err
+			}
+			continue
+		}
+
+		if _, err := database.InsertViolation(a.DB, violation); err != nil {
+			return err
+		}
+		log.Printf("Detected %s GPU usage by %s on %s GPU %d (PID %d)",
+			violation.Kind, violation.UserName, violation.ServerName, violation.GPUNumber, violation.ProcessID)
+	}
+
+	for _, violation := range open {
+		// The node daemons open and resolve over_slice violations themselves
+		if !seen[violation.ID] && violation.Kind != ViolationOverSlice {
+			if err := database.ResolveViolation(a.DB, violation.ID, now); err != nil {
+				return err
+			}
+		}
+	}
+
+	if err := a.enforceOverruns(now); err != nil {
+		return err
+	}
+	return a.notifyAdmins(now)
+}
+
+// enforceOverruns escalates against processes still running after their reservation
+// ended: once past the grace period the owner is warned, then the processes are sent
+// SIGTERM and finally SIGKILL, one EscalationStep apart. The daemon signals every
+// process of the owner on the GPU, so one command covers all of them.
+func (a *UsageAuditor) enforceOverruns(now time.Time) error {
+	if a.EscalationStep <= 0 {
+		return nil
+	}
+	open, err := database.QueryOpenViolations(a.DB)
+	if err != nil {
+		return err
+	}
+
+	sent := make(map[string]bool)
+	for _, violation := range open {
+		if violation.Kind != ViolationExpired || violation.Duration() < a.Grace {
+			continue
+		}
+		step := nextEnforcement(violation, now, a.EscalationStep)
+		if step == "" {
+			continue
+		}
+
+		key := strings.Join([]string{violation.GPUUUID, violation.UserName, step}, "/")
+		if !sent[key] {
+			if err := a.enforce(violation, step); err != nil {
+				return err
+			}
+			sent[key] = true
+			log.Printf("Overrun by %s on %s GPU %d: %s", violation.UserName, violation.ServerName, violation.GPUNumber, step)
+		}
+		if err := database.MarkViolationEnforced(a.DB, violation.ID, step, now); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// nextEnforcement returns the step due for an overrun, or "" if none is due yet
+func nextEnforcement(violation database.UsageViolation, now time.Time, step time.Duration) string {
+	due := !violation.EnforcedAt.Valid || now.Sub(violation.EnforcedAt.Time) >= step
+	switch {
+	case !violation.Enforcement.Valid:
+		return EnforcementNotified
+	case violation.Enforcement.String == EnforcementNotified && due:
+		return EnforcementTerminated
+	case violation.Enforcement.String == EnforcementTerminated && due:
+		return EnforcementKilled
+	}
+	return ""
+}
+
+// enforce takes one escalation step against the owner's processes on the violation's GPU
+func (a *UsageAuditor) enforce(violation database.UsageViolation, step string) error {
+	params := scheduler.CommandParameters{User: violation.UserName, GPUUUIDs: []string{violation.GPUUUID}}
+	commandType := "kill"
+	switch step {
+	case EnforcementNotified:
+		commandType = "notify"
+		params.Message = fmt.Sprintf("Your GPU reservation #%d has ended, but %s (PID %d) is still running on %s GPU %d. "+
+			"Please stop it: it will be terminated in %s and killed %s later.",
+			violation.RequestID.Int64, violation.ProcessName, violation.ProcessID, violation.ServerName, violation.GPUNumber,
+			a.EscalationStep, a.EscalationStep)
+	case EnforcementTerminated:
+		params.Signal = "TERM"
+	case EnforcementKilled:
+		params.Signal = "KILL"
+	}
+
+	payload, err := json.Marshal(params)
+	if err != nil {
+		return err
+	}
+	if _, err := database.InsertCommand(a.DB, violation.ServerName, commandType, string(payload)); err != nil {
+		return err
+	}
+	if a.Publisher != nil {
+		a.Publisher.Publish(violation.ServerName)
+	}
+
+	if step != EnforcementNotified {
+		return nil
+	}
+	user, err := database.QueryUser(a.DB, violation.UserName)
+	if err != nil || user == nil {
+		return err
+	}
+	return a.Notifier.Notify([]string{user.Email}, fmt.Sprintf("[GPU Scheduler] Reservation #%d has ended", violation.RequestID.Int64), params.Message)
+}
+
+// notifyAdmins sends one summary of every violation that outlasted the grace period and was not reported yet
+func (a *UsageAuditor) notifyAdmins(now time.Time) error {
+	open, err := database.QueryOpenViolations(a.DB)
+	if err != nil {
+		return err
+	}
+
+	var pending []database.UsageViolation
+	for _, violation := range open {
+		if !violation.NotifiedAt.Valid && violation.Duration() >= a.Grace {
+			pending = append(pending, violation)
+		}
+	}
+	if len(pending) == 0 {
+		return nil
+	}
+
+	admins, err := database.QueryAdminEmails(a.DB)
+	if err != nil {
+		return err
+	}
+
+	var body strings.Builder
+	body.WriteString("The following processes are running on GPUs without a matching reservation, or beyond their owner's VRAM slice:\n\n")
+	for _, v := range pending {
+		fmt.Fprintf(&body, "- %s: %s GPU %d, PID %d (%s), %s for %s, up to %d MiB\n",
+			v.UserName, v.ServerName, v.GPUNumber, v.ProcessID, v.ProcessName,
+			v.Kind, v.Duration().Round(time.Minute), v.MaxMemoryMB)
+	}
+
+	if err := a.Notifier.Notify(admins, fmt.Sprintf("[GPU Scheduler] %d unauthorized GPU process(es)", len(pending)), body.String()); err != nil {
+		return err
+	}
+	for _, violation := range pending {
+		if err := database.MarkViolationNotified(a.DB, violation.ID, now); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// classifyProcesses returns a violation for every process whose owner does not hold
+// a running reservation on that GPU
+func classifyProcesses(processes []database.GPUProcess, reservations []database.GPUReservation, now time.Time, exempt []string) []database.UsageViolation {
+	var violations []database.UsageViolation
+	for _, process := range processes {
+		if slices.Contains(exempt, process.UserName) {
+			continue
+		}
+
+		kind := ViolationUnreserved
+		var expired sql.NullInt64
+		var lastEnd time.Time
+		authorized := false
+
+		for _, r := range reservations {
+			if r.GPUUUID != process.GPUUUID || r.UserName != process.UserName {
+				continue
+			}
+			started := !r.StartTime.Valid || !r.StartTime.Time.After(now)
+			// Preempted and released requests are over even if evicted before their end time
+			ended := r.Status != "in_progress" || (r.EndTime.Valid && !r.EndTime.Time.After(now))
+			if r.Status == "in_progress" && started && !ended {
+				authorized = true
+				break
+			}
+			// Remember the most recent reservation the process outlived
+			if ended && r.EndTime.Time.After(lastEnd) {
+				kind = ViolationExpired
+				expired = sql.NullInt64{Int64: int64(r.RequestID), Valid: true}
+				lastEnd = r.EndTime.Time
+			}
+		}
+		if authorized {
+			continue
+		}
+
+		violations = append(violations, database.UsageViolation{
+			GPUUUID:     process.GPUUUID,
+			ServerName:  process.ServerName,
+			GPUNumber:   process.GPUNumber,
+			UserName:    process.UserName,
+			ProcessID:   process.ProcessID,
+			ProcessName: process.ProcessName,
+			Kind:        kind,
+			RequestID:   expired,
+			StartedAt:   process.ReportedAt,
+			LastSeenAt:  process.ReportedAt,
+			MaxMemoryMB: process.UsedGPUMemory,
+		})
+	}
+	return violations
+}
@@ -0,0 +1,81 @@
+package services
+
+import (
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/eduardo-escoto/gpu_request/server/internal/database"
+)
+
+func TestClassifyProcesses(t *testing.T) {
+	now := time.Date(2026, 10, 19, 12, 0, 0, 0, time.UTC)
+	at := func(d time.Duration) sql.NullTime { return sql.NullTime{Time: now.Add(d), Valid: true} }
+	process := database.GPUProcess{GPUUUID: "g0", ServerName: "node1", ProcessID: 42, UserName: "alice", ReportedAt: now}
+
+	tests := []struct {
+		name        string
+		reservation database.GPUReservation
+		wantKind    string // Empty if the process is authorized
+		wantRequest int
+	}{
+		{
+			name:        "running reservation",
+			reservation: database.GPUReservation{RequestID: 1, Status: "in_progress", StartTime: at(-time.Hour), EndTime: at(time.Hour)},
+		},
+		{
+			name:        "finished reservation",
+			reservation: database.GPUReservation{RequestID: 1, Status: "done", StartTime: at(-2 * time.Hour), EndTime: at(-time.Hour)},
+			wantKind:    ViolationExpired,
+			wantRequest: 1,
+		},
+		{
+			name:        "still running after preemption",
+			reservation: database.GPUReservation{RequestID: 1, Status: "preempted", StartTime: at(-time.Hour), EndTime: at(-time.Minute)},
+			wantKind:    ViolationExpired,
+			wantRequest: 1,
+		},
+		{
+			name:        "evicted before the shortened end time",
+			reservation: database.GPUReservation{RequestID: 1, Status: "preempted", StartTime: at(-time.Hour), EndTime: at(time.Minute)},
+			wantKind:    ViolationExpired,
+			wantRequest: 1,
+		},
+		{
+			name:        "still running after release",
+			reservation: database.GPUReservation{RequestID: 1, Status: "released", StartTime: at(-time.Hour), EndTime: at(-time.Minute)},
+			wantKind:    ViolationExpired,
+			wantRequest: 1,
+		},
+		{
+			name:        "reservation on another GPU",
+			reservation: database.GPUReservation{RequestID: 1, GPUUUID: "g1", Status: "in_progress", StartTime: at(-time.Hour), EndTime: at(time.Hour)},
+			wantKind:    ViolationUnreserved,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reservation := tt.reservation
+			reservation.UserName = "alice"
+			if reservation.GPUUUID == "" {
+				reservation.GPUUUID = "g0"
+			}
+
+			violations := classifyProcesses([]database.GPUProcess{process}, []database.GPUReservation{reservation}, now, nil)
+			if tt.wantKind == "" {
+				if len(violations) != 0 {
+					t.Fatalf("violations %+v, want none", violations)
+				}
+				return
+			}
+			if len(violations) != 1 {
+				t.Fatalf("violations %+v, want one", violations)
+			}
+			if violations[0].Kind != tt.wantKind || int(violations[0].RequestID.Int64) != tt.wantRequest {
+				t.Errorf("violation %s of request %d, want %s of request %d",
+					violations[0].Kind, violations[0].RequestID.Int64, tt.wantKind, tt.wantRequest)
+			}
+		})
+	}
+}
@@ -0,0 +1,97 @@
+package services
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/eduardo-escoto/gpu_request/server/internal/scheduler"
+)
+
+// WhatIfGPU is a GPU in a what-if answer, with the sizes it counts as
+type WhatIfGPU struct {
+	UUID       string   `json:"gpu_uuid"`
+	ServerName string   `json:"server_name"`
+	Number     int      `json:"gpu_number"`
+	ModelName  string   `json:"model_name"`
+	VRAMMB     int      `json:"vram_size_mb"`
+	Sizes      []string `json:"sizes"`
+}
+
+// WhatIfResult answers "when could this request start?"
+type WhatIfResult struct {
+	Rejected      string      `json:"rejected,omitempty"` // Why the request would be refused outright
+	EarliestStart *time.Time  `json:"earliest_start"`     // null if not within the forecast horizon
+	GPUs          []WhatIfGPU `json:"gpus"`               // GPUs it would get
+	Reason        string      `json:"reason,omitempty"`   // Why it could not start right away
+}
+
+// RunWhatIf simulates submitting a request without creating it. userName is the user it
+// would be submitted as, for fair-share and quotas; empty for an anonymous estimate.
+func RunWhatIf(db *sql.DB, sched *scheduler.Scheduler, req NewRequest, userName string) (WhatIfResult, error) {
+	state, err := (&scheduler.SQLStore{DB: db, UsageWindow: sched.UsageWindow()}).LoadState()
+	if err != nil {
+		return WhatIfResult{}, err
+	}
+
+	candidate := scheduler.Request{
+		UserID:         req.UserID,
+		UserName:       userName,
+		RequestedHours: req.Hours,
+		GPUSize:        req.GPUSize,
+		NumGPUs:        req.NumGPUs,
+		Priority:       req.Priority,
+		ServerName:     req.ServerName,
+	}
+	if err := scheduler.ValidateRequest(candidate, state); err != nil {
+		return WhatIfResult{Rejected: err.Error()}, nil
+	}
+	if req.UserID != 0 {
+		var rejection *RequestError
+		if err := CheckQuota(db, req); errors.As(err, &rejection) {
+			return WhatIfResult{Rejected: rejection.Reason}, nil
+		} else if err != nil {
+			return WhatIfResult{}, err
+		}
+	}
+
+	outcome := sched.WhatIf(state, candidate, forecastHorizon)
+	result := WhatIfResult{
+		GPUs:   whatIfGPUs(outcome.GPUs, state),
+		Reason: outcome.Reason,
+	}
+	if !outcome.EarliestStart.IsZero() {
+		result.EarliestStart = &outcome.EarliestStart
+	}
+	return result, nil
+}
+
+// FreeGPUs lists the GPUs free right now for the given number of hours
+func FreeGPUs(db *sql.DB, sched *scheduler.Scheduler, hours int) ([]WhatIfGPU, error) {
+	state, err := (&scheduler.SQLStore{DB: db}).LoadState()
+	if err != nil {
+		return nil, err
+	}
+	return whatIfGPUs(sched.AvailableGPUs(state, time.Duration(hours)*time.Hour), state), nil
+}
+
+// whatIfGPUs describes GPUs together with the sizes they satisfy
+func whatIfGPUs(gpus []scheduler.GPU, state scheduler.State) []WhatIfGPU {
+	described := []WhatIfGPU{}
+	for _, gpu := range gpus {
+		entry := WhatIfGPU{
+			UUID:       gpu.UUID,
+			ServerName: gpu.ServerName,
+			Number:     gpu.Number,
+			ModelName:  gpu.ModelName,
+			VRAMMB:     gpu.VRAMMB,
+		}
+		for _, size := range scheduler.GPUSizes {
+			if class, ok := state.SizeClasses[size]; !ok || class.Matches(gpu) {
+				entry.Sizes = append(entry.Sizes, size)
+			}
+		}
+		described = append(described, entry)
+	}
+	return described
+}
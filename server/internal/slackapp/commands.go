@@ -1,26 +1,46 @@
 package slackapp
 
 import (
+	"database/sql"
+	"errors"
 	"fmt"
+	"io"
 	"log"
 	"net/http"
+	"strconv"
+	"strings"
 
+	"github.com/eduardo-escoto/gpu_request/server/internal/database"
+	"github.com/eduardo-escoto/gpu_request/server/internal/scheduler"
+	"github.com/eduardo-escoto/gpu_request/server/internal/services"
 	"github.com/slack-go/slack"
 )
 
-func HandleSlashCommands(w http.ResponseWriter, r *http.Request) {
+const gpuRequestUsage = "Usage: `/gpu-request <num_gpus> <size> <hours>[h] [priority] [server]`, e.g. `/gpu-request 2 large 12h high`; `/gpu-request queue` shows your waiting requests; `/gpu-request extend <request_id> <hours>[h]` extends a running one"
+
+func HandleSlashCommands(w http.ResponseWriter, r *http.Request, db *sql.DB, slackClient *SlackClient, sched *scheduler.Scheduler) {
+	// Verify the request signature while the body is being parsed
+	verifier, err := slack.NewSecretsVerifier(r.Header, slackClient.SigningSecret)
+	if err != nil {
+		http.Error(w, "Failed to verify request", http.StatusUnauthorized)
+		return
+	}
+	r.Body = io.NopCloser(io.TeeReader(r.Body, &verifier))
+
 	s, err := slack.SlashCommandParse(r)
 	if err != nil {
 		http.Error(w, "Failed to parse slash command", http.StatusInternalServerError)
 		return
 	}
+	if err := verifier.Ensure(); err != nil {
+		http.Error(w, "Invalid request signature", http.StatusUnauthorized)
+		return
+	}
 
 	log.Printf("Received request: %s\n", string(s.Command))
 	switch s.Command {
 	case "/gpu-request":
-		// Handle the GPU request command
-		response := fmt.Sprintf("Received GPU request: %s", s.Text)
-		w.Write([]byte(response))
+		w.Write([]byte(handleGPURequest(db, slackClient, sched, s)))
 	case "/schedule":
 		response := fmt.Sprintf("Received Schedule Request: %s", s.Text)
 		w.Write(([]byte(response)))
@@ -29,3 +49,178 @@ func HandleSlashCommands(w http.ResponseWriter, r *http.Request) {
 	}
 
 }
+
+// handleGPURequest queues a request for the Slack user and returns the reply text
+func handleGPURequest(db *sql.DB, slackClient *SlackClient, sched *scheduler.Scheduler, s slack.SlashCommand) string {
+	text := strings.TrimSpace(s.Text)
+	if text == "queue" || text == "status" {
+		return describeQueue(db, slackClient, sched, s.UserID)
+	}
+	if args, ok := strings.CutPrefix(text, "extend"); ok {
+		return extendRequest(db, slackClient, s.UserID, args)
+	}
+	if text == "" || text == "help" || text == "sizes" {
+		sizes, err := describeSizeClasses(db)
+		if err != nil {
+			return "Error loading GPU sizes: " + err.Error()
+		}
+		return gpuRequestUsage + "\n" + sizes
+	}
+
+	req, err := parseGPURequest(text)
+	if err != nil {
+		return err.Error() + "\n" + gpuRequestUsage
+	}
+
+	user, err := lookupSlackUser(db, slackClient, s.UserID)
+	if err != nil {
+		return err.Error()
+	}
+	req.UserID = user.ID
+
+	id, rule, err := services.CreateRequest(db, req)
+	var rejection *services.RequestError
+	if errors.As(err, &rejection) {
+		return "Request rejected: " + rejection.Reason
+	}
+	if err != nil {
+		log.Printf("Error creating request from Slack: %v", err)
+		return "Error creating request, please try again later."
+	}
+
+	if rule != "" {
+		return fmt.Sprintf("Request #%d (%d %s GPU(s) for %d hour(s) at %s priority) needs admin approval for %s; it is queued once approved.",
+			id, req.NumGPUs, req.GPUSize, req.Hours, req.Priority, rule)
+	}
+	return fmt.Sprintf("Request #%d queued: %d %s GPU(s) for %d hour(s) at %s priority.", id, req.NumGPUs, req.GPUSize, req.Hours, req.Priority)
+}
+
+// parseGPURequest reads "<num_gpus> <size> <hours>[h] [priority] [server]"
+func parseGPURequest(text string) (services.NewRequest, error) {
+	fields := strings.Fields(text)
+	if len(fields) < 3 || len(fields) > 5 {
+		return services.NewRequest{}, fmt.Errorf("Expected 3 to 5 arguments, got %d.", len(fields))
+	}
+
+	numGPUs, err := strconv.Atoi(fields[0])
+	if err != nil {
+		return services.NewRequest{}, fmt.Errorf("Invalid number of GPUs %q.", fields[0])
+	}
+	hours, err := strconv.Atoi(strings.TrimSuffix(strings.ToLower(fields[2]), "h"))
+	if err != nil {
+		return services.NewRequest{}, fmt.Errorf("Invalid number of hours %q.", fields[2])
+	}
+
+	req := services.NewRequest{
+		NumGPUs:  numGPUs,
+		GPUSize:  strings.ToLower(fields[1]),
+		Hours:    hours,
+		Priority: "medium",
+	}
+	if len(fields) > 3 {
+		req.Priority = strings.ToLower(fields[3])
+	}
+	if len(fields) > 4 {
+		req.ServerName = fields[4]
+	}
+	return req, nil
+}
+
+// extendRequest extends a running request of the Slack user by "<request_id> <hours>[h]"
+func extendRequest(db *sql.DB, slackClient *SlackClient, slackUserID, args string) string {
+	fields := strings.Fields(args)
+	if len(fields) != 2 {
+		return gpuRequestUsage
+	}
+	id, err := strconv.Atoi(strings.TrimPrefix(fields[0], "#"))
+	if err != nil {
+		return fmt.Sprintf("Invalid request ID %q.", fields[0])
+	}
+	hours, err := strconv.Atoi(strings.TrimSuffix(strings.ToLower(fields[1]), "h"))
+	if err != nil {
+		return fmt.Sprintf("Invalid number of hours %q.", fields[1])
+	}
+
+	user, err := lookupSlackUser(db, slackClient, slackUserID)
+	if err != nil {
+		return err.Error()
+	}
+
+	newEnd, err := services.ExtendRequest(db, id, hours, user)
+	var rejection *services.RequestError
+	if errors.As(err, &rejection) {
+		return "Extension rejected: " + rejection.Reason
+	}
+	if err != nil {
+		log.Printf("Error extending request %d from Slack: %v", id, err)
+		return "Error extending request, please try again later."
+	}
+	return fmt.Sprintf("Request #%d extended until %s.", id, newEnd.Format("Mon Jan 2 15:04"))
+}
+
+// describeQueue lists the Slack user's waiting requests with their position, estimated start and blocker
+func describeQueue(db *sql.DB, slackClient *SlackClient, sched *scheduler.Scheduler, slackUserID string) string {
+	user, err := lookupSlackUser(db, slackClient, slackUserID)
+	if err != nil {
+		return err.Error()
+	}
+
+	entries, err := services.LoadQueue(db, sched)
+	if err != nil {
+		log.Printf("Error loading queue for Slack: %v", err)
+		return "Error loading the queue, please try again later."
+	}
+
+	var lines []string
+	for _, entry := range entries {
+		if entry.UserName != user.UserName {
+			continue
+		}
+		start := "unknown"
+		if entry.EstimatedStart != nil {
+			start = entry.EstimatedStart.Format("Mon Jan 2 15:04")
+		}
+		line := fmt.Sprintf("• #%d (%d %s GPU(s), %dh, %s): position %d of %d, estimated start %s",
+			entry.RequestID, entry.NumGPUs, entry.GPUSize, entry.RequestedHours, entry.Priority, entry.Position, len(entries), start)
+		if entry.Reason != "" {
+			line += "\n    Waiting: " + entry.Reason
+		}
+		lines = append(lines, line)
+	}
+	if len(lines) == 0 {
+		return "You have no requests waiting."
+	}
+	return strings.Join(lines, "\n")
+}
+
+// describeSizeClasses lists what each GPU size means
+func describeSizeClasses(db *sql.DB) (string, error) {
+	classes, err := database.QuerySizeClasses(db)
+	if err != nil {
+		return "", err
+	}
+
+	var lines []string
+	for _, class := range classes {
+		lines = append(lines, fmt.Sprintf("• `%s`: %s", class.GPUSize, scheduler.NewSizeClass(class).Describe()))
+	}
+	return strings.Join(lines, "\n"), nil
+}
+
+// lookupSlackUser maps a Slack user to a scheduler user through their email address
+func lookupSlackUser(db *sql.DB, slackClient *SlackClient, slackUserID string) (*database.User, error) {
+	info, err := slackClient.Client.GetUserInfo(slackUserID)
+	if err != nil {
+		log.Printf("Error fetching Slack user %s: %v", slackUserID, err)
+		return nil, errors.New("Could not look up your Slack profile.")
+	}
+
+	user, err := database.QueryUser(db, info.Profile.Email)
+	if err != nil {
+		return nil, errors.New("Error looking up your account, please try again later.")
+	}
+	if user == nil || !user.IsWhitelisted {
+		return nil, fmt.Errorf("No GPU scheduler account uses %s.", info.Profile.Email)
+	}
+	return user, nil
+}
@@ -4,9 +4,14 @@ import (
 	"log"
 	"net/http"
 	"os"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/eduardo-escoto/gpu_request/server/internal/database"
 	"github.com/eduardo-escoto/gpu_request/server/internal/handlers"
+	"github.com/eduardo-escoto/gpu_request/server/internal/scheduler"
+	"github.com/eduardo-escoto/gpu_request/server/internal/services"
 	"github.com/joho/godotenv"
 )
 
@@ -26,9 +31,76 @@ func main() {
 		log.Fatal("Error connecting to database")
 	}
 
+	// Wakes daemons long-polling for commands
+	broker := services.NewCommandBroker()
+
+	notifier := services.NewNotifierFromEnv()
+
+	// The scheduler's configuration also serves the forecasts, what-if and replay pages
+	sched := scheduler.New(scheduler.SystemClock{})
+	sched.PreemptionGrace = durationFromEnv("PREEMPTION_GRACE", sched.PreemptionGrace)
+	sched.FairShareHalfLife = durationFromEnv("FAIR_SHARE_HALF_LIFE", sched.FairShareHalfLife)
+	sched.FairShareByGroup = os.Getenv("FAIR_SHARE_BY_GROUP") == "true"
+	sched.NoShowWarning = durationFromEnv("NO_SHOW_WARNING", sched.NoShowWarning)
+	sched.NoShowRelease = durationFromEnv("NO_SHOW_RELEASE", sched.NoShowRelease)
+	sched.EndWarning = durationFromEnv("END_WARNING", sched.EndWarning)
+
+	// Start the scheduler loop that turns queued requests into GPU assignments (opt-in while
+	// it is rolled out; until then queued requests wait)
+	if os.Getenv("SCHEDULER_ENABLED") == "true" {
+		schedulerService := &scheduler.Service{
+			Scheduler: sched,
+			Store:     &scheduler.SQLStore{DB: db, Notifier: notifier, Publisher: broker, UsageWindow: sched.UsageWindow()},
+			Interval:  intervalFromEnv("SCHEDULER_INTERVAL", 30*time.Second),
+		}
+		go schedulerService.Start()
+	} else {
+		log.Println("Scheduler disabled, set SCHEDULER_ENABLED=true to assign queued requests automatically")
+	}
+
+	// Book the occurrences of recurring bookings as they come within reach
+	recurring := &services.RecurringBookings{
+		DB:       db,
+		Notifier: notifier,
+		Interval: intervalFromEnv("RECURRING_BOOKING_INTERVAL", time.Hour),
+	}
+	go recurring.Start()
+
+	// Start unauthorized-usage detection (opt-in)
+	if os.Getenv("USAGE_AUDIT_INTERVAL") != "" {
+		auditor := &services.UsageAuditor{
+			DB:       db,
+			Notifier: notifier,
+			Interval: intervalFromEnv("USAGE_AUDIT_INTERVAL", time.Minute),
+			Grace:    durationFromEnv("USAGE_AUDIT_GRACE", 5*time.Minute),
+
+			EscalationStep: durationFromEnv("OVERRUN_ESCALATION_STEP", 0),
+			Publisher:      broker,
+		}
+		if exempt := os.Getenv("USAGE_AUDIT_EXEMPT_USERS"); exempt != "" {
+			auditor.ExemptUsers = strings.Split(exempt, ",")
+		}
+		go auditor.Start()
+	}
+
+	// Start deriving GPU health from telemetry (opt-in)
+	if os.Getenv("HEALTH_CHECK_INTERVAL") != "" {
+		monitor := &services.HealthMonitor{
+			DB:       db,
+			Notifier: notifier,
+			Interval: intervalFromEnv("HEALTH_CHECK_INTERVAL", time.Minute),
+
+			StaleAfter:            durationFromEnv("HEALTH_STALE_AFTER", 5*time.Minute),
+			DegradedTemperature:   floatFromEnv("HEALTH_DEGRADED_TEMPERATURE", 85),
+			QuarantineTemperature: floatFromEnv("HEALTH_QUARANTINE_TEMPERATURE", 95),
+			CorrectedECCLimit:     int64(floatFromEnv("HEALTH_CORRECTED_ECC_LIMIT", 0)),
+		}
+		go monitor.Start()
+	}
+
 	// Initialize routes
 	mux := http.NewServeMux()
-	handlers.RegisterRoutesWithDB(mux, db)
+	handlers.RegisterRoutesWithDB(mux, db, broker, sched)
 
 	// Start the server
 	log.Println("Starting server on :8080")
@@ -36,3 +108,45 @@ func main() {
 		log.Fatalf("Server failed: %v", err)
 	}
 }
+
+// durationFromEnv parses a duration such as "30s" or "5m" from an environment variable, falling back to a default.
+// Zero is kept, as it disables several features; negative durations fall back to the default.
+func durationFromEnv(name string, fallback time.Duration) time.Duration {
+	value := os.Getenv(name)
+	if value == "" {
+		return fallback
+	}
+	duration, err := time.ParseDuration(value)
+	if err != nil {
+		log.Fatalf("Invalid %s value: %v", name, err)
+	}
+	if duration < 0 {
+		log.Printf("Ignoring negative %s value %s, using %s", name, value, fallback)
+		return fallback
+	}
+	return duration
+}
+
+// intervalFromEnv is durationFromEnv for loop intervals, which must be positive: a zero
+// interval would spin a loop against the database
+func intervalFromEnv(name string, fallback time.Duration) time.Duration {
+	interval := durationFromEnv(name, fallback)
+	if interval <= 0 {
+		log.Printf("Ignoring non-positive %s value, using %s", name, fallback)
+		return fallback
+	}
+	return interval
+}
+
+// floatFromEnv parses a number from an environment variable, falling back to a default
+func floatFromEnv(name string, fallback float64) float64 {
+	value := os.Getenv(name)
+	if value == "" {
+		return fallback
+	}
+	number, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		log.Fatalf("Invalid %s value: %v", name, err)
+	}
+	return number
+}